@@ -0,0 +1,238 @@
+package velox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Aggregation computes counts, sums, averages, minimums and maximums over
+// the records of a query, optionally per group, for example
+// table.Aggregate().GroupBy("country").Sum("total").Avg("total").Run().
+// Fields are read as Where reads them, so typed tables work too. Records
+// missing a field, or holding nil in it, are left out of that field's
+// aggregates.
+type Aggregation struct {
+	query   *QueryBuilder
+	groupBy []string
+	sum     []string
+	avg     []string
+	min     []string
+	max     []string
+}
+
+// AggregateResult holds the aggregates of one group. Group holds the group
+// fields and their values, and is empty without GroupBy. Fields with no
+// values have no entry in Avg, Min and Max.
+type AggregateResult struct {
+	Group map[string]interface{}
+	Count int
+	Sum   map[string]float64
+	Avg   map[string]float64
+	Min   map[string]interface{}
+	Max   map[string]interface{}
+}
+
+// Aggregate starts an aggregation over every record of the table.
+func (table *Table) Aggregate() *Aggregation {
+	return table.Select().Aggregate()
+}
+
+// Aggregate starts an aggregation over the results of the query.
+func (query *QueryBuilder) Aggregate() *Aggregation {
+	return &Aggregation{query: query}
+}
+
+// GroupBy computes the aggregates separately for each combination of
+// values of fields. Records missing a group field are grouped under nil.
+func (agg *Aggregation) GroupBy(fields ...string) *Aggregation {
+	agg.groupBy = append(agg.groupBy, fields...)
+	return agg
+}
+
+// Sum adds up numeric fields. Non-numeric values are an error.
+func (agg *Aggregation) Sum(fields ...string) *Aggregation {
+	agg.sum = append(agg.sum, fields...)
+	return agg
+}
+
+// Avg averages numeric fields. Non-numeric values are an error.
+func (agg *Aggregation) Avg(fields ...string) *Aggregation {
+	agg.avg = append(agg.avg, fields...)
+	return agg
+}
+
+// Min finds the smallest value of fields, which must all be numbers, all
+// strings or all bools, as for OrderBy.
+func (agg *Aggregation) Min(fields ...string) *Aggregation {
+	agg.min = append(agg.min, fields...)
+	return agg
+}
+
+// Max is Min for the largest value.
+func (agg *Aggregation) Max(fields ...string) *Aggregation {
+	agg.max = append(agg.max, fields...)
+	return agg
+}
+
+// Run returns one result per group, ordered by the group values. Without
+// GroupBy there is exactly one result, even for no records.
+func (agg *Aggregation) Run() ([]AggregateResult, error) {
+	return agg.RunCtx(context.Background())
+}
+
+func (agg *Aggregation) RunCtx(ctx context.Context) ([]AggregateResult, error) {
+	records, err := agg.query.RunCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		result  *AggregateResult
+		keys    []sortKey
+		counted map[string]int
+		min     map[string]sortKey
+		max     map[string]sortKey
+	}
+	groups := make(map[string]*group)
+	order := make([]*group, 0)
+
+	for _, record := range records {
+		data := record.GetData()
+
+		values := make([]interface{}, len(agg.groupBy))
+		names := make([]string, len(agg.groupBy))
+		for i, field := range agg.groupBy {
+			values[i], _ = agg.query.table.fieldOf(data, field)
+			names[i], _ = indexKey(values[i])
+		}
+		name := strings.Join(names, "\x00")
+
+		g, ok := groups[name]
+		if !ok {
+			g = &group{
+				result:  agg.newResult(),
+				keys:    make([]sortKey, len(agg.groupBy)),
+				counted: make(map[string]int),
+				min:     make(map[string]sortKey),
+				max:     make(map[string]sortKey),
+			}
+			for i, field := range agg.groupBy {
+				g.result.Group[field] = values[i]
+				g.keys[i], _ = sortKeyOf(values[i])
+			}
+			groups[name] = g
+			order = append(order, g)
+		}
+		g.result.Count++
+
+		for _, field := range agg.sum {
+			if n, ok, err := agg.query.table.numberField(record, field); err != nil {
+				return nil, err
+			} else if ok {
+				g.result.Sum[field] += n
+			}
+		}
+		for _, field := range agg.avg {
+			if n, ok, err := agg.query.table.numberField(record, field); err != nil {
+				return nil, err
+			} else if ok {
+				// Averages are summed here and divided once all records
+				// are in.
+				g.result.Avg[field] += n
+				g.counted[field]++
+			}
+		}
+		for _, field := range agg.min {
+			if err := agg.query.table.extremeField(record, field, g.result.Min, g.min, -1); err != nil {
+				return nil, err
+			}
+		}
+		for _, field := range agg.max {
+			if err := agg.query.table.extremeField(record, field, g.result.Max, g.max, 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(agg.groupBy) == 0 && len(order) == 0 {
+		order = append(order, &group{result: agg.newResult()})
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		for k := range agg.groupBy {
+			a, b := order[i].keys[k], order[j].keys[k]
+			if a.kind != b.kind {
+				return a.kind < b.kind
+			}
+			if c := compareSortKeys(a, b); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	results := make([]AggregateResult, len(order))
+	for i, g := range order {
+		for field, n := range g.counted {
+			g.result.Avg[field] /= float64(n)
+		}
+		results[i] = *g.result
+	}
+	return results, nil
+}
+
+func (agg *Aggregation) newResult() *AggregateResult {
+	result := &AggregateResult{
+		Group: make(map[string]interface{}, len(agg.groupBy)),
+		Sum:   make(map[string]float64, len(agg.sum)),
+		Avg:   make(map[string]float64, len(agg.avg)),
+		Min:   make(map[string]interface{}, len(agg.min)),
+		Max:   make(map[string]interface{}, len(agg.max)),
+	}
+	for _, field := range agg.sum {
+		result.Sum[field] = 0
+	}
+	return result
+}
+
+// numberField reads a numeric field of record. It reports false for a
+// missing or nil field.
+func (table *Table) numberField(record RecordInterface, field string) (float64, bool, error) {
+	value, ok := table.fieldOf(record.GetData(), field)
+	if !ok || value == nil {
+		return 0, false, nil
+	}
+
+	key, err := sortKeyOf(value)
+	if err != nil || key.kind != sortNumber {
+		return 0, false, fmt.Errorf("Aggregate: record %d field %q: %T is not a number", record.GetID(), field, value)
+	}
+	return key.number, true, nil
+}
+
+// extremeField keeps the smallest (sign -1) or largest (sign 1) value of
+// field seen so far in values, and its sort key in keys.
+func (table *Table) extremeField(record RecordInterface, field string, values map[string]interface{}, keys map[string]sortKey, sign int) error {
+	value, ok := table.fieldOf(record.GetData(), field)
+	if !ok || value == nil {
+		return nil
+	}
+
+	key, err := sortKeyOf(value)
+	if err != nil {
+		return fmt.Errorf("Aggregate: record %d field %q: %w", record.GetID(), field, err)
+	}
+
+	current, seen := keys[field]
+	if seen && current.kind != key.kind {
+		return fmt.Errorf("Aggregate: field %q mixes %s and %s values",
+			field, sortKindNames[current.kind], sortKindNames[key.kind])
+	}
+	if !seen || compareSortKeys(key, current)*sign > 0 {
+		keys[field] = key
+		values[field] = value
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrPermissionDenied is returned when the Authorizer of a database
+// refuses an operation.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Permission is what an operation needs on a table. Each permission
+// includes the ones before it: writing a table needs write or admin.
+type Permission int
+
+const (
+	// PermissionRead allows getting the table, and so reading and
+	// querying its records.
+	PermissionRead Permission = iota + 1
+	// PermissionWrite allows creating, changing and deleting records.
+	PermissionWrite
+	// PermissionAdmin allows creating, dropping, renaming and truncating
+	// the table.
+	PermissionAdmin
+)
+
+var permissionNames = map[Permission]string{
+	PermissionRead:  "read",
+	PermissionWrite: "write",
+	PermissionAdmin: "admin",
+}
+
+func (permission Permission) String() string {
+	if name, ok := permissionNames[permission]; ok {
+		return name
+	}
+	return fmt.Sprintf("Permission(%d)", int(permission))
+}
+
+// Authorizer decides whether the principal of ctx, the actor given to
+// WithActor, may do what needs permission on table. It returns nil to allow
+// it and an error, which should wrap ErrPermissionDenied, to refuse it.
+// Methods without a Ctx variant, and the Ctx methods given a context
+// without an actor, ask for the principal "".
+type Authorizer interface {
+	Authorize(ctx context.Context, table string, permission Permission) error
+}
+
+// SetAuthorizer makes the database ask authorizer before each operation,
+// or stops checking if authorizer is nil. Read permission is checked when
+// a table is got with GetTable or GetTableCtx, and ListTablesCtx leaves
+// out the tables the principal can't read. Write permission is checked by
+// every method that creates, changes or deletes records. Admin permission
+// is checked by CreateTable, CreateTableWithOptions, GetOrCreateTable when
+// it creates the table, DropTable, RenameTable, for both names,
+// TruncateTable and Import, for each table it creates, and by the methods
+// that change the settings of a table, such as its indexes, constraints,
+// hooks and modes, as well as ReserveIDs and ExpireRecords. Watch and
+// GetBlob check read permission, and PutBlob and DeleteBlob write
+// permission. Changes the database makes itself, such as cascading
+// deletes, expiry and replaying the write-ahead log, aren't checked.
+func (database *Database) SetAuthorizer(authorizer Authorizer) {
+	if authorizer == nil {
+		database.authorizer.Store(nil)
+		return
+	}
+	database.authorizer.Store(&authorizer)
+}
+
+// WithAuth sets authorizer on database, as SetAuthorizer does, and
+// returns database, so that a database can be guarded where it is handed
+// to a frontend:
+//
+//	server := veloxhttp.NewServer(velox.WithAuth(database, roles))
+func WithAuth(database *Database, authorizer Authorizer) *Database {
+	database.SetAuthorizer(authorizer)
+	return database
+}
+
+// authorize asks the authorizer, if any, whether the principal of ctx may
+// do what needs permission on table.
+func (database *Database) authorize(ctx context.Context, table string, permission Permission) error {
+	authorizer := database.authorizer.Load()
+	if authorizer == nil {
+		return nil
+	}
+	return (*authorizer).Authorize(ctx, table, permission)
+}
+
+// authorize is Database.authorize for the table. Tables that don't belong
+// to a database aren't checked.
+func (table *Table) authorize(ctx context.Context, permission Permission) error {
+	database := table.database
+	if database == nil || database.authorizer.Load() == nil {
+		return nil
+	}
+
+	database.RWMutex.RLock()
+	name := table.name
+	database.RWMutex.RUnlock()
+	return database.authorize(ctx, name, permission)
+}
+
+// administer checks a change to the settings of the table, such as its
+// indexes, constraints and hooks: it needs admin permission, and read-only
+// databases refuse it.
+func (table *Table) administer(op string) error {
+	if table.database != nil && table.database.readOnly {
+		return fmt.Errorf("%s: %w", op, ErrReadOnly)
+	}
+	return table.throttleCtx(context.Background(), op, PermissionAdmin)
+}
+
+// GetTableCtx is GetTable for the principal of ctx.
+func (database *Database) GetTableCtx(ctx context.Context, name string) (*Table, error) {
+	if err := database.authorize(ctx, name, PermissionRead); err != nil {
+		return nil, &TableError{Op: "GetTable", Table: name, Err: err}
+	}
+	return database.getTable(name)
+}
+
+// ListTablesCtx is ListTables without the tables the principal of ctx
+// can't read.
+func (database *Database) ListTablesCtx(ctx context.Context) []string {
+	names := database.ListTables()
+	if database.authorizer.Load() == nil {
+		return names
+	}
+
+	readable := names[:0]
+	for _, name := range names {
+		if database.authorize(ctx, name, PermissionRead) == nil {
+			readable = append(readable, name)
+		}
+	}
+	return readable
+}
+
+// AnyTable is the table name a Roles grant uses to cover every table.
+const AnyTable = "*"
+
+// Roles is an Authorizer for role-based access control. A role grants a
+// permission on each of a set of tables, and principals are given roles;
+// a principal may do what any of its roles allows. Principals without a
+// role may do nothing. Roles is safe for concurrent use, and roles can be
+// changed while it is in use.
+type Roles struct {
+	sync.RWMutex
+	grants  map[string]map[string]Permission
+	members map[string][]string
+}
+
+func NewRoles() *Roles {
+	return &Roles{
+		grants:  make(map[string]map[string]Permission),
+		members: make(map[string][]string),
+	}
+}
+
+// Define creates or replaces role, which grants each table its permission.
+// A grant on AnyTable covers every table, for example
+//
+//	roles.Define("support", map[string]velox.Permission{
+//		velox.AnyTable: velox.PermissionRead,
+//		"tickets":      velox.PermissionWrite,
+//	})
+func (roles *Roles) Define(role string, grants map[string]Permission) error {
+	for table, permission := range grants {
+		if _, ok := permissionNames[permission]; !ok {
+			return fmt.Errorf("Define: invalid permission %d for table %s", int(permission), table)
+		}
+	}
+
+	copied := make(map[string]Permission, len(grants))
+	for table, permission := range grants {
+		copied[table] = permission
+	}
+
+	roles.Lock()
+	defer roles.Unlock()
+
+	roles.grants[role] = copied
+	return nil
+}
+
+// Assign gives principal the roles, on top of those it has. Roles must be
+// defined first.
+func (roles *Roles) Assign(principal string, names ...string) error {
+	roles.Lock()
+	defer roles.Unlock()
+
+	for _, role := range names {
+		if _, ok := roles.grants[role]; !ok {
+			return fmt.Errorf("Assign: role %s: %w", role, ErrNotFound)
+		}
+	}
+	for _, role := range names {
+		if !containsString(roles.members[principal], role) {
+			roles.members[principal] = append(roles.members[principal], role)
+		}
+	}
+	return nil
+}
+
+// Revoke takes the roles away from principal.
+func (roles *Roles) Revoke(principal string, names ...string) {
+	roles.Lock()
+	defer roles.Unlock()
+
+	kept := roles.members[principal][:0]
+	for _, role := range roles.members[principal] {
+		if !containsString(names, role) {
+			kept = append(kept, role)
+		}
+	}
+	if len(kept) == 0 {
+		delete(roles.members, principal)
+		return
+	}
+	roles.members[principal] = kept
+}
+
+// RolesOf returns the roles of principal, sorted.
+func (roles *Roles) RolesOf(principal string) []string {
+	roles.RLock()
+	defer roles.RUnlock()
+
+	names := append([]string(nil), roles.members[principal]...)
+	sort.Strings(names)
+	return names
+}
+
+func (roles *Roles) Authorize(ctx context.Context, table string, permission Permission) error {
+	principal := ActorFrom(ctx)
+
+	roles.RLock()
+	defer roles.RUnlock()
+
+	for _, role := range roles.members[principal] {
+		grants := roles.grants[role]
+		if grants[table] >= permission || grants[AnyTable] >= permission {
+			return nil
+		}
+	}
+	if principal == "" {
+		return fmt.Errorf("%w: no %s permission on table %s", ErrPermissionDenied, permission, table)
+	}
+	return fmt.Errorf("%w: %s has no %s permission on table %s", ErrPermissionDenied, principal, permission, table)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
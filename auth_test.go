@@ -0,0 +1,101 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSettingsNeedAdmin(t *testing.T) {
+	database, table := newTestTable(t, "items")
+	database.SetFolder(t.TempDir())
+
+	record, err := table.CreateRecord(map[string]interface{}{"name": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := NewRoles()
+	if err := roles.Define("writer", map[string]Permission{AnyTable: PermissionWrite}); err != nil {
+		t.Fatal(err)
+	}
+	if err := roles.Assign("", "writer"); err != nil {
+		t.Fatal(err)
+	}
+	database.SetAuthorizer(roles)
+
+	settings := map[string]func() error{
+		"CreateIndex":     func() error { return table.CreateIndex("name") },
+		"SetSoftDelete":   func() error { return table.SetSoftDelete(true) },
+		"EnableHistory":   table.EnableHistory,
+		"SuspendIndexing": table.SuspendIndexing,
+		"BeforeCreate": func() error {
+			return table.BeforeCreate(func(data interface{}) (interface{}, error) { return data, nil })
+		},
+		"ReserveIDs": func() error {
+			_, err := table.ReserveIDs(1)
+			return err
+		},
+		"ExpireRecords": func() error {
+			_, err := table.ExpireRecords()
+			return err
+		},
+	}
+	for name, change := range settings {
+		if err := change(); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("%s by a writer = %v, want ErrPermissionDenied", name, err)
+		}
+	}
+
+	if err := table.PutBlob(record.GetID(), "note", []byte("hi")); err != nil {
+		t.Fatalf("PutBlob by a writer: %v", err)
+	}
+	if _, err := table.Watch(WithActor(context.Background(), "stranger")); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Watch by a stranger = %v, want ErrPermissionDenied", err)
+	}
+
+	if err := roles.Define("writer", map[string]Permission{AnyTable: PermissionRead}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.GetBlob(record.GetID(), "note"); err != nil {
+		t.Errorf("GetBlob by a reader: %v", err)
+	}
+	if err := table.DeleteBlob(record.GetID(), "note"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("DeleteBlob by a reader = %v, want ErrPermissionDenied", err)
+	}
+}
+
+func TestSettingsReadOnly(t *testing.T) {
+	folder := t.TempDir()
+	database, err := New(WithFolder(folder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	readOnly, err := OpenReadOnly(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := readOnly.GetTable("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.CreateIndex("name"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CreateIndex = %v, want ErrReadOnly", err)
+	}
+	if err := table.AddUniqueConstraint("name"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("AddUniqueConstraint = %v, want ErrReadOnly", err)
+	}
+	if err := table.SetCopyOnRead(true); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SetCopyOnRead = %v, want ErrReadOnly", err)
+	}
+}
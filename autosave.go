@@ -0,0 +1,99 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type autoSaver struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartAutoSave saves the database every interval while it has changes
+// that have not been saved. Failed saves are logged and retried at the
+// next tick.
+func (database *Database) StartAutoSave(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("StartAutoSave: interval must be positive")
+	}
+
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	if database.autoSave != nil {
+		return errors.New("StartAutoSave: auto-save already running")
+	}
+	if database.memory {
+		return fmt.Errorf("StartAutoSave: %w", ErrInMemory)
+	}
+	if database.readOnly {
+		return fmt.Errorf("StartAutoSave: %w", ErrReadOnly)
+	}
+	if database.folder == "" && database.storage == nil {
+		return errors.New("StartAutoSave: database folder not set")
+	}
+
+	saver := &autoSaver{stop: make(chan struct{}), done: make(chan struct{})}
+	database.autoSave = saver
+	go saver.run(database, interval)
+
+	return nil
+}
+
+// StopAutoSave stops auto-saving and waits for a save in progress to
+// finish. It doesn't save pending changes itself.
+func (database *Database) StopAutoSave() {
+	database.RWMutex.Lock()
+	saver := database.autoSave
+	database.autoSave = nil
+	database.RWMutex.Unlock()
+
+	if saver == nil {
+		return
+	}
+	close(saver.stop)
+	<-saver.done
+}
+
+func (saver *autoSaver) run(database *Database, interval time.Duration) {
+	defer close(saver.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-saver.stop:
+			return
+		case <-ticker.C:
+			if !database.dirty() {
+				continue
+			}
+			if err := database.Save(); err != nil {
+				database.log().Error("autosave failed", "error", err)
+			}
+		}
+	}
+}
+
+// dirty reports whether any table has changed since it was last saved.
+func (database *Database) dirty() bool {
+	dirty := database.layoutChanged.Load()
+	database.tables.IterCb(func(name string, val interface{}) {
+		if table, ok := val.(*Table); ok && table.dirty() {
+			dirty = true
+		}
+	})
+	return dirty
+}
+
+// modified marks the table as changed since the last Save.
+func (table *Table) modified() {
+	table.generation.Add(1)
+}
+
+func (table *Table) dirty() bool {
+	return table.generation.Load() != table.savedGeneration.Load()
+}
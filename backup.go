@@ -0,0 +1,217 @@
+package velox
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Backup writes a tar archive of the database to w holding master.json and
+// every table file, encoded, compressed and encrypted as Save would write
+// them. Loaded tables are read from a Snapshot, so writes carry on while
+// the backup runs and the archive holds the database as of a single
+// moment. Tables that are on disk but not loaded are copied from their
+// files. Blobs are not included. Restore unpacks the archive.
+func (database *Database) Backup(w io.Writer) error {
+	_, err := database.backup(w)
+	return err
+}
+
+// backup writes the archive for Backup and returns the snapshot it was
+// taken from, which is already closed.
+func (database *Database) backup(w io.Writer) (*Snapshot, error) {
+	snapshot := database.Snapshot()
+	defer snapshot.Close()
+
+	database.RWMutex.RLock()
+	storage := database.storageLocked()
+	codec := database.codec
+	if codec == nil {
+		codec = JSONCodec
+	}
+	compression := database.compression
+	keys := database.keys
+	unloaded := make(map[string]tableMeta, len(database.unloaded))
+	for name, meta := range database.unloaded {
+		unloaded[name] = meta
+	}
+	database.RWMutex.RUnlock()
+
+	archive := tar.NewWriter(w)
+	manifest := make(map[string]tableMeta)
+
+	for _, name := range snapshot.Tables() {
+		view := snapshot.tables[name]
+		stored, err := view.stored("Backup")
+		if err != nil {
+			return nil, err
+		}
+		records := make([]Record, len(stored))
+		for i := range stored {
+			records[i] = *stored[i]
+		}
+
+		meta := view.table.meta()
+		meta.File = tableFileName(name)
+		body, err := codec.Marshal(records)
+		if err != nil {
+			return nil, fmt.Errorf("Backup: table %s: %w", name, err)
+		}
+		encoded, err := encodeTableFile(body, codec, compression, keys, len(records), view.table.NextID())
+		if err != nil {
+			return nil, fmt.Errorf("Backup: table %s: %w", name, err)
+		}
+		if err := writeArchiveFile(archive, meta.File, encoded, snapshot.at); err != nil {
+			return nil, fmt.Errorf("Backup: %w", err)
+		}
+
+		if meta.History {
+			history, err := view.table.encodeHistory(compression, keys, snapshot.at)
+			if err != nil {
+				return nil, fmt.Errorf("Backup: table %s: %w", name, err)
+			}
+			if err := writeArchiveFile(archive, historyFileName(meta.File), history, snapshot.at); err != nil {
+				return nil, fmt.Errorf("Backup: %w", err)
+			}
+		}
+		manifest[name] = meta
+	}
+
+	names := make([]string, 0, len(unloaded))
+	for name := range unloaded {
+		if _, ok := manifest[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files, err := tableFiles(name, unloaded[name])
+		if err != nil {
+			return nil, fmt.Errorf("Backup: %w", err)
+		}
+		for _, file := range files {
+			data, err := storage.ReadTable(file)
+			if err != nil {
+				return nil, fmt.Errorf("Backup: table %s: %w", name, err)
+			}
+			if err := writeArchiveFile(archive, file, data, snapshot.at); err != nil {
+				return nil, fmt.Errorf("Backup: %w", err)
+			}
+		}
+		manifest[name] = unloaded[name]
+	}
+
+	encoded, err := jsoniter.Marshal(manifestFile{Version: manifestVersion, SavedAt: snapshot.at, Tables: manifest, LSN: snapshot.lsn})
+	if err != nil {
+		return nil, fmt.Errorf("Backup: %w", err)
+	}
+	if err := writeArchiveFile(archive, "master.json", encoded, snapshot.at); err != nil {
+		return nil, fmt.Errorf("Backup: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("Backup: %w", err)
+	}
+	return snapshot, nil
+}
+
+func writeArchiveFile(archive *tar.Writer, name string, data []byte, modified time.Time) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  modified,
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if _, err := archive.Write(data); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// Restore unpacks an archive written by Backup into folder, creating it if
+// needed, so Load can open it. It refuses a folder that already holds a
+// database. If the archive is damaged or incomplete, the files written so
+// far are removed again.
+func Restore(r io.Reader, folder string) (err error) {
+	if _, err := os.Stat(filepath.Join(folder, "master.json")); err == nil {
+		return errors.New("Restore: folder already holds a database")
+	}
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return fmt.Errorf("Restore: %w", err)
+	}
+
+	written := make(map[string]bool)
+	defer func() {
+		if err != nil {
+			for file := range written {
+				os.Remove(filepath.Join(folder, file))
+			}
+		}
+	}()
+
+	var manifest []byte
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Restore: %w: %v", ErrCorrupted, err)
+		}
+
+		name := header.Name
+		if header.Typeflag != tar.TypeReg || filepath.Base(name) != name || name == "." || name == ".." || written[name] {
+			return fmt.Errorf("Restore: %w: unexpected entry %q", ErrCorrupted, name)
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return fmt.Errorf("Restore: %w: %v", ErrCorrupted, err)
+		}
+
+		// master.json goes last, so a folder is never left with a
+		// manifest pointing at missing tables.
+		if name == "master.json" {
+			manifest = data
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(folder, name), data, 0644); err != nil {
+			return fmt.Errorf("Restore: %w", err)
+		}
+		written[name] = true
+	}
+
+	if manifest == nil {
+		return fmt.Errorf("Restore: %w: archive has no master.json", ErrCorrupted)
+	}
+	parsed, err := parseManifest(manifest)
+	if err != nil {
+		return fmt.Errorf("Restore: %w", err)
+	}
+	for name, meta := range parsed.Tables {
+		files, err := tableFiles(name, meta)
+		if err != nil {
+			return fmt.Errorf("Restore: %w", err)
+		}
+		for _, file := range files {
+			if !written[file] {
+				return fmt.Errorf("Restore: %w: archive has no %s", ErrCorrupted, file)
+			}
+		}
+	}
+
+	if err := writeFileAtomic(filepath.Join(folder, "master.json"), manifest, 0644); err != nil {
+		return fmt.Errorf("Restore: %w", err)
+	}
+	return nil
+}
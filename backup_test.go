@@ -0,0 +1,90 @@
+package velox
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	database, err := New(WithFolder(t.TempDir()), WithCompression(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	want := make(map[string]map[int]string)
+	for _, name := range []string{"items", "orders"} {
+		if err := database.CreateTable(name); err != nil {
+			t.Fatal(err)
+		}
+		table, _ := database.GetTable(name)
+		for i := 0; i < 3; i++ {
+			if _, err := table.CreateRecord(map[string]interface{}{"table": name, "n": i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := table.DeleteRecord(2); err != nil {
+			t.Fatal(err)
+		}
+		want[name] = recordsOf(t, table)
+	}
+
+	var archive bytes.Buffer
+	if err := database.Backup(&archive); err != nil {
+		t.Fatal(err)
+	}
+	// Later writes aren't in the backup.
+	items, _ := database.GetTable("items")
+	if err := items.UpdateRecord(1, map[string]interface{}{"n": 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	folder := filepath.Join(t.TempDir(), "restored")
+	if err := Restore(bytes.NewReader(archive.Bytes()), folder); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(bytes.NewReader(archive.Bytes()), folder); err == nil {
+		t.Fatal("Restore over a database succeeded")
+	}
+
+	restored, err := New(WithFolder(folder), WithLoad())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	for name, records := range want {
+		table, err := restored.GetTable(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := recordsOf(t, table); !reflect.DeepEqual(got, records) {
+			t.Fatalf("restored %s = %v, want %v", name, got, records)
+		}
+		if record, err := table.CreateRecord(map[string]interface{}{}); err != nil || record.GetID() != 4 {
+			t.Fatalf("CreateRecord in restored %s = %v, %v, want record 4", name, record, err)
+		}
+	}
+}
+
+func TestRestoreTruncated(t *testing.T) {
+	database, table := newTestTable(t, "items")
+	if _, err := table.CreateRecord(map[string]interface{}{"name": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := database.Backup(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	folder := t.TempDir()
+	err := Restore(bytes.NewReader(archive.Bytes()[:archive.Len()/2]), folder)
+	if !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("Restore of a truncated archive = %v, want ErrCorrupted", err)
+	}
+	if entries, _ := os.ReadDir(folder); len(entries) != 0 {
+		t.Fatalf("Restore left %d files behind", len(entries))
+	}
+}
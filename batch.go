@@ -0,0 +1,173 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BatchError reports the operations of a batch that failed. The others
+// were applied.
+type BatchError struct {
+	// Failed is keyed by position for CreateRecords and by ID for
+	// UpdateRecords and DeleteRecords.
+	Failed map[int]error
+}
+
+func (err *BatchError) Error() string {
+	keys := make([]int, 0, len(err.Failed))
+	for key := range err.Failed {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	messages := make([]string, 0, len(keys))
+	for _, key := range keys {
+		messages = append(messages, fmt.Sprintf("%d: %v", key, err.Failed[key]))
+	}
+	return fmt.Sprintf("%d batch operation(s) failed: %s", len(keys), strings.Join(messages, ", "))
+}
+
+// Is reports whether any of the failures matches target.
+func (err *BatchError) Is(target error) bool {
+	for _, failure := range err.Failed {
+		if errors.Is(failure, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateRecords creates a record for each element of records under a
+// single table lock and write-ahead log write. The result has the created
+// record at each position, or nil where creating it failed; the failures
+// are returned in a *BatchError. A batch counts as one write for the rate
+// limiter.
+func (table *Table) CreateRecords(records []interface{}) ([]RecordInterface, error) {
+	if err := table.throttle("CreateRecords"); err != nil {
+		return nil, err
+	}
+
+	locked := []lockedTable{{table: table, acquired: table.lock()}}
+	defer unlockTables(locked)
+
+	created := make([]RecordInterface, len(records))
+	failed := make(map[int]error)
+	err := runCommit(locked, func() error {
+		for i, record := range records {
+			rec, err := table.insertRecord("CreateRecords", record, nil)
+			if err != nil {
+				failed[i] = err
+				continue
+			}
+			created[i] = rec
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("CreateRecords: %w", err)
+	}
+
+	if len(failed) > 0 {
+		return created, &BatchError{Failed: failed}
+	}
+	return created, nil
+}
+
+// UpdateRecords replaces the data of each record in records, keyed by ID,
+// like CreateRecords does for creates.
+func (table *Table) UpdateRecords(records map[int]interface{}) error {
+	if err := table.throttle("UpdateRecords"); err != nil {
+		return err
+	}
+
+	ids := make([]int, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	locked := []lockedTable{{table: table, acquired: table.lock()}}
+	defer unlockTables(locked)
+
+	failed := make(map[int]error)
+	err := runCommit(locked, func() error {
+		for _, id := range ids {
+			if err := table.updateLocked("UpdateRecords", id, records[id]); err != nil {
+				failed[id] = err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateRecords: %w", err)
+	}
+
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// DeleteRecords deletes the records with the given IDs, like CreateRecords
+// does for creates. Foreign keys are enforced per record, so a cascade
+// from one delete can make a later ID in the batch fail as not found.
+func (table *Table) DeleteRecords(ids []int) error {
+	if err := table.throttle("DeleteRecords"); err != nil {
+		return err
+	}
+
+	locked := table.lockForDelete()
+	defer unlockTables(locked)
+
+	failed := make(map[int]error)
+	err := runCommit(locked, func() error {
+		for _, id := range ids {
+			if err := table.deleteLocked("DeleteRecords", id); err != nil {
+				failed[id] = err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteRecords: %w", err)
+	}
+
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// updateLocked updates a live record. Callers hold the write lock.
+func (table *Table) updateLocked(op string, id int, data interface{}) error {
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return table.notFound(op, id)
+	}
+
+	record, err := table.recordValue(op, val)
+	if err != nil {
+		return err
+	}
+	if table.hidden(record) {
+		return table.notFound(op, id)
+	}
+	return table.replaceData(op, record, data)
+}
+
+// deleteLocked deletes a record. Callers hold the locks of deleteScope.
+func (table *Table) deleteLocked(op string, id int) error {
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return table.notFound(op, id)
+	}
+
+	record, err := table.recordValue(op, val)
+	if err != nil {
+		return err
+	}
+	return table.deleteRecord(op, record)
+}
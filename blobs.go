@@ -0,0 +1,148 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Blobs are stored outside the table JSON, directly under the database
+// folder:
+//
+//	<folder>/blobs/<table>/<id>/<name>
+//
+// The table and blob names are escaped like table file names. PutBlob
+// writes straight to disk instead of waiting for Save, and only to the
+// database folder, not to extra save targets. Deleting a record removes
+// its blobs.
+const blobsFolder = "blobs"
+
+func (table *Table) PutBlob(id int, name string, data []byte) error {
+	if err := table.throttle("PutBlob"); err != nil {
+		return err
+	}
+
+	defer table.runlock(table.rlock())
+
+	if table.database != nil && table.database.readOnly {
+		return fmt.Errorf("PutBlob: %w", ErrReadOnly)
+	}
+
+	dir, err := table.blobDir(id)
+	if err != nil {
+		return fmt.Errorf("PutBlob: %w", err)
+	}
+	if name == "" {
+		return errors.New("PutBlob: blob name is required")
+	}
+	if _, ok := table.records.Get(strconv.Itoa(id)); !ok {
+		return table.notFound("PutBlob", id)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("PutBlob: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, blobFileName(name)), data, 0644); err != nil {
+		return fmt.Errorf("PutBlob: %w", err)
+	}
+	return nil
+}
+
+func (table *Table) GetBlob(id int, name string) ([]byte, error) {
+	if err := table.authorize(context.Background(), PermissionRead); err != nil {
+		return nil, fmt.Errorf("GetBlob: %w", err)
+	}
+
+	defer table.runlock(table.rlock())
+
+	dir, err := table.blobDir(id)
+	if err != nil {
+		return nil, fmt.Errorf("GetBlob: %w", err)
+	}
+	if _, ok := table.records.Get(strconv.Itoa(id)); !ok {
+		return nil, table.notFound("GetBlob", id)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, blobFileName(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("GetBlob: blob %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetBlob: %w", err)
+	}
+	return data, nil
+}
+
+func (table *Table) DeleteBlob(id int, name string) error {
+	if err := table.throttle("DeleteBlob"); err != nil {
+		return err
+	}
+
+	defer table.runlock(table.rlock())
+
+	if table.database != nil && table.database.readOnly {
+		return fmt.Errorf("DeleteBlob: %w", ErrReadOnly)
+	}
+
+	dir, err := table.blobDir(id)
+	if err != nil {
+		return fmt.Errorf("DeleteBlob: %w", err)
+	}
+
+	err = os.Remove(filepath.Join(dir, blobFileName(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("DeleteBlob: blob %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("DeleteBlob: %w", err)
+	}
+	return nil
+}
+
+func (table *Table) blobDir(id int) (string, error) {
+	dir, err := table.blobsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strconv.Itoa(id)), nil
+}
+
+// blobsDir returns the folder holding all blobs of the table.
+func (table *Table) blobsDir() (string, error) {
+	if table.database == nil {
+		return "", errors.New("table does not belong to a database")
+	}
+	if table.database.memory {
+		return "", ErrInMemory
+	}
+
+	table.database.RWMutex.RLock()
+	folder, name := table.database.folder, table.name
+	table.database.RWMutex.RUnlock()
+
+	// An empty name would make this the folder of every table's blobs.
+	if name == "" {
+		return "", errors.New("table has no name")
+	}
+	return filepath.Join(folder, blobsFolder, blobFileName(name)), nil
+}
+
+// removeBlobs deletes every blob of a record. Callers hold the write lock.
+func (table *Table) removeBlobs(id int) {
+	dir, err := table.blobDir(id)
+	if err != nil {
+		return
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		table.database.log().Warn("removing blobs failed", "table", table.name, "id", id, "error", err)
+	}
+}
+
+func blobFileName(name string) string {
+	return strings.TrimSuffix(tableFileName(name), ".json")
+}
@@ -0,0 +1,501 @@
+package velox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Change data capture keeps, next to the write-ahead log, a log of the
+// record changes not yet published and the LSN of the last one a sink
+// took.
+const (
+	cdcFileName   = "cdc.log"
+	cdcOffsetName = "cdc.offset"
+)
+
+// cdcRetry is how long publishing waits before retrying a batch the sink
+// refused at first. The wait doubles up to maxCDCRetry while the sink
+// keeps failing.
+const (
+	cdcRetry    = 100 * time.Millisecond
+	maxCDCRetry = 10 * time.Second
+
+	defaultCDCBatch = 100
+)
+
+// CDCEvent is a committed record change, as published by change data
+// capture. Before is nil for creates and After is nil for deletes. LSN is
+// the change's write-ahead log sequence number, which grows with every
+// change, so sinks can drop events they have already seen.
+type CDCEvent struct {
+	LSN    uint64      `json:"lsn"`
+	Time   time.Time   `json:"time"`
+	Table  string      `json:"table"`
+	Op     ChangeOp    `json:"op"`
+	ID     int         `json:"id"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// CDCSink is where change data capture publishes events. Publish gets
+// events in LSN order and must return nil only once the sink has stored
+// all of them; after an error, or a restart, the same events are
+// published again. It is never called concurrently.
+type CDCSink interface {
+	Publish(ctx context.Context, events []CDCEvent) error
+}
+
+// CDCOptions configures EnableCDCWithOptions.
+type CDCOptions struct {
+	// BatchSize is how many events Publish gets at most. It defaults to
+	// 100.
+	BatchSize int
+	// Tables, if not empty, limits capture to the changes of these
+	// tables.
+	Tables []string
+}
+
+type cdcLog struct {
+	folder  string
+	sink    CDCSink
+	options CDCOptions
+	keys    KeyProvider
+	logger  Logger
+
+	// file is appended to by writers, under the mutex, which the
+	// publisher also holds to truncate it.
+	file *os.File
+	sync.Mutex
+
+	published atomic.Uint64
+	wake      chan struct{}
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// EnableCDC publishes every committed create, update and delete to sink,
+// with at-least-once delivery. Changes are written to a log next to the
+// write-ahead log as they are committed, and a background goroutine
+// publishes them in batches, retrying while the sink fails, and saves the
+// LSN of the last published change alongside them. After a restart,
+// calling EnableCDC again resumes from there. The write-ahead log must be
+// enabled, and each write waits for the change to be synced to disk as
+// well.
+func (database *Database) EnableCDC(sink CDCSink) error {
+	return database.EnableCDCWithOptions(sink, CDCOptions{})
+}
+
+// EnableCDCWithOptions is EnableCDC with options.
+func (database *Database) EnableCDCWithOptions(sink CDCSink, options CDCOptions) error {
+	if sink == nil {
+		return errors.New("EnableCDC: nil sink")
+	}
+	if options.BatchSize < 0 {
+		return fmt.Errorf("EnableCDC: negative batch size %d", options.BatchSize)
+	}
+	if options.BatchSize == 0 {
+		options.BatchSize = defaultCDCBatch
+	}
+	options.Tables = append([]string(nil), options.Tables...)
+
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	if database.memory {
+		return fmt.Errorf("EnableCDC: %w", ErrInMemory)
+	}
+	if database.readOnly {
+		return fmt.Errorf("EnableCDC: %w", ErrReadOnly)
+	}
+	if database.cdc != nil {
+		return errors.New("EnableCDC: already enabled")
+	}
+	if database.wal == nil {
+		return errors.New("EnableCDC: write-ahead log not enabled")
+	}
+
+	folder := database.wal.folder
+	offset, err := readCDCOffset(folder)
+	if err != nil {
+		return fmt.Errorf("EnableCDC: %w", err)
+	}
+	if err := trimPartialLine(filepath.Join(folder, cdcFileName)); err != nil {
+		return fmt.Errorf("EnableCDC: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(folder, cdcFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("EnableCDC: %w", err)
+	}
+	reader, err := os.Open(file.Name())
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("EnableCDC: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	log := &cdcLog{
+		folder:  folder,
+		sink:    sink,
+		options: options,
+		keys:    database.keys,
+		logger:  database.log(),
+		file:    file,
+		wake:    make(chan struct{}, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	log.published.Store(offset)
+	database.cdc = log
+	go log.run(ctx, reader)
+
+	return nil
+}
+
+// DisableCDC stops publishing changes, cutting short a Publish in
+// progress. Changes not published yet stay on disk for the next
+// EnableCDC.
+func (database *Database) DisableCDC() error {
+	database.RWMutex.Lock()
+	log := database.cdc
+	database.cdc = nil
+	database.RWMutex.Unlock()
+
+	if log == nil {
+		return nil
+	}
+
+	log.cancel()
+	<-log.done
+
+	log.Lock()
+	defer log.Unlock()
+
+	if err := log.file.Close(); err != nil {
+		return fmt.Errorf("DisableCDC: %w", err)
+	}
+	return nil
+}
+
+// CDCOffset returns the LSN of the last change published by change data
+// capture, or zero if it is off.
+func (database *Database) CDCOffset() uint64 {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	if database.cdc == nil {
+		return 0
+	}
+	return database.cdc.published.Load()
+}
+
+// capturing reports whether change data capture is on.
+func (database *Database) capturing() bool {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	return database.cdc != nil
+}
+
+// keepBefore sets the before record of entries that change records.
+// Callers hold the write locks of the tables in entries, which haven't
+// been applied yet.
+func (database *Database) keepBefore(entries []walEntry) {
+	// changed holds the records earlier entries leave behind, for a
+	// record changed more than once.
+	changed := make(map[string]*Record)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Op != ChangeCreate && entry.Op != ChangeUpdate && entry.Op != ChangeDelete {
+			continue
+		}
+
+		key := entry.Table + "/" + strconv.Itoa(entry.ID)
+		before, ok := changed[key]
+		if !ok {
+			before = database.currentRecord(entry.Table, entry.ID)
+		}
+		entry.before = before
+		changed[key] = entry.Record
+	}
+}
+
+// currentRecord returns record id of table as it is, or nil.
+func (database *Database) currentRecord(name string, id int) *Record {
+	val, ok := database.tables.Get(name)
+	if !ok {
+		return nil
+	}
+	table, ok := val.(*Table)
+	if !ok {
+		return nil
+	}
+	val, ok = table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return nil
+	}
+	record, err := table.recordValue("CDC", val)
+	if err != nil {
+		return nil
+	}
+	return &record
+}
+
+// captureChanges writes the changes of logged entries, already numbered,
+// to the change data capture log.
+func (database *Database) captureChanges(log *cdcLog, entries []walEntry) error {
+	var encoded []byte
+	for _, entry := range entries {
+		if entry.Op != ChangeCreate && entry.Op != ChangeUpdate && entry.Op != ChangeDelete {
+			continue
+		}
+		if len(log.options.Tables) > 0 && !containsString(log.options.Tables, entry.Table) {
+			continue
+		}
+
+		event := CDCEvent{LSN: entry.LSN, Time: *entry.Time, Table: entry.Table, Op: entry.Op, ID: entry.ID}
+		if entry.before != nil {
+			event.Before = entry.before.Data
+		}
+		if entry.Record != nil {
+			event.After = entry.Record.Data
+		}
+
+		line, err := encodeCDCEvent(log.keys, event)
+		if err != nil {
+			return err
+		}
+		encoded = append(encoded, line...)
+	}
+	if len(encoded) == 0 {
+		return nil
+	}
+
+	log.Lock()
+	defer log.Unlock()
+
+	if _, err := log.file.Write(encoded); err != nil {
+		return err
+	}
+	if err := log.file.Sync(); err != nil {
+		return err
+	}
+
+	select {
+	case log.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// encodeCDCEvent encodes event as a line of the log, sealed if keys is
+// set.
+func encodeCDCEvent(keys KeyProvider, event CDCEvent) ([]byte, error) {
+	line, err := jsoniter.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		sealed, keyID, err := seal(keys, line)
+		if err != nil {
+			return nil, err
+		}
+		if line, err = jsoniter.Marshal(walEntry{Sealed: sealed, KeyID: keyID}); err != nil {
+			return nil, err
+		}
+	}
+	return append(line, '\n'), nil
+}
+
+func decodeCDCEvent(keys KeyProvider, line []byte) (CDCEvent, error) {
+	var sealed walEntry
+	if err := jsoniter.Unmarshal(line, &sealed); err != nil {
+		return CDCEvent{}, err
+	}
+	if sealed.Sealed != nil {
+		plain, err := unseal(keys, sealed.KeyID, sealed.Sealed)
+		if err != nil {
+			return CDCEvent{}, err
+		}
+		line = plain
+	}
+
+	var event CDCEvent
+	err := jsoniter.Unmarshal(line, &event)
+	return event, err
+}
+
+// run publishes the log read through reader until ctx is done.
+func (log *cdcLog) run(ctx context.Context, reader *os.File) {
+	defer close(log.done)
+	defer reader.Close()
+
+	buffered := bufio.NewReader(reader)
+	var partial []byte
+	for {
+		var batch []CDCEvent
+		for len(batch) < log.options.BatchSize {
+			line, err := buffered.ReadBytes('\n')
+			if err == io.EOF {
+				// A line being written shows up in pieces.
+				partial = append(partial, line...)
+				break
+			}
+			if err != nil {
+				log.logger.Error("reading change data capture log failed", "error", err)
+				break
+			}
+			if partial != nil {
+				line = append(partial, line...)
+				partial = nil
+			}
+
+			event, err := decodeCDCEvent(log.keys, line)
+			if err != nil {
+				log.logger.Error("decoding change data capture event failed", "error", err)
+				continue
+			}
+			if event.LSN > log.published.Load() {
+				batch = append(batch, event)
+			}
+		}
+
+		if len(batch) == 0 {
+			if err := log.truncate(reader, buffered, partial); err != nil {
+				log.logger.Error("truncating change data capture log failed", "error", err)
+			}
+			select {
+			case <-log.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if !log.publish(ctx, batch) {
+			return
+		}
+	}
+}
+
+// publish hands batch to the sink until it takes it, and saves the LSN of
+// its last event. It reports false if ctx ends first.
+func (log *cdcLog) publish(ctx context.Context, batch []CDCEvent) bool {
+	retry := cdcRetry
+	for {
+		err := log.sink.Publish(ctx, batch)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		log.logger.Error("publishing changes failed", "events", len(batch), "error", err)
+
+		timer := time.NewTimer(retry)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+		if retry *= 2; retry > maxCDCRetry {
+			retry = maxCDCRetry
+		}
+	}
+
+	lsn := batch[len(batch)-1].LSN
+	log.published.Store(lsn)
+	if err := writeCDCOffset(log.folder, lsn); err != nil {
+		log.logger.Error("saving change data capture offset failed", "lsn", lsn, "error", err)
+	}
+	return true
+}
+
+// truncate empties the log once every event in it has been published, so
+// it doesn't grow forever. Writers are held off while it checks that the
+// reader is at the end.
+func (log *cdcLog) truncate(reader *os.File, buffered *bufio.Reader, partial []byte) error {
+	log.Lock()
+	defer log.Unlock()
+
+	if partial != nil || buffered.Buffered() > 0 {
+		return nil
+	}
+	info, err := log.file.Stat()
+	if err != nil {
+		return err
+	}
+	position, err := reader.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 || position != info.Size() {
+		return nil
+	}
+
+	if err := log.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	buffered.Reset(reader)
+	return nil
+}
+
+type cdcOffset struct {
+	LSN uint64 `json:"lsn"`
+}
+
+func readCDCOffset(folder string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(folder, cdcOffsetName))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var offset cdcOffset
+	if err := jsoniter.Unmarshal(data, &offset); err != nil {
+		return 0, fmt.Errorf("%s: %w", cdcOffsetName, err)
+	}
+	return offset.LSN, nil
+}
+
+func writeCDCOffset(folder string, lsn uint64) error {
+	data, err := jsoniter.Marshal(cdcOffset{LSN: lsn})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(folder, cdcOffsetName), data, 0644)
+}
+
+// trimPartialLine cuts a partly written last line, from a write that was
+// in flight when the process stopped, off the file at path.
+func trimPartialLine(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+
+	return os.Truncate(path, int64(bytes.LastIndexByte(data, '\n')+1))
+}
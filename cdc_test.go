@@ -0,0 +1,179 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink keeps the events published to it. It refuses batches
+// while failing is set.
+type recordingSink struct {
+	sync.Mutex
+	events  []CDCEvent
+	failing bool
+}
+
+func (sink *recordingSink) Publish(ctx context.Context, events []CDCEvent) error {
+	sink.Lock()
+	defer sink.Unlock()
+
+	if sink.failing {
+		return errors.New("sink unavailable")
+	}
+	sink.events = append(sink.events, events...)
+	return nil
+}
+
+func (sink *recordingSink) setFailing(failing bool) {
+	sink.Lock()
+	defer sink.Unlock()
+
+	sink.failing = failing
+}
+
+// waitFor waits until the sink got the change numbered lsn and returns the
+// events so far.
+func (sink *recordingSink) waitFor(t *testing.T, lsn uint64) []CDCEvent {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		sink.Lock()
+		events := append([]CDCEvent(nil), sink.events...)
+		sink.Unlock()
+		if len(events) > 0 && events[len(events)-1].LSN >= lsn {
+			return events
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sink got %d events, none with LSN %d", len(events), lsn)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// checkEvents checks that events are in LSN order and that each change of
+// a record starts from where the one before it left the record, and
+// returns the records the events leave behind.
+func checkEvents(t *testing.T, events []CDCEvent) map[int]string {
+	t.Helper()
+	records := make(map[int]string)
+	var last uint64
+	for _, event := range events {
+		if event.LSN <= last {
+			t.Fatalf("event %d published after event %d", event.LSN, last)
+		}
+		last = event.LSN
+
+		before, after := "", ""
+		if event.Before != nil {
+			before = canonical(t, event.Before)
+		}
+		if event.After != nil {
+			after = canonical(t, event.After)
+		}
+		if before != records[event.ID] {
+			t.Fatalf("event %d: %s of record %d from %s, but the record was %s", event.LSN, event.Op, event.ID, before, records[event.ID])
+		}
+		if after == "" {
+			delete(records, event.ID)
+		} else {
+			records[event.ID] = after
+		}
+	}
+	return records
+}
+
+func canonical(t *testing.T, data interface{}) string {
+	t.Helper()
+	encoded, err := canonicalJSON.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encoded)
+}
+
+func TestCDCDeliveryOrder(t *testing.T) {
+	folder := t.TempDir()
+	database := openWALDatabase(t, folder)
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := database.GetTable("items")
+	// Load, which replays the log after the restart, needs master.json.
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	sink := &recordingSink{failing: true}
+	if err := database.EnableCDCWithOptions(sink, CDCOptions{BatchSize: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				record, err := table.CreateRecord(map[string]interface{}{"writer": w, "n": i})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if err := table.UpdateRecord(record.GetID(), map[string]interface{}{"writer": w, "n": i, "updated": true}); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%3 == 0 {
+					if err := table.DeleteRecord(record.GetID()); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	tx := database.Begin()
+	tx.Create("items", map[string]interface{}{"tx": 1})
+	tx.Update("items", 2, map[string]interface{}{"tx": 2})
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Events wait on disk while the sink fails.
+	time.Sleep(50 * time.Millisecond)
+	if offset := database.CDCOffset(); offset != 0 {
+		t.Fatalf("CDCOffset with a failing sink = %d, want 0", offset)
+	}
+	sink.setFailing(false)
+	events := sink.waitFor(t, database.LSN())
+	if got, want := checkEvents(t, events), recordsOf(t, table); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records from events = %v, want %v", got, want)
+	}
+
+	// Changes left unpublished at a restart are published after it.
+	sink.setFailing(true)
+	for i := 0; i < 5; i++ {
+		if _, err := table.CreateRecord(map[string]interface{}{"restart": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := recordsOf(t, table)
+	if err := database.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	database = openWALDatabase(t, folder)
+	defer database.Close()
+	sink.setFailing(false)
+	if err := database.EnableCDC(sink); err != nil {
+		t.Fatal(err)
+	}
+	events = sink.waitFor(t, database.LSN())
+	if got := checkEvents(t, events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records from events after restart = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package velox
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+type ChangeOp string
+
+const (
+	ChangeCreate ChangeOp = "create"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+	// ChangeSoftDelete and ChangeRestore mark and unmark a record as
+	// deleted in a table in soft delete mode.
+	ChangeSoftDelete ChangeOp = "soft_delete"
+	ChangeRestore    ChangeOp = "restore"
+)
+
+// ChangeLogEntry is one line of the change log. Data is the record data
+// after the change and is left out for deletes.
+type ChangeLogEntry struct {
+	Time  time.Time   `json:"time"`
+	Table string      `json:"table"`
+	Op    ChangeOp    `json:"op"`
+	ID    int         `json:"id"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// changeLogBuffer is how many entries can wait for the writer before new
+// ones are dropped.
+const changeLogBuffer = 4096
+
+type changeLog struct {
+	entries chan ChangeLogEntry
+	done    chan struct{}
+	dropped atomic.Uint64
+	logger  Logger
+}
+
+// SetChangeLog appends every committed create, update and delete to w as a
+// JSON line. Entries are handed to a background writer, so a slow writer
+// never blocks mutations. If the writer falls more than changeLogBuffer
+// entries behind, new entries are dropped and counted in
+// ChangeLogDropped. Passing nil turns the log off. Replacing or removing a
+// log waits until its queued entries are written.
+func (database *Database) SetChangeLog(w io.Writer) {
+	var log *changeLog
+	if w != nil {
+		log = &changeLog{
+			entries: make(chan ChangeLogEntry, changeLogBuffer),
+			done:    make(chan struct{}),
+			logger:  database.log(),
+		}
+		go log.run(w)
+	}
+
+	database.RWMutex.Lock()
+	previous := database.changeLog
+	database.changeLog = log
+	if previous != nil {
+		close(previous.entries)
+	}
+	database.RWMutex.Unlock()
+
+	if previous != nil {
+		<-previous.done
+	}
+}
+
+// ChangeLogDropped returns how many entries the current change log has
+// dropped because its writer fell behind.
+func (database *Database) ChangeLogDropped() uint64 {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	if database.changeLog == nil {
+		return 0
+	}
+	return database.changeLog.dropped.Load()
+}
+
+func (log *changeLog) run(w io.Writer) {
+	defer close(log.done)
+
+	for entry := range log.entries {
+		line, err := jsoniter.Marshal(entry)
+		if err != nil {
+			log.logger.Error("encoding change log entry failed", "table", entry.Table, "error", err)
+			continue
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			log.logger.Error("writing change log entry failed", "table", entry.Table, "error", err)
+		}
+	}
+}
+
+// changed reports a committed change of a record. before is nil for
+// creates and after is nil for deletes. Callers hold the table lock. While
+// a transaction commits, its changes are held back until all of them have
+// been applied.
+func (table *Table) changed(op ChangeOp, before, after *Record) {
+	if table.commit != nil {
+		table.commit.changes = append(table.commit.changes, txChange{table: table, op: op, before: before, after: after})
+		return
+	}
+	table.modified()
+	table.lastModified.Store(table.now().UnixNano())
+	if table.history != nil {
+		table.addHistory(op, before, after)
+	}
+	table.runAfterHooks(op, before, after)
+
+	if len(table.watchers) > 0 {
+		event := ChangeEvent{Table: table.name, Op: op}
+		if before != nil {
+			event.ID = before.ID
+			event.Before = before.Data
+		}
+		if after != nil {
+			event.ID = after.ID
+			event.After = after.Data
+		}
+		table.notifyWatchers(event)
+	}
+	for view := range table.views {
+		view.changed(table, before, after)
+	}
+
+	if table.database == nil {
+		return
+	}
+
+	entry := ChangeLogEntry{Table: table.name, Op: op}
+	if after != nil {
+		entry.ID = after.ID
+		entry.Data = after.Data
+	} else {
+		entry.ID = before.ID
+	}
+
+	database := table.database
+	entry.Time = database.now()
+
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	if database.changeLog == nil {
+		return
+	}
+
+	select {
+	case database.changeLog.entries <- entry:
+	default:
+		database.changeLog.dropped.Add(1)
+	}
+}
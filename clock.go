@@ -0,0 +1,70 @@
+package velox
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for everything time-dependent in a database,
+// such as save timestamps and write rate limiting. Lock statistics always
+// measure real time.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a Clock that only moves when told to, for tests.
+type FakeClock struct {
+	now time.Time
+	sync.Mutex
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.Lock()
+	defer clock.Unlock()
+
+	return clock.now
+}
+
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.Lock()
+	defer clock.Unlock()
+
+	clock.now = clock.now.Add(d)
+}
+
+func (clock *FakeClock) Set(now time.Time) {
+	clock.Lock()
+	defer clock.Unlock()
+
+	clock.now = now
+}
+
+// SetClock replaces the database's clock, for example with a FakeClock in
+// tests.
+func (database *Database) SetClock(clock Clock) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.clock = clock
+}
+
+func (database *Database) now() time.Time {
+	database.RWMutex.RLock()
+	clock := database.clock
+	database.RWMutex.RUnlock()
+
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	jsoniter "github.com/json-iterator/go"
+	velox "github.com/properfish/VeloxDB"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// inspect lists the tables with their record counts.
+func inspect(args []string) error {
+	set, key := flags("inspect")
+	rest, err := parse(set, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	database, err := open(rest[0], *key, openRead)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tRECORDS\tNEXT ID\tAPPROX BYTES")
+	for _, name := range database.ListTables() {
+		table, err := database.GetTable(name)
+		if err != nil {
+			return err
+		}
+		stats := table.Stats()
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", name, stats.Records, stats.NextID, stats.ApproxBytes)
+	}
+	return w.Flush()
+}
+
+// get prints a record as JSON.
+func get(args []string) error {
+	set, key := flags("get")
+	rest, err := parse(set, args, 3, 3)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(rest[2])
+	if err != nil {
+		return err
+	}
+	database, err := open(rest[0], *key, openRead)
+	if err != nil {
+		return err
+	}
+	table, err := database.GetTable(rest[1])
+	if err != nil {
+		return err
+	}
+
+	record, err := table.GetRecord(id)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", encoded)
+	return nil
+}
+
+// put creates a record, or creates or replaces the record with the given
+// ID, from JSON data given as an argument or on standard input. The table
+// and the database are created if they don't exist.
+func put(args []string) error {
+	set, key := flags("put")
+	rest, err := parse(set, args, 2, 4)
+	if err != nil {
+		return err
+	}
+
+	// With three arguments the last is the ID if it is a number and the
+	// data otherwise.
+	id := 0
+	var encoded []byte
+	switch {
+	case len(rest) == 4:
+		if id, err = parseID(rest[2]); err != nil {
+			return err
+		}
+		encoded = []byte(rest[3])
+	case len(rest) == 3 && !isNumber(rest[2]):
+		encoded = []byte(rest[2])
+	case len(rest) == 3:
+		if id, err = parseID(rest[2]); err != nil {
+			return err
+		}
+		fallthrough
+	default:
+		if encoded, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	}
+	var data interface{}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return fmt.Errorf("invalid data: %w", err)
+	}
+
+	database, err := open(rest[0], *key, openCreate)
+	if err != nil {
+		return err
+	}
+	table, err := database.GetOrCreateTable(rest[1])
+	if err != nil {
+		return err
+	}
+
+	if id == 0 {
+		record, err := table.CreateRecord(data)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %d\n", record.GetID())
+	} else {
+		created, err := table.UpsertRecord(id, data)
+		if err != nil {
+			return err
+		}
+		if created {
+			fmt.Printf("created %d\n", id)
+		} else {
+			fmt.Printf("updated %d\n", id)
+		}
+	}
+	return database.Save()
+}
+
+// remove deletes a record.
+func remove(args []string) error {
+	set, key := flags("delete")
+	rest, err := parse(set, args, 3, 3)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(rest[2])
+	if err != nil {
+		return err
+	}
+	database, err := open(rest[0], *key, openWrite)
+	if err != nil {
+		return err
+	}
+	table, err := database.GetTable(rest[1])
+	if err != nil {
+		return err
+	}
+
+	if err := table.DeleteRecord(id); err != nil {
+		return err
+	}
+	return database.Save()
+}
+
+// conditions collects -where flags.
+type conditions []string
+
+func (c *conditions) String() string { return strings.Join(*c, ", ") }
+
+func (c *conditions) Set(value string) error {
+	*c = append(*c, value)
+	return nil
+}
+
+// query prints the matching records as JSON, one per line.
+func query(args []string) error {
+	set, key := flags("query")
+	var where conditions
+	set.Var(&where, "where", "condition such as 'age>=30' or 'name=\"Ann\"'")
+	sortBy := set.String("sort", "", "field to order by")
+	desc := set.Bool("desc", false, "order descending")
+	limit := set.Int("limit", -1, "maximum number of records")
+	rest, err := parse(set, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	database, err := open(rest[0], *key, openRead)
+	if err != nil {
+		return err
+	}
+	table, err := database.GetTable(rest[1])
+	if err != nil {
+		return err
+	}
+
+	builder := table.Select()
+	for _, expr := range where {
+		field, op, value, err := parseCondition(expr)
+		if err != nil {
+			return err
+		}
+		builder = builder.Where(field, op, value)
+	}
+	if *sortBy != "" {
+		if *desc {
+			builder = builder.OrderByDesc(*sortBy)
+		} else {
+			builder = builder.OrderBy(*sortBy)
+		}
+	}
+	if *limit >= 0 {
+		builder = builder.Limit(*limit)
+	}
+
+	records, err := builder.Run()
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// operators are the query operators, longer ones first so that <= isn't
+// read as <.
+var operators = []string{"==", "!=", "<=", ">=", "=", "<", ">"}
+
+// parseCondition splits a condition such as age>=30 into its field,
+// operator and value. The value is read as JSON if it is valid JSON and as
+// a string otherwise, so name=Ann and name="Ann" mean the same.
+func parseCondition(expr string) (string, string, interface{}, error) {
+	i := strings.IndexAny(expr, "=!<>")
+	if i <= 0 {
+		return "", "", nil, fmt.Errorf("invalid condition %q", expr)
+	}
+	field := strings.TrimSpace(expr[:i])
+	for _, op := range operators {
+		if !strings.HasPrefix(expr[i:], op) {
+			continue
+		}
+		raw := strings.TrimSpace(expr[i+len(op):])
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		return field, op, value, nil
+	}
+	return "", "", nil, fmt.Errorf("invalid condition %q", expr)
+}
+
+// export writes the database as an export stream; see Database.Export.
+func export(args []string) error {
+	set, key := flags("export")
+	output := set.String("o", "", "file to write instead of standard output")
+	rest, err := parse(set, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	database, err := open(rest[0], *key, openRead)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return database.Export(os.Stdout)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := database.Export(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// importStream adds the tables of an export stream to the database,
+// creating the database if there is none.
+func importStream(args []string) error {
+	set, key := flags("import")
+	rest, err := parse(set, args, 1, 2)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if len(rest) > 1 {
+		file, err := os.Open(rest[1])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	database, err := open(rest[0], *key, openCreate)
+	if err != nil {
+		return err
+	}
+	if err := database.Import(r); err != nil {
+		return err
+	}
+	return database.Save()
+}
+
+// compact compacts each table, folding the write-ahead log into the table
+// files, and removes files no table uses. With -wal it also merges the log
+// segments kept for point-in-time recovery.
+func compact(args []string) error {
+	set, key := flags("compact")
+	wal := set.Bool("wal", false, "merge the archived write-ahead log segments")
+	rest, err := parse(set, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	folder := rest[0]
+	database, err := open(folder, *key, openWrite)
+	if err != nil {
+		return err
+	}
+
+	before, err := folderSize(folder)
+	if err != nil {
+		return err
+	}
+	for _, name := range database.ListTables() {
+		table, err := database.GetTable(name)
+		if err != nil {
+			return err
+		}
+		result, err := table.CompactWithOptions(velox.CompactOptions{WAL: *wal})
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Printf("%s: %d bytes reclaimed\n", name, result.Reclaimed())
+	}
+	// Compacting a table saves the database, but there may be no tables.
+	if err := database.Save(); err != nil {
+		return err
+	}
+	after, err := folderSize(folder)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d bytes before, %d after\n", before, after)
+	return nil
+}
+
+func folderSize(folder string) (int64, error) {
+	var size int64
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// repair loads what it can of a damaged database and reports the tables
+// that can't be loaded. With -drop it drops them, deleting their files,
+// and saves the rest.
+func repair(args []string) error {
+	set, key := flags("repair")
+	drop := set.Bool("drop", false, "drop the tables that can't be loaded")
+	rest, err := parse(set, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	database, err := open(rest[0], *key, openRepair)
+	var loadErr *velox.LoadError
+	if err != nil && !errors.As(err, &loadErr) {
+		return err
+	}
+
+	if loadErr == nil {
+		fmt.Println("all tables loaded")
+		return database.Save()
+	}
+	names := make([]string, 0, len(loadErr.Failed))
+	for name := range loadErr.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %v\n", name, loadErr.Failed[name])
+	}
+	if !*drop {
+		return fmt.Errorf("%d table(s) can't be loaded; run with -drop to drop them", len(loadErr.Failed))
+	}
+	for _, name := range names {
+		if err := database.DropTable(name); err != nil {
+			return err
+		}
+		fmt.Printf("dropped %s\n", name)
+	}
+	return database.Save()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by editor.readLine when the user presses
+// Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// editor reads lines from a terminal in raw mode, with cursor movement,
+// history and tab completion.
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int
+	complete func(word string) []string
+
+	history []string
+}
+
+func (e *editor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	var line []rune
+	pos := 0
+	// browsing is the history entry shown, len(e.history) for the line
+	// being typed, which is kept in draft meanwhile.
+	browsing := len(e.history)
+	var draft []rune
+	lastTab := false
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	show := func(entry []rune) {
+		line = append([]rune(nil), entry...)
+		pos = len(line)
+		redraw()
+	}
+	redraw()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		tab := false
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			text := string(line)
+			if strings.TrimSpace(text) != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != text) {
+				e.history = append(e.history, text)
+			}
+			return text, nil
+
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+
+		case 127, 8: // Backspace
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(line)
+		case 11: // Ctrl-K
+			line = line[:pos]
+		case 21: // Ctrl-U
+			line = line[pos:]
+			pos = 0
+
+		case '\t':
+			tab = true
+			e.completeWord(&line, &pos, lastTab, redraw)
+
+		case 27: // Escape sequence
+			if next, _, err := e.in.ReadRune(); err != nil || next != '[' {
+				continue
+			}
+			code, _, err := e.in.ReadRune()
+			if err != nil {
+				return "", err
+			}
+			switch code {
+			case 'A':
+				if browsing > 0 {
+					if browsing == len(e.history) {
+						draft = line
+					}
+					browsing--
+					show([]rune(e.history[browsing]))
+				}
+			case 'B':
+				if browsing < len(e.history) {
+					browsing++
+					if browsing == len(e.history) {
+						show(draft)
+					} else {
+						show([]rune(e.history[browsing]))
+					}
+				}
+			case 'C':
+				if pos < len(line) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '3': // Delete, sent as ESC [ 3 ~
+				if tilde, _, err := e.in.ReadRune(); err == nil && tilde == '~' && pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+				}
+			}
+
+		default:
+			if !unicode.IsPrint(r) {
+				continue
+			}
+			line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+			pos++
+		}
+
+		lastTab = tab
+		redraw()
+	}
+}
+
+// completeWord completes the word before the cursor. With several
+// candidates it completes their common prefix, and lists them on a second
+// Tab in a row.
+func (e *editor) completeWord(line *[]rune, pos *int, again bool, redraw func()) {
+	start := *pos
+	for start > 0 && !strings.ContainsRune(" \t,(", (*line)[start-1]) {
+		start--
+	}
+	word := string((*line)[start:*pos])
+	matches := e.complete(word)
+	if len(matches) == 0 {
+		return
+	}
+
+	completion := matches[0]
+	if len(matches) == 1 {
+		completion += " "
+	} else {
+		for _, match := range matches[1:] {
+			completion = commonPrefix(completion, match)
+		}
+		if len(completion) <= len(word) && again {
+			fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(matches, "  "))
+			redraw()
+			return
+		}
+	}
+	if len(completion) < len(word) {
+		return
+	}
+
+	// Keep what was typed for the part of the completion it covers, so
+	// completing "SEL" doesn't rewrite it in lower case.
+	inserted := []rune(completion[len(word):])
+	rest := append([]rune(nil), (*line)[*pos:]...)
+	*line = append(append((*line)[:*pos], inserted...), rest...)
+	*pos += len(inserted)
+}
+
+// commonPrefix returns the longest prefix of a and b, ignoring case.
+func commonPrefix(a, b string) string {
+	n := 0
+	for n < len(a) && n < len(b) && unicode.ToLower(rune(a[n])) == unicode.ToLower(rune(b[n])) {
+		n++
+	}
+	return a[:n]
+}
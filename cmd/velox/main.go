@@ -0,0 +1,185 @@
+// Command velox inspects and edits a VeloxDB database folder from the
+// command line:
+//
+//	velox inspect <folder>
+//	velox get <folder> <table> <id>
+//	velox put <folder> <table> [id] [data]
+//	velox delete <folder> <table> <id>
+//	velox query [-where 'field op value']... [-sort field] [-desc] [-limit n] <folder> <table>
+//	velox export [-o file] <folder>
+//	velox import <folder> [file]
+//	velox compact [-wal] <folder>
+//	velox repair [-drop] <folder>
+//	velox shell <folder>
+//
+// shell runs statements in a small query language interactively; type
+// .help in it for the language. Commands that change the database save it
+// before they exit. They refuse to work on a folder another process has
+// loaded, which is locked, while inspect, get, query and export open the
+// database read-only and work on any folder. Encrypted databases need
+// their key, in hex, in -key or the VELOX_KEY environment variable.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	velox "github.com/properfish/VeloxDB"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"inspect": {"<folder>", inspect},
+		"get":     {"<folder> <table> <id>", get},
+		"put":     {"<folder> <table> [id] [data]", put},
+		"delete":  {"<folder> <table> <id>", remove},
+		"query":   {"[-where 'field op value']... [-sort field] [-desc] [-limit n] <folder> <table>", query},
+		"export":  {"[-o file] <folder>", export},
+		"import":  {"<folder> [file]", importStream},
+		"compact": {"[-wal] <folder>", compact},
+		"repair":  {"[-drop] <folder>", repair},
+		"shell":   {"<folder>", shell},
+	}
+}
+
+// errUsage is returned by commands called with the wrong arguments.
+var errUsage = errors.New("usage")
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "velox: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "usage: velox %s %s\n", name, cmd.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "velox %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\tvelox %s %s\n", name, commands[name].usage)
+	}
+}
+
+// flags returns a flag set for a command with the -key flag every command
+// takes. Parse errors are returned, not fatal, so main prints the usage.
+func flags(name string) (*flag.FlagSet, *string) {
+	set := flag.NewFlagSet(name, flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+	key := set.String("key", os.Getenv("VELOX_KEY"), "encryption key in hex")
+	return set, key
+}
+
+// parse parses args and checks that between min and max positional
+// arguments are left.
+func parse(set *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := set.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, errUsage
+		}
+		return nil, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	rest := set.Args()
+	if len(rest) < min || len(rest) > max {
+		return nil, errUsage
+	}
+	return rest, nil
+}
+
+type openMode int
+
+const (
+	openRead   openMode = iota // read only; see velox.OpenReadOnly
+	openWrite                  // fail if there is no database
+	openCreate                 // start an empty database if there is none
+	openRepair                 // load the tables that can be loaded
+)
+
+// open loads the database in folder.
+func open(folder, key string, mode openMode) (*velox.Database, error) {
+	if _, err := os.Stat(folder); err != nil {
+		return nil, err
+	}
+
+	opts := []velox.Option{velox.WithLogger(quiet{})}
+	if key != "" {
+		decoded, err := hex.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key: %w", err)
+		}
+		opts = append(opts, velox.WithEncryptionKey(decoded))
+	}
+	if mode == openRead {
+		opts = append(opts, velox.WithReadOnly())
+	}
+	database, err := velox.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	database.LoadBestEffort = mode == openRepair
+
+	if _, err := os.Stat(filepath.Join(folder, "master.json")); err != nil {
+		if mode != openCreate || !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no database in %s", folder)
+		}
+		database.SetFolder(folder)
+		return database, nil
+	}
+	return database, database.Load(folder)
+}
+
+// quiet drops the database's log. Commands report what went wrong
+// themselves.
+type quiet struct{}
+
+func (quiet) Debug(string, ...interface{}) {}
+func (quiet) Info(string, ...interface{})  {}
+func (quiet) Warn(string, ...interface{})  {}
+func (quiet) Error(string, ...interface{}) {}
+
+func parseID(arg string) (int, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid record id %q", arg)
+	}
+	return id, nil
+}
+
+func isNumber(arg string) bool {
+	_, err := strconv.Atoi(arg)
+	return err == nil
+}
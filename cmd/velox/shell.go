@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	velox "github.com/properfish/VeloxDB"
+)
+
+const shellHelp = `Statements:
+  select * | count(*) | field, ... from table
+      [where cond [and cond]...] [order by field [asc|desc]] [limit n]
+  insert into table {json} [, {json}]...
+  update table set field = value [, field = value]... [where cond [and cond]...]
+  delete from table [where cond [and cond]...]
+  create table name
+  drop table name
+  truncate table name
+  rename table name to name
+
+A cond is field op value, with op one of = != < <= > >=. The field id
+compares record IDs. Values are numbers, 'strings', true, false and null.
+
+Commands:
+  .tables   list the tables
+  .help     show this help
+  .quit     leave the shell
+`
+
+// shell runs statements read from standard input against the database,
+// saving it after each one that changes it.
+func shell(args []string) error {
+	set, key := flags("shell")
+	rest, err := parse(set, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	database, err := open(rest[0], *key, openCreate)
+	if err != nil {
+		return err
+	}
+
+	readLine := lineReader(database)
+	for {
+		line, err := readLine("velox> ")
+		if errors.Is(err, errInterrupted) {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		switch line {
+		case "":
+			continue
+		case ".quit", ".exit":
+			return nil
+		case ".help":
+			fmt.Print(shellHelp)
+			continue
+		case ".tables":
+			for _, name := range database.ListTables() {
+				fmt.Println(name)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ".") {
+			fmt.Fprintf(os.Stderr, "error: unknown command %s, try .help\n", line)
+			continue
+		}
+
+		if err := run(database, line, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+	}
+}
+
+// lineReader returns a function reading lines from standard input, with
+// line editing, history and completion when it is a terminal.
+func lineReader(database *velox.Database) func(prompt string) (string, error) {
+	if isTerminal(int(os.Stdin.Fd())) {
+		editor := &editor{
+			in:  bufio.NewReader(os.Stdin),
+			out: os.Stdout,
+			fd:  int(os.Stdin.Fd()),
+			complete: func(word string) []string {
+				return completions(database, word)
+			},
+		}
+		return editor.readLine
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 16<<20)
+	return func(string) (string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return scanner.Text(), nil
+	}
+}
+
+// completions returns the keywords, commands and table names starting with
+// word.
+func completions(database *velox.Database, word string) []string {
+	candidates := append([]string{".tables", ".help", ".quit"}, keywords...)
+	candidates = append(candidates, database.ListTables()...)
+
+	var matches []string
+	for _, candidate := range candidates {
+		if len(candidate) >= len(word) && strings.EqualFold(candidate[:len(word)], word) {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// run runs one statement, saving the database if it changed it.
+func run(database *velox.Database, input string, w io.Writer) error {
+	stmt, err := parseStatement(input)
+	if err != nil {
+		return err
+	}
+
+	switch stmt.kind {
+	case stmtSelect:
+		return runSelect(database, stmt, w)
+	case stmtCreate:
+		err = database.CreateTable(stmt.table)
+	case stmtDrop:
+		err = database.DropTable(stmt.table)
+	case stmtTruncate:
+		err = database.TruncateTable(stmt.table)
+	case stmtRename:
+		err = database.RenameTable(stmt.table, stmt.newName)
+	default:
+		err = runWrite(database, stmt, w)
+	}
+	if err != nil {
+		return err
+	}
+	return database.Save()
+}
+
+func runSelect(database *velox.Database, stmt *statement, w io.Writer) error {
+	table, err := database.GetTable(stmt.table)
+	if err != nil {
+		return err
+	}
+	records, err := matching(table, stmt)
+	if err != nil {
+		return err
+	}
+
+	if stmt.count {
+		fmt.Fprintln(w, len(records))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if stmt.fields == nil {
+		fmt.Fprintln(tw, "id\tdata")
+	} else {
+		fmt.Fprintf(tw, "id\t%s\n", strings.Join(stmt.fields, "\t"))
+	}
+	for _, record := range records {
+		if stmt.fields == nil {
+			encoded, err := json.Marshal(record.GetData())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(tw, "%d\t%s\n", record.GetID(), encoded)
+			continue
+		}
+
+		fmt.Fprint(tw, record.GetID())
+		data, _ := record.GetData().(map[string]interface{})
+		for _, field := range stmt.fields {
+			value, ok := data[field]
+			if !ok {
+				fmt.Fprint(tw, "\t")
+				continue
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(tw, "\t%s", encoded)
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(records) == 1 {
+		fmt.Fprintln(w, "(1 row)")
+	} else {
+		fmt.Fprintf(w, "(%d rows)\n", len(records))
+	}
+	return nil
+}
+
+func runWrite(database *velox.Database, stmt *statement, w io.Writer) error {
+	table, err := database.GetTable(stmt.table)
+	if err != nil {
+		return err
+	}
+
+	if stmt.kind == stmtInsert {
+		records, err := table.CreateRecords(stmt.records)
+		if err != nil {
+			return err
+		}
+		ids := make([]string, len(records))
+		for i, record := range records {
+			ids[i] = fmt.Sprint(record.GetID())
+		}
+		fmt.Fprintf(w, "inserted %s\n", strings.Join(ids, ", "))
+		return nil
+	}
+
+	records, err := matching(table, stmt)
+	if err != nil {
+		return err
+	}
+	if stmt.kind == stmtDelete {
+		ids := make([]int, len(records))
+		for i, record := range records {
+			ids[i] = record.GetID()
+		}
+		if err := table.DeleteRecords(ids); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "deleted %d\n", len(ids))
+		return nil
+	}
+
+	for i, record := range records {
+		if err := table.PatchRecord(record.GetID(), stmt.set); err != nil {
+			fmt.Fprintf(w, "updated %d\n", i)
+			return err
+		}
+	}
+	fmt.Fprintf(w, "updated %d\n", len(records))
+	return nil
+}
+
+// matching returns the records of table meeting the conditions of stmt,
+// in its order and up to its limit.
+func matching(table *velox.Table, stmt *statement) ([]velox.RecordInterface, error) {
+	builder := table.Select()
+	var ids []cond
+	for _, c := range stmt.where {
+		if c.field == "id" {
+			if _, ok := c.value.(float64); !ok {
+				return nil, fmt.Errorf("id compared with %v", c.value)
+			}
+			ids = append(ids, c)
+			continue
+		}
+		builder = builder.Where(c.field, c.op, c.value)
+	}
+	if stmt.order != "" {
+		if stmt.desc {
+			builder = builder.OrderByDesc(stmt.order)
+		} else {
+			builder = builder.OrderBy(stmt.order)
+		}
+	}
+
+	records, err := builder.Run()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		kept := records[:0]
+		for _, record := range records {
+			if idMatches(record.GetID(), ids) {
+				kept = append(kept, record)
+			}
+		}
+		records = kept
+	}
+	if stmt.limit >= 0 && len(records) > stmt.limit {
+		records = records[:stmt.limit]
+	}
+	return records, nil
+}
+
+func idMatches(id int, conds []cond) bool {
+	for _, c := range conds {
+		value := c.value.(float64)
+		var ok bool
+		switch c.op {
+		case "=", "==":
+			ok = float64(id) == value
+		case "!=":
+			ok = float64(id) != value
+		case "<":
+			ok = float64(id) < value
+		case "<=":
+			ok = float64(id) <= value
+		case ">":
+			ok = float64(id) > value
+		case ">=":
+			ok = float64(id) >= value
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
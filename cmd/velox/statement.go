@@ -0,0 +1,496 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The shell's statements:
+//
+//	select * | count(*) | field, ... from table
+//	    [where cond [and cond]...] [order by field [asc|desc]] [limit n]
+//	insert into table {json} [, {json}]...
+//	update table set field = value [, field = value]... [where cond [and cond]...]
+//	delete from table [where cond [and cond]...]
+//	create table name
+//	drop table name
+//	truncate table name
+//	rename table name to name
+//
+// A cond is field op value with op one of =, ==, !=, <, <=, > and >=, as
+// in QueryBuilder.Where. The field id compares record IDs. Values are
+// numbers, 'strings' or "strings", true, false and null. Keywords are case
+// insensitive.
+
+type statementKind int
+
+const (
+	stmtSelect statementKind = iota
+	stmtInsert
+	stmtUpdate
+	stmtDelete
+	stmtCreate
+	stmtDrop
+	stmtTruncate
+	stmtRename
+)
+
+type statement struct {
+	kind  statementKind
+	table string
+
+	// select
+	count  bool
+	fields []string
+	order  string
+	desc   bool
+	limit  int // -1 for none
+
+	where   []cond
+	set     map[string]interface{} // update
+	records []interface{}          // insert
+	newName string                 // rename
+}
+
+type cond struct {
+	field string
+	op    string
+	value interface{}
+}
+
+// keywords are the words completion offers besides table names.
+var keywords = []string{
+	"select", "count(*)", "from", "where", "and", "order", "by", "asc", "desc", "limit",
+	"insert", "into", "update", "set", "delete", "create", "drop", "truncate", "rename",
+	"table", "to", "true", "false", "null",
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokNumber
+	tokString
+	tokOp
+	tokPunct
+	tokJSON
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+
+		case c == '\'' || c == '"':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(input) && input[j] != c; j++ {
+				if input[j] == '\\' && j+1 < len(input) {
+					j++
+				}
+				text.WriteByte(input[j])
+			}
+			if j == len(input) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, token{kind: tokString, text: input[i : j+1], value: text.String()})
+			i = j + 1
+
+		case c == '{' || c == '[':
+			end, err := scanJSON(input, i)
+			if err != nil {
+				return nil, err
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(input[i:end]), &value); err != nil {
+				return nil, fmt.Errorf("invalid JSON: %v", err)
+			}
+			tokens = append(tokens, token{kind: tokJSON, text: input[i:end], value: value})
+			i = end
+
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(input) && input[i+1] >= '0' && input[i+1] <= '9':
+			j := i + 1
+			for j < len(input) && strings.IndexByte("0123456789.eE+-", input[j]) >= 0 {
+				j++
+			}
+			number, err := strconv.ParseFloat(input[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", input[i:j])
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: input[i:j], value: number})
+			i = j
+
+		case strings.IndexByte("=!<>", c) >= 0:
+			j := i + 1
+			if j < len(input) && input[j] == '=' {
+				j++
+			}
+			op := input[i:j]
+			if op == "!" {
+				return nil, errors.New("unexpected !")
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op})
+			i = j
+
+		case strings.IndexByte(",()*;", c) >= 0:
+			tokens = append(tokens, token{kind: tokPunct, text: input[i : i+1]})
+			i++
+
+		case c == '_' || c == '.' || c >= 0x80 || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(input) && (input[j] == '_' || input[j] == '.' || input[j] == '-' || input[j] >= 0x80 ||
+				unicode.IsLetter(rune(input[j])) || unicode.IsDigit(rune(input[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokWord, text: input[i:j]})
+			i = j
+
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// scanJSON returns the end of the JSON object or array starting at
+// input[start].
+func scanJSON(input string, start int) (int, error) {
+	depth := 0
+	for i := start; i < len(input); i++ {
+		switch input[i] {
+		case '"':
+			for i++; i < len(input) && input[i] != '"'; i++ {
+				if input[i] == '\\' {
+					i++
+				}
+			}
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth--; depth == 0 {
+				return i + 1, nil
+			}
+		}
+	}
+	return 0, errors.New("unterminated JSON")
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parseStatement(input string) (*statement, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(tokens); n > 0 && tokens[n-1].kind == tokPunct && tokens[n-1].text == ";" {
+		tokens = tokens[:n-1]
+	}
+	p := &parser{tokens: tokens}
+
+	var stmt *statement
+	switch word := strings.ToLower(p.word()); word {
+	case "select":
+		stmt, err = p.parseSelect()
+	case "insert":
+		stmt, err = p.parseInsert()
+	case "update":
+		stmt, err = p.parseUpdate()
+	case "delete":
+		stmt, err = p.parseDelete()
+	case "create", "drop", "truncate", "rename":
+		stmt, err = p.parseTableStatement(word)
+	case "":
+		return nil, errors.New("expected a statement")
+	default:
+		return nil, fmt.Errorf("unknown statement %q", word)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return stmt, nil
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// word reads a word, or returns "" if the next token isn't one.
+func (p *parser) word() string {
+	tok, ok := p.peek()
+	if !ok || tok.kind != tokWord {
+		return ""
+	}
+	p.pos++
+	return tok.text
+}
+
+// keyword reads the keyword kw if it comes next.
+func (p *parser) keyword(kw string) bool {
+	tok, ok := p.peek()
+	if !ok || tok.kind != tokWord || !strings.EqualFold(tok.text, kw) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.keyword(kw) {
+		return p.expected(kw)
+	}
+	return nil
+}
+
+// punct reads the punctuation s if it comes next.
+func (p *parser) punct(s string) bool {
+	tok, ok := p.peek()
+	if !ok || tok.kind != tokPunct || tok.text != s {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) name(what string) (string, error) {
+	name := p.word()
+	if name == "" {
+		return "", p.expected(what)
+	}
+	return name, nil
+}
+
+func (p *parser) expected(what string) error {
+	if tok, ok := p.peek(); ok {
+		return fmt.Errorf("expected %s, found %q", what, tok.text)
+	}
+	return fmt.Errorf("expected %s", what)
+}
+
+// value reads a number, string, JSON value, true, false or null.
+func (p *parser) value() (interface{}, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, p.expected("a value")
+	}
+	switch tok.kind {
+	case tokNumber, tokString, tokJSON:
+		p.pos++
+		return tok.value, nil
+	case tokWord:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			p.pos++
+			return true, nil
+		case "false":
+			p.pos++
+			return false, nil
+		case "null":
+			p.pos++
+			return nil, nil
+		}
+	}
+	return nil, p.expected("a value")
+}
+
+func (p *parser) parseSelect() (*statement, error) {
+	stmt := &statement{kind: stmtSelect, limit: -1}
+	switch {
+	case p.punct("*"):
+	case p.keyword("count"):
+		if !p.punct("(") || !p.punct("*") || !p.punct(")") {
+			return nil, p.expected("count(*)")
+		}
+		stmt.count = true
+	default:
+		for {
+			field, err := p.name("a field")
+			if err != nil {
+				return nil, err
+			}
+			stmt.fields = append(stmt.fields, field)
+			if !p.punct(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.table, err = p.name("a table"); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+
+	if p.keyword("order") {
+		if err := p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		if stmt.order, err = p.name("a field"); err != nil {
+			return nil, err
+		}
+		if p.keyword("desc") {
+			stmt.desc = true
+		} else {
+			p.keyword("asc")
+		}
+	}
+	if p.keyword("limit") {
+		tok, ok := p.peek()
+		limit, isNumber := tok.value.(float64)
+		if !ok || tok.kind != tokNumber || !isNumber || limit < 0 || limit != float64(int(limit)) {
+			return nil, p.expected("a limit")
+		}
+		p.pos++
+		stmt.limit = int(limit)
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseWhere() ([]cond, error) {
+	if !p.keyword("where") {
+		return nil, nil
+	}
+	var conds []cond
+	for {
+		field, err := p.name("a field")
+		if err != nil {
+			return nil, err
+		}
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokOp {
+			return nil, p.expected("an operator")
+		}
+		p.pos++
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond{field: field, op: tok.text, value: value})
+
+		if !p.keyword("and") {
+			return conds, nil
+		}
+	}
+}
+
+func (p *parser) parseInsert() (*statement, error) {
+	if err := p.expectKeyword("into"); err != nil {
+		return nil, err
+	}
+	stmt := &statement{kind: stmtInsert}
+	var err error
+	if stmt.table, err = p.name("a table"); err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokJSON {
+			return nil, p.expected("a JSON record")
+		}
+		p.pos++
+		stmt.records = append(stmt.records, tok.value)
+		if !p.punct(",") {
+			return stmt, nil
+		}
+	}
+}
+
+func (p *parser) parseUpdate() (*statement, error) {
+	stmt := &statement{kind: stmtUpdate, set: make(map[string]interface{}), limit: -1}
+	var err error
+	if stmt.table, err = p.name("a table"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("set"); err != nil {
+		return nil, err
+	}
+	for {
+		field, err := p.name("a field")
+		if err != nil {
+			return nil, err
+		}
+		if tok, ok := p.peek(); !ok || tok.kind != tokOp || tok.text != "=" {
+			return nil, p.expected("=")
+		}
+		p.pos++
+		if stmt.set[field], err = p.value(); err != nil {
+			return nil, err
+		}
+		if !p.punct(",") {
+			break
+		}
+	}
+	if stmt.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseDelete() (*statement, error) {
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	stmt := &statement{kind: stmtDelete, limit: -1}
+	var err error
+	if stmt.table, err = p.name("a table"); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseTableStatement(verb string) (*statement, error) {
+	if err := p.expectKeyword("table"); err != nil {
+		return nil, err
+	}
+	stmt := &statement{}
+	var err error
+	if stmt.table, err = p.name("a table"); err != nil {
+		return nil, err
+	}
+
+	switch verb {
+	case "create":
+		stmt.kind = stmtCreate
+	case "drop":
+		stmt.kind = stmtDrop
+	case "truncate":
+		stmt.kind = stmtTruncate
+	case "rename":
+		stmt.kind = stmtRename
+		if err := p.expectKeyword("to"); err != nil {
+			return nil, err
+		}
+		if stmt.newName, err = p.name("a table"); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
@@ -0,0 +1,114 @@
+package velox
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Codec encodes the records of a table file. The codec's name is stored in
+// each file's header, so Load picks the right codec for every file no
+// matter which one the database is set to write. The write-ahead log is
+// always JSON.
+type Codec interface {
+	Name() string
+	Marshal(records []Record) ([]byte, error)
+	Unmarshal(data []byte) ([]Record, error)
+}
+
+// JSONCodec is the default codec. Record data comes back from it as the
+// generic values JSON decodes into, such as map[string]interface{}.
+var JSONCodec Codec = jsonCodec{}
+
+// GobCodec stores records with encoding/gob, which is faster than JSON for
+// large tables and gives record data back with the types it was stored
+// with. Every concrete type stored in record data, apart from the generic
+// JSON types, must be registered with gob.Register before Save or Load.
+var GobCodec Codec = gobCodec{}
+
+var codecs = struct {
+	byName map[string]Codec
+	sync.RWMutex
+}{byName: map[string]Codec{"json": JSONCodec, "gob": GobCodec}}
+
+// RegisterCodec makes a custom codec's files loadable. Codecs are looked up
+// by name, so the name must be unique and must not change.
+func RegisterCodec(codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	codecs.byName[codec.Name()] = codec
+}
+
+func codecByName(name string) (Codec, error) {
+	if name == "" {
+		return JSONCodec, nil
+	}
+
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	codec, ok := codecs.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return codec, nil
+}
+
+// SetCodec sets the codec Save writes table files with. The next Save
+// rewrites every table.
+func (database *Database) SetCodec(codec Codec) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.codec = codec
+	database.savedTargets = nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(records []Record) ([]byte, error) {
+	return jsoniter.Marshal(records)
+}
+
+func (jsonCodec) Unmarshal(data []byte) ([]Record, error) {
+	var records []Record
+	if err := strictJSON.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+type gobCodec struct{}
+
+func init() {
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(records []Record) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte) ([]Record, error) {
+	var records []Record
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
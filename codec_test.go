@@ -0,0 +1,36 @@
+package velox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadGob(t *testing.T) {
+	folder := t.TempDir()
+	want := saveItems(t, folder, WithCodec(GobCodec), WithCompression(Gzip))
+
+	// Files record their codec, so a database set to JSON loads them too.
+	for _, codec := range []Codec{GobCodec, JSONCodec} {
+		got, err := loadItems(t, folder, WithCodec(codec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("records loaded with codec %s = %v, want %v", codec.Name(), got, want)
+		}
+	}
+
+	database, err := New(WithFolder(folder), WithLoad())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	table, _ := database.GetTable("items")
+	record, err := table.ReadRecord(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := record.(map[string]interface{})["n"].(int); !ok || n != 0 {
+		t.Fatalf("gob gave back n = %#v, want int 0", record.(map[string]interface{})["n"])
+	}
+}
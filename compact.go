@@ -0,0 +1,145 @@
+package velox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CompactOptions configures Table.CompactWithOptions.
+type CompactOptions struct {
+	// WAL also merges the write-ahead log segments kept for point-in-time
+	// recovery into one file, leaving out the entries older than the
+	// oldest base backup, which no restore replays.
+	WAL bool
+}
+
+// CompactResult reports what Compact reclaimed. Sizes are in bytes and
+// are only measured for a database folder; they are zero for other
+// storage and for tables that aren't saved.
+type CompactResult struct {
+	// Before and After are the size of the table's files.
+	Before, After int64
+	// WALBefore and WALAfter are the size of the write-ahead log and, with
+	// CompactOptions.WAL, of the segments kept for point-in-time recovery.
+	WALBefore, WALAfter int64
+}
+
+// Reclaimed returns the bytes freed on disk, negative if the files grew,
+// for example because records were added while Compact ran.
+func (result CompactResult) Reclaimed() int64 {
+	return result.Before - result.After + result.WALBefore - result.WALAfter
+}
+
+// Compact is CompactWithOptions with the default options.
+func (table *Table) Compact() (CompactResult, error) {
+	return table.CompactWithOptions(CompactOptions{})
+}
+
+// CompactWithOptions gives back the space a table keeps after many
+// deletes. It rebuilds the in-memory maps, which never shrink on their
+// own, and then rewrites the table's files and saves the database, which
+// also folds the write-ahead log into the files. Record IDs are kept as
+// they are, as other tables and callers may hold them, so IDs stay sparse.
+func (table *Table) CompactWithOptions(options CompactOptions) (CompactResult, error) {
+	database := table.database
+	if database != nil && database.readOnly {
+		return CompactResult{}, fmt.Errorf("Compact: %w", ErrReadOnly)
+	}
+
+	func() {
+		defer table.unlock(table.lock())
+
+		table.records.compact()
+		if table.keys != nil {
+			keys := make(map[string]int, len(table.keys))
+			for key, id := range table.keys {
+				keys[key] = id
+			}
+			table.keys = keys
+		}
+		// The files are rewritten even if nothing changed since the last
+		// Save, which would otherwise skip the table.
+		table.modified()
+	}()
+
+	if database == nil || database.memory {
+		return CompactResult{}, nil
+	}
+
+	database.RWMutex.RLock()
+	folder := database.folder
+	_, inFolder := database.storageLocked().(dirStorage)
+	database.RWMutex.RUnlock()
+	if folder == "" {
+		return CompactResult{}, nil
+	}
+
+	var result CompactResult
+	result.Before, result.WALBefore = table.diskUsage(folder, inFolder, options.WAL)
+
+	if err := database.Save(); err != nil {
+		return result, fmt.Errorf("Compact: %w", err)
+	}
+	if options.WAL {
+		if err := database.mergeSegments(folder); err != nil {
+			return result, fmt.Errorf("Compact: write-ahead log: %w", err)
+		}
+	}
+
+	result.After, result.WALAfter = table.diskUsage(folder, inFolder, options.WAL)
+	database.log().Info("table compacted", "table", table.name, "reclaimed", result.Reclaimed())
+	return result, nil
+}
+
+// diskUsage returns the size of the table's files, if inFolder, and of
+// the write-ahead log. Save moves both around, so none may run meanwhile.
+func (table *Table) diskUsage(folder string, inFolder, archived bool) (int64, int64) {
+	table.database.saving.Lock()
+	defer table.database.saving.Unlock()
+
+	var files int64
+	if inFolder {
+		files = table.fileSize(folder)
+	}
+	return files, walSize(folder, archived)
+}
+
+// fileSize returns the size of the table's files in folder as of its last
+// Save.
+func (table *Table) fileSize(folder string) int64 {
+	file := tableFileName(table.name)
+	files := shardFiles(file, tableMeta{Shards: table.savedShards})
+	files = append(files, historyFileName(file))
+
+	var size int64
+	for _, name := range files {
+		if info, err := os.Stat(filepath.Join(folder, name)); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// walSize returns the size of the write-ahead log in folder, including the
+// segments kept for point-in-time recovery if archived is set.
+func walSize(folder string, archived bool) int64 {
+	files := []string{filepath.Join(folder, walFileName), filepath.Join(folder, walSegmentName)}
+	if archived {
+		entries, _ := os.ReadDir(filepath.Join(folder, pitrFolder))
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), "wal-") && strings.HasSuffix(entry.Name(), ".log") {
+				files = append(files, filepath.Join(folder, pitrFolder, entry.Name()))
+			}
+		}
+	}
+
+	var size int64
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
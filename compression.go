@@ -0,0 +1,106 @@
+package velox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression int
+
+const (
+	NoCompression Compression = iota
+	Gzip
+	Zstd
+)
+
+var compressionNames = map[Compression]string{
+	Gzip: "gzip",
+	Zstd: "zstd",
+}
+
+// SetCompression makes Save compress table files. Each file records its
+// compression in its header, so Load reads files written with any setting.
+// The next Save rewrites every table.
+func (database *Database) SetCompression(compression Compression) error {
+	if _, ok := compressionNames[compression]; !ok && compression != NoCompression {
+		return fmt.Errorf("SetCompression: unknown compression %d", compression)
+	}
+
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.compression = compression
+	database.savedTargets = nil
+	return nil
+}
+
+func compress(compression Compression, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch compression {
+	case NoCompression:
+		return data, nil
+	case Gzip:
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	case Zstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %d", compression)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress undoes compress for the compression named in a file header.
+func decompress(name string, data []byte) ([]byte, error) {
+	switch name {
+	case "":
+		return data, nil
+	case compressionNames[Gzip]:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case compressionNames[Zstd]:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unknown compression %q", name)
+}
+
+// decompressReader is decompress for a stream.
+func decompressReader(name string, r io.Reader) (io.ReadCloser, error) {
+	switch name {
+	case "":
+		return io.NopCloser(r), nil
+	case compressionNames[Gzip]:
+		return gzip.NewReader(r)
+	case compressionNames[Zstd]:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", name)
+}
@@ -0,0 +1,76 @@
+package velox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// saveItems saves a database made with opts in folder, holding an "items"
+// table with a few records, and returns the records.
+func saveItems(t *testing.T, folder string, opts ...Option) map[int]string {
+	t.Helper()
+	database, err := New(append(opts, WithFolder(folder))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := database.GetTable("items")
+	for i := 0; i < 100; i++ {
+		if _, err := table.CreateRecord(map[string]interface{}{"name": "plain text item", "n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return recordsOf(t, table)
+}
+
+// loadItems loads the "items" table of the database saved in folder.
+func loadItems(t *testing.T, folder string, opts ...Option) (map[int]string, error) {
+	t.Helper()
+	database, err := New(append(opts, WithFolder(folder), WithLoad())...)
+	if err != nil {
+		return nil, err
+	}
+	defer database.Close()
+	table, err := database.GetTable("items")
+	if err != nil {
+		return nil, err
+	}
+	return recordsOf(t, table), nil
+}
+
+func TestLoadCompressed(t *testing.T) {
+	for _, compression := range []Compression{Gzip, Zstd} {
+		t.Run(compressionNames[compression], func(t *testing.T) {
+			folder := t.TempDir()
+			want := saveItems(t, folder, WithCompression(compression))
+
+			file, err := os.ReadFile(filepath.Join(folder, tableFileName("items")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(file, []byte("plain text item")) {
+				t.Fatal("table file is not compressed")
+			}
+
+			// Files record their compression, so any setting loads them.
+			for _, setting := range []Compression{NoCompression, compression} {
+				got, err := loadItems(t, folder, WithCompression(setting))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("records loaded with compression %d = %v, want %v", setting, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ComputeFunc derives the value of a computed field from the data of a
+// record. It reports false when the record has no value for the field, as
+// for a missing field. It must not change data.
+type ComputeFunc func(data interface{}) (interface{}, bool)
+
+// AddComputedField declares a field whose value compute derives from the
+// rest of each record, for example
+//
+//	table.AddComputedField("full_name", func(data interface{}) (interface{}, bool) {
+//		user := data.(map[string]interface{})
+//		return fmt.Sprint(user["first"], " ", user["last"]), true
+//	})
+//
+// The value is never stored in records. Queries, OrderBy, aggregations and
+// joins compute it as they read each record, and indexes and unique
+// constraints on the field are maintained as records are written, so they
+// can be created before or after the field. A computed field hides a
+// field of the data with the same name. Computed fields are not saved;
+// add them again after Load.
+func (table *Table) AddComputedField(name string, compute ComputeFunc) error {
+	if name == "" {
+		return errors.New("AddComputedField: invalid field name")
+	}
+	if compute == nil {
+		return errors.New("AddComputedField: nil function")
+	}
+
+	if err := table.administer("AddComputedField"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	current := table.computedFields()
+	if _, ok := current[name]; ok {
+		return fmt.Errorf("AddComputedField: field %q already exists", name)
+	}
+
+	computed := make(map[string]ComputeFunc, len(current)+1)
+	for field, fn := range current {
+		computed[field] = fn
+	}
+	computed[name] = compute
+	return table.setComputed("AddComputedField", name, computed)
+}
+
+// RemoveComputedField removes the computed field name. Indexes and
+// constraints on it go back to the field of the data with that name.
+func (table *Table) RemoveComputedField(name string) error {
+	if err := table.administer("RemoveComputedField"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	current := table.computedFields()
+	if _, ok := current[name]; !ok {
+		return fmt.Errorf("RemoveComputedField: field %q not found", name)
+	}
+
+	computed := make(map[string]ComputeFunc, len(current))
+	for field, fn := range current {
+		if field != name {
+			computed[field] = fn
+		}
+	}
+	return table.setComputed("RemoveComputedField", name, computed)
+}
+
+// ComputedFields returns the names of the computed fields, sorted.
+func (table *Table) ComputedFields() []string {
+	computed := table.computedFields()
+	names := make([]string, 0, len(computed))
+	for name := range computed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadComputed returns the value of computed field name for record id.
+func (table *Table) ReadComputed(id int, name string) (interface{}, error) {
+	compute, ok := table.computedFields()[name]
+	if !ok {
+		return nil, fmt.Errorf("ReadComputed: field %q not found", name)
+	}
+
+	record, err := table.liveRecord("ReadComputed", id)
+	if err != nil {
+		return nil, err
+	}
+	value, _ := compute(record.Data)
+	return value, nil
+}
+
+// setComputed replaces the computed fields with computed, which changes
+// field, and rebuilds the indexes and unique constraint on field. Callers
+// hold the write lock.
+func (table *Table) setComputed(op, field string, computed map[string]ComputeFunc) error {
+	previous := table.computed.Load()
+	table.computed.Store(&computed)
+
+	if _, ok := table.uniques[field]; ok {
+		index := table.indexRecords(field)
+		for key, ids := range index {
+			if key == "null" {
+				continue
+			}
+			if holders := table.uniqueHolders(ids); len(holders) > 1 {
+				table.computed.Store(previous)
+				return fmt.Errorf("%s: %w in field %q: records %d and %d both hold %s", op, ErrDuplicate, field, holders[0], holders[1], key)
+			}
+		}
+		table.uniques[field] = index
+	}
+	if _, ok := table.indexes[field]; ok {
+		table.buildIndex(field)
+	}
+	return nil
+}
+
+func (table *Table) computedFields() map[string]ComputeFunc {
+	if computed := table.computed.Load(); computed != nil {
+		return *computed
+	}
+	return nil
+}
+
+// fieldOf is fieldValue for the data of a record of the table, computing
+// the value of computed fields.
+func (table *Table) fieldOf(data interface{}, field string) (interface{}, bool) {
+	if compute, ok := table.computedFields()[field]; ok {
+		return compute(data)
+	}
+	return fieldValue(data, field)
+}
@@ -0,0 +1,280 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFloat is returned for data holding NaN or ±Inf, which JSON
+// can't represent and would otherwise only fail once Save runs.
+var ErrInvalidFloat = errors.New("invalid float value")
+
+// ErrDuplicate is returned for writes that would give a field with a
+// unique constraint a value another record already has.
+var ErrDuplicate = errors.New("duplicate value")
+
+type ConstraintError struct {
+	Field   string
+	Value   interface{}
+	Allowed []string
+}
+
+func (err *ConstraintError) Error() string {
+	return fmt.Sprintf("enum constraint violated on field %q: value %#v is not one of [%s]",
+		err.Field, err.Value, strings.Join(err.Allowed, ", "))
+}
+
+// AddEnumConstraint restricts field to the allowed values on every write.
+// Records without the field are accepted. Existing records are checked
+// first, and the constraint is not added if any of them violate it.
+func (table *Table) AddEnumConstraint(field string, allowed []string) error {
+	if field == "" || len(allowed) == 0 {
+		return errors.New("AddEnumConstraint: field and allowed values are required")
+	}
+
+	if err := table.administer("AddEnumConstraint"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	values := append([]string(nil), allowed...)
+
+	var violation error
+	table.records.IterCb(func(key string, val interface{}) {
+		if violation != nil {
+			return
+		}
+		if record, err := table.recordValue("AddEnumConstraint", val); err == nil {
+			violation = checkEnum(field, values, record.Data)
+		}
+	})
+	if violation != nil {
+		return fmt.Errorf("AddEnumConstraint: existing record: %w", violation)
+	}
+
+	if table.enums == nil {
+		table.enums = make(map[string][]string)
+	}
+	table.enums[field] = values
+	table.modified()
+	return nil
+}
+
+// AddUniqueConstraint makes every record hold a different value of field.
+// Records without the field, or with it set to null, are accepted. Existing
+// records are checked first, and the constraint is not added if any two of
+// them share a value. The constraint is saved in master.json.
+func (table *Table) AddUniqueConstraint(field string) error {
+	if field == "" {
+		return errors.New("AddUniqueConstraint: invalid field name")
+	}
+
+	if err := table.administer("AddUniqueConstraint"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if _, ok := table.uniques[field]; ok {
+		return errors.New("AddUniqueConstraint: constraint already exists")
+	}
+
+	index := table.indexRecords(field)
+	for key, ids := range index {
+		if key == "null" {
+			continue
+		}
+		if holders := table.uniqueHolders(ids); len(holders) > 1 {
+			return fmt.Errorf("AddUniqueConstraint: %w in field %q: records %d and %d both hold %s", ErrDuplicate, field, holders[0], holders[1], key)
+		}
+	}
+
+	if table.uniques == nil {
+		table.uniques = make(map[string]fieldIndex)
+	}
+	table.uniques[field] = index
+	table.modified()
+	return nil
+}
+
+func (table *Table) DropUniqueConstraint(field string) error {
+	if err := table.administer("DropUniqueConstraint"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if _, ok := table.uniques[field]; !ok {
+		return errors.New("DropUniqueConstraint: constraint not found")
+	}
+
+	delete(table.uniques, field)
+	table.modified()
+	return nil
+}
+
+// checkConstraints validates data as the data of record id.
+func (table *Table) checkConstraints(id int, data interface{}) error {
+	if err := checkFloats(data); err != nil {
+		return err
+	}
+	if table.schema != nil {
+		if err := table.schema.Validate(data); err != nil {
+			return err
+		}
+	}
+
+	for field, allowed := range table.enums {
+		if err := checkEnum(field, allowed, data); err != nil {
+			return err
+		}
+	}
+
+	for field, index := range table.uniques {
+		value, ok := table.fieldOf(data, field)
+		if !ok || value == nil {
+			continue
+		}
+		key, ok := indexKey(value)
+		if !ok {
+			continue
+		}
+		for _, holder := range table.uniqueHolders(index[key]) {
+			if holder != id {
+				return fmt.Errorf("%w in field %q: value %s is already used by record %d", ErrDuplicate, field, key, holder)
+			}
+		}
+	}
+
+	return table.checkForeignKeys(data)
+}
+
+func checkEnum(field string, allowed []string, data interface{}) error {
+	value, ok := fieldValue(data, field)
+	if !ok {
+		return nil
+	}
+
+	if str, ok := value.(string); ok {
+		for _, candidate := range allowed {
+			if str == candidate {
+				return nil
+			}
+		}
+	}
+
+	return &ConstraintError{Field: field, Value: value, Allowed: allowed}
+}
+
+// uniqueHolders returns the live records among ids, the records sharing
+// one value of a field with a unique constraint. Expired records that are
+// not removed yet don't count.
+func (table *Table) uniqueHolders(ids map[int]struct{}) []int {
+	holders := make([]int, 0, len(ids))
+	for id := range ids {
+		if val, ok := table.records.Get(strconv.Itoa(id)); ok {
+			if record, err := table.recordValue("uniqueHolders", val); err == nil && !table.hidden(record) {
+				holders = append(holders, id)
+			}
+		}
+	}
+	sort.Ints(holders)
+	return holders
+}
+
+// maxFloatCheckDepth bounds the walk so cyclic data can't recurse forever.
+// Such data can't be encoded anyway, and Save reports that.
+const maxFloatCheckDepth = 64
+
+// invalidFloat is a NaN or ±Inf found by findFloat. path holds the steps
+// to it innermost first, so that they are only joined for the error.
+type invalidFloat struct {
+	value float64
+	path  []string
+}
+
+func checkFloats(data interface{}) error {
+	found := findFloat(reflect.ValueOf(data), 0)
+	if found == nil {
+		return nil
+	}
+
+	path := "data"
+	for i := len(found.path) - 1; i >= 0; i-- {
+		path += found.path[i]
+	}
+	return fmt.Errorf("%w %v in field %q", ErrInvalidFloat, found.value, path)
+}
+
+func findFloat(value reflect.Value, depth int) *invalidFloat {
+	if depth > maxFloatCheckDepth {
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if f := value.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return &invalidFloat{value: f}
+		}
+
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			return findFloat(value.Elem(), depth+1)
+		}
+
+	case reflect.Map:
+		if !mayHoldFloat(value.Type().Elem()) {
+			return nil
+		}
+		iter := value.MapRange()
+		for iter.Next() {
+			if found := findFloat(iter.Value(), depth+1); found != nil {
+				found.path = append(found.path, fmt.Sprintf(".%v", iter.Key()))
+				return found
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		if !mayHoldFloat(value.Type().Elem()) {
+			return nil
+		}
+		for i := 0; i < value.Len(); i++ {
+			if found := findFloat(value.Index(i), depth+1); found != nil {
+				found.path = append(found.path, fmt.Sprintf("[%d]", i))
+				return found
+			}
+		}
+
+	case reflect.Struct:
+		typ := value.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			if typ.Field(i).PkgPath != "" {
+				continue
+			}
+			if found := findFloat(value.Field(i), depth+1); found != nil {
+				found.path = append(found.path, "."+typ.Field(i).Name)
+				return found
+			}
+		}
+	}
+
+	return nil
+}
+
+// mayHoldFloat reports whether values of typ can be or contain a float, so
+// that slices such as []byte and []string aren't walked element by element.
+func mayHoldFloat(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Complex64, reflect.Complex128, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package velox
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRejectInvalidFloats(t *testing.T) {
+	_, table := newTestTable(t, "readings")
+
+	type reading struct {
+		Sensor string
+		Values []float64
+	}
+	cases := []struct {
+		data interface{}
+		path string
+	}{
+		{map[string]interface{}{"temp": math.NaN()}, "data.temp"},
+		{map[string]interface{}{"nested": map[string]interface{}{"max": math.Inf(1)}}, "data.nested.max"},
+		{map[string]interface{}{"list": []interface{}{1.0, math.Inf(-1)}}, "data.list[1]"},
+		{reading{Sensor: "a", Values: []float64{1, 2, math.NaN()}}, "data.Values[2]"},
+		{&reading{Values: []float64{math.Inf(1)}}, "data.Values[0]"},
+	}
+	for _, c := range cases {
+		_, err := table.CreateRecord(c.data)
+		if !errors.Is(err, ErrInvalidFloat) {
+			t.Errorf("CreateRecord(%#v) = %v, want ErrInvalidFloat", c.data, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), `"`+c.path+`"`) {
+			t.Errorf("error %q doesn't name field %s", err, c.path)
+		}
+	}
+	if n := table.Count(); n != 0 {
+		t.Fatalf("%d invalid records stored", n)
+	}
+
+	record, err := table.CreateRecord(map[string]interface{}{"temp": 21.5, "raw": []byte("ok")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.UpdateRecord(record.GetID(), map[string]interface{}{"temp": math.NaN()})
+	if !errors.Is(err, ErrInvalidFloat) {
+		t.Fatalf("UpdateRecord with NaN = %v, want ErrInvalidFloat", err)
+	}
+	data, _ := table.ReadRecord(record.GetID())
+	if data.(map[string]interface{})["temp"] != 21.5 {
+		t.Fatalf("rejected update changed the record: %v", data)
+	}
+}
+
+func TestCheckFloatsAllocations(t *testing.T) {
+	var values, raw interface{} = make([]float64, 1000), make([]byte, 1000)
+	allocs := testing.AllocsPerRun(10, func() {
+		if checkFloats(values) != nil || checkFloats(raw) != nil {
+			t.Fatal("valid data rejected")
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("checkFloats allocates %v times for valid slices", allocs)
+	}
+}
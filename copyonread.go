@@ -0,0 +1,132 @@
+package velox
+
+import "reflect"
+
+// SetCopyOnRead turns copy on read mode on or off. Reads normally hand out
+// the data the table holds, so changing a map returned by ReadRecord
+// changes the record in the table without a write: no version bump, no
+// index update and nothing saved. In copy on read mode, every method
+// returning records, ReadRecord, GetRecord, queries, lookups, cursors,
+// snapshots and History, returns a deep copy of their data and metadata
+// instead, which callers may change freely. Copying costs an allocation per
+// map, slice and pointer in the data. Query predicates, hooks and change
+// events still see the held data and must not change it. Data passed to
+// writes is held as given, so callers shouldn't change it afterwards in
+// either mode. The mode is saved in master.json.
+func (table *Table) SetCopyOnRead(on bool) error {
+	if err := table.administer("SetCopyOnRead"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.copyOnRead.Store(on)
+	table.modified()
+	return nil
+}
+
+// readable returns record as reads hand it out: copied in copy on read
+// mode, as is otherwise.
+func (table *Table) readable(record Record) Record {
+	if !table.copyOnRead.Load() {
+		return record
+	}
+	record.Data = copyData(record.Data)
+	record.Meta = copyMeta(record.Meta)
+	return record
+}
+
+// copyData deep-copies data. Maps, slices, arrays, pointers and exported
+// struct fields are copied; unexported fields, channels and functions are
+// shared with the original.
+func copyData(data interface{}) interface{} {
+	switch data := data.(type) {
+	case nil, string, bool, float64, int:
+		return data
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(data))
+		for key, value := range data {
+			copied[key] = copyData(value)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(data))
+		for i, value := range data {
+			copied[i] = copyData(value)
+		}
+		return copied
+	}
+	return copyValue(reflect.ValueOf(data)).Interface()
+}
+
+func copyValue(value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Interface:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.New(value.Type()).Elem()
+		copied.Set(copyValue(value.Elem()))
+		return copied
+	case reflect.Pointer:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.New(value.Type().Elem())
+		copied.Elem().Set(copyValue(value.Elem()))
+		return copied
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.MakeMapWithSize(value.Type(), value.Len())
+		entries := value.MapRange()
+		for entries.Next() {
+			copied.SetMapIndex(entries.Key(), copyValue(entries.Value()))
+		}
+		return copied
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		reflect.Copy(copied, value)
+		if sharesMemory(value.Type().Elem()) {
+			for i := 0; i < value.Len(); i++ {
+				copied.Index(i).Set(copyValue(value.Index(i)))
+			}
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(value.Type()).Elem()
+		copied.Set(value)
+		if sharesMemory(value.Type().Elem()) {
+			for i := 0; i < value.Len(); i++ {
+				copied.Index(i).Set(copyValue(value.Index(i)))
+			}
+		}
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(value.Type()).Elem()
+		copied.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			if field := copied.Field(i); field.CanSet() {
+				field.Set(copyValue(value.Field(i)))
+			}
+		}
+		return copied
+	}
+	return value
+}
+
+// sharesMemory reports whether copying a value of type t by assignment
+// leaves the copy sharing memory with the original.
+func sharesMemory(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Struct:
+		return true
+	case reflect.Array:
+		return sharesMemory(t.Elem())
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package velox
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+type CSVImportOptions struct {
+	// Delimiter separates fields. Zero means a comma.
+	Delimiter rune
+	// TrimSpace trims leading and trailing spaces from every value.
+	TrimSpace bool
+	// InferTypes stores values that look like integers, floats or
+	// true/false as int, float64 and bool. Without it, or Types, every
+	// record's Data is a map[string]string; with it, a
+	// map[string]interface{}.
+	InferTypes bool
+	// Mapping maps column names to field names. When set, only the
+	// columns it names are imported.
+	Mapping map[string]string
+	// Types converts the values of the fields it names, and takes
+	// precedence over InferTypes. A value that doesn't convert fails the
+	// import; an empty one leaves the field out.
+	Types map[string]CSVType
+}
+
+// CSVType is the type ImportCSV converts a field's values to.
+type CSVType int
+
+const (
+	CSVString CSVType = iota
+	CSVInt
+	CSVFloat
+	CSVBool
+)
+
+// ImportCSV creates one record per data row of r, using the header row for
+// field names, and returns how many records it created. The whole input is
+// parsed before anything is inserted, so a malformed line imports nothing
+// and the error names its line. A row rejected on insert stops the import
+// after the rows before it.
+func (table *Table) ImportCSV(r io.Reader, opts CSVImportOptions) (int, error) {
+	reader := csv.NewReader(r)
+	if opts.Delimiter != 0 {
+		reader.Comma = opts.Delimiter
+	}
+	reader.TrimLeadingSpace = opts.TrimSpace
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return 0, errors.New("ImportCSV: missing header row")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ImportCSV: %w", err)
+	}
+	for i := range header {
+		if opts.TrimSpace {
+			header[i] = strings.TrimSpace(header[i])
+		}
+	}
+	fields := make([]string, len(header))
+	found := make(map[string]bool, len(header))
+	for i, column := range header {
+		fields[i] = column
+		if opts.Mapping != nil {
+			fields[i] = opts.Mapping[column]
+		}
+		found[column] = true
+	}
+	for column := range opts.Mapping {
+		if !found[column] {
+			return 0, fmt.Errorf("ImportCSV: no column %q", column)
+		}
+	}
+
+	type row struct {
+		line int
+		data interface{}
+	}
+	rows := make([]row, 0)
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("ImportCSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		data, err := csvRecord(fields, values, opts)
+		if err != nil {
+			return 0, fmt.Errorf("ImportCSV: line %d: %w", line, err)
+		}
+		rows = append(rows, row{line: line, data: data})
+	}
+
+	if err := table.throttle("ImportCSV"); err != nil {
+		return 0, err
+	}
+
+	defer table.unlock(table.lock())
+
+	for i, row := range rows {
+		if _, err := table.insertRecord("ImportCSV", row.data, nil); err != nil {
+			return i, fmt.Errorf("line %d: %w", row.line, err)
+		}
+	}
+	return len(rows), nil
+}
+
+// csvRecord builds the data of a record from a row. Columns without a
+// field are skipped.
+func csvRecord(fields, values []string, opts CSVImportOptions) (interface{}, error) {
+	if !opts.InferTypes && opts.Types == nil {
+		data := make(map[string]string, len(fields))
+		for i, field := range fields {
+			if field == "" {
+				continue
+			}
+			value := values[i]
+			if opts.TrimSpace {
+				value = strings.TrimSpace(value)
+			}
+			data[field] = value
+		}
+		return data, nil
+	}
+
+	data := make(map[string]interface{}, len(fields))
+	for i, field := range fields {
+		if field == "" {
+			continue
+		}
+		value := values[i]
+		if opts.TrimSpace {
+			value = strings.TrimSpace(value)
+		}
+		typ, ok := opts.Types[field]
+		if !ok {
+			if opts.InferTypes {
+				data[field] = inferCSVValue(value)
+			} else {
+				data[field] = value
+			}
+			continue
+		}
+		if value == "" && typ != CSVString {
+			continue
+		}
+		converted, err := convertCSVValue(value, typ)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		data[field] = converted
+	}
+	return data, nil
+}
+
+func convertCSVValue(value string, typ CSVType) (interface{}, error) {
+	switch typ {
+	case CSVString:
+		return value, nil
+	case CSVInt:
+		return strconv.Atoi(value)
+	case CSVFloat:
+		return strconv.ParseFloat(value, 64)
+	case CSVBool:
+		return strconv.ParseBool(value)
+	}
+	return nil, fmt.Errorf("unknown type %d", typ)
+}
+
+func inferCSVValue(value string) interface{} {
+	if i, err := strconv.Atoi(value); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !strings.ContainsAny(value, "xXnN") {
+		return f
+	}
+	switch strings.ToLower(value) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return value
+}
+
+// ExportCSV writes the records to w as CSV ordered by ID, one column per
+// field in columns, and returns how many records it wrote. Without
+// columns, every top-level field any record has is written, in name
+// order. Strings, numbers and booleans are written as they are, missing
+// fields and nil as empty values, times in RFC 3339 and anything else as
+// JSON. ImportCSV reads the output back.
+func (table *Table) ExportCSV(w io.Writer, columns ...string) (int, error) {
+	records := table.snapshot("ExportCSV")
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	if len(columns) == 0 {
+		seen := make(map[string]bool)
+		for _, record := range records {
+			for _, field := range topLevelFields(record.Data) {
+				if !seen[field] {
+					seen[field] = true
+					columns = append(columns, field)
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return 0, fmt.Errorf("ExportCSV: %w", err)
+	}
+	row := make([]string, len(columns))
+	for i, record := range records {
+		for j, column := range columns {
+			value, _ := fieldValue(record.Data, column)
+			text, err := formatCSVValue(value)
+			if err != nil {
+				return i, fmt.Errorf("ExportCSV: record %d: field %s: %w", record.ID, column, err)
+			}
+			row[j] = text
+		}
+		if err := writer.Write(row); err != nil {
+			return i, fmt.Errorf("ExportCSV: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return len(records), fmt.Errorf("ExportCSV: %w", err)
+	}
+	return len(records), nil
+}
+
+func formatCSVValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	}
+	encoded, err := jsoniter.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// topLevelFields returns the fields fieldValue finds in data: the keys of
+// a map, or the exported fields of a struct by json name.
+func topLevelFields(data interface{}) []string {
+	value := reflect.ValueOf(data)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	var fields []string
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range value.MapKeys() {
+			fields = append(fields, key.String())
+		}
+	case reflect.Struct:
+		typ := value.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
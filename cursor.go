@@ -0,0 +1,121 @@
+package velox
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Cursor walks a table's records in ID order, one lookup at a time, so a
+// large table can be read without copying it. Each call to Next holds the
+// table's read lock while it looks, but none is held between calls:
+// records created, changed or deleted ahead of the cursor while it runs
+// are seen as they are when it reaches them.
+type Cursor struct {
+	table  *Table
+	next   int
+	record *Record
+
+	// ids holds the used IDs from next on, in order, when most IDs ahead
+	// of the cursor are unused. It is only good while the table is at
+	// generation.
+	ids        []int
+	generation uint64
+}
+
+func (table *Table) Cursor() *Cursor {
+	return &Cursor{table: table, next: 1}
+}
+
+// Next moves to the next record and reports whether there is one.
+func (cursor *Cursor) Next() bool {
+	table := cursor.table
+	defer table.runlock(table.rlock())
+
+	if cursor.ids != nil && cursor.generation != table.generation.Load() {
+		cursor.ids = nil
+	}
+	if cursor.ids == nil {
+		// Dense tables are walked by ID. Once the next ID turns out to be
+		// unused and most IDs ahead are too, sorting the used ones is
+		// cheaper, as in page.
+		if cursor.next < table.nextID && cursor.visit(cursor.next) {
+			cursor.next++
+			return true
+		}
+		if table.nextID-cursor.next > 2*table.records.Count() {
+			cursor.ids = table.idsFrom(cursor.next)
+			cursor.generation = table.generation.Load()
+		}
+	}
+
+	if cursor.ids != nil {
+		for len(cursor.ids) > 0 {
+			id := cursor.ids[0]
+			cursor.ids = cursor.ids[1:]
+			cursor.next = id + 1
+			if cursor.visit(id) {
+				return true
+			}
+		}
+	} else {
+		for end := table.nextID; cursor.next < end; cursor.next++ {
+			if cursor.visit(cursor.next) {
+				cursor.next++
+				return true
+			}
+		}
+	}
+
+	cursor.record = nil
+	return false
+}
+
+// visit moves the cursor to record id if it exists and isn't hidden.
+// Callers hold the read lock.
+func (cursor *Cursor) visit(id int) bool {
+	table := cursor.table
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return false
+	}
+	record, err := table.recordValue("Cursor", val)
+	if err != nil || table.hidden(record) {
+		return false
+	}
+
+	record = table.readable(record)
+	cursor.record = &record
+	return true
+}
+
+// idsFrom returns the used IDs from id on, sorted. Callers hold the read
+// lock.
+func (table *Table) idsFrom(id int) []int {
+	ids := make([]int, 0)
+	table.records.IterCb(func(key string, val interface{}) {
+		if n, err := strconv.Atoi(key); err == nil && n >= id {
+			ids = append(ids, n)
+		}
+	})
+	sort.Ints(ids)
+	return ids
+}
+
+// Record returns the record Next moved to, or nil after Next returns false.
+func (cursor *Cursor) Record() RecordInterface {
+	if cursor.record == nil {
+		return nil
+	}
+	return cursor.record
+}
+
+// Iterate calls fn with each record in ID order until fn returns false.
+// It reads the table like a Cursor, so fn may write to the table.
+func (table *Table) Iterate(fn func(id int, data interface{}) bool) {
+	cursor := table.Cursor()
+	for cursor.Next() {
+		if !fn(cursor.record.ID, cursor.record.Data) {
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package velox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursorSparse(t *testing.T) {
+	_, table := newTestTable(t, "items")
+	for _, id := range []int{3, 20000000, 7, 1000000} {
+		if _, err := table.CreateRecordWithID(id, map[string]interface{}{"id": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	var ids []int
+	table.Iterate(func(id int, data interface{}) bool {
+		ids = append(ids, id)
+		if id == 7 {
+			// Records created ahead of the cursor are still seen.
+			if _, err := table.CreateRecordWithID(500, map[string]interface{}{"id": 500}); err != nil {
+				t.Fatal(err)
+			}
+			if err := table.DeleteRecord(1000000); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return true
+	})
+	if elapsed := time.Since(start); elapsed > time.Second/10 {
+		t.Errorf("Iterate over 5 sparse records took %v", elapsed)
+	}
+
+	want := []int{3, 7, 500, 20000000}
+	if len(ids) != len(want) {
+		t.Fatalf("Iterate visited %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("Iterate visited %v, want %v", ids, want)
+		}
+	}
+
+	cursor := table.Cursor()
+	for cursor.Next() {
+	}
+	if cursor.Next() {
+		t.Fatal("Next after the end found a record")
+	}
+	record, err := table.CreateRecord(map[string]interface{}{"late": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cursor.Next() || cursor.Record().GetID() != record.GetID() {
+		t.Fatal("cursor at the end missed a record created after it")
+	}
+}
@@ -0,0 +1,120 @@
+package velox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// KeyProvider supplies the AES keys table files and the write-ahead log
+// are encrypted with. Keys are 16, 24 or 32 bytes long. Every file records
+// the ID of its key, so keys can be rotated: new files use the current key
+// while older ones are still read with theirs.
+type KeyProvider interface {
+	CurrentKey() (id string, key []byte, err error)
+	Key(id string) ([]byte, error)
+}
+
+// encryptionName is the cipher recorded in table file headers.
+const encryptionName = "aes-gcm"
+
+// SetEncryptionKey encrypts table files and the write-ahead log with key
+// using AES-GCM. Blobs are stored as given. Load needs the same key set
+// before it runs. The next Save rewrites every table.
+func (database *Database) SetEncryptionKey(key []byte) error {
+	if _, err := aes.NewCipher(key); err != nil {
+		return fmt.Errorf("SetEncryptionKey: %w", err)
+	}
+
+	sum := sha256.Sum256(key)
+	database.SetKeyProvider(staticKey{id: hex.EncodeToString(sum[:8]), key: append([]byte(nil), key...)})
+	return nil
+}
+
+// SetKeyProvider is SetEncryptionKey for keys held elsewhere, such as in a
+// key management service. A nil provider turns encryption off.
+func (database *Database) SetKeyProvider(provider KeyProvider) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.keys = provider
+	database.savedTargets = nil
+}
+
+func (database *Database) keyProvider() KeyProvider {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	return database.keys
+}
+
+type staticKey struct {
+	id  string
+	key []byte
+}
+
+func (static staticKey) CurrentKey() (string, []byte, error) {
+	return static.id, static.key, nil
+}
+
+func (static staticKey) Key(id string) ([]byte, error) {
+	if id != static.id {
+		return nil, fmt.Errorf("unknown encryption key %s", id)
+	}
+	return static.key, nil
+}
+
+// seal encrypts data with the provider's current key and returns the
+// nonce followed by the ciphertext, and the key's ID.
+func seal(keys KeyProvider, data []byte) ([]byte, string, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	return aead.Seal(nonce, nonce, data, nil), id, nil
+}
+
+// unseal reverses seal. keys is nil when the database has no key set.
+func unseal(keys KeyProvider, id string, sealed []byte) ([]byte, error) {
+	if keys == nil {
+		return nil, errors.New("data is encrypted but no encryption key is set")
+	}
+	key, err := keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: encrypted data is truncated", ErrCorrupted)
+	}
+	data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt with key %s: wrong key or damaged data", id)
+	}
+	return data, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,97 @@
+package velox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadEncrypted(t *testing.T) {
+	folder := t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+	other := bytes.Repeat([]byte{2}, 32)
+	want := saveItems(t, folder, WithEncryptionKey(key), WithCompression(Zstd))
+
+	file, err := os.ReadFile(filepath.Join(folder, tableFileName("items")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(file, []byte("plain text item")) {
+		t.Fatal("table file is not encrypted")
+	}
+
+	if _, err := loadItems(t, folder); err == nil {
+		t.Error("Load without a key succeeded")
+	}
+	if _, err := loadItems(t, folder, WithEncryptionKey(other)); err == nil {
+		t.Error("Load with another key succeeded")
+	}
+	right := NewDatabase()
+	if err := right.SetEncryptionKey(key); err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := right.keyProvider().CurrentKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadItems(t, folder, WithKeyProvider(staticKey{id: id, key: other})); err == nil {
+		t.Error("Load with the wrong key under the right ID succeeded")
+	}
+
+	got, err := loadItems(t, folder, WithEncryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("records loaded = %v, want %v", got, want)
+	}
+}
+
+func TestWALEncrypted(t *testing.T) {
+	folder := t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+	database, err := New(WithFolder(folder), WithEncryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := database.GetTable("items")
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.EnableWAL(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.CreateRecord(map[string]interface{}{"name": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	want := recordsOf(t, table)
+	if err := database.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	logged, err := os.ReadFile(filepath.Join(folder, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) == 0 || bytes.Contains(logged, []byte("secret")) {
+		t.Fatalf("write-ahead log is empty or not encrypted: %q", logged)
+	}
+
+	loaded, err := New(WithFolder(folder), WithEncryptionKey(key), WithLoad())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	if err := loaded.EnableWAL(); err != nil {
+		t.Fatal(err)
+	}
+	table, _ = loaded.GetTable("items")
+	if got := recordsOf(t, table); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records after replay = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors that callers can check for with errors.Is. Failures involving a
+// particular record or table wrap them in a *RecordError or *TableError,
+// which say where the failure happened.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrRecordExists = errors.New("already exists")
+	ErrTableExists  = errors.New("already exists")
+	// ErrCorrupted is returned for files on disk that fail validation.
+	ErrCorrupted = errors.New("corrupted")
+)
+
+type RecordError struct {
+	Op    string
+	Table string
+	ID    int
+	// Key is set instead of ID for lookups by record key.
+	Key string
+	Err error
+}
+
+func (err *RecordError) Error() string {
+	record := fmt.Sprintf("record %d", err.ID)
+	if err.Key != "" {
+		record = fmt.Sprintf("record %q", err.Key)
+	}
+	if err.Table != "" {
+		record += " in table " + err.Table
+	}
+	return fmt.Sprintf("%s: %s: %v", err.Op, record, err.Err)
+}
+
+func (err *RecordError) Unwrap() error {
+	return err.Err
+}
+
+type TableError struct {
+	Op    string
+	Table string
+	Err   error
+}
+
+func (err *TableError) Error() string {
+	if err.Op == "" {
+		return fmt.Sprintf("table %s: %v", err.Table, err.Err)
+	}
+	return fmt.Sprintf("%s: table %s: %v", err.Op, err.Table, err.Err)
+}
+
+func (err *TableError) Unwrap() error {
+	return err.Err
+}
+
+// notFound reports that record id is missing from the table.
+func (table *Table) notFound(op string, id int) error {
+	return &RecordError{Op: op, Table: table.tableName(), ID: id, Err: ErrNotFound}
+}
+
+// tableName returns the table's name for error messages. Callers may hold
+// the table lock but not the database lock.
+func (table *Table) tableName() string {
+	if table.database == nil {
+		return table.name
+	}
+
+	table.database.RWMutex.RLock()
+	defer table.database.RWMutex.RUnlock()
+	return table.name
+}
@@ -0,0 +1,238 @@
+package velox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// exportFormat names the format Export writes: an exportHeader, then for
+// each table an exportTable followed by its records, all as JSON lines.
+const (
+	exportFormat  = "velox-export"
+	exportVersion = 1
+)
+
+type exportHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Tables  int    `json:"tables"`
+}
+
+type exportTable struct {
+	Table   string    `json:"table"`
+	Meta    tableMeta `json:"meta"`
+	NextID  int       `json:"next_id"`
+	Records int       `json:"records"`
+}
+
+// Export writes every table, its settings and records, to w as one stream
+// that Import reads back. Unlike Backup, the stream doesn't depend on the
+// file layout, codec, compression or encryption of the database: records
+// are written as plain JSON, so keep the stream somewhere safe if the
+// database is encrypted. Like Backup, it holds the database as of a single
+// moment. History and blobs are not exported.
+func (database *Database) Export(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	stream := jsoniter.NewEncoder(writer)
+
+	err := database.exportTables("Export", func(count int) error {
+		return stream.Encode(exportHeader{Format: exportFormat, Version: exportVersion, Tables: count})
+	}, func(name string, meta tableMeta, nextID int, records []Record) error {
+		meta.File = ""
+		meta.History = false
+		if err := stream.Encode(exportTable{Table: name, Meta: meta, NextID: nextID, Records: len(records)}); err != nil {
+			return err
+		}
+		for i := range records {
+			if err := stream.Encode(&records[i]); err != nil {
+				return fmt.Errorf("record %d: %w", records[i].ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("Export: %w", err)
+	}
+	return nil
+}
+
+// exportTables passes every table to fn in name order, with its records
+// ordered by ID, after passing the number of tables to start. Loaded
+// tables are read from a Snapshot; tables that are on disk but not loaded
+// are read from their files.
+func (database *Database) exportTables(op string, start func(count int) error, fn func(name string, meta tableMeta, nextID int, records []Record) error) error {
+	snapshot := database.Snapshot()
+	defer snapshot.Close()
+
+	database.RWMutex.RLock()
+	storage := database.storageLocked()
+	keys := database.keys
+	unloaded := make(map[string]tableMeta, len(database.unloaded))
+	for name, meta := range database.unloaded {
+		unloaded[name] = meta
+	}
+	database.RWMutex.RUnlock()
+
+	names := snapshot.Tables()
+	for name := range unloaded {
+		if _, ok := snapshot.tables[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if err := start(len(names)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, name := range names {
+		var meta tableMeta
+		var records []Record
+		var nextID int
+		if view, ok := snapshot.tables[name]; ok {
+			stored, err := view.stored(op)
+			if err != nil {
+				return err
+			}
+			records = make([]Record, len(stored))
+			for i := range stored {
+				records[i] = *stored[i]
+			}
+			meta = view.table.meta()
+			nextID = view.table.NextID()
+		} else {
+			table, err := loadTable(storage, name, unloaded[name], keys)
+			if err != nil {
+				return fmt.Errorf("%s: table %s: %w", op, name, err)
+			}
+			records = table.allRecords()
+			meta = unloaded[name]
+			nextID = table.nextID
+		}
+
+		if err := fn(name, meta, nextID, records); err != nil {
+			return fmt.Errorf("%s: table %s: %w", op, name, err)
+		}
+	}
+	return nil
+}
+
+// Import reads a stream written by Export and adds its tables to the
+// database. It fails without changing anything if the stream is damaged
+// or a table of the same name exists, loaded or not. With the write-ahead
+// log enabled the imported records are logged; their settings are not,
+// as with every table setting, until the next Save.
+func (database *Database) Import(r io.Reader) error {
+	if database.isFollower() {
+		return fmt.Errorf("Import: %w", ErrReplica)
+	}
+	if database.readOnly {
+		return fmt.Errorf("Import: %w", ErrReadOnly)
+	}
+
+	stream := jsoniter.NewDecoder(bufio.NewReader(r))
+
+	var header exportHeader
+	if err := stream.Decode(&header); err != nil {
+		return fmt.Errorf("Import: %w: %v", ErrCorrupted, err)
+	}
+	if header.Format != exportFormat {
+		return fmt.Errorf("Import: %w: not an export", ErrCorrupted)
+	}
+	if header.Version > exportVersion {
+		return fmt.Errorf("Import: unsupported export version %d", header.Version)
+	}
+
+	tables := make(map[string]*Table, header.Tables)
+	names := make([]string, 0, header.Tables)
+	for i := 0; i < header.Tables; i++ {
+		var block exportTable
+		if err := stream.Decode(&block); err != nil {
+			return fmt.Errorf("Import: %w: %v", ErrCorrupted, err)
+		}
+		if block.Table == "" || tables[block.Table] != nil || block.Records < 0 {
+			return fmt.Errorf("Import: %w: unexpected table %q", ErrCorrupted, block.Table)
+		}
+
+		records := make([]Record, block.Records)
+		for j := range records {
+			if err := stream.Decode(&records[j]); err != nil {
+				return fmt.Errorf("Import: table %s: %w: %v", block.Table, ErrCorrupted, err)
+			}
+		}
+		table, err := restoreTable(block.Meta, records, block.NextID)
+		if err != nil {
+			return fmt.Errorf("Import: table %s: %w", block.Table, err)
+		}
+		tables[block.Table] = table
+		names = append(names, block.Table)
+	}
+
+	for _, name := range names {
+		if err := database.authorize(context.Background(), name, PermissionAdmin); err != nil {
+			return fmt.Errorf("Import: %w", &TableError{Table: name, Err: err})
+		}
+		if database.isUnloaded(name) {
+			return fmt.Errorf("Import: %w", &TableError{Table: name, Err: ErrTableExists})
+		}
+		if _, ok := database.tables.Get(name); ok {
+			return fmt.Errorf("Import: %w", &TableError{Table: name, Err: ErrTableExists})
+		}
+	}
+
+	var entries []walEntry
+	for _, name := range names {
+		for _, record := range tables[name].allRecords() {
+			record := record
+			entries = append(entries, walEntry{Table: name, Op: ChangeCreate, ID: record.ID, Record: &record})
+		}
+	}
+	if len(entries) > 0 {
+		if err := database.writeAhead(entries...); err != nil {
+			return fmt.Errorf("Import: %w", err)
+		}
+	}
+
+	for i, name := range names {
+		table := tables[name]
+		database.attach(name, table)
+		table.modified()
+		if !database.tables.SetIfAbsent(name, table) {
+			// Only a table created while importing can get here; the
+			// ones added so far stay.
+			return fmt.Errorf("Import: %d of %d tables imported: %w", i, len(names), &TableError{Table: name, Err: ErrTableExists})
+		}
+	}
+
+	database.resolveForeignKeys()
+	return nil
+}
+
+func (database *Database) isFollower() bool {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	return database.follower
+}
+
+// allRecords returns the records of a table that isn't shared yet, ordered
+// by ID.
+func (table *Table) allRecords() []Record {
+	records := make([]Record, 0, table.records.Count())
+	table.records.IterCb(func(key string, val interface{}) {
+		if record, err := table.recordValue("Export", val); err == nil {
+			records = append(records, record)
+		}
+	})
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records
+}
@@ -0,0 +1,279 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// fieldValue looks up a top-level field in record data. Maps are indexed by
+// key and structs by their json name, falling back to the Go field name.
+func fieldValue(data interface{}, field string) (interface{}, bool) {
+	value := reflect.ValueOf(data)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil, false
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		item := value.MapIndex(reflect.ValueOf(field).Convert(value.Type().Key()))
+		if !item.IsValid() {
+			return nil, false
+		}
+		return item.Interface(), true
+
+	case reflect.Struct:
+		index, ok := structField(value.Type(), field)
+		if !ok {
+			return nil, false
+		}
+		return value.FieldByIndex(index).Interface(), true
+	}
+
+	return nil, false
+}
+
+func structField(typ reflect.Type, field string) ([]int, bool) {
+	var fallback []int
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == field {
+			return f.Index, true
+		}
+		if name == "" && f.Name == field && fallback == nil {
+			fallback = f.Index
+		}
+	}
+
+	return fallback, fallback != nil
+}
+
+// RenameField moves oldName to newName in every map-typed record and
+// returns how many records changed, bumping their version and update
+// time. Records without oldName, and records that are not maps, are left
+// alone. Nothing is changed if any record already has both fields, or if
+// the table has a schema. Enum and unique constraints and indexes on
+// oldName move with it, so newName must not have constraints of its own.
+func (table *Table) RenameField(oldName, newName string) (int, error) {
+	if oldName == "" || newName == "" || oldName == newName {
+		return 0, errors.New("RenameField: invalid field names")
+	}
+
+	if err := table.throttle("RenameField"); err != nil {
+		return 0, err
+	}
+
+	defer table.unlock(table.lock())
+
+	if table.schema != nil {
+		return 0, errors.New("RenameField: table has a schema")
+	}
+	if _, ok := table.uniques[newName]; ok {
+		return 0, fmt.Errorf("RenameField: field %q has a unique constraint", newName)
+	}
+	if _, ok := table.enums[newName]; ok {
+		return 0, fmt.Errorf("RenameField: field %q has an enum constraint", newName)
+	}
+
+	type change struct{ previous, record Record }
+	renamed := make([]change, 0)
+	now := table.now()
+	var conflict error
+	table.records.IterCb(func(key string, val interface{}) {
+		if conflict != nil {
+			return
+		}
+		record, err := table.recordValue("RenameField", val)
+		if err != nil {
+			return
+		}
+
+		data, ok, err := renameMapKey(record.Data, oldName, newName)
+		if err != nil {
+			conflict = fmt.Errorf("RenameField: record %d: %w", record.ID, err)
+			return
+		}
+		if ok {
+			previous := record
+			record.Data = data
+			record.Version++
+			record.UpdatedAt = now
+			if record.Hash, err = table.recordHash(data); err != nil {
+				conflict = fmt.Errorf("RenameField: record %d: %w", record.ID, err)
+				return
+			}
+			renamed = append(renamed, change{previous, record})
+		}
+	})
+	if conflict != nil {
+		return 0, conflict
+	}
+
+	entries := make([]walEntry, len(renamed))
+	for i := range renamed {
+		entries[i] = walEntry{Table: table.name, Op: ChangeUpdate, ID: renamed[i].record.ID, Record: &renamed[i].record}
+	}
+	if err := table.writeAhead(entries...); err != nil {
+		return 0, fmt.Errorf("RenameField: %w", err)
+	}
+
+	for i := range renamed {
+		table.setRecord(&renamed[i].previous, renamed[i].record)
+		table.changed(ChangeUpdate, &renamed[i].previous, &renamed[i].record)
+	}
+
+	if allowed, ok := table.enums[oldName]; ok {
+		delete(table.enums, oldName)
+		table.enums[newName] = allowed
+	}
+	if _, ok := table.indexes[oldName]; ok {
+		delete(table.indexes, oldName)
+		table.buildIndex(newName)
+	}
+	if _, ok := table.uniques[oldName]; ok {
+		delete(table.uniques, oldName)
+		table.uniques[newName] = table.indexRecords(newName)
+	}
+	if table.text != nil {
+		fields := table.textFields()
+		for i, field := range fields {
+			if field == oldName {
+				fields[i] = newName
+			}
+		}
+		table.buildTextIndex(fields)
+	}
+	table.renameForeignKey(oldName, newName)
+	table.modified()
+
+	return len(renamed), nil
+}
+
+func renameMapKey(data interface{}, oldName, newName string) (interface{}, bool, error) {
+	value := reflect.ValueOf(data)
+	if value.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String {
+		return data, false, nil
+	}
+
+	oldKey := reflect.ValueOf(oldName).Convert(value.Type().Key())
+	newKey := reflect.ValueOf(newName).Convert(value.Type().Key())
+
+	moved := value.MapIndex(oldKey)
+	if !moved.IsValid() {
+		return data, false, nil
+	}
+	if value.MapIndex(newKey).IsValid() {
+		return nil, false, fmt.Errorf("field %q already exists", newName)
+	}
+
+	copied := reflect.MakeMapWithSize(value.Type(), value.Len())
+	iter := value.MapRange()
+	for iter.Next() {
+		copied.SetMapIndex(iter.Key(), iter.Value())
+	}
+	copied.SetMapIndex(oldKey, reflect.Value{})
+	copied.SetMapIndex(newKey, moved)
+
+	return copied.Interface(), true, nil
+}
+
+// withField returns a copy of data with field set to value. Maps are
+// copied and structs are copied by value, so the stored data and anything
+// callers already hold are never modified. value is converted to the
+// field's type when the container is typed.
+func withField(data interface{}, field string, value interface{}) (interface{}, error) {
+	original := reflect.ValueOf(data)
+	current := original
+	if current.Kind() == reflect.Ptr {
+		if current.IsNil() {
+			return nil, errors.New("data is nil")
+		}
+		current = current.Elem()
+	}
+
+	var updated reflect.Value
+	switch current.Kind() {
+	case reflect.Map:
+		if current.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot set field %q on %T", field, data)
+		}
+		item, err := convertValue(value, current.Type().Elem())
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", field, err)
+		}
+
+		updated = reflect.MakeMapWithSize(current.Type(), current.Len()+1)
+		iter := current.MapRange()
+		for iter.Next() {
+			updated.SetMapIndex(iter.Key(), iter.Value())
+		}
+		updated.SetMapIndex(reflect.ValueOf(field).Convert(current.Type().Key()), item)
+
+	case reflect.Struct:
+		index, ok := structField(current.Type(), field)
+		if !ok {
+			return nil, fmt.Errorf("%T has no field %q", data, field)
+		}
+		item, err := convertValue(value, current.Type().FieldByIndex(index).Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", field, err)
+		}
+
+		updated = reflect.New(current.Type()).Elem()
+		updated.Set(current)
+		updated.FieldByIndex(index).Set(item)
+
+	default:
+		return nil, fmt.Errorf("cannot set field %q on %T", field, data)
+	}
+
+	if original.Kind() == reflect.Ptr {
+		ptr := reflect.New(updated.Type())
+		ptr.Elem().Set(updated)
+		return ptr.Interface(), nil
+	}
+	return updated.Interface(), nil
+}
+
+func convertValue(value interface{}, typ reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(typ), nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(typ) {
+		return v, nil
+	}
+
+	if isNumberKind(v.Kind()) && isNumberKind(typ.Kind()) {
+		converted := v.Convert(typ)
+		if converted.Convert(v.Type()).Interface() != v.Interface() {
+			return reflect.Value{}, fmt.Errorf("value %v does not fit in %s", value, typ)
+		}
+		return converted, nil
+	}
+	if v.Type().ConvertibleTo(typ) && v.Kind() == typ.Kind() {
+		return v.Convert(typ), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot use %T as %s", value, typ)
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
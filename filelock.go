@@ -0,0 +1,98 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrLocked is returned when the database folder is in use by another
+// process, or another Database in this one.
+var ErrLocked = errors.New("database folder is locked")
+
+// lockFileName is the file in the database folder that is locked while a
+// Database uses the folder. It is left behind when the lock is released.
+const lockFileName = "velox.lock"
+
+// folderLock holds an advisory lock on the database folder. Load, Save and
+// EnableWAL take it, so two Databases can't load and save the same folder
+// and overwrite each other's saves. It is released by Close or when the
+// process exits.
+type folderLock struct {
+	sync.Mutex
+	folder string
+	file   *os.File
+}
+
+// acquire locks folder, releasing the lock on any other folder once it
+// has. It fails with ErrLocked if another Database holds the lock.
+func (lock *folderLock) acquire(folder string) error {
+	abs, err := filepath.Abs(folder)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if lock.file != nil && lock.folder == abs {
+		return nil
+	}
+
+	file, err := os.OpenFile(filepath.Join(abs, lockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, ErrLocked) {
+			return fmt.Errorf("%w: %s", ErrLocked, folder)
+		}
+		return err
+	}
+
+	if lock.file != nil {
+		lock.file.Close()
+	}
+	lock.folder = abs
+	lock.file = file
+	return nil
+}
+
+func (lock *folderLock) release() error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if lock.file == nil {
+		return nil
+	}
+	// Closing the file releases the lock.
+	err := lock.file.Close()
+	lock.file = nil
+	lock.folder = ""
+	return err
+}
+
+// Close stops auto-save, closes the write-ahead log and releases the lock
+// on the database folder, so another process or Database can load it. It
+// closes the namespaces loaded with Namespace too. It doesn't save. The
+// database stays usable in memory, and a later Load, Save or EnableWAL
+// locks the folder again.
+func (database *Database) Close() error {
+	if err := database.closeNamespaces(); err != nil {
+		return fmt.Errorf("Close: %w", err)
+	}
+	database.StopAutoSave()
+	if err := database.DisableCDC(); err != nil {
+		return fmt.Errorf("Close: %w", err)
+	}
+	if err := database.DisableWAL(); err != nil {
+		return fmt.Errorf("Close: %w", err)
+	}
+	if err := database.folderLock.release(); err != nil {
+		return fmt.Errorf("Close: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+
+package velox
+
+import "os"
+
+// lockFile does nothing where file locks aren't available.
+func lockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,57 @@
+package velox
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// tableFileName maps a table name to a plain file name in the database
+// folder. ASCII letters, digits, '-' and '_' are kept and every other byte
+// is written as %XX, so names like "tenant:1/orders" can't escape the
+// folder and distinct names get distinct file names. Letters keep their
+// case, so on case-insensitive filesystems, the default on macOS and
+// Windows, names that differ only in case share a file and shouldn't be
+// used together. A table called "master" gets its first byte escaped to
+// stay clear of master.json.
+func tableFileName(name string) string {
+	var builder strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if i == 0 && name == "master" {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		} else if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	builder.WriteString(".json")
+	return builder.String()
+}
+
+// tableFile returns the file holding name, as recorded in master.json.
+// Manifests written before file names were recorded used name + ".json".
+func tableFile(name string, meta tableMeta) (string, error) {
+	if meta.File == "" {
+		return name + ".json", nil
+	}
+	if filepath.Base(meta.File) != meta.File || meta.File == "." || meta.File == ".." {
+		return "", fmt.Errorf("table %s: invalid file name %q", name, meta.File)
+	}
+	return meta.File, nil
+}
+
+// tableFiles returns the files of name: its table file or shard files and,
+// if it keeps history, its history file.
+func tableFiles(name string, meta tableMeta) ([]string, error) {
+	file, err := tableFile(name, meta)
+	if err != nil {
+		return nil, err
+	}
+	files := shardFiles(file, meta)
+	if meta.History {
+		files = append(files, historyFileName(file))
+	}
+	return files, nil
+}
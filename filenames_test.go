@@ -0,0 +1,86 @@
+package velox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTableFileName(t *testing.T) {
+	names := []string{
+		"orders", "tenant:1/orders", "tenant:1\\orders", "../escape", "..", ".",
+		"master", "mAster", "заказы", "注文", "emoji 📦", "a%2Fb", "a/b",
+	}
+	seen := make(map[string]string)
+	for _, name := range names {
+		file := tableFileName(name)
+		if filepath.Base(file) != file || strings.ContainsAny(file, "/\\:") {
+			t.Errorf("tableFileName(%q) = %q, not a plain file name", name, file)
+		}
+		if file == "master.json" {
+			t.Errorf("tableFileName(%q) clashes with master.json", name)
+		}
+		if other, ok := seen[file]; ok {
+			t.Errorf("tableFileName(%q) = tableFileName(%q) = %q", name, other, file)
+		}
+		seen[file] = name
+	}
+}
+
+func TestSaveLoadUnsafeTableNames(t *testing.T) {
+	folder := t.TempDir()
+	names := []string{"tenant:1/orders", "..\\up", "заказы", "注文/2024", "master"}
+
+	database, err := New(WithFolder(folder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := database.CreateTable(name); err != nil {
+			t.Fatalf("CreateTable(%q): %v", name, err)
+		}
+		table, _ := database.GetTable(name)
+		if _, err := table.CreateRecord(map[string]interface{}{"table": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != blobsFolder {
+			t.Errorf("Save created directory %q", entry.Name())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(folder), "up.json")); err == nil {
+		t.Error("Save wrote outside the database folder")
+	}
+
+	loaded, err := New(WithFolder(folder), WithLoad())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	for _, name := range names {
+		table, err := loaded.GetTable(name)
+		if err != nil {
+			t.Fatalf("GetTable(%q) after Load: %v", name, err)
+		}
+		data, err := table.ReadRecord(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := data.(map[string]interface{})["table"]; got != name {
+			t.Errorf("table %q holds record of %q", name, got)
+		}
+	}
+}
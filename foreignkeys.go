@@ -0,0 +1,373 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var ErrForeignKeyViolation = errors.New("foreign key violation")
+
+type ForeignKeyAction int
+
+const (
+	// RestrictOnDelete refuses to delete a record that is still referenced.
+	RestrictOnDelete ForeignKeyAction = iota
+	// CascadeOnDelete deletes the referencing records along with it.
+	CascadeOnDelete
+)
+
+// foreignKey links field of child to the IDs of parent. parent is nil while
+// the referenced table is not loaded. The links of a database are guarded
+// by its RWMutex, taken after any table locks.
+type foreignKey struct {
+	child      *Table
+	field      string
+	parent     *Table
+	parentName string
+	action     ForeignKeyAction
+
+	// name and inverse name the foreign key as a relation from child and
+	// from parent; see Relation.
+	name    string
+	inverse string
+}
+
+type foreignKeyMeta struct {
+	Table   string `json:"table"`
+	Cascade bool   `json:"cascade,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Inverse string `json:"inverse,omitempty"`
+}
+
+// AddForeignKey makes writes to table fail with ErrForeignKeyViolation when
+// field holds an ID missing from refTable, and blocks deleting records of
+// refTable that are still referenced. A missing or nil field is allowed.
+func (table *Table) AddForeignKey(field string, refTable *Table) error {
+	return table.AddForeignKeyWithAction(field, refTable, RestrictOnDelete)
+}
+
+func (table *Table) AddForeignKeyWithAction(field string, refTable *Table, action ForeignKeyAction) error {
+	return table.addForeignKey("AddForeignKey", field, refTable, action, "", "")
+}
+
+func (table *Table) addForeignKey(op, field string, refTable *Table, action ForeignKeyAction, name, inverse string) error {
+	if field == "" || refTable == nil {
+		return fmt.Errorf("%s: field and referenced table are required", op)
+	}
+	if table.database == nil || table.database != refTable.database {
+		return fmt.Errorf("%s: both tables must belong to the same database", op)
+	}
+	if err := table.administer(op); err != nil {
+		return err
+	}
+
+	defer unlockTables(lockTables([]*Table{table, refTable}))
+
+	var violation error
+	table.records.IterCb(func(key string, val interface{}) {
+		if violation != nil {
+			return
+		}
+		if record, err := table.recordValue("AddForeignKey", val); err == nil {
+			if err := checkReference(field, refTable, record.Data); err != nil {
+				violation = fmt.Errorf("%s: existing record %d: %w", op, record.ID, err)
+			}
+		}
+	})
+	if violation != nil {
+		return violation
+	}
+
+	database := table.database
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	if _, ok := table.foreignKeys[field]; ok {
+		return fmt.Errorf("%s: field %q already has a foreign key", op, field)
+	}
+	if err := checkRelationNames(table, refTable, name, inverse); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if table.foreignKeys == nil {
+		table.foreignKeys = make(map[string]*foreignKey)
+	}
+
+	fk := &foreignKey{child: table, field: field, parent: refTable, parentName: refTable.name, action: action, name: name, inverse: inverse}
+	table.foreignKeys[field] = fk
+	refTable.referencedBy = append(refTable.referencedBy, fk)
+	table.modified()
+	return nil
+}
+
+// checkForeignKeys validates the references in data. Callers hold the
+// table lock.
+func (table *Table) checkForeignKeys(data interface{}) error {
+	if table.database == nil {
+		return nil
+	}
+
+	table.database.RWMutex.RLock()
+	defer table.database.RWMutex.RUnlock()
+
+	for field, fk := range table.foreignKeys {
+		if fk.parent == nil {
+			if _, ok := fieldValue(data, field); ok {
+				return fmt.Errorf("%w: referenced table %s is not loaded", ErrForeignKeyViolation, fk.parentName)
+			}
+			continue
+		}
+		if err := checkReference(field, fk.parent, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkReference(field string, parent *Table, data interface{}) error {
+	value, ok := fieldValue(data, field)
+	if !ok || value == nil {
+		return nil
+	}
+
+	if id, ok := referencedID(value); ok {
+		if _, exists := parent.records.Get(strconv.Itoa(id)); exists {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: field %q value %v has no match in table %s", ErrForeignKeyViolation, field, value, parent.name)
+}
+
+func (table *Table) foreignKeyMeta() map[string]foreignKeyMeta {
+	if table.database == nil || len(table.foreignKeys) == 0 {
+		return nil
+	}
+
+	table.database.RWMutex.RLock()
+	defer table.database.RWMutex.RUnlock()
+
+	meta := make(map[string]foreignKeyMeta, len(table.foreignKeys))
+	for field, fk := range table.foreignKeys {
+		meta[field] = foreignKeyMeta{Table: fk.parentName, Cascade: fk.action == CascadeOnDelete, Name: fk.name, Inverse: fk.inverse}
+	}
+	return meta
+}
+
+// renameForeignKey moves a foreign key to a renamed field. Callers hold
+// the table lock.
+func (table *Table) renameForeignKey(oldName, newName string) {
+	if table.database == nil {
+		return
+	}
+
+	table.database.RWMutex.Lock()
+	defer table.database.RWMutex.Unlock()
+
+	if fk, ok := table.foreignKeys[oldName]; ok {
+		if _, taken := table.foreignKeys[newName]; !taken {
+			delete(table.foreignKeys, oldName)
+			fk.field = newName
+			table.foreignKeys[newName] = fk
+		}
+	}
+}
+
+type plannedDelete struct {
+	table  *Table
+	record Record
+}
+
+// deleteRecord soft-deletes record in soft delete mode and purges it
+// otherwise. Callers hold the locks returned by lockForDelete.
+func (table *Table) deleteRecord(op string, record Record) error {
+	if table.softDelete {
+		return table.softDeleteRecord(op, record)
+	}
+	return table.purgeRecord(op, record, true)
+}
+
+// purgeRecord removes record together with everything that cascades from
+// it, or nothing at all if a restricting reference is found or, when
+// hooked, a BeforeDelete hook refuses. Callers hold the locks returned by
+// lockForDelete.
+func (table *Table) purgeRecord(op string, record Record, hooked bool) error {
+	plan := make([]plannedDelete, 0, 1)
+	if err := table.planDelete(&plan, record, make(map[*Table]map[int]bool)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if hooked {
+		for i := range plan {
+			if err := plan[i].table.runBeforeDelete(op, plan[i].record); err != nil {
+				return err
+			}
+		}
+	}
+
+	entries := make([]walEntry, len(plan))
+	for i := range plan {
+		entries[i] = walEntry{Table: plan[i].table.name, Op: ChangeDelete, ID: plan[i].record.ID}
+	}
+	if err := table.writeAhead(entries...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range plan {
+		plan[i].table.removeRecord(plan[i].record)
+		plan[i].table.changed(ChangeDelete, &plan[i].record, nil)
+	}
+	return nil
+}
+
+func (table *Table) planDelete(plan *[]plannedDelete, record Record, seen map[*Table]map[int]bool) error {
+	if seen[table] == nil {
+		seen[table] = make(map[int]bool)
+	}
+	if seen[table][record.ID] {
+		return nil
+	}
+	seen[table][record.ID] = true
+	*plan = append(*plan, plannedDelete{table: table, record: record})
+
+	for _, fk := range table.references() {
+		var referencing []Record
+		fk.child.records.IterCb(func(key string, val interface{}) {
+			child, err := fk.child.recordValue("DeleteRecord", val)
+			if err != nil {
+				return
+			}
+			if value, ok := fieldValue(child.Data, fk.field); ok && value != nil {
+				if id, ok := referencedID(value); ok && id == record.ID {
+					referencing = append(referencing, child)
+				}
+			}
+		})
+
+		for _, child := range referencing {
+			if fk.action != CascadeOnDelete {
+				return fmt.Errorf("%w: record %d is referenced by record %d of table %s", ErrForeignKeyViolation, record.ID, child.ID, fk.child.name)
+			}
+			if err := fk.child.planDelete(plan, child, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (table *Table) references() []*foreignKey {
+	if table.database == nil {
+		return nil
+	}
+
+	table.database.RWMutex.RLock()
+	defer table.database.RWMutex.RUnlock()
+
+	return append([]*foreignKey(nil), table.referencedBy...)
+}
+
+// lockForDelete write-locks table and every table that references it,
+// directly or through cascades, so a delete can check and remove the
+// referencing records atomically.
+func (table *Table) lockForDelete() []lockedTable {
+	return lockScope(table.deleteScope)
+}
+
+// lockScope locks the tables returned by scope, retrying until the scope
+// is the same after locking as it was before.
+func lockScope(scope func() []*Table) []lockedTable {
+	for {
+		tables := scope()
+		locked := lockTables(tables)
+
+		current := scope()
+		if len(current) == len(tables) {
+			same := true
+			for i := range tables {
+				same = same && tables[i] == current[i]
+			}
+			if same {
+				return locked
+			}
+		}
+		unlockTables(locked)
+	}
+}
+
+func (table *Table) deleteScope() []*Table {
+	scope := []*Table{table}
+	if table.database == nil {
+		return scope
+	}
+
+	table.database.RWMutex.RLock()
+	defer table.database.RWMutex.RUnlock()
+
+	seen := map[*Table]bool{table: true}
+	for i := 0; i < len(scope); i++ {
+		for _, fk := range scope[i].referencedBy {
+			if !seen[fk.child] {
+				seen[fk.child] = true
+				scope = append(scope, fk.child)
+			}
+		}
+	}
+	return scope
+}
+
+type lockedTable struct {
+	table    *Table
+	acquired time.Time
+}
+
+// lockTables write-locks tables in creation order, the order every
+// multi-table operation uses, so two of them can't deadlock.
+func lockTables(tables []*Table) []lockedTable {
+	ordered := make([]*Table, 0, len(tables))
+	seen := make(map[*Table]bool, len(tables))
+	for _, table := range tables {
+		if !seen[table] {
+			seen[table] = true
+			ordered = append(ordered, table)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].seq < ordered[j].seq })
+
+	locked := make([]lockedTable, 0, len(ordered))
+	for _, table := range ordered {
+		locked = append(locked, lockedTable{table: table, acquired: table.lock()})
+	}
+	return locked
+}
+
+func unlockTables(locked []lockedTable) {
+	for i := len(locked) - 1; i >= 0; i-- {
+		locked[i].table.unlock(locked[i].acquired)
+	}
+}
+
+// resolveForeignKeys links foreign keys read from master.json to their
+// referenced tables once those are loaded.
+func (database *Database) resolveForeignKeys() {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.tables.IterCb(func(name string, val interface{}) {
+		table, ok := val.(*Table)
+		if !ok {
+			return
+		}
+		for _, fk := range table.foreignKeys {
+			if fk.parent != nil {
+				continue
+			}
+			if parentVal, ok := database.tables.Get(fk.parentName); ok {
+				if parent, ok := parentVal.(*Table); ok {
+					fk.parent = parent
+					parent.referencedBy = append(parent.referencedBy, fk)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package velox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// canonicalJSON sorts map keys and keeps numbers as written, so a struct
+// and the map it decodes into after a Save/Load round trip hash the same.
+var canonicalJSON = jsoniter.Config{
+	SortMapKeys: true,
+	UseNumber:   true,
+}.Froze()
+
+// EnableContentHash makes the table store a SHA-256 hash of each record's
+// canonical JSON in Record.Hash, which FindByContentHash and CreateIfNew
+// use. Existing records are hashed straight away. The setting is saved
+// in master.json.
+func (table *Table) EnableContentHash() error {
+	if err := table.administer("EnableContentHash"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if table.hashes != nil {
+		return nil
+	}
+
+	hashed := make([]Record, 0, table.records.Count())
+	var failure error
+	table.records.IterCb(func(key string, val interface{}) {
+		if failure != nil {
+			return
+		}
+		record, err := table.recordValue("EnableContentHash", val)
+		if err != nil {
+			return
+		}
+
+		hash, err := contentHash(record.Data)
+		if err != nil {
+			failure = fmt.Errorf("EnableContentHash: record %d: %w", record.ID, err)
+			return
+		}
+		record.Hash = hash
+		hashed = append(hashed, record)
+	})
+	if failure != nil {
+		return failure
+	}
+
+	table.hashes = make(map[string]map[int]struct{})
+	for _, record := range hashed {
+		table.setRecord(nil, record)
+	}
+	table.modified()
+	return nil
+}
+
+func (table *Table) FindByContentHash(h string) ([]RecordInterface, error) {
+	defer table.runlock(table.rlock())
+
+	if table.hashes == nil {
+		return nil, errors.New("FindByContentHash: content hashing is not enabled")
+	}
+
+	results := make([]RecordInterface, 0, len(table.hashes[h]))
+	for id := range table.hashes[h] {
+		if val, ok := table.records.Get(strconv.Itoa(id)); ok {
+			if record, err := table.recordValue("FindByContentHash", val); err == nil && !table.hidden(record) {
+				record = table.readable(record)
+				results = append(results, &record)
+			}
+		}
+	}
+	return results, nil
+}
+
+// CreateIfNew creates a record unless one with the same content hash is
+// already stored. In that case it returns one of the existing records and
+// false.
+func (table *Table) CreateIfNew(record interface{}) (RecordInterface, bool, error) {
+	if err := table.throttle("CreateIfNew"); err != nil {
+		return nil, false, err
+	}
+
+	defer table.unlock(table.lock())
+
+	if table.hashes == nil {
+		return nil, false, errors.New("CreateIfNew: content hashing is not enabled")
+	}
+
+	hash, err := contentHash(record)
+	if err != nil {
+		return nil, false, fmt.Errorf("CreateIfNew: %w", err)
+	}
+
+	for id := range table.hashes[hash] {
+		if val, ok := table.records.Get(strconv.Itoa(id)); ok {
+			if existing, err := table.recordValue("CreateIfNew", val); err == nil && !table.hidden(existing) {
+				return &existing, false, nil
+			}
+		}
+	}
+
+	created, err := table.insertRecord("CreateIfNew", record, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	return created, true, nil
+}
+
+// recordHash returns the content hash for data, or "" when the table
+// doesn't hash its records. Callers hold the table lock.
+func (table *Table) recordHash(data interface{}) (string, error) {
+	if table.hashes == nil {
+		return "", nil
+	}
+	return contentHash(data)
+}
+
+func (table *Table) indexHash(record Record) {
+	if table.hashes == nil || record.Hash == "" {
+		return
+	}
+
+	ids, ok := table.hashes[record.Hash]
+	if !ok {
+		ids = make(map[int]struct{}, 1)
+		table.hashes[record.Hash] = ids
+	}
+	ids[record.ID] = struct{}{}
+}
+
+func (table *Table) unindexHash(record Record) {
+	if table.hashes == nil || record.Hash == "" {
+		return
+	}
+
+	ids := table.hashes[record.Hash]
+	delete(ids, record.ID)
+	if len(ids) == 0 {
+		delete(table.hashes, record.Hash)
+	}
+}
+
+func contentHash(data interface{}) (string, error) {
+	encoded, err := canonicalJSON.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	var generic interface{}
+	if err := canonicalJSON.Unmarshal(encoded, &generic); err != nil {
+		return "", err
+	}
+
+	canonical, err := canonicalJSON.Marshal(generic)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
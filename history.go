@@ -0,0 +1,239 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// HistoryEntry is one change to a record, as kept by EnableHistory.
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+	Op   ChangeOp  `json:"op"`
+	// Actor is who made the change, as given to WithActor, or empty.
+	Actor string `json:"actor,omitempty"`
+	// Version is the record's version after the change, or before it for
+	// deletes.
+	Version int `json:"version"`
+	// Fields lists the top-level fields an update changed.
+	Fields []string `json:"fields,omitempty"`
+	// Before and After are the record data before and after the change,
+	// nil for the side that has none. After a Load they hold generic JSON
+	// values rather than the types written.
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a context that attributes the changes made with it to
+// actor in record histories. It applies to CreateRecordCtx,
+// UpdateRecordCtx, DeleteRecordCtx and Tx.CommitCtx.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set with WithActor, or "".
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// EnableHistory keeps a history of every later change to the table's
+// records: when it happened, who made it, and the data before and after.
+// Save writes the history to a file next to the table file, and Load reads
+// it back. Changes replayed from the write-ahead log after a crash are not
+// in the history. Enabling it again does nothing.
+func (table *Table) EnableHistory() error {
+	if err := table.administer("EnableHistory"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if table.history == nil {
+		table.history = make(map[int][]HistoryEntry)
+		table.modified()
+	}
+	return nil
+}
+
+// DisableHistory stops keeping history and discards the history kept so
+// far.
+func (table *Table) DisableHistory() error {
+	if err := table.administer("DisableHistory"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if table.history == nil {
+		return errors.New("DisableHistory: history not enabled")
+	}
+
+	table.history = nil
+	table.modified()
+	return nil
+}
+
+// History returns the changes made to record id since history was
+// enabled, oldest first. Deleted records keep their history.
+func (table *Table) History(id int) ([]HistoryEntry, error) {
+	defer table.runlock(table.rlock())
+
+	if table.history == nil {
+		return nil, errors.New("History: history not enabled")
+	}
+
+	entries, ok := table.history[id]
+	if !ok {
+		if _, ok := table.records.Get(strconv.Itoa(id)); !ok {
+			return nil, table.notFound("History", id)
+		}
+	}
+	entries = append([]HistoryEntry{}, entries...)
+	if table.copyOnRead.Load() {
+		for i := range entries {
+			entries[i].Before = copyData(entries[i].Before)
+			entries[i].After = copyData(entries[i].After)
+		}
+	}
+	return entries, nil
+}
+
+// addHistory appends a change to the history of its record. Callers hold
+// the write lock.
+func (table *Table) addHistory(op ChangeOp, before, after *Record) {
+	entry := HistoryEntry{Time: table.now(), Op: op, Actor: table.actor}
+
+	var id int
+	if before != nil {
+		id = before.ID
+		entry.Version = before.Version
+		entry.Before = before.Data
+	}
+	if after != nil {
+		id = after.ID
+		entry.Version = after.Version
+		entry.After = after.Data
+	}
+	if before != nil && after != nil {
+		entry.Fields = changedFields(before.Data, after.Data)
+	}
+
+	table.history[id] = append(table.history[id], entry)
+}
+
+// changedFields returns the sorted top-level fields whose values differ
+// between two versions of record data. Data that isn't an object has no
+// fields to list.
+func changedFields(before, after interface{}) []string {
+	was, err := genericValue(before)
+	if err != nil {
+		return nil
+	}
+	is, err := genericValue(after)
+	if err != nil {
+		return nil
+	}
+	oldFields, ok := was.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	newFields, ok := is.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	fields := make([]string, 0)
+	for field, value := range oldFields {
+		if other, ok := newFields[field]; !ok || !reflect.DeepEqual(value, other) {
+			fields = append(fields, field)
+		}
+	}
+	for field := range newFields {
+		if _, ok := oldFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// actAs attributes the changes made to the locked tables to the actor of
+// ctx until the returned function is called. Callers hold the write locks.
+func actAs(ctx context.Context, locked []lockedTable) func() {
+	actor := ActorFrom(ctx)
+	if actor == "" {
+		return func() {}
+	}
+
+	for _, lt := range locked {
+		lt.table.actor = actor
+	}
+	return func() {
+		for _, lt := range locked {
+			lt.table.actor = ""
+		}
+	}
+}
+
+func (table *Table) actAs(ctx context.Context) func() {
+	return actAs(ctx, []lockedTable{{table: table}})
+}
+
+// historyFileName returns the file holding the history of the table stored
+// in file.
+func historyFileName(file string) string {
+	return strings.TrimSuffix(file, ".json") + ".history.json"
+}
+
+// encodeHistory encodes the table's history in the table file format, so
+// it is checked, compressed and encrypted as the table is. Unless until is
+// zero, changes made after it are left out.
+func (table *Table) encodeHistory(compression Compression, keys KeyProvider, until time.Time) ([]byte, error) {
+	body, err := func() ([]byte, error) {
+		defer table.runlock(table.rlock())
+
+		history := table.history
+		if !until.IsZero() {
+			history = make(map[int][]HistoryEntry, len(table.history))
+			for id, entries := range table.history {
+				n := sort.Search(len(entries), func(i int) bool { return entries[i].Time.After(until) })
+				if n > 0 {
+					history[id] = entries[:n]
+				}
+			}
+		}
+		return jsoniter.Marshal(history)
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return encodeTableFile(body, JSONCodec, compression, keys, 0, 1)
+}
+
+func loadHistory(storage Storage, file string, keys KeyProvider) (map[int][]HistoryEntry, error) {
+	file = historyFileName(file)
+	data, err := storage.ReadTable(file)
+	if err != nil {
+		return nil, err
+	}
+
+	body, _, _, err := openTableFile(data, keys)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	history := make(map[int][]HistoryEntry)
+	if err := jsoniter.Unmarshal(body, &history); err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", file, ErrCorrupted, err)
+	}
+	return history, nil
+}
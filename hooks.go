@@ -0,0 +1,162 @@
+package velox
+
+import "fmt"
+
+// Hooks run inside writes, while the table's write lock is held, so they
+// must not call back into the table. Before hooks run in the order they
+// were added, each seeing the data returned by the one before; an error
+// from any of them refuses the write, which fails with that error wrapped.
+// After hooks run once the change is committed, which for a Tx is after
+// every operation has been applied. Loading and replaying the write-ahead
+// log run no hooks.
+type hooks struct {
+	beforeCreate []func(data interface{}) (interface{}, error)
+	beforeUpdate []func(current RecordInterface, data interface{}) (interface{}, error)
+	beforeDelete []func(record RecordInterface) error
+
+	afterCreate []func(record RecordInterface)
+	afterUpdate []func(before, after RecordInterface)
+	afterDelete []func(record RecordInterface)
+}
+
+// BeforeCreate adds a hook that runs before each record is created. It
+// returns the data to store, which can be data itself, changed, or
+// something else entirely, or an error to refuse the create.
+func (table *Table) BeforeCreate(fn func(data interface{}) (interface{}, error)) error {
+	if err := table.administer("BeforeCreate"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.hooks.beforeCreate = append(table.hooks.beforeCreate, fn)
+	return nil
+}
+
+// BeforeUpdate adds a hook that runs before each update with the record as
+// it is and the new data. It returns the data to store or an error to
+// refuse the update.
+func (table *Table) BeforeUpdate(fn func(current RecordInterface, data interface{}) (interface{}, error)) error {
+	if err := table.administer("BeforeUpdate"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.hooks.beforeUpdate = append(table.hooks.beforeUpdate, fn)
+	return nil
+}
+
+// BeforeDelete adds a hook that runs before each record is deleted,
+// including records a delete cascades to, and can refuse the delete by
+// returning an error. Records removed by ExpireRecords and PurgeDeleted
+// are already gone from reads, so it doesn't run for them.
+func (table *Table) BeforeDelete(fn func(record RecordInterface) error) error {
+	if err := table.administer("BeforeDelete"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.hooks.beforeDelete = append(table.hooks.beforeDelete, fn)
+	return nil
+}
+
+func (table *Table) AfterCreate(fn func(record RecordInterface)) error {
+	if err := table.administer("AfterCreate"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.hooks.afterCreate = append(table.hooks.afterCreate, fn)
+	return nil
+}
+
+func (table *Table) AfterUpdate(fn func(before, after RecordInterface)) error {
+	if err := table.administer("AfterUpdate"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.hooks.afterUpdate = append(table.hooks.afterUpdate, fn)
+	return nil
+}
+
+// AfterDelete adds a hook that runs after each record is deleted, soft
+// deletes and expiry included.
+func (table *Table) AfterDelete(fn func(record RecordInterface)) error {
+	if err := table.administer("AfterDelete"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.hooks.afterDelete = append(table.hooks.afterDelete, fn)
+	return nil
+}
+
+func (h hooks) clone() hooks {
+	return hooks{
+		beforeCreate: append(h.beforeCreate[:0:0], h.beforeCreate...),
+		beforeUpdate: append(h.beforeUpdate[:0:0], h.beforeUpdate...),
+		beforeDelete: append(h.beforeDelete[:0:0], h.beforeDelete...),
+		afterCreate:  append(h.afterCreate[:0:0], h.afterCreate...),
+		afterUpdate:  append(h.afterUpdate[:0:0], h.afterUpdate...),
+		afterDelete:  append(h.afterDelete[:0:0], h.afterDelete...),
+	}
+}
+
+func (table *Table) runBeforeCreate(op string, data interface{}) (interface{}, error) {
+	for _, fn := range table.hooks.beforeCreate {
+		var err error
+		if data, err = fn(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return data, nil
+}
+
+func (table *Table) runBeforeUpdate(op string, current Record, data interface{}) (interface{}, error) {
+	for _, fn := range table.hooks.beforeUpdate {
+		record := current
+		var err error
+		if data, err = fn(&record, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return data, nil
+}
+
+func (table *Table) runBeforeDelete(op string, record Record) error {
+	for _, fn := range table.hooks.beforeDelete {
+		record := record
+		if err := fn(&record); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// runAfterHooks runs the after hooks for a committed change. Callers hold
+// the write lock.
+func (table *Table) runAfterHooks(op ChangeOp, before, after *Record) {
+	switch op {
+	case ChangeCreate:
+		for _, fn := range table.hooks.afterCreate {
+			record := *after
+			fn(&record)
+		}
+	case ChangeUpdate:
+		for _, fn := range table.hooks.afterUpdate {
+			previous, record := *before, *after
+			fn(&previous, &record)
+		}
+	case ChangeDelete, ChangeSoftDelete:
+		for _, fn := range table.hooks.afterDelete {
+			record := *before
+			fn(&record)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package velox
+
+import (
+	"errors"
+	"strconv"
+)
+
+// NextID returns the ID the next CreateRecord will use, without using it.
+func (table *Table) NextID() int {
+	defer table.runlock(table.rlock())
+
+	return table.nextID
+}
+
+// ReserveIDs reserves n consecutive IDs starting at the returned ID.
+// CreateRecord never hands them out, so the caller can assign them with
+// CreateRecordWithID, for example to link records before inserting them.
+// An n below one reserves nothing.
+func (table *Table) ReserveIDs(n int) (int, error) {
+	if err := table.administer("ReserveIDs"); err != nil {
+		return 0, err
+	}
+
+	return table.reserveIDs(n), nil
+}
+
+func (table *Table) reserveIDs(n int) int {
+	defer table.unlock(table.lock())
+
+	start := table.nextID
+	if n > 0 {
+		table.nextID += n
+	}
+	return start
+}
+
+// CreateRecordWithID creates a record under a caller-chosen ID, such as
+// one from ReserveIDs. It fails if the ID is already used.
+func (table *Table) CreateRecordWithID(id int, record interface{}) (RecordInterface, error) {
+	if id < 1 {
+		return nil, errors.New("CreateRecordWithID: invalid id")
+	}
+
+	if err := table.throttle("CreateRecordWithID"); err != nil {
+		return nil, err
+	}
+
+	defer table.unlock(table.lock())
+
+	if _, ok := table.records.Get(strconv.Itoa(id)); ok {
+		return nil, &RecordError{Op: "CreateRecordWithID", Table: table.tableName(), ID: id, Err: ErrRecordExists}
+	}
+
+	return table.insertRecordAt("CreateRecordWithID", id, record, nil)
+}
+
+// UpsertRecord updates the record with the given ID, or creates it under
+// that ID if there is none, and reports whether it created one. Creating
+// moves NextID past id, as CreateRecordWithID does. A record that has
+// expired or been soft-deleted but not yet been removed is replaced as if
+// it were gone.
+func (table *Table) UpsertRecord(id int, record interface{}) (bool, error) {
+	if id < 1 {
+		return false, errors.New("UpsertRecord: invalid id")
+	}
+
+	if err := table.throttle("UpsertRecord"); err != nil {
+		return false, err
+	}
+
+	defer table.unlock(table.lock())
+
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		_, err := table.insertRecordAt("UpsertRecord", id, record, nil)
+		return err == nil, err
+	}
+
+	existing, err := table.recordValue("UpsertRecord", val)
+	if err != nil {
+		return false, err
+	}
+	if !table.hidden(existing) {
+		return false, table.replaceData("UpsertRecord", existing, record)
+	}
+
+	existing.ExpiresAt = nil
+	existing.DeletedAt = nil
+	existing.Meta = nil
+	existing.CreatedAt = table.now()
+	if err := table.replaceData("UpsertRecord", existing, record); err != nil {
+		return false, err
+	}
+	table.removeBlobs(id)
+	return true, nil
+}
@@ -0,0 +1,74 @@
+package velox
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestReserveIDsDontCollide(t *testing.T) {
+	_, table := newTestTable(t, "items")
+
+	next := table.NextID()
+	if table.NextID() != next {
+		t.Fatal("NextID consumed an ID")
+	}
+
+	const blocks, blockSize, autos = 20, 10, 200
+	reserved := make(chan int, blocks)
+	auto := make(chan int, autos)
+	var wg sync.WaitGroup
+	for i := 0; i < blocks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start, err := table.ReserveIDs(blockSize)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			reserved <- start
+		}()
+	}
+	for i := 0; i < autos; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record, err := table.CreateRecord(map[string]interface{}{"auto": true})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			auto <- record.GetID()
+		}()
+	}
+	wg.Wait()
+	close(reserved)
+	close(auto)
+
+	owner := make(map[int]string)
+	for id := range auto {
+		owner[id] = "auto"
+	}
+	for start := range reserved {
+		for id := start; id < start+blockSize; id++ {
+			if other, ok := owner[id]; ok {
+				t.Fatalf("reserved ID %d was also handed out as %s", id, other)
+			}
+			owner[id] = "reserved"
+			if _, err := table.CreateRecordWithID(id, map[string]interface{}{"reserved": true}); err != nil {
+				t.Fatalf("CreateRecordWithID(%d): %v", id, err)
+			}
+		}
+	}
+
+	record, err := table.CreateRecord(map[string]interface{}{"auto": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := owner[record.GetID()]; ok {
+		t.Fatalf("CreateRecord reused ID %d", record.GetID())
+	}
+	if n := table.Count(); n != blocks*blockSize+autos+1 {
+		t.Fatalf("Count() = %d, want %d", n, blocks*blockSize+autos+1)
+	}
+}
@@ -0,0 +1,68 @@
+package velox
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Increment atomically adds delta to a numeric field of a record and
+// returns the new value. A missing field is set to delta. Integer fields
+// keep their type, so a fractional result for them is an error.
+func (table *Table) Increment(id int, field string, delta float64) (float64, error) {
+	if err := table.throttle("Increment"); err != nil {
+		return 0, err
+	}
+
+	defer table.unlock(table.lock())
+
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return 0, table.notFound("Increment", id)
+	}
+
+	record, err := table.recordValue("Increment", val)
+	if err != nil {
+		return 0, err
+	}
+	if table.hidden(record) {
+		return 0, table.notFound("Increment", id)
+	}
+
+	var result interface{} = delta
+	total := delta
+	if current, ok := fieldValue(record.Data, field); ok && current != nil {
+		number := reflect.ValueOf(current)
+		switch {
+		case number.CanInt():
+			total += float64(number.Int())
+			result = reflect.ValueOf(total).Convert(number.Type()).Interface()
+		case number.CanUint():
+			total += float64(number.Uint())
+			if total < 0 {
+				return 0, fmt.Errorf("Increment: field %q is unsigned but the result %v is negative", field, total)
+			}
+			result = reflect.ValueOf(total).Convert(number.Type()).Interface()
+		case number.CanFloat():
+			total += number.Float()
+			result = reflect.ValueOf(total).Convert(number.Type()).Interface()
+		default:
+			return 0, fmt.Errorf("Increment: field %q is %T, not a number", field, current)
+		}
+		if number.CanInt() || number.CanUint() {
+			if total != float64(int64(total)) {
+				return 0, fmt.Errorf("Increment: field %q is an integer but the result %v is not", field, total)
+			}
+		}
+	}
+
+	data, err := withField(record.Data, field, result)
+	if err != nil {
+		return 0, fmt.Errorf("Increment: %w", err)
+	}
+
+	if err := table.replaceData("Increment", record, data); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
@@ -0,0 +1,321 @@
+package velox
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// fieldIndex maps the canonical JSON of a field value to the IDs of the
+// records holding it, so 5 and 5.0 find the same records before and after
+// a Save/Load round trip.
+type fieldIndex map[string]map[int]struct{}
+
+// CreateIndex indexes field so FindByIndex can look records up by its
+// value. Existing records are indexed straight away and every later write
+// keeps the index up to date. The index is saved in master.json.
+func (table *Table) CreateIndex(field string) error {
+	if field == "" {
+		return errors.New("CreateIndex: invalid field name")
+	}
+
+	if err := table.administer("CreateIndex"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if _, ok := table.indexes[field]; ok {
+		return errors.New("CreateIndex: index already exists")
+	}
+
+	table.buildIndex(field)
+	table.modified()
+	return nil
+}
+
+func (table *Table) DropIndex(field string) error {
+	if err := table.administer("DropIndex"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if _, ok := table.indexes[field]; !ok {
+		return errors.New("DropIndex: index not found")
+	}
+
+	delete(table.indexes, field)
+	table.modified()
+	return nil
+}
+
+// FindByIndex returns the records whose field equals value, ordered by ID.
+func (table *Table) FindByIndex(field string, value interface{}) ([]RecordInterface, error) {
+	defer table.runlock(table.rlock())
+
+	index, ok := table.indexes[field]
+	if !ok {
+		return nil, errors.New("FindByIndex: index not found")
+	}
+	if table.indexingSuspended {
+		return nil, errors.New("FindByIndex: indexing is suspended")
+	}
+
+	key, ok := indexKey(value)
+	if !ok {
+		return nil, errors.New("FindByIndex: value cannot be indexed")
+	}
+
+	ids := make([]int, 0, len(index[key]))
+	for id := range index[key] {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	results := make([]RecordInterface, 0, len(ids))
+	for _, id := range ids {
+		if val, ok := table.records.Get(strconv.Itoa(id)); ok {
+			if record, err := table.recordValue("FindByIndex", val); err == nil && !table.hidden(record) {
+				record = table.readable(record)
+				results = append(results, &record)
+			}
+		}
+	}
+	return results, nil
+}
+
+// FindOneByIndex returns the record whose field equals value, using the
+// unique constraint or index on field. If several records match, it
+// returns the one with the lowest ID. It reports false if none does, or if
+// field has neither. Unlike FindByIndex it doesn't build a slice, which
+// makes it the cheaper lookup for unique fields.
+func (table *Table) FindOneByIndex(field string, value interface{}) (RecordInterface, bool) {
+	defer table.runlock(table.rlock())
+
+	index, ok := table.uniques[field]
+	if !ok {
+		if index, ok = table.indexes[field]; !ok || table.indexingSuspended {
+			return nil, false
+		}
+	}
+
+	key, ok := indexKey(value)
+	if !ok {
+		return nil, false
+	}
+
+	var found Record
+	for id := range index[key] {
+		if found.ID != 0 && id > found.ID {
+			continue
+		}
+		if val, ok := table.records.Get(strconv.Itoa(id)); ok {
+			if record, err := table.recordValue("FindOneByIndex", val); err == nil && !table.hidden(record) {
+				found = record
+			}
+		}
+	}
+	if found.ID == 0 {
+		return nil, false
+	}
+	found = table.readable(found)
+	return &found, true
+}
+
+// SuspendIndexing stops writes from updating the field indexes and the
+// text index, which makes bulk loads into indexed tables faster.
+// ResumeIndexing rebuilds them once the load is done. Unique constraints
+// are still enforced and kept up to date. Until then FindByIndex and
+// Search fail, and FindOneByIndex only uses unique constraints.
+func (table *Table) SuspendIndexing() error {
+	if err := table.administer("SuspendIndexing"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.indexingSuspended = true
+	return nil
+}
+
+// ResumeIndexing rebuilds the indexes from the current records, however
+// they were created, updated or deleted while indexing was suspended, and
+// keeps them up to date again.
+func (table *Table) ResumeIndexing() error {
+	if err := table.administer("ResumeIndexing"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if !table.indexingSuspended {
+		return nil
+	}
+	table.indexingSuspended = false
+	table.rebuildIndexes()
+	if table.text != nil {
+		table.buildTextIndex(table.textFields())
+	}
+	return nil
+}
+
+// rebuildIndexes rebuilds every field index from the current records,
+// indexing the shards of the record map in parallel and then merging
+// their indexes. Callers hold the write lock.
+func (table *Table) rebuildIndexes() {
+	fields := fieldNames(table.indexes)
+	if len(fields) == 0 {
+		return
+	}
+
+	shards := *table.records
+	parts := make([][]fieldIndex, len(shards))
+	parallel(len(shards), func(i int) error {
+		shard := shards[i]
+		shard.RLock()
+		defer shard.RUnlock()
+
+		parts[i] = make([]fieldIndex, len(fields))
+		for j, field := range fields {
+			index := make(fieldIndex)
+			for _, val := range shard.items {
+				if record, err := table.recordValue("Table_ResumeIndexing", val); err == nil {
+					index.add(table, field, record)
+				}
+			}
+			parts[i][j] = index
+		}
+		return nil
+	})
+
+	for j, field := range fields {
+		size := 0
+		for _, part := range parts {
+			size += len(part[j])
+		}
+		index := make(fieldIndex, size)
+		for _, part := range parts {
+			for key, ids := range part[j] {
+				merged, ok := index[key]
+				if !ok {
+					index[key] = ids
+					continue
+				}
+				for id := range ids {
+					merged[id] = struct{}{}
+				}
+			}
+		}
+		table.indexes[field] = index
+	}
+}
+
+// buildIndex replaces the index on field with one built from the current
+// records. Callers hold the write lock.
+func (table *Table) buildIndex(field string) {
+	if table.indexes == nil {
+		table.indexes = make(map[string]fieldIndex)
+	}
+
+	table.indexes[field] = table.indexRecords(field)
+}
+
+// indexRecords returns an index on field of the current records. Callers
+// hold the write lock.
+func (table *Table) indexRecords(field string) fieldIndex {
+	index := make(fieldIndex)
+	table.records.IterCb(func(key string, val interface{}) {
+		if record, err := table.recordValue("Table_BuildIndex", val); err == nil {
+			index.add(table, field, record)
+		}
+	})
+	return index
+}
+
+// fieldNames returns the sorted fields of indexes.
+func fieldNames(indexes map[string]fieldIndex) []string {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	fields := make([]string, 0, len(indexes))
+	for field := range indexes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (table *Table) indexFields(record Record) {
+	for field, index := range table.uniques {
+		index.add(table, field, record)
+	}
+	if table.indexingSuspended {
+		return
+	}
+	for field, index := range table.indexes {
+		index.add(table, field, record)
+	}
+	if table.text != nil {
+		table.text.add(record)
+	}
+}
+
+func (table *Table) unindexFields(record Record) {
+	for field, index := range table.uniques {
+		index.remove(table, field, record)
+	}
+	if table.indexingSuspended {
+		return
+	}
+	for field, index := range table.indexes {
+		index.remove(table, field, record)
+	}
+	if table.text != nil {
+		table.text.remove(record)
+	}
+}
+
+func (index fieldIndex) add(table *Table, field string, record Record) {
+	value, ok := table.fieldOf(record.Data, field)
+	if !ok {
+		return
+	}
+	key, ok := indexKey(value)
+	if !ok {
+		return
+	}
+
+	ids, ok := index[key]
+	if !ok {
+		ids = make(map[int]struct{}, 1)
+		index[key] = ids
+	}
+	ids[record.ID] = struct{}{}
+}
+
+func (index fieldIndex) remove(table *Table, field string, record Record) {
+	value, ok := table.fieldOf(record.Data, field)
+	if !ok {
+		return
+	}
+	key, ok := indexKey(value)
+	if !ok {
+		return
+	}
+
+	ids := index[key]
+	delete(ids, record.ID)
+	if len(ids) == 0 {
+		delete(index, key)
+	}
+}
+
+func indexKey(value interface{}) (string, bool) {
+	encoded, err := canonicalJSON.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(encoded), true
+}
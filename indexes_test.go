@@ -0,0 +1,178 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFindOneByIndex(t *testing.T) {
+	_, table := newTestTable(t, "users")
+	for _, email := range []string{"ann@example.com", "bob@example.com", "ann@example.com"} {
+		if _, err := table.CreateRecord(map[string]interface{}{"email": email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok := table.FindOneByIndex("email", "ann@example.com"); ok {
+		t.Fatal("FindOneByIndex found a record without an index")
+	}
+	if err := table.CreateIndex("email"); err != nil {
+		t.Fatal(err)
+	}
+	record, ok := table.FindOneByIndex("email", "ann@example.com")
+	if !ok || record.GetID() != 1 {
+		t.Fatalf("FindOneByIndex = %v, %v, want record 1", record, ok)
+	}
+	if err := table.DeleteRecord(1); err != nil {
+		t.Fatal(err)
+	}
+	if record, ok = table.FindOneByIndex("email", "ann@example.com"); !ok || record.GetID() != 3 {
+		t.Fatalf("FindOneByIndex after delete = %v, %v, want record 3", record, ok)
+	}
+	if _, ok := table.FindOneByIndex("email", "eve@example.com"); ok {
+		t.Fatal("FindOneByIndex found a missing value")
+	}
+
+	if err := table.DropIndex("email"); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.DeleteRecord(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.AddUniqueConstraint("email"); err != nil {
+		t.Fatal(err)
+	}
+	if record, ok = table.FindOneByIndex("email", "bob@example.com"); !ok || record.GetID() != 2 {
+		t.Fatalf("FindOneByIndex on unique field = %v, %v, want record 2", record, ok)
+	}
+}
+
+func benchmarkIndexLookup(b *testing.B, lookup func(table *Table, email string) bool) {
+	_, table := newTestTable(b, "users")
+	if err := table.AddUniqueConstraint("email"); err != nil {
+		b.Fatal(err)
+	}
+	if err := table.CreateIndex("email"); err != nil {
+		b.Fatal(err)
+	}
+	const users = 10000
+	for i := 0; i < users; i++ {
+		if _, err := table.CreateRecord(map[string]interface{}{"email": fmt.Sprintf("user%d@example.com", i)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !lookup(table, "user4242@example.com") {
+			b.Fatal("user not found")
+		}
+	}
+}
+
+func BenchmarkFindByIndex(b *testing.B) {
+	benchmarkIndexLookup(b, func(table *Table, email string) bool {
+		records, err := table.FindByIndex("email", email)
+		return err == nil && len(records) == 1
+	})
+}
+
+func BenchmarkFindOneByIndex(b *testing.B) {
+	benchmarkIndexLookup(b, func(table *Table, email string) bool {
+		_, ok := table.FindOneByIndex("email", email)
+		return ok
+	})
+}
+
+func TestSuspendIndexing(t *testing.T) {
+	_, table := newTestTable(t, "users")
+	if err := table.CreateIndex("city"); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.AddUniqueConstraint("email"); err != nil {
+		t.Fatal(err)
+	}
+
+	table.SuspendIndexing()
+	for i := 0; i < 100; i++ {
+		data := map[string]interface{}{"email": fmt.Sprintf("user%d@example.com", i), "city": fmt.Sprint("city", i%7)}
+		if _, err := table.CreateRecord(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := 1; id <= 100; id += 3 {
+		data := map[string]interface{}{"email": fmt.Sprintf("user%d@example.com", id-1), "city": "moved"}
+		if err := table.UpdateRecord(id, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := 2; id <= 100; id += 5 {
+		if err := table.DeleteRecord(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := table.FindByIndex("city", "moved"); err == nil {
+		t.Fatal("FindByIndex succeeded while indexing was suspended")
+	}
+	_, err := table.CreateRecord(map[string]interface{}{"email": "user0@example.com"})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("unique constraint not enforced while suspended: %v", err)
+	}
+
+	table.ResumeIndexing()
+	if want := table.indexRecords("city"); !reflect.DeepEqual(table.indexes["city"], want) {
+		t.Fatal("index after ResumeIndexing differs from a rebuilt one")
+	}
+	moved, err := table.FindByIndex("city", "moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 27 {
+		t.Fatalf("FindByIndex found %d moved records, want 27", len(moved))
+	}
+
+	if _, err := table.CreateRecord(map[string]interface{}{"email": "new@example.com", "city": "moved"}); err != nil {
+		t.Fatal(err)
+	}
+	if moved, _ = table.FindByIndex("city", "moved"); len(moved) != 28 {
+		t.Fatal("index not maintained after ResumeIndexing")
+	}
+}
+
+// BenchmarkIndexedImport loads a million records into a table with two
+// indexes, keeping them up to date on every insert or rebuilding them once.
+func BenchmarkIndexedImport(b *testing.B) {
+	const records = 1000000
+	for _, suspend := range []bool{false, true} {
+		b.Run(fmt.Sprintf("suspend=%v", suspend), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				_, table := newTestTable(b, "import")
+				if err := table.CreateIndex("group"); err != nil {
+					b.Fatal(err)
+				}
+				if err := table.CreateIndex("n"); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				if suspend {
+					table.SuspendIndexing()
+				}
+				for j := 0; j < records; j++ {
+					if _, err := table.CreateRecord(map[string]interface{}{"group": j % 100, "n": j}); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if suspend {
+					table.ResumeIndexing()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// JoinOn says how Join matches records: a left record joins the right
+// records whose RightField equals its LeftField. An empty RightField
+// matches the right records by ID, which is how foreign keys refer to
+// records.
+type JoinOn struct {
+	LeftField  string
+	RightField string
+	// Outer keeps left records without a match, with a nil Right, as a
+	// left outer join does.
+	Outer bool
+}
+
+// JoinResult is one left record and one right record it matched.
+type JoinResult struct {
+	Left  RecordInterface
+	Right RecordInterface
+}
+
+// Join matches every record of the left table with the records of the
+// right table as on describes. Results are ordered by left ID, then right
+// ID. Right records are looked up by ID, or found with a single read of the
+// right table, rather than with a query per left record.
+func (database *Database) Join(left, right string, on JoinOn) ([]JoinResult, error) {
+	return database.JoinCtx(context.Background(), left, right, on)
+}
+
+// JoinCtx is Join that stops scanning once ctx is done.
+func (database *Database) JoinCtx(ctx context.Context, left, right string, on JoinOn) ([]JoinResult, error) {
+	table, err := database.table(left)
+	if err != nil {
+		return nil, fmt.Errorf("Join: %w", err)
+	}
+	return table.Select().RunJoinCtx(ctx, right, on)
+}
+
+// RunJoin runs the query and joins its results with the records of the
+// right table, as Database.Join does. The order and limit of the query
+// apply to the left records.
+func (query *QueryBuilder) RunJoin(right string, on JoinOn) ([]JoinResult, error) {
+	return query.RunJoinCtx(context.Background(), right, on)
+}
+
+func (query *QueryBuilder) RunJoinCtx(ctx context.Context, right string, on JoinOn) ([]JoinResult, error) {
+	if on.LeftField == "" {
+		return nil, errors.New("Join: left field is required")
+	}
+	if query.table.database == nil {
+		return nil, errors.New("Join: table does not belong to a database")
+	}
+	rightTable, err := query.table.database.table(right)
+	if err != nil {
+		return nil, fmt.Errorf("Join: %w", err)
+	}
+
+	lefts, err := query.RunCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var match func(value interface{}) []*Record
+	if on.RightField == "" {
+		match = rightTable.joinByID()
+	} else if match, err = rightTable.joinByField(ctx, on.RightField); err != nil {
+		return nil, err
+	}
+
+	results := make([]JoinResult, 0, len(lefts))
+	for _, left := range lefts {
+		var matched []*Record
+		if value, ok := query.table.fieldOf(left.GetData(), on.LeftField); ok && value != nil {
+			matched = match(value)
+		}
+
+		for _, record := range matched {
+			if rightTable.copyOnRead.Load() {
+				copied := rightTable.readable(*record)
+				record = &copied
+			}
+			results = append(results, JoinResult{Left: left, Right: record})
+		}
+		if len(matched) == 0 && on.Outer {
+			results = append(results, JoinResult{Left: left})
+		}
+	}
+	return results, nil
+}
+
+// joinByID returns a function finding the live record a value refers to.
+func (table *Table) joinByID() func(value interface{}) []*Record {
+	return func(value interface{}) []*Record {
+		id, ok := referencedID(value)
+		if !ok {
+			return nil
+		}
+		record, err := table.liveRecord("Join", id)
+		if err != nil {
+			return nil
+		}
+		return []*Record{&record}
+	}
+}
+
+// joinByField reads the table once and returns a function finding the
+// records whose field holds a value, ordered by ID.
+func (table *Table) joinByField(ctx context.Context, field string) (func(value interface{}) []*Record, error) {
+	byValue := make(map[string][]*Record)
+	var failure error
+
+	func() {
+		defer table.runlock(table.rlock())
+
+		scanned := 0
+		table.records.IterCb(func(k string, val interface{}) {
+			if failure != nil {
+				return
+			}
+			if scanned++; scanned%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					failure = fmt.Errorf("Join: %w", err)
+					return
+				}
+			}
+			record, err := table.recordValue("Join", val)
+			if err != nil || table.hidden(record) {
+				return
+			}
+			if value, ok := table.fieldOf(record.Data, field); ok && value != nil {
+				if key, ok := indexKey(value); ok {
+					byValue[key] = append(byValue[key], &record)
+				}
+			}
+		})
+	}()
+	if failure != nil {
+		return nil, failure
+	}
+
+	for _, records := range byValue {
+		sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	}
+	return func(value interface{}) []*Record {
+		key, ok := indexKey(value)
+		if !ok {
+			return nil
+		}
+		return byValue[key]
+	}, nil
+}
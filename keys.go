@@ -0,0 +1,175 @@
+package velox
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// KeyStrategy decides how records of a table are addressed besides their
+// ID. Records always get an ID; tables with string keys also map a unique
+// Record.Key to it.
+type KeyStrategy int
+
+const (
+	// KeyAutoIncrement addresses records by ID only.
+	KeyAutoIncrement KeyStrategy = iota
+	// KeyUUID gives every record a random UUIDv4 key unless
+	// CreateRecordWithKey supplies one.
+	KeyUUID
+	// KeyString requires every record to be created with
+	// CreateRecordWithKey.
+	KeyString
+)
+
+var keyStrategyNames = map[KeyStrategy]string{
+	KeyUUID:   "uuid",
+	KeyString: "string",
+}
+
+// parseKeyStrategy reads the strategy name saved in master.json.
+func parseKeyStrategy(name string) (KeyStrategy, error) {
+	if name == "" {
+		return KeyAutoIncrement, nil
+	}
+	for strategy, strategyName := range keyStrategyNames {
+		if strategyName == name {
+			return strategy, nil
+		}
+	}
+	return KeyAutoIncrement, fmt.Errorf("unknown key strategy %q", name)
+}
+
+// CreateRecordWithKey creates a record under a caller-chosen key. The table
+// must use KeyUUID or KeyString, and the key must not be used yet.
+func (table *Table) CreateRecordWithKey(key string, record interface{}) (RecordInterface, error) {
+	if key == "" {
+		return nil, errors.New("CreateRecordWithKey: invalid key")
+	}
+
+	if err := table.throttle("CreateRecordWithKey"); err != nil {
+		return nil, err
+	}
+
+	defer table.unlock(table.lock())
+
+	if table.keys == nil {
+		return nil, errors.New("CreateRecordWithKey: table does not use string keys")
+	}
+
+	return table.insert("CreateRecordWithKey", Record{ID: table.nextID, Key: key, Data: record})
+}
+
+func (table *Table) GetRecordByKey(key string) (RecordInterface, error) {
+	defer table.runlock(table.rlock())
+
+	record, err := table.keyedRecord("GetRecordByKey", key)
+	if err != nil {
+		return nil, err
+	}
+	record = table.readable(record)
+	return &record, nil
+}
+
+func (table *Table) UpdateRecordByKey(key string, record interface{}) error {
+	if err := table.throttle("UpdateRecordByKey"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	existing, err := table.keyedRecord("UpdateRecordByKey", key)
+	if err != nil {
+		return err
+	}
+	return table.replaceData("UpdateRecordByKey", existing, record)
+}
+
+func (table *Table) DeleteRecordByKey(key string) error {
+	if err := table.throttle("DeleteRecordByKey"); err != nil {
+		return err
+	}
+
+	defer unlockTables(table.lockForDelete())
+
+	record, err := table.keyedRecord("DeleteRecordByKey", key)
+	if err != nil {
+		return err
+	}
+	return table.deleteRecord("DeleteRecordByKey", record)
+}
+
+// keyedRecord looks a record up by key. Callers hold a table lock.
+func (table *Table) keyedRecord(op, key string) (Record, error) {
+	if table.keys == nil {
+		return Record{}, fmt.Errorf("%s: table does not use string keys", op)
+	}
+
+	id, ok := table.keys[key]
+	if !ok {
+		return Record{}, &RecordError{Op: op, Table: table.tableName(), Key: key, Err: ErrNotFound}
+	}
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return Record{}, &RecordError{Op: op, Table: table.tableName(), Key: key, Err: ErrNotFound}
+	}
+
+	record, err := table.recordValue(op, val)
+	if err != nil {
+		return Record{}, err
+	}
+	if table.hidden(record) {
+		return Record{}, &RecordError{Op: op, Table: table.tableName(), Key: key, Err: ErrNotFound}
+	}
+	return record, nil
+}
+
+// assignKey fills in the key of a record about to be inserted and checks
+// that it is free. Callers hold the write lock.
+func (table *Table) assignKey(record *Record) error {
+	if table.keys == nil {
+		if record.Key != "" {
+			return errors.New("table does not use string keys")
+		}
+		return nil
+	}
+
+	if record.Key == "" && table.keyStrategy == KeyUUID {
+		key, err := newUUID()
+		if err != nil {
+			return err
+		}
+		record.Key = key
+	}
+	if record.Key == "" {
+		return errors.New("record key required")
+	}
+	if _, ok := table.keys[record.Key]; ok {
+		return fmt.Errorf("key %q: %w", record.Key, ErrRecordExists)
+	}
+	return nil
+}
+
+func (table *Table) indexRecordKey(record Record) {
+	if table.keys != nil && record.Key != "" {
+		table.keys[record.Key] = record.ID
+	}
+}
+
+func (table *Table) unindexRecordKey(record Record) {
+	if table.keys != nil && record.Key != "" && table.keys[record.Key] == record.ID {
+		delete(table.keys, record.Key)
+	}
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,109 @@
+package velox
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type LockStats struct {
+	WriteAcquisitions uint64
+	ReadAcquisitions  uint64
+	TotalWait         time.Duration
+	MaxWait           time.Duration
+	TotalHeld         time.Duration
+	MaxHeld           time.Duration
+}
+
+type lockMonitor struct {
+	enabled atomic.Bool
+	stats   LockStats
+	sync.Mutex
+}
+
+// SetLockInstrumentation turns lock wait and hold time recording on or off
+// for the table. When off, the only cost is an atomic flag check per lock.
+func (table *Table) SetLockInstrumentation(enabled bool) {
+	table.monitor.enabled.Store(enabled)
+}
+
+func (table *Table) LockStats() LockStats {
+	table.monitor.Lock()
+	defer table.monitor.Unlock()
+
+	return table.monitor.stats
+}
+
+func (table *Table) ResetLockStats() {
+	table.monitor.Lock()
+	defer table.monitor.Unlock()
+
+	table.monitor.stats = LockStats{}
+}
+
+func (table *Table) lock() time.Time {
+	if !table.monitor.enabled.Load() {
+		table.RWMutex.Lock()
+		return time.Time{}
+	}
+
+	start := time.Now()
+	table.RWMutex.Lock()
+	acquired := time.Now()
+	table.monitor.acquired(false, acquired.Sub(start))
+	return acquired
+}
+
+func (table *Table) unlock(acquired time.Time) {
+	table.RWMutex.Unlock()
+	table.monitor.released(acquired)
+}
+
+func (table *Table) rlock() time.Time {
+	if !table.monitor.enabled.Load() {
+		table.RWMutex.RLock()
+		return time.Time{}
+	}
+
+	start := time.Now()
+	table.RWMutex.RLock()
+	acquired := time.Now()
+	table.monitor.acquired(true, acquired.Sub(start))
+	return acquired
+}
+
+func (table *Table) runlock(acquired time.Time) {
+	table.RWMutex.RUnlock()
+	table.monitor.released(acquired)
+}
+
+func (monitor *lockMonitor) acquired(read bool, wait time.Duration) {
+	monitor.Lock()
+	defer monitor.Unlock()
+
+	if read {
+		monitor.stats.ReadAcquisitions++
+	} else {
+		monitor.stats.WriteAcquisitions++
+	}
+	monitor.stats.TotalWait += wait
+	if wait > monitor.stats.MaxWait {
+		monitor.stats.MaxWait = wait
+	}
+}
+
+func (monitor *lockMonitor) released(acquired time.Time) {
+	if acquired.IsZero() {
+		return
+	}
+
+	held := time.Since(acquired)
+
+	monitor.Lock()
+	defer monitor.Unlock()
+
+	monitor.stats.TotalHeld += held
+	if held > monitor.stats.MaxHeld {
+		monitor.stats.MaxHeld = held
+	}
+}
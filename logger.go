@@ -0,0 +1,116 @@
+package velox
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Logger receives what a database has to report. Debug and Info get
+// lifecycle events such as loads, saves, write-ahead log archiving and
+// replicas connecting; Warn and Error get problems that no call returns,
+// such as a failing autosave. keysAndValues alternate between string keys
+// and their values.
+//
+// *slog.Logger satisfies Logger as it is, and ZapLogger adapts a
+// *zap.SugaredLogger. Without one, warnings and errors are printed to
+// standard error and the rest is dropped.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// SugaredLogger is the part of *zap.SugaredLogger that ZapLogger uses, so
+// the module doesn't depend on zap.
+type SugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// ZapLogger returns a Logger writing to a zap logger, for example
+// velox.ZapLogger(zapLogger.Sugar()).
+func ZapLogger(logger SugaredLogger) Logger {
+	return zapLogger{logger}
+}
+
+type zapLogger struct {
+	SugaredLogger
+}
+
+func (logger zapLogger) Debug(msg string, keysAndValues ...interface{}) {
+	logger.Debugw(msg, keysAndValues...)
+}
+
+func (logger zapLogger) Info(msg string, keysAndValues ...interface{}) {
+	logger.Infow(msg, keysAndValues...)
+}
+
+func (logger zapLogger) Warn(msg string, keysAndValues ...interface{}) {
+	logger.Warnw(msg, keysAndValues...)
+}
+
+func (logger zapLogger) Error(msg string, keysAndValues ...interface{}) {
+	logger.Errorw(msg, keysAndValues...)
+}
+
+// printLogger is the Logger of databases that weren't given one.
+type printLogger struct{}
+
+func (printLogger) Debug(msg string, keysAndValues ...interface{}) {}
+
+func (printLogger) Info(msg string, keysAndValues ...interface{}) {}
+
+func (printLogger) Warn(msg string, keysAndValues ...interface{}) {
+	printLog("WARN", msg, keysAndValues)
+}
+
+func (printLogger) Error(msg string, keysAndValues ...interface{}) {
+	printLog("ERROR", msg, keysAndValues)
+}
+
+func printLog(level, msg string, keysAndValues []interface{}) {
+	var line strings.Builder
+	line.WriteString("velox: " + level + " " + msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 < len(keysAndValues) {
+			fmt.Fprintf(&line, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+		} else {
+			fmt.Fprintf(&line, " %v", keysAndValues[i])
+		}
+	}
+	fmt.Fprintln(os.Stderr, line.String())
+}
+
+// loggerRef boxes a Logger for Database.logger.
+type loggerRef struct {
+	Logger
+}
+
+// SetLogger makes the database report to logger. Nil restores the default.
+func (database *Database) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = printLogger{}
+	}
+	database.logger.Store(&loggerRef{logger})
+}
+
+// log returns the Logger of the table's database, or the default one for
+// tables that don't belong to a database.
+func (table *Table) log() Logger {
+	if table.database == nil {
+		return printLogger{}
+	}
+	return table.database.log()
+}
+
+// log returns the Logger the database reports to.
+func (database *Database) log() Logger {
+	if ref := database.logger.Load(); ref != nil {
+		return ref.Logger
+	}
+	return printLogger{}
+}
@@ -0,0 +1,54 @@
+package velox
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (logger *recordingLogger) record(level, msg string) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.messages = append(logger.messages, level+" "+msg)
+}
+
+func (logger *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	logger.record("DEBUG", msg)
+}
+
+func (logger *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	logger.record("INFO", msg)
+}
+
+func (logger *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	logger.record("WARN", msg)
+}
+
+func (logger *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	logger.record("ERROR", msg)
+}
+
+func TestCorruptRecordLogged(t *testing.T) {
+	logger := &recordingLogger{}
+	database, err := New(WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := database.GetTable("items")
+	table.records.Set("1", "not a record")
+
+	if _, err := table.ReadRecord(1); !errors.Is(err, ErrInvalidRecordType) {
+		t.Fatalf("ReadRecord = %v, want ErrInvalidRecordType", err)
+	}
+	if len(logger.messages) != 1 || logger.messages[0] != "ERROR unexpected value in record map" {
+		t.Fatalf("logged %q", logger.messages)
+	}
+}
@@ -0,0 +1,76 @@
+package velox
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// manifestVersion is the master.json format Save writes. Version 0 is the
+// original format, a bare object of table entries, which Load still reads.
+const manifestVersion = 1
+
+type manifestFile struct {
+	Version int                  `json:"version"`
+	SavedAt time.Time            `json:"saved_at"`
+	Tables  map[string]tableMeta `json:"tables"`
+	// LSN is the last write-ahead log sequence number handed out when the
+	// manifest was written, so numbering carries on after a Load.
+	LSN uint64 `json:"lsn,omitempty"`
+}
+
+// strictJSON rejects fields it doesn't know, so a master.json written by a
+// newer version fails to load instead of losing settings silently.
+var strictJSON = jsoniter.Config{DisallowUnknownFields: true}.Froze()
+
+func readManifest(storage Storage) (manifestFile, error) {
+	data, err := storage.ReadTable("master.json")
+	if err != nil {
+		return manifestFile{}, err
+	}
+	return parseManifest(data)
+}
+
+func parseManifest(data []byte) (manifestFile, error) {
+	var probe map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(data, &probe); err != nil {
+		return manifestFile{}, fmt.Errorf("master.json: %w", err)
+	}
+
+	// A version 0 manifest can hold a table named "version", but its value
+	// is an object, never a number.
+	raw, versioned := probe["version"]
+	if versioned {
+		raw = bytes.TrimSpace(raw)
+		versioned = len(raw) > 0 && raw[0] != '{'
+	}
+
+	var manifest manifestFile
+	if !versioned {
+		if err := strictJSON.Unmarshal(data, &manifest.Tables); err != nil {
+			return manifestFile{}, fmt.Errorf("master.json: %w", err)
+		}
+		return manifest, nil
+	}
+
+	if err := strictJSON.Unmarshal(data, &manifest); err != nil {
+		return manifestFile{}, fmt.Errorf("master.json: %w", err)
+	}
+	if manifest.Version < 1 || manifest.Version > manifestVersion {
+		return manifestFile{}, fmt.Errorf("master.json: unsupported version %d", manifest.Version)
+	}
+	for name, meta := range manifest.Tables {
+		if name == "" || meta.File == "" {
+			return manifestFile{}, fmt.Errorf("master.json: table %q has no file", name)
+		}
+		if meta.Shards < 0 {
+			return manifestFile{}, fmt.Errorf("master.json: table %q has %d shards", name, meta.Shards)
+		}
+		if meta.MapShards < 0 {
+			return manifestFile{}, fmt.Errorf("master.json: table %q has %d map shards", name, meta.MapShards)
+		}
+	}
+	return manifest, nil
+}
@@ -0,0 +1,89 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInMemory is returned by operations that need the disk when they are
+// called on a database created with NewMemoryDatabase.
+var ErrInMemory = errors.New("database is in memory only")
+
+// NewMemoryDatabase returns a database that never touches the disk. Save,
+// Load, LoadTables, EnableWAL, StartAutoSave and blobs fail with
+// ErrInMemory; everything else works as usual. It makes a fast fake for
+// tests, with Clone giving each test its own copy of a fixture.
+func NewMemoryDatabase() *Database {
+	database := NewDatabase()
+	database.memory = true
+	return database
+}
+
+// Clone returns an in-memory database holding a copy of every loaded
+// table, taken while all of them are locked: the records, the table
+// settings, history and hooks. Tables that are on disk but not loaded are
+// not copied. The clone uses the same Clock. Record data itself is shared
+// rather than copied, so it must be replaced, not changed in place.
+func (database *Database) Clone() (*Database, error) {
+	tables := make([]*Table, 0, database.tables.Count())
+	database.tables.IterCb(func(name string, val interface{}) {
+		if table, ok := val.(*Table); ok {
+			tables = append(tables, table)
+		}
+	})
+
+	locked := lockTables(tables)
+	defer unlockTables(locked)
+
+	clone := NewMemoryDatabase()
+	database.RWMutex.RLock()
+	clone.clock = database.clock
+	clone.SetLogger(database.log())
+	database.RWMutex.RUnlock()
+
+	for _, lt := range locked {
+		if lt.table.dropped {
+			continue
+		}
+
+		table, err := lt.table.clone()
+		if err != nil {
+			return nil, fmt.Errorf("Clone: table %s: %w", lt.table.name, err)
+		}
+		clone.attach(lt.table.name, table)
+		clone.tables.Set(lt.table.name, table)
+	}
+
+	clone.resolveForeignKeys()
+	return clone, nil
+}
+
+// clone copies the table for Clone. Callers hold the table lock.
+func (table *Table) clone() (*Table, error) {
+	records := make([]Record, 0, table.records.Count())
+	var invalid error
+	table.records.IterCb(func(key string, val interface{}) {
+		record, err := table.recordValue("Clone", val)
+		if err != nil {
+			invalid = err
+			return
+		}
+		records = append(records, record)
+	})
+	if invalid != nil {
+		return nil, invalid
+	}
+
+	clone, err := restoreTable(table.metaLocked(), records, table.nextID)
+	if err != nil {
+		return nil, err
+	}
+	if table.history != nil {
+		clone.history = make(map[int][]HistoryEntry, len(table.history))
+		for id, entries := range table.history {
+			clone.history[id] = append([]HistoryEntry(nil), entries...)
+		}
+	}
+	clone.hooks = table.hooks.clone()
+	return clone, nil
+}
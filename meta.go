@@ -0,0 +1,125 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// GetMeta never returns nil, so callers can index the result directly.
+func (record *Record) GetMeta() map[string]string {
+	if record.Meta == nil {
+		return map[string]string{}
+	}
+	return record.Meta
+}
+
+func (table *Table) CreateRecordWithMeta(record interface{}, meta map[string]string) (RecordInterface, error) {
+	return table.createRecord(context.Background(), "CreateRecordWithMeta", record, copyMeta(meta))
+}
+
+// SetMeta sets the metadata key of record id to value. Metadata is kept
+// apart from Data, so it can tag records, with an owner or a content type
+// for example, without touching what the application stored. Queries can
+// filter on it with QueryBuilder.WhereMeta.
+func (table *Table) SetMeta(id int, key, value string) error {
+	return table.updateMeta("SetMeta", id, func(meta map[string]string) bool {
+		if current, ok := meta[key]; ok && current == value {
+			return false
+		}
+		meta[key] = value
+		return true
+	})
+}
+
+// DeleteMeta removes the metadata key from record id. Removing a key the
+// record doesn't have is not an error.
+func (table *Table) DeleteMeta(id int, key string) error {
+	return table.updateMeta("DeleteMeta", id, func(meta map[string]string) bool {
+		if _, ok := meta[key]; !ok {
+			return false
+		}
+		delete(meta, key)
+		return true
+	})
+}
+
+// updateMeta applies change to a copy of the metadata of record id and
+// stores it as a new version of the record if change reports that it
+// changed anything.
+func (table *Table) updateMeta(op string, id int, change func(meta map[string]string) bool) error {
+	if err := table.throttle(op); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return table.notFound(op, id)
+	}
+
+	record, err := table.recordValue(op, val)
+	if err != nil {
+		return err
+	}
+	if table.hidden(record) {
+		return table.notFound(op, id)
+	}
+
+	previous := record
+	record.Meta = copyMeta(record.Meta)
+	if record.Meta == nil {
+		record.Meta = make(map[string]string, 1)
+	}
+	if !change(record.Meta) {
+		return nil
+	}
+	if len(record.Meta) == 0 {
+		record.Meta = nil
+	}
+	record.Version++
+	record.UpdatedAt = table.now()
+	if err := table.writeAhead(walEntry{Table: table.name, Op: ChangeUpdate, ID: record.ID, Record: &record}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	table.setRecord(&previous, record)
+	table.changed(ChangeUpdate, &previous, &record)
+	return nil
+}
+
+func (table *Table) QueryMeta(predicate func(meta map[string]string) bool) ([]RecordInterface, error) {
+	if predicate == nil {
+		return nil, errors.New("QueryMeta: predicate is required")
+	}
+
+	defer table.runlock(table.rlock())
+
+	results := make([]RecordInterface, 0)
+	table.records.IterCb(func(key string, val interface{}) {
+		record, err := table.recordValue("QueryMeta", val)
+		if err != nil || table.hidden(record) {
+			return
+		}
+		if predicate(record.GetMeta()) {
+			record = table.readable(record)
+			results = append(results, &record)
+		}
+	})
+
+	return results, nil
+}
+
+func copyMeta(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+
+	copied := make(map[string]string, len(meta))
+	for key, value := range meta {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,246 @@
+package velox
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot is a read-only view of every table as it was when Snapshot was
+// called. Writers carry on while it is open: the first change to a record
+// afterwards keeps the record's old version for the snapshot, so a
+// snapshot costs memory in proportion to the records changed while it is
+// open, not to the size of the database. Close releases it.
+type Snapshot struct {
+	at time.Time
+	// lsn is the last write-ahead log entry the snapshot includes.
+	lsn    uint64
+	tables map[string]*SnapshotTable
+	closed atomic.Bool
+}
+
+type SnapshotTable struct {
+	table    *Table
+	name     string
+	snapshot *Snapshot
+	// before holds the snapshot's version of every record changed since it
+	// was taken, nil for records created since.
+	before map[int]*Record
+}
+
+// Snapshot takes a consistent snapshot of all loaded tables. Writes wait
+// only for the snapshot to be registered with each table.
+func (database *Database) Snapshot() *Snapshot {
+	var tables []*Table
+	database.tables.IterCb(func(name string, val interface{}) {
+		if table, ok := val.(*Table); ok {
+			tables = append(tables, table)
+		}
+	})
+
+	snapshot := &Snapshot{tables: make(map[string]*SnapshotTable, len(tables))}
+
+	locked := lockTables(tables)
+	defer unlockTables(locked)
+
+	snapshot.at = database.now()
+	snapshot.lsn = database.lsn.Load()
+	for _, table := range tables {
+		if table.dropped {
+			continue
+		}
+
+		view := &SnapshotTable{table: table, name: table.name, snapshot: snapshot, before: make(map[int]*Record)}
+		if table.snapshots == nil {
+			table.snapshots = make(map[*SnapshotTable]struct{})
+		}
+		table.snapshots[view] = struct{}{}
+		snapshot.tables[table.name] = view
+	}
+	return snapshot
+}
+
+// Close stops the snapshot from keeping old record versions. Reading from a
+// closed snapshot fails.
+func (snapshot *Snapshot) Close() {
+	if snapshot.closed.Swap(true) {
+		return
+	}
+
+	for _, view := range snapshot.tables {
+		func() {
+			defer view.table.unlock(view.table.lock())
+			delete(view.table.snapshots, view)
+			view.before = nil
+		}()
+	}
+}
+
+// Tables returns the names the snapshot's tables had when it was taken, in
+// sorted order.
+func (snapshot *Snapshot) Tables() []string {
+	names := make([]string, 0, len(snapshot.tables))
+	for name := range snapshot.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (snapshot *Snapshot) Table(name string) (*SnapshotTable, error) {
+	view, ok := snapshot.tables[name]
+	if !ok {
+		return nil, &TableError{Op: "Snapshot", Table: name, Err: ErrNotFound}
+	}
+	return view, nil
+}
+
+func (view *SnapshotTable) ReadRecord(id int) (interface{}, error) {
+	record, err := view.record("ReadRecord", id)
+	if err != nil {
+		return nil, err
+	}
+	return view.table.readable(*record).Data, nil
+}
+
+func (view *SnapshotTable) GetRecord(id int) (RecordInterface, error) {
+	record, err := view.record("GetRecord", id)
+	if err != nil {
+		return nil, err
+	}
+	if view.table.copyOnRead.Load() {
+		copied := view.table.readable(*record)
+		record = &copied
+	}
+	return record, nil
+}
+
+// Query returns the records matching predicate ordered by ID. A nil
+// predicate matches every record.
+func (view *SnapshotTable) Query(predicate func(RecordInterface) bool) ([]RecordInterface, error) {
+	records, err := view.records()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RecordInterface, 0, len(records))
+	for _, record := range records {
+		if predicate == nil || predicate(record) {
+			if view.table.copyOnRead.Load() {
+				copied := view.table.readable(*record)
+				record = &copied
+			}
+			results = append(results, record)
+		}
+	}
+	return results, nil
+}
+
+func (view *SnapshotTable) Count() (int, error) {
+	records, err := view.records()
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+func (view *SnapshotTable) record(op string, id int) (*Record, error) {
+	table := view.table
+	defer table.runlock(table.rlock())
+
+	if view.snapshot.closed.Load() {
+		return nil, fmt.Errorf("%s: snapshot is closed", op)
+	}
+
+	record, ok := view.before[id]
+	if !ok {
+		val, found := table.records.Get(strconv.Itoa(id))
+		if found {
+			current, err := table.recordValue(op, val)
+			if err != nil {
+				return nil, err
+			}
+			record = &current
+		}
+	}
+	if record == nil || view.hidden(*record) {
+		return nil, &RecordError{Op: op, Table: view.name, ID: id, Err: ErrNotFound}
+	}
+	return record, nil
+}
+
+// records returns the snapshot's records ordered by ID.
+func (view *SnapshotTable) records() ([]*Record, error) {
+	stored, err := view.stored("Query")
+	if err != nil {
+		return nil, err
+	}
+
+	records := stored[:0]
+	for _, record := range stored {
+		if !view.hidden(*record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// stored returns every record the table held when the snapshot was taken,
+// hidden ones included, ordered by ID.
+func (view *SnapshotTable) stored(op string) ([]*Record, error) {
+	table := view.table
+	defer table.runlock(table.rlock())
+
+	if view.snapshot.closed.Load() {
+		return nil, fmt.Errorf("%s: snapshot is closed", op)
+	}
+
+	records := make([]*Record, 0, table.records.Count())
+	table.records.IterCb(func(key string, val interface{}) {
+		record, err := table.recordValue(op, val)
+		if err != nil {
+			return
+		}
+		if _, changed := view.before[record.ID]; !changed {
+			records = append(records, &record)
+		}
+	})
+	for _, record := range view.before {
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
+
+func (view *SnapshotTable) hidden(record Record) bool {
+	if record.DeletedAt != nil {
+		return true
+	}
+	return record.ExpiresAt != nil && !view.snapshot.at.Before(*record.ExpiresAt)
+}
+
+// preserve keeps the current version of record id for every open snapshot
+// that doesn't have one yet. It runs before each change to the record map.
+// Callers hold the write lock.
+func (table *Table) preserve(id int) {
+	if len(table.snapshots) == 0 {
+		return
+	}
+
+	var current *Record
+	if val, ok := table.records.Get(strconv.Itoa(id)); ok {
+		if record, err := table.recordValue("Table_Snapshot", val); err == nil {
+			current = &record
+		}
+	}
+	for view := range table.snapshots {
+		if _, ok := view.before[id]; !ok {
+			view.before[id] = current
+		}
+	}
+}
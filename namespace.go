@@ -0,0 +1,201 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// namespaceFolder is the folder, under the database folder, holding a
+// folder for each namespace.
+const namespaceFolder = "namespaces"
+
+// Namespace returns the database for namespace name: a set of tables of
+// its own, kept in <folder>/namespaces/<name>, for example one per tenant
+// of an application. The first call loads it from its folder, or starts
+// it empty if there is none; later calls return the same Database. A
+// namespace of an in-memory database is in memory too.
+//
+// The namespace starts with the logger, clock, codec, compression,
+// encryption keys and shard count of database, and is read-only if
+// database is. Otherwise it is an ordinary Database: it is saved, backed
+// up and has its write-ahead log enabled on its own, and Save on database
+// doesn't save it. Close closes the namespaces along with database.
+func (database *Database) Namespace(name string) (*Database, error) {
+	if name == "" {
+		return nil, errors.New("Namespace: empty name")
+	}
+
+	database.namespaceMu.Lock()
+	defer database.namespaceMu.Unlock()
+
+	if namespace, ok := database.namespaces[name]; ok {
+		return namespace, nil
+	}
+
+	namespace := NewDatabase()
+	namespace.logger.Store(database.logger.Load())
+	database.RWMutex.RLock()
+	folder, storage := database.folder, database.storage
+	namespace.memory = database.memory
+	namespace.readOnly = database.readOnly
+	namespace.clock = database.clock
+	namespace.codec = database.codec
+	namespace.compression = database.compression
+	namespace.keys = database.keys
+	namespace.shardCount = database.shardCount
+	database.RWMutex.RUnlock()
+
+	if !namespace.memory {
+		if folder == "" && storage != nil {
+			return nil, errors.New("Namespace: namespaces need a database folder, not custom storage")
+		}
+		if folder == "" {
+			return nil, errors.New("Namespace: database folder not set")
+		}
+
+		dir := filepath.Join(folder, namespaceFolder, namespaceDir(name))
+		_, err := os.Stat(filepath.Join(dir, "master.json"))
+		switch {
+		case err == nil:
+			if err := namespace.Load(dir); err != nil {
+				return nil, fmt.Errorf("Namespace %s: %w", name, err)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("Namespace %s: %w", name, err)
+		case namespace.readOnly:
+			return nil, fmt.Errorf("Namespace %s: %w", name, ErrNotFound)
+		default:
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, fmt.Errorf("Namespace %s: %w", name, err)
+			}
+			namespace.SetFolder(dir)
+		}
+	}
+
+	if database.namespaces == nil {
+		database.namespaces = make(map[string]*Database)
+	}
+	database.namespaces[name] = namespace
+	return namespace, nil
+}
+
+// Namespaces returns the names of the namespaces that are loaded or have
+// a folder, sorted.
+func (database *Database) Namespaces() ([]string, error) {
+	database.namespaceMu.Lock()
+	found := make(map[string]bool, len(database.namespaces))
+	for name := range database.namespaces {
+		found[name] = true
+	}
+	database.namespaceMu.Unlock()
+
+	database.RWMutex.RLock()
+	folder := database.folder
+	database.RWMutex.RUnlock()
+
+	if folder != "" && !database.memory {
+		entries, err := os.ReadDir(filepath.Join(folder, namespaceFolder))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Namespaces: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if name, err := url.PathUnescape(entry.Name()); err == nil {
+				found[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DropNamespace closes namespace name and deletes its folder with every
+// table in it. It fails with ErrLocked if another process has the
+// namespace loaded.
+func (database *Database) DropNamespace(name string) error {
+	if name == "" {
+		return errors.New("DropNamespace: empty name")
+	}
+	if database.readOnly {
+		return fmt.Errorf("DropNamespace: %w", ErrReadOnly)
+	}
+
+	database.namespaceMu.Lock()
+	defer database.namespaceMu.Unlock()
+
+	database.RWMutex.RLock()
+	folder := database.folder
+	database.RWMutex.RUnlock()
+
+	namespace, loaded := database.namespaces[name]
+	if loaded {
+		if err := namespace.Close(); err != nil {
+			return fmt.Errorf("DropNamespace: %w", err)
+		}
+		delete(database.namespaces, name)
+	}
+	if database.memory || folder == "" {
+		if !loaded {
+			return fmt.Errorf("DropNamespace %s: %w", name, ErrNotFound)
+		}
+		return nil
+	}
+
+	root := filepath.Join(folder, namespaceFolder)
+	dir := filepath.Join(root, namespaceDir(name))
+	if filepath.Dir(dir) != root {
+		return fmt.Errorf("DropNamespace: invalid namespace folder %q", dir)
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if loaded {
+			return nil
+		}
+		return fmt.Errorf("DropNamespace %s: %w", name, ErrNotFound)
+	} else if err != nil {
+		return fmt.Errorf("DropNamespace: %w", err)
+	}
+
+	// Holding the lock while deleting keeps another process from loading
+	// the folder meanwhile.
+	var lock folderLock
+	if err := lock.acquire(dir); err != nil {
+		return fmt.Errorf("DropNamespace: %w", err)
+	}
+	defer lock.release()
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("DropNamespace: %w", err)
+	}
+	return nil
+}
+
+// closeNamespaces closes the loaded namespaces, returning the first error.
+func (database *Database) closeNamespaces() error {
+	database.namespaceMu.Lock()
+	defer database.namespaceMu.Unlock()
+
+	var first error
+	for name, namespace := range database.namespaces {
+		if err := namespace.Close(); err != nil && first == nil {
+			first = fmt.Errorf("namespace %s: %w", name, err)
+		}
+	}
+	return first
+}
+
+// namespaceDir returns the folder name for a namespace, escaped as table
+// file names are.
+func namespaceDir(name string) string {
+	return strings.TrimSuffix(tableFileName(name), ".json")
+}
@@ -0,0 +1,47 @@
+package velox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDropNamespaceEmptyName(t *testing.T) {
+	folder := t.TempDir()
+	database, err := New(WithFolder(folder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	for _, name := range []string{"tenant-1", "tenant-2"} {
+		namespace, err := database.Namespace(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := namespace.CreateTable("users"); err != nil {
+			t.Fatal(err)
+		}
+		if err := namespace.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := database.DropNamespace(""); err == nil {
+		t.Fatal("DropNamespace accepted an empty name")
+	}
+	entries, err := os.ReadDir(filepath.Join(folder, namespaceFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d namespace folders left, want 2", len(entries))
+	}
+
+	if err := database.DropNamespace("tenant-1"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ = os.ReadDir(filepath.Join(folder, namespaceFolder)); len(entries) != 1 {
+		t.Fatalf("%d namespace folders left after dropping one, want 1", len(entries))
+	}
+}
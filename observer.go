@@ -0,0 +1,77 @@
+package velox
+
+import "context"
+
+// Operation names an operation for an Observer: the method that started it,
+// such as "CreateRecord", "Query" or "Save", and the table it works on,
+// empty for operations on the whole database.
+type Operation struct {
+	Name  string
+	Table string
+}
+
+// Observer watches operations as they run, for metrics and tracing. Begin
+// is called as an operation starts with the context it was given, or
+// context.Background for methods without one. The operation runs under the
+// context Begin returns and calls the returned function once it is done,
+// with its error or nil. Observers run on every operation, from many
+// goroutines at once, so they must be quick and safe for concurrent use.
+//
+// Operations report under the name of their method without the Ctx
+// suffix: CreateRecord, CreateRecordWithMeta, ReadRecord, GetRecord,
+// UpdateRecord, UpdateRecordIfVersion, UpdateRecordFull, DeleteRecord,
+// Query and QuerySorted on tables, and Save and Load on the database.
+// QueryBuilder.Run reports as the query it runs.
+type Observer interface {
+	Begin(ctx context.Context, op Operation) (context.Context, func(err error))
+}
+
+// AddObserver makes observer see every operation from now on. Observers
+// begin in the order they were added and end in reverse.
+func (database *Database) AddObserver(observer Observer) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	var observers []Observer
+	if current := database.observers.Load(); current != nil {
+		observers = append(observers, *current...)
+	}
+	observers = append(observers, observer)
+	database.observers.Store(&observers)
+}
+
+func endNothing(error) {}
+
+// observe begins op with every observer and returns the function that
+// ends it.
+func (database *Database) observe(ctx context.Context, name, table string) (context.Context, func(err error)) {
+	observers := database.observers.Load()
+	if observers == nil {
+		return ctx, endNothing
+	}
+
+	op := Operation{Name: name, Table: table}
+	ends := make([]func(error), len(*observers))
+	for i, observer := range *observers {
+		ctx, ends[i] = observer.Begin(ctx, op)
+	}
+	return ctx, func(err error) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+	}
+}
+
+// observe is Database.observe for an operation on the table. Tables that
+// don't belong to a database aren't observed.
+func (table *Table) observe(ctx context.Context, name string) (context.Context, func(err error)) {
+	database := table.database
+	if database == nil || database.observers.Load() == nil {
+		return ctx, endNothing
+	}
+
+	database.RWMutex.RLock()
+	tableName := table.name
+	database.RWMutex.RUnlock()
+	return database.observe(ctx, name, tableName)
+}
@@ -0,0 +1,178 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Option configures a database made by New.
+type Option func(*options)
+
+type options struct {
+	folder      string
+	storage     Storage
+	codec       Codec
+	compression *Compression
+	keys        KeyProvider
+	key         []byte
+	logger      Logger
+	clock       Clock
+	shards      int
+	autoSave    time.Duration
+	load        bool
+	readOnly    bool
+}
+
+// New returns a database configured by opts. Options are applied in an
+// order that works whatever order they are given in: the database is
+// loaded, if WithLoad asks for it, after everything else is set and before
+// auto-save starts.
+func New(opts ...Option) (*Database, error) {
+	var config options
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.folder != "" && config.storage != nil {
+		return nil, errors.New("New: WithFolder and WithStorage both given")
+	}
+
+	database := NewDatabaseWithOptions(DatabaseOptions{Logger: config.logger})
+	database.readOnly = config.readOnly
+	if config.clock != nil {
+		database.SetClock(config.clock)
+	}
+	if config.key != nil {
+		if err := database.SetEncryptionKey(config.key); err != nil {
+			return nil, fmt.Errorf("New: %w", err)
+		}
+	}
+	if config.keys != nil {
+		database.SetKeyProvider(config.keys)
+	}
+	if config.codec != nil {
+		database.SetCodec(config.codec)
+	}
+	if config.compression != nil {
+		if err := database.SetCompression(*config.compression); err != nil {
+			return nil, fmt.Errorf("New: %w", err)
+		}
+	}
+	if config.shards != 0 {
+		database.SetShardCount(config.shards)
+	}
+
+	storage := config.storage
+	if config.folder != "" {
+		storage = dirStorage(config.folder)
+	}
+	if storage != nil {
+		database.SetStorage(storage)
+	}
+
+	if config.load {
+		if storage == nil {
+			return nil, errors.New("New: WithLoad needs WithFolder or WithStorage")
+		}
+		if _, err := storage.ReadTable("master.json"); err == nil {
+			if err := database.LoadFrom(storage); err != nil {
+				// Load locks the folder before it reads the tables.
+				database.Close()
+				return nil, fmt.Errorf("New: %w", err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) || config.readOnly {
+			return nil, fmt.Errorf("New: %w", err)
+		}
+	}
+
+	if config.autoSave != 0 {
+		if err := database.StartAutoSave(config.autoSave); err != nil {
+			database.Close()
+			return nil, fmt.Errorf("New: %w", err)
+		}
+	}
+	return database, nil
+}
+
+// WithFolder keeps the database in folder; see SetFolder.
+func WithFolder(folder string) Option {
+	return func(config *options) {
+		config.folder = folder
+	}
+}
+
+// WithStorage keeps the database in storage; see SetStorage.
+func WithStorage(storage Storage) Option {
+	return func(config *options) {
+		config.storage = storage
+	}
+}
+
+// WithLoad loads the database from its folder or storage, unless nothing
+// has been saved there yet.
+func WithLoad() Option {
+	return func(config *options) {
+		config.load = true
+	}
+}
+
+// WithCodec sets the codec table files are written with; see SetCodec.
+func WithCodec(codec Codec) Option {
+	return func(config *options) {
+		config.codec = codec
+	}
+}
+
+// WithCompression sets the compression of table files; see
+// SetCompression.
+func WithCompression(compression Compression) Option {
+	return func(config *options) {
+		config.compression = &compression
+	}
+}
+
+// WithEncryptionKey encrypts the database with key; see SetEncryptionKey.
+func WithEncryptionKey(key []byte) Option {
+	return func(config *options) {
+		config.key = key
+	}
+}
+
+// WithKeyProvider encrypts the database with the keys of provider; see
+// SetKeyProvider.
+func WithKeyProvider(provider KeyProvider) Option {
+	return func(config *options) {
+		config.keys = provider
+	}
+}
+
+// WithLogger sets the Logger the database reports to.
+func WithLogger(logger Logger) Option {
+	return func(config *options) {
+		config.logger = logger
+	}
+}
+
+// WithClock sets the database's clock; see SetClock.
+func WithClock(clock Clock) Option {
+	return func(config *options) {
+		config.clock = clock
+	}
+}
+
+// WithShardCount splits large tables into up to n files; see
+// SetShardCount.
+func WithShardCount(n int) Option {
+	return func(config *options) {
+		config.shards = n
+	}
+}
+
+// WithAutoSave saves the database every interval while it has unsaved
+// changes; see StartAutoSave. It needs WithFolder or WithStorage.
+func WithAutoSave(interval time.Duration) Option {
+	return func(config *options) {
+		config.autoSave = interval
+	}
+}
@@ -0,0 +1,84 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// List returns up to limit records in ID order after skipping the first
+// offset. Each page costs more the further in it starts, and deleting
+// records shifts the pages that follow, so ListAfter is the better choice
+// for walking a whole table.
+func (table *Table) List(offset, limit int) ([]RecordInterface, error) {
+	if offset < 0 {
+		return nil, errors.New("List: negative offset")
+	}
+	return table.page("List", 0, offset, limit)
+}
+
+// ListAfter returns up to limit records with IDs above id in ID order.
+// Passing 0 and then the last ID of each page walks the table without
+// skipping or repeating records, however it changes in between.
+func (table *Table) ListAfter(id, limit int) ([]RecordInterface, error) {
+	if id < 0 {
+		return nil, errors.New("ListAfter: negative id")
+	}
+	return table.page("ListAfter", id, 0, limit)
+}
+
+func (table *Table) page(op string, after, offset, limit int) ([]RecordInterface, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("%s: negative limit", op)
+	}
+
+	defer table.runlock(table.rlock())
+
+	results := make([]RecordInterface, 0)
+	if limit == 0 {
+		return results, nil
+	}
+	visit := func(val interface{}) bool {
+		record, err := table.recordValue(op, val)
+		if err != nil || table.hidden(record) {
+			return true
+		}
+		if offset > 0 {
+			offset--
+			return true
+		}
+		record = table.readable(record)
+		results = append(results, &record)
+		return len(results) < limit
+	}
+
+	// Dense tables are walked by ID like a Cursor. Where most IDs after the
+	// start are unused, sorting the IDs that are used is cheaper.
+	if table.nextID-after <= 2*table.records.Count() {
+		for id := after + 1; id < table.nextID; id++ {
+			if val, ok := table.records.Get(strconv.Itoa(id)); ok && !visit(val) {
+				break
+			}
+		}
+		return results, nil
+	}
+
+	values := make(map[int]interface{})
+	table.records.IterCb(func(key string, val interface{}) {
+		if id, err := strconv.Atoi(key); err == nil && id > after {
+			values[id] = val
+		}
+	})
+	ids := make([]int, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if !visit(values[id]) {
+			break
+		}
+	}
+	return results, nil
+}
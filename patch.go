@@ -0,0 +1,428 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ErrInvalidPatch is returned for patches that are malformed or don't fit
+// the record, such as one removing a field the record doesn't have.
+var ErrInvalidPatch = errors.New("invalid patch")
+
+// PatchRecord changes only the fields of a record named in patch and leaves
+// the rest alone. It follows JSON merge patch (RFC 7386): a nil value
+// removes the field and a nested map is merged into the object it names.
+// The record is read and written under one lock, so concurrent patches to
+// different fields don't undo each other.
+func (table *Table) PatchRecord(id int, patch map[string]interface{}) error {
+	return table.patchRecord(context.Background(), "PatchRecord", id, func(data interface{}) (interface{}, error) {
+		return mergePatch(data, patch)
+	})
+}
+
+// MergePatchRecord applies a JSON merge patch document (RFC 7386) to a
+// record, as PatchRecord does.
+func (table *Table) MergePatchRecord(id int, patch []byte) error {
+	return table.MergePatchRecordCtx(context.Background(), id, patch)
+}
+
+// MergePatchRecordCtx is MergePatchRecord for the principal of ctx; see
+// SetAuthorizer.
+func (table *Table) MergePatchRecordCtx(ctx context.Context, id int, patch []byte) error {
+	var decoded interface{}
+	if err := jsoniter.Unmarshal(patch, &decoded); err != nil {
+		return fmt.Errorf("MergePatchRecord: %w: %v", ErrInvalidPatch, err)
+	}
+	return table.patchRecord(ctx, "MergePatchRecord", id, func(data interface{}) (interface{}, error) {
+		return mergePatch(data, decoded)
+	})
+}
+
+// JSONPatchRecord applies a JSON Patch document (RFC 6902) to a record.
+// The operations are applied in order and either all of them take effect
+// or none do. A failed test operation returns ErrPreconditionFailed.
+func (table *Table) JSONPatchRecord(id int, patch []byte) error {
+	return table.JSONPatchRecordCtx(context.Background(), id, patch)
+}
+
+// JSONPatchRecordCtx is JSONPatchRecord for the principal of ctx; see
+// SetAuthorizer.
+func (table *Table) JSONPatchRecordCtx(ctx context.Context, id int, patch []byte) error {
+	var operations []patchOperation
+	if err := jsoniter.Unmarshal(patch, &operations); err != nil {
+		return fmt.Errorf("JSONPatchRecord: %w: %v", ErrInvalidPatch, err)
+	}
+	return table.patchRecord(ctx, "JSONPatchRecord", id, func(data interface{}) (interface{}, error) {
+		for i, operation := range operations {
+			var err error
+			if data, err = operation.apply(data); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		}
+		return data, nil
+	})
+}
+
+func (table *Table) patchRecord(ctx context.Context, op string, id int, patch func(data interface{}) (interface{}, error)) error {
+	if err := table.throttleCtx(ctx, op, PermissionWrite); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return table.notFound(op, id)
+	}
+
+	record, err := table.recordValue(op, val)
+	if err != nil {
+		return err
+	}
+	if table.hidden(record) {
+		return table.notFound(op, id)
+	}
+
+	data, err := genericValue(record.Data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if data, err = patch(data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if data, err = asTypeOf(record.Data, data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return table.replaceData(op, record, data)
+}
+
+// genericValue returns v as JSON would decode it into an interface{}.
+// Values already in that form are returned as they are, so callers must
+// copy maps and slices before changing them.
+func genericValue(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil, bool, float64, string, map[string]interface{}, []interface{}:
+		return v, nil
+	}
+
+	encoded, err := jsoniter.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := jsoniter.Unmarshal(encoded, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// asTypeOf converts patched, a patched copy of original in generic form,
+// back to the type of original, so records of typed tables keep their
+// type.
+func asTypeOf(original, patched interface{}) (interface{}, error) {
+	typ := reflect.TypeOf(original)
+	if typ == nil || typ == reflect.TypeOf(map[string]interface{}(nil)) {
+		return patched, nil
+	}
+
+	encoded, err := jsoniter.Marshal(patched)
+	if err != nil {
+		return nil, err
+	}
+
+	base := typ
+	if typ.Kind() == reflect.Ptr {
+		base = typ.Elem()
+	}
+	value := reflect.New(base)
+	if err := strictJSON.Unmarshal(encoded, value.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: result does not fit %s: %v", ErrInvalidPatch, typ, err)
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		return value.Interface(), nil
+	}
+	return value.Elem().Interface(), nil
+}
+
+// mergePatch applies the merge patch algorithm of RFC 7386 to target
+// without modifying it.
+func mergePatch(target, patch interface{}) (interface{}, error) {
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch, nil
+	}
+
+	generic, err := genericValue(target)
+	if err != nil {
+		return nil, err
+	}
+	object, _ := generic.(map[string]interface{})
+
+	merged := make(map[string]interface{}, len(object)+len(fields))
+	for name, value := range object {
+		merged[name] = value
+	}
+	for name, value := range fields {
+		if value == nil {
+			delete(merged, name)
+			continue
+		}
+		if merged[name], err = mergePatch(merged[name], value); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+type patchOperation struct {
+	Op    string              `json:"op"`
+	Path  *string             `json:"path"`
+	From  *string             `json:"from"`
+	Value jsoniter.RawMessage `json:"value"`
+}
+
+func (operation patchOperation) apply(doc interface{}) (interface{}, error) {
+	if operation.Path == nil {
+		return nil, fmt.Errorf("%w: %s operation has no path", ErrInvalidPatch, operation.Op)
+	}
+	path, err := parsePointer(*operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("%w: %s operation has no value", ErrInvalidPatch, operation.Op)
+		}
+		if err := jsoniter.Unmarshal(operation.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+	case "move", "copy":
+		if operation.From == nil {
+			return nil, fmt.Errorf("%w: %s operation has no from", ErrInvalidPatch, operation.Op)
+		}
+		from, err := parsePointer(*operation.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = pointerValue(doc, from); err != nil {
+			return nil, err
+		}
+		if operation.Op == "move" {
+			if strings.HasPrefix(*operation.Path+"/", *operation.From+"/") && *operation.Path != *operation.From {
+				return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, *operation.From)
+			}
+			if doc, err = patchRemove(doc, from); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch operation.Op {
+	case "add", "move", "copy":
+		return patchAdd(doc, path, value)
+	case "remove":
+		return patchRemove(doc, path)
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		return updateAt(doc, path, func(parent interface{}, token string) (interface{}, error) {
+			switch parent := parent.(type) {
+			case map[string]interface{}:
+				if _, ok := parent[token]; !ok {
+					return nil, fmt.Errorf("%w: path %s does not exist", ErrInvalidPatch, *operation.Path)
+				}
+				parent[token] = value
+			case []interface{}:
+				i, err := arrayIndex(token, len(parent)-1)
+				if err != nil {
+					return nil, err
+				}
+				parent[i] = value
+			}
+			return parent, nil
+		})
+	case "test":
+		current, err := pointerValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		currentHash, err := contentHash(current)
+		if err != nil {
+			return nil, err
+		}
+		valueHash, err := contentHash(value)
+		if err != nil {
+			return nil, err
+		}
+		if currentHash != valueHash {
+			return nil, fmt.Errorf("%w: test of %s failed", ErrPreconditionFailed, *operation.Path)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, operation.Op)
+}
+
+func patchAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateAt(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch parent := parent.(type) {
+		case map[string]interface{}:
+			parent[token] = value
+			return parent, nil
+		case []interface{}:
+			i := len(parent)
+			if token != "-" {
+				var err error
+				if i, err = arrayIndex(token, len(parent)); err != nil {
+					return nil, err
+				}
+			}
+			parent = append(parent, nil)
+			copy(parent[i+1:], parent[i:])
+			parent[i] = value
+			return parent, nil
+		}
+		return parent, nil
+	})
+}
+
+func patchRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole record", ErrInvalidPatch)
+	}
+	return updateAt(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch parent := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := parent[token]; !ok {
+				return nil, fmt.Errorf("%w: field %q does not exist", ErrInvalidPatch, token)
+			}
+			delete(parent, token)
+			return parent, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(parent)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(parent[:i], parent[i+1:]...), nil
+		}
+		return parent, nil
+	})
+}
+
+// updateAt copies the objects and arrays along path and calls change with
+// the copy of the last one and the final token of path. change returns the
+// container to put in its place. path is never empty.
+func updateAt(doc interface{}, path []string, change func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	generic, err := genericValue(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := generic.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(container)+1)
+		for name, value := range container {
+			copied[name] = value
+		}
+		if len(path) == 1 {
+			return change(copied, path[0])
+		}
+
+		child, ok := copied[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: field %q does not exist", ErrInvalidPatch, path[0])
+		}
+		if copied[path[0]], err = updateAt(child, path[1:], change); err != nil {
+			return nil, err
+		}
+		return copied, nil
+
+	case []interface{}:
+		copied := make([]interface{}, len(container), len(container)+1)
+		copy(copied, container)
+		if len(path) == 1 {
+			return change(copied, path[0])
+		}
+
+		i, err := arrayIndex(path[0], len(copied)-1)
+		if err != nil {
+			return nil, err
+		}
+		if copied[i], err = updateAt(copied[i], path[1:], change); err != nil {
+			return nil, err
+		}
+		return copied, nil
+	}
+	return nil, fmt.Errorf("%w: %q is not inside an object or array", ErrInvalidPatch, path[0])
+}
+
+// pointerValue returns the value path points to in doc.
+func pointerValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		generic, err := genericValue(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		switch container := generic.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: field %q does not exist", ErrInvalidPatch, token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, fmt.Errorf("%w: %q is not inside an object or array", ErrInvalidPatch, token)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("%w: path %q does not start with /", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token that may be at most last.
+func arrayIndex(token string, last int) (int, error) {
+	invalid := fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.Trim(token, "0123456789") != "" {
+		return 0, invalid
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i > last {
+		return 0, invalid
+	}
+	return i, nil
+}
@@ -0,0 +1,619 @@
+package velox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point-in-time recovery keeps, under <folder>/pitr, base backups written
+// by Backup and the write-ahead log segments Save would otherwise delete:
+//
+//	pitr/base-<lsn>-<unix nanoseconds>.tar
+//	pitr/wal-<first lsn>-<last lsn>.log
+//
+// A base holds the database as of its LSN and time, and the segments hold
+// every entry logged since the oldest base.
+const pitrFolder = "pitr"
+
+type pitrBase struct {
+	file string
+	lsn  uint64
+	at   time.Time
+}
+
+type pitrSegment struct {
+	file        string
+	first, last uint64
+}
+
+// SetWALRetention keeps what RestoreToTime and RestoreToLSN need to go back
+// as far as window: a base backup at least that old and the write-ahead
+// log entries since. Save archives the log instead of deleting it and
+// writes a new base backup once the newest one is older than window,
+// dropping what is no longer needed. The write-ahead log must be enabled.
+// A window of zero turns retention off and deletes what was kept.
+func (database *Database) SetWALRetention(window time.Duration) error {
+	if window < 0 {
+		return errors.New("SetWALRetention: negative window")
+	}
+	if database.readOnly {
+		return fmt.Errorf("SetWALRetention: %w", ErrReadOnly)
+	}
+
+	database.saving.Lock()
+	defer database.saving.Unlock()
+
+	database.RWMutex.Lock()
+	folder := database.folder
+	logging := database.wal != nil
+	if window > 0 && (database.memory || !logging) {
+		database.RWMutex.Unlock()
+		if database.memory {
+			return fmt.Errorf("SetWALRetention: %w", ErrInMemory)
+		}
+		return errors.New("SetWALRetention: write-ahead log not enabled")
+	}
+	database.retention = window
+	database.RWMutex.Unlock()
+
+	dir := filepath.Join(folder, pitrFolder)
+	if window == 0 {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("SetWALRetention: %w", err)
+		}
+		return nil
+	}
+
+	bases, _, err := readPITR(dir)
+	if err != nil {
+		return fmt.Errorf("SetWALRetention: %w", err)
+	}
+	if len(bases) == 0 {
+		if err := database.writeBase(dir); err != nil {
+			return fmt.Errorf("SetWALRetention: %w", err)
+		}
+	}
+	return nil
+}
+
+// LSN returns the sequence number of the last entry written to the
+// write-ahead log.
+func (database *Database) LSN() uint64 {
+	return database.lsn.Load()
+}
+
+// RestoreToTime rolls the records of every table back to how they were at
+// t, which must be within the WAL retention window. The rollback is an
+// ordinary change: it is logged, watchers and hooks see it, and it can
+// itself be undone by restoring to a later point. Tables created since t
+// are emptied and tables dropped since t are created again; table
+// settings such as indexes stay as they are now.
+func (database *Database) RestoreToTime(t time.Time) error {
+	return database.restoreTo("RestoreToTime", func(lsn uint64, at time.Time) bool {
+		return !at.After(t)
+	})
+}
+
+// RestoreToLSN is RestoreToTime for the moment the write-ahead log entry
+// numbered lsn was written. If that entry was logged together with later
+// ones, as part of a transaction for example, none of them are kept.
+func (database *Database) RestoreToLSN(lsn uint64) error {
+	return database.restoreTo("RestoreToLSN", func(n uint64, at time.Time) bool {
+		return n <= lsn
+	})
+}
+
+// restoreTo rebuilds the database from the newest base and the log entries
+// that keep accepts, then rolls the database back to it.
+func (database *Database) restoreTo(op string, keep func(lsn uint64, at time.Time) bool) error {
+	if database.readOnly {
+		return fmt.Errorf("%s: %w", op, ErrReadOnly)
+	}
+	// Save moves log files around, so none may run while they are read.
+	database.saving.Lock()
+	defer database.saving.Unlock()
+
+	database.RWMutex.RLock()
+	folder := database.folder
+	retention := database.retention
+	keys := database.keys
+	database.RWMutex.RUnlock()
+
+	if retention == 0 {
+		return fmt.Errorf("%s: WAL retention not enabled", op)
+	}
+
+	dir := filepath.Join(folder, pitrFolder)
+	bases, segments, err := readPITR(dir)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var base *pitrBase
+	for i := range bases {
+		if keep(bases[i].lsn, bases[i].at) {
+			base = &bases[i]
+		}
+	}
+	if base == nil {
+		return fmt.Errorf("%s: point is older than the retained history", op)
+	}
+
+	archive, err := os.Open(filepath.Join(dir, base.file))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	recovered, err := loadArchive(archive, dir, keys)
+	archive.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", op, base.file, err)
+	}
+
+	files := make([]string, 0, len(segments)+2)
+	for _, segment := range segments {
+		if segment.last > base.lsn {
+			files = append(files, filepath.Join(dir, segment.file))
+		}
+	}
+	files = append(files, filepath.Join(folder, walSegmentName), filepath.Join(folder, walFileName))
+
+	applied := base.lsn
+	for _, name := range files {
+		file, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		err = recovered.readWAL(file, func(group []walEntry) error {
+			last := group[len(group)-1]
+			if last.LSN <= applied || last.Time == nil || !keep(last.LSN, *last.Time) {
+				return nil
+			}
+			for _, entry := range group {
+				if entry.LSN <= applied {
+					continue
+				}
+				if err := recovered.replayEntry(entry); err != nil {
+					return err
+				}
+			}
+			applied = last.LSN
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", op, filepath.Base(name), err)
+		}
+	}
+
+	if err := database.rollBack(op, recovered); err != nil {
+		return err
+	}
+	database.log().Info("database rolled back", "op", op, "lsn", applied)
+	return nil
+}
+
+// loadArchive loads an archive written by Backup into a database of its
+// own, unpacking it in a temporary folder under dir.
+func loadArchive(archive io.Reader, dir string, keys KeyProvider) (*Database, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(dir, "restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := Restore(archive, tmp); err != nil {
+		return nil, err
+	}
+	recovered := NewDatabase()
+	recovered.keys = keys
+	err = recovered.Load(tmp)
+	// tmp is removed on return, so the lock on it is of no use.
+	recovered.folderLock.release()
+	if err != nil {
+		return nil, err
+	}
+	return recovered, nil
+}
+
+// rollBack makes the records of every table match recovered, as one
+// logged commit.
+func (database *Database) rollBack(op string, recovered *Database) error {
+	database.RWMutex.RLock()
+	unloaded := len(database.unloaded)
+	database.RWMutex.RUnlock()
+	if unloaded > 0 {
+		return fmt.Errorf("%s: all tables must be loaded", op)
+	}
+
+	sources := make(map[string]*Table)
+	recovered.tables.IterCb(func(name string, val interface{}) {
+		if table, ok := val.(*Table); ok {
+			sources[name] = table
+		}
+	})
+	for name := range sources {
+		if err := database.CreateTable(name); err != nil && !errors.Is(err, ErrTableExists) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	tables := make([]*Table, 0, database.tables.Count())
+	database.tables.IterCb(func(name string, val interface{}) {
+		if table, ok := val.(*Table); ok {
+			tables = append(tables, table)
+		}
+	})
+
+	locked := lockTables(tables)
+	defer unlockTables(locked)
+
+	return runCommit(locked, func() error {
+		for _, lt := range locked {
+			if lt.table.dropped {
+				continue
+			}
+			if err := lt.table.rollBack(op, sources[lt.table.name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// rollBack replaces the records of the table with those of source, or
+// removes them all if source is nil. Callers hold the write lock.
+func (table *Table) rollBack(op string, source *Table) error {
+	removed, changes, err := table.diffRecords(op, source)
+	if err != nil {
+		return err
+	}
+
+	for i := range removed {
+		record := removed[i]
+		if err := table.writeAhead(walEntry{Table: table.name, Op: ChangeDelete, ID: record.ID}); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		table.removeRecord(record)
+		table.changed(ChangeDelete, &record, nil)
+	}
+
+	for _, change := range changes {
+		record := change.record
+		kind := ChangeUpdate
+		if change.previous == nil {
+			kind = ChangeCreate
+		}
+		if err := table.writeAhead(walEntry{Table: table.name, Op: kind, ID: record.ID, Record: &record}); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		table.setRecord(change.previous, record)
+		table.changed(kind, change.previous, &record)
+	}
+	return nil
+}
+
+type recordChange struct {
+	previous *Record
+	record   Record
+}
+
+// diffRecords compares the records of the table with those of source, nil
+// meaning none, and returns the records source doesn't have and the ones
+// it adds or changes, both ordered by ID. It raises nextID to cover
+// source. Callers hold the write lock.
+func (table *Table) diffRecords(op string, source *Table) ([]Record, []recordChange, error) {
+	target := make(map[int]Record)
+	if source != nil {
+		source.records.IterCb(func(key string, val interface{}) {
+			if record, err := source.recordValue(op, val); err == nil {
+				target[record.ID] = record
+			}
+		})
+		if source.nextID > table.nextID {
+			table.nextID = source.nextID
+		}
+	}
+
+	removed := make([]Record, 0)
+	table.records.IterCb(func(key string, val interface{}) {
+		if record, err := table.recordValue(op, val); err == nil {
+			if _, ok := target[record.ID]; !ok {
+				removed = append(removed, record)
+			}
+		}
+	})
+	sort.Slice(removed, func(i, j int) bool { return removed[i].ID < removed[j].ID })
+
+	ids := make([]int, 0, len(target))
+	for id := range target {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	changes := make([]recordChange, 0)
+	for _, id := range ids {
+		record := target[id]
+		if table.hashes != nil && record.Hash == "" {
+			hash, err := contentHash(record.Data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: record %d: %w", op, id, err)
+			}
+			record.Hash = hash
+		}
+
+		var previous *Record
+		if val, ok := table.records.Get(strconv.Itoa(id)); ok {
+			existing, err := table.recordValue(op, val)
+			if err != nil {
+				return nil, nil, err
+			}
+			if reflect.DeepEqual(existing, record) {
+				continue
+			}
+			previous = &existing
+		}
+		if id >= table.nextID {
+			table.nextID = id + 1
+		}
+		changes = append(changes, recordChange{previous: previous, record: record})
+	}
+	return removed, changes, nil
+}
+
+// writeBase writes a base backup to dir.
+func (database *Database) writeBase(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, "base-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	snapshot, err := database.backup(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("base-%020d-%d.tar", snapshot.lsn, snapshot.at.UnixNano())
+	return os.Rename(file.Name(), filepath.Join(dir, name))
+}
+
+// archiveWAL moves the log segment a Save has made redundant into dir,
+// writes a new base once the newest is older than window and removes the
+// bases and segments that are no longer needed to go back window.
+func (database *Database) archiveWAL(folder string, window time.Duration) error {
+	dir := filepath.Join(folder, pitrFolder)
+	segment := filepath.Join(folder, walSegmentName)
+
+	var first, last uint64
+	if file, err := os.Open(segment); err == nil {
+		err = database.readWAL(file, func(group []walEntry) error {
+			if first == 0 {
+				first = group[0].LSN
+			}
+			last = group[len(group)-1].LSN
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if last > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("wal-%020d-%020d.log", first, last)
+		if err := os.Rename(segment, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+		database.log().Debug("write-ahead log archived", "segment", name)
+	} else if err := os.Remove(segment); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	bases, segments, err := readPITR(dir)
+	if err != nil {
+		return err
+	}
+	now := database.now()
+	if len(bases) == 0 || now.Sub(bases[len(bases)-1].at) >= window {
+		if err := database.writeBase(dir); err != nil {
+			return err
+		}
+		if bases, segments, err = readPITR(dir); err != nil {
+			return err
+		}
+	}
+
+	// The oldest base worth keeping is the newest one at least window old.
+	oldest := 0
+	for i := range bases {
+		if now.Sub(bases[i].at) >= window {
+			oldest = i
+		}
+	}
+	for _, base := range bases[:oldest] {
+		if err := os.Remove(filepath.Join(dir, base.file)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for _, segment := range segments {
+		if segment.last <= bases[oldest].lsn {
+			if err := os.Remove(filepath.Join(dir, segment.file)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeSegments rewrites the log segments archived under folder as one,
+// leaving out the entries the oldest base already holds. Entries are
+// copied as they were written, sealed or not.
+func (database *Database) mergeSegments(folder string) error {
+	database.saving.Lock()
+	defer database.saving.Unlock()
+
+	dir := filepath.Join(folder, pitrFolder)
+	bases, segments, err := readPITR(dir)
+	if err != nil {
+		return err
+	}
+	var floor uint64
+	if len(bases) > 0 {
+		floor = bases[0].lsn
+	}
+	if len(segments) == 0 || len(segments) == 1 && segments[0].first > floor {
+		return nil
+	}
+
+	file, err := os.CreateTemp(dir, "wal-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	keys := database.keyProvider()
+	writer := bufio.NewWriter(file)
+	var first, last uint64
+	for _, segment := range segments {
+		if segment.last <= floor {
+			continue
+		}
+		err = func() error {
+			in, err := os.Open(filepath.Join(dir, segment.file))
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+
+			reader := bufio.NewReader(in)
+			for {
+				line, err := reader.ReadBytes('\n')
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				entry, err := decodeWALEntry(keys, line)
+				if err != nil {
+					return fmt.Errorf("%s: %w", segment.file, err)
+				}
+				if entry.LSN <= floor || entry.LSN <= last {
+					continue
+				}
+				if first == 0 {
+					first = entry.LSN
+				}
+				last = entry.LSN
+				if _, err := writer.Write(line); err != nil {
+					return err
+				}
+			}
+		}()
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Restores skip entries they have already applied, so until the old
+	// segments are gone, having them next to the merged one is harmless.
+	merged := fmt.Sprintf("wal-%020d-%020d.log", first, last)
+	if last > 0 {
+		if err := os.Rename(file.Name(), filepath.Join(dir, merged)); err != nil {
+			return err
+		}
+	}
+	for _, segment := range segments {
+		if segment.file == merged {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, segment.file)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	database.log().Debug("write-ahead log segments merged", "segments", len(segments), "into", merged)
+	return nil
+}
+
+// readPITR lists the bases and segments in dir, oldest first.
+func readPITR(dir string) ([]pitrBase, []pitrSegment, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bases []pitrBase
+	var segments []pitrSegment
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasPrefix(name, "base-") && strings.HasSuffix(name, ".tar"):
+			parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, "base-"), ".tar"), "-")
+			if len(parts) != 2 {
+				continue
+			}
+			lsn, err1 := strconv.ParseUint(parts[0], 10, 64)
+			at, err2 := strconv.ParseInt(parts[1], 10, 64)
+			if err1 == nil && err2 == nil {
+				bases = append(bases, pitrBase{file: name, lsn: lsn, at: time.Unix(0, at)})
+			}
+		case strings.HasPrefix(name, "wal-") && strings.HasSuffix(name, ".log"):
+			parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, "wal-"), ".log"), "-")
+			if len(parts) != 2 {
+				continue
+			}
+			first, err1 := strconv.ParseUint(parts[0], 10, 64)
+			last, err2 := strconv.ParseUint(parts[1], 10, 64)
+			if err1 == nil && err2 == nil {
+				segments = append(segments, pitrSegment{file: name, first: first, last: last})
+			}
+		}
+	}
+
+	sort.Slice(bases, func(i, j int) bool { return bases[i].lsn < bases[j].lsn })
+	sort.Slice(segments, func(i, j int) bool { return segments[i].first < segments[j].first })
+	return bases, segments, nil
+}
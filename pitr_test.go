@@ -0,0 +1,87 @@
+package velox
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRestoreToPoint(t *testing.T) {
+	folder := t.TempDir()
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	database, err := New(WithFolder(folder), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := database.GetTable("items")
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.EnableWAL(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetWALRetention(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Minute)
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := table.CreateRecord(map[string]interface{}{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, firstTime := recordsOf(t, table), clock.Now()
+
+	clock.Advance(time.Minute)
+	if err := table.UpdateRecord(1, map[string]interface{}{"name": "a2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.DeleteRecord(2); err != nil {
+		t.Fatal(err)
+	}
+	// Save archives the log so far.
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	second, secondLSN := recordsOf(t, table), database.LSN()
+
+	clock.Advance(time.Minute)
+	tx := database.Begin()
+	tx.Update("items", 3, map[string]interface{}{"name": "c2"})
+	tx.Create("items", map[string]interface{}{"name": "d"})
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	third, thirdLSN := recordsOf(t, table), database.LSN()
+
+	// The first entry of the transaction alone is not a point to stop at.
+	if err := database.RestoreToLSN(secondLSN + 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := recordsOf(t, table); !reflect.DeepEqual(got, second) {
+		t.Fatalf("records at LSN %d = %v, want %v", secondLSN+1, got, second)
+	}
+
+	if err := database.RestoreToTime(firstTime); err != nil {
+		t.Fatal(err)
+	}
+	if got := recordsOf(t, table); !reflect.DeepEqual(got, first) {
+		t.Fatalf("records at %v = %v, want %v", firstTime, got, first)
+	}
+
+	// Restoring is itself logged, so it can be undone.
+	if err := database.RestoreToLSN(thirdLSN); err != nil {
+		t.Fatal(err)
+	}
+	if got := recordsOf(t, table); !reflect.DeepEqual(got, third) {
+		t.Fatalf("records at LSN %d = %v, want %v", thirdLSN, got, third)
+	}
+
+	if err := database.RestoreToTime(firstTime.Add(-time.Hour)); err == nil {
+		t.Fatal("RestoreToTime before the oldest base succeeded")
+	}
+}
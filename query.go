@@ -0,0 +1,414 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ctxCheckInterval is how many records a scan reads between checks of its
+// context.
+const ctxCheckInterval = 1024
+
+type sortKind int
+
+const (
+	sortNumber sortKind = iota + 1
+	sortString
+	sortBool
+)
+
+var sortKindNames = map[sortKind]string{
+	sortNumber: "number",
+	sortString: "string",
+	sortBool:   "bool",
+}
+
+type sortKey struct {
+	kind   sortKind
+	number float64
+	text   string
+}
+
+// QuerySorted returns the records matching predicate ordered by field. Each
+// record's field is read once. Every matching record must have the field,
+// and all values must be numbers, all strings or all bools. Records with
+// equal values are ordered by ID. A nil predicate matches every record.
+func (table *Table) QuerySorted(predicate func(RecordInterface) bool, field string, asc bool) ([]RecordInterface, error) {
+	return table.QuerySortedCtx(context.Background(), predicate, field, asc)
+}
+
+// QuerySortedCtx is QuerySorted that stops scanning once ctx is done.
+func (table *Table) QuerySortedCtx(ctx context.Context, predicate func(RecordInterface) bool, field string, asc bool) (results []RecordInterface, err error) {
+	ctx, done := table.observe(ctx, "QuerySorted")
+	defer func() { done(err) }()
+
+	type match struct {
+		record *Record
+		key    sortKey
+	}
+
+	matches := make([]match, 0)
+	var failure error
+
+	func() {
+		defer table.runlock(table.rlock())
+
+		scanned := 0
+		table.records.IterCb(func(k string, val interface{}) {
+			if failure != nil {
+				return
+			}
+			if scanned++; scanned%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					failure = fmt.Errorf("QuerySorted: %w", err)
+					return
+				}
+			}
+			record, err := table.recordValue("QuerySorted", val)
+			if err != nil || table.hidden(record) {
+				return
+			}
+			if predicate != nil && !predicate(&record) {
+				return
+			}
+
+			value, ok := table.fieldOf(record.Data, field)
+			if !ok {
+				failure = fmt.Errorf("QuerySorted: record %d has no field %q", record.ID, field)
+				return
+			}
+
+			key, err := sortKeyOf(value)
+			if err != nil {
+				failure = fmt.Errorf("QuerySorted: record %d field %q: %w", record.ID, field, err)
+				return
+			}
+			if len(matches) > 0 && matches[0].key.kind != key.kind {
+				failure = fmt.Errorf("QuerySorted: field %q mixes %s and %s values",
+					field, sortKindNames[matches[0].key.kind], sortKindNames[key.kind])
+				return
+			}
+
+			record = table.readable(record)
+			matches = append(matches, match{record: &record, key: key})
+		})
+	}()
+	if failure != nil {
+		return nil, failure
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if c := compareSortKeys(matches[i].key, matches[j].key); c != 0 {
+			return (c < 0) == asc
+		}
+		return matches[i].record.ID < matches[j].record.ID
+	})
+
+	results = make([]RecordInterface, len(matches))
+	for i := range matches {
+		results[i] = matches[i].record
+	}
+	return results, nil
+}
+
+func sortKeyOf(value interface{}) (sortKey, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return sortKey{kind: sortNumber, number: float64(v.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return sortKey{kind: sortNumber, number: float64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return sortKey{kind: sortNumber, number: v.Float()}, nil
+	case reflect.String:
+		return sortKey{kind: sortString, text: v.String()}, nil
+	case reflect.Bool:
+		key := sortKey{kind: sortBool}
+		if v.Bool() {
+			key.number = 1
+		}
+		return key, nil
+	}
+
+	return sortKey{}, fmt.Errorf("unsortable value of type %T", value)
+}
+
+func compareSortKeys(a, b sortKey) int {
+	if a.kind == sortString {
+		switch {
+		case a.text < b.text:
+			return -1
+		case a.text > b.text:
+			return 1
+		}
+		return 0
+	}
+
+	switch {
+	case a.number < b.number:
+		return -1
+	case a.number > b.number:
+		return 1
+	}
+	return 0
+}
+
+// QuerySnapshot copies the table's records under a short read lock and
+// then runs predicate over the copy with no table lock held, so a slow scan
+// doesn't block writers. Results reflect the table as of the copy: writes
+// made after QuerySnapshot starts are not seen. A nil predicate matches
+// every record.
+func (table *Table) QuerySnapshot(predicate func(RecordInterface) bool) ([]RecordInterface, error) {
+	snapshot := table.snapshot("QuerySnapshot")
+
+	results := make([]RecordInterface, 0)
+	for i := range snapshot {
+		if predicate == nil || predicate(&snapshot[i]) {
+			record := table.readable(snapshot[i])
+			results = append(results, &record)
+		}
+	}
+	return results, nil
+}
+
+func (table *Table) snapshot(op string) []Record {
+	defer table.runlock(table.rlock())
+
+	records := make([]Record, 0, table.records.Count())
+	table.records.IterCb(func(key string, val interface{}) {
+		if record, err := table.recordValue(op, val); err == nil && !table.hidden(record) {
+			records = append(records, record)
+		}
+	})
+	return records
+}
+
+// Query returns the records matching predicate ordered by ID. A nil
+// predicate matches every record.
+func (table *Table) Query(predicate func(RecordInterface) bool) ([]RecordInterface, error) {
+	return table.QueryCtx(context.Background(), predicate)
+}
+
+// QueryCtx is Query that stops scanning once ctx is done.
+func (table *Table) QueryCtx(ctx context.Context, predicate func(RecordInterface) bool) (results []RecordInterface, err error) {
+	ctx, done := table.observe(ctx, "Query")
+	defer func() { done(err) }()
+	defer table.runlock(table.rlock())
+
+	matches := make([]*Record, 0)
+	scanned := 0
+	var failure error
+	table.records.IterCb(func(key string, val interface{}) {
+		if failure != nil {
+			return
+		}
+		if scanned++; scanned%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				failure = fmt.Errorf("Query: %w", err)
+				return
+			}
+		}
+		record, err := table.recordValue("Query", val)
+		if err != nil || table.hidden(record) {
+			return
+		}
+		if predicate == nil || predicate(&record) {
+			record = table.readable(record)
+			matches = append(matches, &record)
+		}
+	})
+
+	if failure != nil {
+		return nil, failure
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	results = make([]RecordInterface, len(matches))
+	for i := range matches {
+		results[i] = matches[i]
+	}
+	return results, nil
+}
+
+// QueryBuilder builds a query from field conditions, for example
+// table.Where("age", ">", 30).OrderBy("name").Limit(10).Run(). Problems
+// with the query itself are reported by Run.
+type QueryBuilder struct {
+	table      *Table
+	conditions []condition
+	orderBy    string
+	desc       bool
+	limit      int
+	limited    bool
+	err        error
+}
+
+type condition struct {
+	field string
+	op    string
+	value interface{}
+	// meta is set for conditions on a metadata key rather than a field
+	// of the data.
+	meta bool
+}
+
+// Select starts a query that matches every record.
+func (table *Table) Select() *QueryBuilder {
+	return &QueryBuilder{table: table}
+}
+
+// Where starts a query with a single condition. See QueryBuilder.Where.
+func (table *Table) Where(field, op string, value interface{}) *QueryBuilder {
+	return table.Select().Where(field, op, value)
+}
+
+// Where adds a condition that every result must meet. op is one of =, ==,
+// !=, <, <=, > and >=. Numbers compare with numbers, strings with strings
+// and bools with bools; a record whose field is missing or holds another
+// kind of value doesn't match, whatever op is. Values that are none of
+// those kinds can only be compared with = and !=.
+func (query *QueryBuilder) Where(field, op string, value interface{}) *QueryBuilder {
+	switch op {
+	case "=", "==", "!=", "<", "<=", ">", ">=":
+	default:
+		if query.err == nil {
+			query.err = fmt.Errorf("Query: unknown operator %q", op)
+		}
+	}
+
+	query.conditions = append(query.conditions, condition{field: field, op: op, value: value})
+	return query
+}
+
+// WhereMeta starts a query with a single metadata condition. See
+// QueryBuilder.WhereMeta.
+func (table *Table) WhereMeta(key, op, value string) *QueryBuilder {
+	return table.Select().WhereMeta(key, op, value)
+}
+
+// WhereMeta adds a condition on the record metadata set with SetMeta. It
+// takes the same operators as Where and compares the strings byte by
+// byte; a record without the key doesn't match.
+func (query *QueryBuilder) WhereMeta(key, op, value string) *QueryBuilder {
+	query.Where(key, op, value)
+	query.conditions[len(query.conditions)-1].meta = true
+	return query
+}
+
+// OrderBy sorts the results by field in ascending order, as QuerySorted
+// does.
+func (query *QueryBuilder) OrderBy(field string) *QueryBuilder {
+	query.orderBy = field
+	query.desc = false
+	return query
+}
+
+func (query *QueryBuilder) OrderByDesc(field string) *QueryBuilder {
+	query.orderBy = field
+	query.desc = true
+	return query
+}
+
+// Limit caps the number of results. Without OrderBy the first n records
+// by ID are returned.
+func (query *QueryBuilder) Limit(n int) *QueryBuilder {
+	if n < 0 && query.err == nil {
+		query.err = errors.New("Query: negative limit")
+	}
+
+	query.limit = n
+	query.limited = true
+	return query
+}
+
+func (query *QueryBuilder) Run() ([]RecordInterface, error) {
+	return query.RunCtx(context.Background())
+}
+
+func (query *QueryBuilder) RunCtx(ctx context.Context) ([]RecordInterface, error) {
+	if query.err != nil {
+		return nil, query.err
+	}
+
+	var results []RecordInterface
+	var err error
+	if query.orderBy != "" {
+		results, err = query.table.QuerySortedCtx(ctx, query.matches, query.orderBy, !query.desc)
+	} else {
+		results, err = query.table.QueryCtx(ctx, query.matches)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if query.limited && len(results) > query.limit {
+		results = results[:query.limit]
+	}
+	return results, nil
+}
+
+func (query *QueryBuilder) matches(record RecordInterface) bool {
+	for _, cond := range query.conditions {
+		if cond.meta {
+			value, ok := record.GetMeta()[cond.field]
+			if !ok || !cond.compare(value) {
+				return false
+			}
+			continue
+		}
+		if !cond.matches(query.table, record.GetData()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cond condition) matches(table *Table, data interface{}) bool {
+	value, ok := table.fieldOf(data, cond.field)
+	if !ok {
+		return false
+	}
+	return cond.compare(value)
+}
+
+// compare reports whether value meets the condition.
+func (cond condition) compare(value interface{}) bool {
+	have, haveErr := sortKeyOf(value)
+	want, wantErr := sortKeyOf(cond.value)
+	if haveErr != nil || wantErr != nil {
+		if haveErr == nil || wantErr == nil {
+			return false
+		}
+		switch cond.op {
+		case "=", "==":
+			return reflect.DeepEqual(value, cond.value)
+		case "!=":
+			return !reflect.DeepEqual(value, cond.value)
+		}
+		return false
+	}
+	if have.kind != want.kind {
+		return false
+	}
+
+	c := compareSortKeys(have, want)
+	switch cond.op {
+	case "=", "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
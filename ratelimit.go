@@ -0,0 +1,124 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("write rate limit exceeded")
+
+type RateLimitMode int
+
+const (
+	// RateLimitBlock makes writes wait until the limiter lets them through.
+	RateLimitBlock RateLimitMode = iota
+	// RateLimitReject makes writes over the limit fail with ErrRateLimited.
+	RateLimitReject
+)
+
+// rateLimiter is a token bucket refilled at rate tokens per second, holding
+// at most one second worth of tokens. A rate of zero means unlimited.
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	mode   RateLimitMode
+	sync.Mutex
+}
+
+// SetWriteRateLimit caps mutating record operations across all tables of
+// the database at opsPerSec. Zero or less removes the limit. Reads are never
+// limited.
+func (database *Database) SetWriteRateLimit(opsPerSec int) {
+	now := database.now()
+
+	database.limiter.Lock()
+	defer database.limiter.Unlock()
+
+	if opsPerSec <= 0 {
+		database.limiter.rate = 0
+		return
+	}
+
+	database.limiter.rate = float64(opsPerSec)
+	database.limiter.tokens = float64(opsPerSec)
+	database.limiter.last = now
+}
+
+func (database *Database) SetWriteRateLimitMode(mode RateLimitMode) {
+	database.limiter.Lock()
+	defer database.limiter.Unlock()
+
+	database.limiter.mode = mode
+}
+
+// wait takes a token, sleeping until one is available in RateLimitBlock
+// mode. A token taken for a wait that ctx cuts short is given back.
+func (limiter *rateLimiter) wait(ctx context.Context, now time.Time) error {
+	limiter.Lock()
+
+	if limiter.rate == 0 {
+		limiter.Unlock()
+		return nil
+	}
+
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.rate {
+		limiter.tokens = limiter.rate
+	}
+	limiter.last = now
+
+	if limiter.tokens >= 1 {
+		limiter.tokens--
+		limiter.Unlock()
+		return nil
+	}
+
+	if limiter.mode == RateLimitReject {
+		limiter.Unlock()
+		return ErrRateLimited
+	}
+
+	delay := time.Duration((1 - limiter.tokens) / limiter.rate * float64(time.Second))
+	limiter.tokens--
+	limiter.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		limiter.Lock()
+		limiter.tokens++
+		limiter.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (table *Table) throttle(op string) error {
+	return table.throttleCtx(context.Background(), op, PermissionWrite)
+}
+
+// throttleCtx checks that the principal of ctx has permission on the
+// table and waits for the database's rate limit.
+func (table *Table) throttleCtx(ctx context.Context, op string, permission Permission) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if table.database == nil {
+		return nil
+	}
+
+	if err := table.authorize(ctx, permission); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := table.database.limiter.wait(ctx, table.database.now()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
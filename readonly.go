@@ -0,0 +1,37 @@
+package velox
+
+import "errors"
+
+// ErrReadOnly is returned by writes to a database opened with
+// OpenReadOnly.
+var ErrReadOnly = errors.New("database is read-only")
+
+// OpenReadOnly loads the database in folder for reading only. Creating,
+// changing and deleting records, creating, dropping and renaming tables,
+// changing their settings, such as indexes and hooks, blobs, Import, Save,
+// the write-ahead log and point-in-time recovery all fail with
+// ErrReadOnly, and nothing is ever written to folder, not even the lock
+// file, so any number of read-only openers can share a folder with each
+// other and with the process that writes it. They see the folder as of
+// when it was loaded.
+//
+// Use New with WithReadOnly for a read-only database with other options,
+// such as an encryption key.
+func OpenReadOnly(folder string) (*Database, error) {
+	database, err := New(WithReadOnly())
+	if err != nil {
+		return nil, err
+	}
+	if err := database.Load(folder); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// WithReadOnly makes the database read-only; see OpenReadOnly. WithLoad
+// loads it, and fails if there is nothing to load.
+func WithReadOnly() Option {
+	return func(config *options) {
+		config.readOnly = true
+	}
+}
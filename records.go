@@ -0,0 +1,95 @@
+package velox
+
+import "sync"
+
+const defaultShardCount = 32
+
+// recordMap is the sharded map holding a table's records. It mirrors the
+// parts of cmap.ConcurrentMap the table uses, but lets each table pick its
+// shard count and presize the shards for an expected number of records.
+type recordMap []*recordShard
+
+type recordShard struct {
+	items map[string]interface{}
+	sync.RWMutex
+}
+
+func newRecordMap(shards, capacity int) *recordMap {
+	if shards <= 0 {
+		shards = defaultShardCount
+	}
+
+	m := make(recordMap, shards)
+	for i := range m {
+		m[i] = &recordShard{items: make(map[string]interface{}, capacity/shards)}
+	}
+	return &m
+}
+
+func (m recordMap) shard(key string) *recordShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash *= 16777619
+		hash ^= uint32(key[i])
+	}
+	return m[hash%uint32(len(m))]
+}
+
+func (m recordMap) Get(key string) (interface{}, bool) {
+	shard := m.shard(key)
+	shard.RLock()
+	val, ok := shard.items[key]
+	shard.RUnlock()
+	return val, ok
+}
+
+func (m recordMap) Set(key string, value interface{}) {
+	shard := m.shard(key)
+	shard.Lock()
+	shard.items[key] = value
+	shard.Unlock()
+}
+
+func (m recordMap) Remove(key string) {
+	shard := m.shard(key)
+	shard.Lock()
+	delete(shard.items, key)
+	shard.Unlock()
+}
+
+func (m recordMap) Count() int {
+	count := 0
+	for _, shard := range m {
+		shard.RLock()
+		count += len(shard.items)
+		shard.RUnlock()
+	}
+	return count
+}
+
+// IterCb calls fn for every record while holding each shard's read lock in
+// turn, so fn must not write to the same map.
+func (m recordMap) IterCb(fn func(key string, val interface{})) {
+	for _, shard := range m {
+		shard.RLock()
+		for key, val := range shard.items {
+			fn(key, val)
+		}
+		shard.RUnlock()
+	}
+}
+
+// compact copies each shard into a map sized for what it holds now. Go maps
+// never shrink, so a shard that once held many more records keeps their
+// buckets until it is rebuilt.
+func (m recordMap) compact() {
+	for _, shard := range m {
+		shard.Lock()
+		items := make(map[string]interface{}, len(shard.items))
+		for key, val := range shard.items {
+			items[key] = val
+		}
+		shard.items = items
+		shard.Unlock()
+	}
+}
@@ -0,0 +1,110 @@
+package velox
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+type Reference struct {
+	FromTable string
+	Field     string
+	ToTable   string
+}
+
+type DanglingRef struct {
+	Reference
+	RecordID int
+	Value    interface{}
+}
+
+// CheckReferences scans FromTable for each reference and reports records
+// whose Field holds an ID that doesn't exist in ToTable. Records with the
+// field missing or nil are not references and are skipped. Values that
+// can't be read as an ID are reported as dangling. Nothing is modified.
+func (database *Database) CheckReferences(refs []Reference) ([]DanglingRef, error) {
+	dangling := make([]DanglingRef, 0)
+
+	for _, ref := range refs {
+		from, err := database.table(ref.FromTable)
+		if err != nil {
+			return nil, fmt.Errorf("CheckReferences: %w", err)
+		}
+		to, err := database.table(ref.ToTable)
+		if err != nil {
+			return nil, fmt.Errorf("CheckReferences: %w", err)
+		}
+
+		found := make([]DanglingRef, 0)
+		func() {
+			defer from.runlock(from.rlock())
+
+			from.records.IterCb(func(key string, val interface{}) {
+				record, err := from.recordValue("CheckReferences", val)
+				if err != nil {
+					return
+				}
+
+				value, ok := fieldValue(record.Data, ref.Field)
+				if !ok || value == nil {
+					return
+				}
+
+				if id, ok := referencedID(value); ok {
+					if _, exists := to.records.Get(strconv.Itoa(id)); exists {
+						return
+					}
+				}
+				found = append(found, DanglingRef{Reference: ref, RecordID: record.ID, Value: value})
+			})
+		}()
+
+		sort.Slice(found, func(i, j int) bool { return found[i].RecordID < found[j].RecordID })
+		dangling = append(dangling, found...)
+	}
+
+	return dangling, nil
+}
+
+func (database *Database) table(name string) (*Table, error) {
+	val, ok := database.tables.Get(name)
+	if !ok {
+		if err := database.hydrate(name); err != nil {
+			return nil, &TableError{Table: name, Err: err}
+		}
+		if val, ok = database.tables.Get(name); !ok {
+			return nil, &TableError{Table: name, Err: ErrNotFound}
+		}
+	}
+
+	table, ok := val.(*Table)
+	if !ok {
+		database.log().Error("unexpected value in table map", "table", name, "type", fmt.Sprintf("%T", val))
+		return nil, fmt.Errorf("table %s: %w", name, ErrInvalidTableType)
+	}
+	return table, nil
+}
+
+// referencedID reads a field value as a record ID. Whole numbers of any
+// numeric type and decimal strings are accepted, since IDs stored as JSON
+// come back as float64.
+func referencedID(value interface{}) (int, bool) {
+	v := reflect.ValueOf(value)
+	switch {
+	case v.CanInt():
+		return int(v.Int()), true
+	case v.CanUint():
+		return int(v.Uint()), true
+	case v.CanFloat():
+		f := v.Float()
+		if f != float64(int(f)) {
+			return 0, false
+		}
+		return int(f), true
+	case v.Kind() == reflect.String:
+		id, err := strconv.Atoi(v.String())
+		return id, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,176 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Relation declares that Field of Table holds IDs of records in
+// References. It is a foreign key, with OnDelete deciding what happens to
+// the records of Table when the record they reference is deleted, and
+// additionally has a Name that GetRelated follows from Table to
+// References. The optional Inverse names the way back.
+type Relation struct {
+	Name       string
+	Table      string
+	Field      string
+	References string
+	OnDelete   ForeignKeyAction
+	Inverse    string
+}
+
+// AddRelation adds the foreign key relation describes. Each table's
+// relations, including the inverse ones that lead to it, must have
+// distinct names.
+func (database *Database) AddRelation(relation Relation) error {
+	if relation.Name == "" || relation.Table == "" || relation.Field == "" || relation.References == "" {
+		return errors.New("AddRelation: name, table, field and referenced table are required")
+	}
+
+	table, err := database.table(relation.Table)
+	if err != nil {
+		return fmt.Errorf("AddRelation: %w", err)
+	}
+	refTable, err := database.table(relation.References)
+	if err != nil {
+		return fmt.Errorf("AddRelation: %w", err)
+	}
+
+	return table.addForeignKey("AddRelation", relation.Field, refTable, relation.OnDelete, relation.Name, relation.Inverse)
+}
+
+// GetRelated follows the named relation from record id of table. For a
+// relation declared on table it returns the referenced record; for an
+// inverse relation, the records that reference record id, ordered by ID.
+// A reference that is missing, nil or dangling gives no records.
+func (database *Database) GetRelated(table string, id int, relation string) ([]RecordInterface, error) {
+	from, err := database.table(table)
+	if err != nil {
+		return nil, fmt.Errorf("GetRelated: %w", err)
+	}
+
+	record, err := from.liveRecord("GetRelated", id)
+	if err != nil {
+		return nil, err
+	}
+
+	database.RWMutex.RLock()
+	fk, inverse, ok := from.relation(relation)
+	var field, toName string
+	var to *Table
+	if ok {
+		field, to, toName = fk.field, fk.parent, fk.parentName
+		if inverse {
+			to = fk.child
+		}
+	}
+	database.RWMutex.RUnlock()
+
+	if !ok {
+		return nil, &TableError{Op: "GetRelated", Table: table, Err: fmt.Errorf("relation %q: %w", relation, ErrNotFound)}
+	}
+	if to == nil {
+		return nil, fmt.Errorf("GetRelated: referenced table %s is not loaded", toName)
+	}
+
+	if inverse {
+		return to.referencing(field, id), nil
+	}
+
+	value, ok := fieldValue(record.Data, field)
+	if !ok || value == nil {
+		return []RecordInterface{}, nil
+	}
+	refID, ok := referencedID(value)
+	if !ok {
+		return []RecordInterface{}, nil
+	}
+	related, err := to.liveRecord("GetRelated", refID)
+	if errors.Is(err, ErrNotFound) {
+		return []RecordInterface{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	related = to.readable(related)
+	return []RecordInterface{&related}, nil
+}
+
+// relation finds the foreign key named name from table, and reports
+// whether it leads back to table as an inverse relation. Callers hold the
+// database lock.
+func (table *Table) relation(name string) (*foreignKey, bool, bool) {
+	for _, fk := range table.foreignKeys {
+		if fk.name == name {
+			return fk, false, true
+		}
+	}
+	for _, fk := range table.referencedBy {
+		if fk.inverse == name {
+			return fk, true, true
+		}
+	}
+	return nil, false, false
+}
+
+// checkRelationNames checks that name and inverse are free on the tables
+// they would be added to. Callers hold the database lock.
+func checkRelationNames(table, refTable *Table, name, inverse string) error {
+	if name != "" {
+		if _, _, taken := table.relation(name); taken {
+			return fmt.Errorf("table %s already has a relation %q", table.name, name)
+		}
+	}
+	if inverse != "" {
+		if _, _, taken := refTable.relation(inverse); taken || (table == refTable && inverse == name) {
+			return fmt.Errorf("table %s already has a relation %q", refTable.name, inverse)
+		}
+	}
+	return nil
+}
+
+// liveRecord returns record id unless it is missing or expired.
+func (table *Table) liveRecord(op string, id int) (Record, error) {
+	defer table.runlock(table.rlock())
+
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return Record{}, table.notFound(op, id)
+	}
+	record, err := table.recordValue(op, val)
+	if err != nil {
+		return Record{}, err
+	}
+	if table.hidden(record) {
+		return Record{}, table.notFound(op, id)
+	}
+	return record, nil
+}
+
+// referencing returns the live records whose field references id, ordered
+// by ID.
+func (table *Table) referencing(field string, id int) []RecordInterface {
+	defer table.runlock(table.rlock())
+
+	var records []Record
+	table.records.IterCb(func(key string, val interface{}) {
+		record, err := table.recordValue("GetRelated", val)
+		if err != nil || table.hidden(record) {
+			return
+		}
+		if value, ok := fieldValue(record.Data, field); ok && value != nil {
+			if refID, ok := referencedID(value); ok && refID == id {
+				records = append(records, table.readable(record))
+			}
+		}
+	})
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	results := make([]RecordInterface, len(records))
+	for i := range records {
+		results[i] = &records[i]
+	}
+	return results
+}
@@ -0,0 +1,582 @@
+package velox
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ErrReplica is returned by writes to a database that follows a primary.
+var ErrReplica = errors.New("database is a read-only replica")
+
+// Replication streams the entries a primary logs, encoded as in the
+// write-ahead log, over TCP. A replica connecting sends a replicationHello
+// saying how far it got; the primary answers with a replicationSync and,
+// unless the replica can carry on from where it was, an archive written
+// by Backup, then sends entries as they are logged.
+type replicationHello struct {
+	// ID is the primary the replica last synced from, empty if none.
+	ID  string `json:"id"`
+	LSN uint64 `json:"lsn"`
+}
+
+type replicationSync struct {
+	ID  string `json:"id"`
+	LSN uint64 `json:"lsn"`
+	// Snapshot is the size of the archive that follows, zero when the
+	// replica carries on from LSN.
+	Snapshot int64 `json:"snapshot,omitempty"`
+}
+
+// replicationBacklog is how many recent entries a primary keeps for
+// replicas that reconnect, and how far a replica may fall behind before it
+// is disconnected and has to resync.
+const replicationBacklog = 65536
+
+// Primary serves the changes of a database to replicas. Close stops it.
+type Primary struct {
+	database *Database
+	listener net.Listener
+	// id tells replicas whether they synced from this primary, as LSNs
+	// alone don't: a database loaded again can log different entries
+	// under the same numbers.
+	id string
+
+	mu        sync.Mutex
+	backlog   []replicatedEntry
+	last      uint64
+	followers map[*follower]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+type replicatedEntry struct {
+	lsn  uint64
+	line []byte
+}
+
+type follower struct {
+	conn  net.Conn
+	queue []replicatedEntry
+	ready chan struct{}
+	done  bool
+}
+
+// Replicate makes database a primary, serving its changes to replicas that
+// connect to addr with FollowPrimary. Every create, update, delete, table
+// drop and rename is sent as it is logged, whether or not the write-ahead
+// log is enabled. A replica that connects for the first time, falls too
+// far behind or reconnects after the primary was restarted is sent the
+// whole database first. Table settings such as indexes are only sent then.
+// Connections are neither authenticated nor encrypted, though with
+// encryption on the data sent is.
+func Replicate(database *Database, addr string) (*Primary, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("Replicate: %w", err)
+	}
+
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	if database.primary != nil {
+		return nil, errors.New("Replicate: database is already a primary")
+	}
+	if database.follower {
+		return nil, fmt.Errorf("Replicate: %w", ErrReplica)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Replicate: %w", err)
+	}
+	primary := &Primary{
+		database:  database,
+		listener:  listener,
+		id:        hex.EncodeToString(id),
+		last:      database.lsn.Load(),
+		followers: make(map[*follower]struct{}),
+	}
+	database.primary = primary
+
+	primary.wg.Add(1)
+	go primary.serve()
+	return primary, nil
+}
+
+// Addr returns the address the primary listens on.
+func (primary *Primary) Addr() net.Addr {
+	return primary.listener.Addr()
+}
+
+// Replicas returns how many replicas are connected.
+func (primary *Primary) Replicas() int {
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+
+	return len(primary.followers)
+}
+
+// Close stops serving replicas and disconnects them.
+func (primary *Primary) Close() error {
+	database := primary.database
+	database.RWMutex.Lock()
+	if database.primary == primary {
+		database.primary = nil
+	}
+	database.RWMutex.Unlock()
+
+	primary.mu.Lock()
+	if primary.closed {
+		primary.mu.Unlock()
+		return nil
+	}
+	primary.closed = true
+	for f := range primary.followers {
+		primary.drop(f)
+	}
+	primary.mu.Unlock()
+
+	err := primary.listener.Close()
+	primary.wg.Wait()
+	if err != nil {
+		return fmt.Errorf("Primary_Close: %w", err)
+	}
+	return nil
+}
+
+func (primary *Primary) serve() {
+	defer primary.wg.Done()
+
+	for {
+		conn, err := primary.listener.Accept()
+		if err != nil {
+			return
+		}
+		primary.wg.Add(1)
+		go primary.handle(conn)
+	}
+}
+
+// publish queues logged entries for every replica. Callers hold
+// database.sequence, so entries arrive in order.
+func (primary *Primary) publish(entries []replicatedEntry) {
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+
+	if len(primary.backlog)+len(entries) > 2*replicationBacklog {
+		keep := replicationBacklog
+		if keep > len(primary.backlog) {
+			keep = len(primary.backlog)
+		}
+		primary.backlog = append(primary.backlog[:0:0], primary.backlog[len(primary.backlog)-keep:]...)
+	}
+	primary.backlog = append(primary.backlog, entries...)
+	primary.last = entries[len(entries)-1].lsn
+
+	for f := range primary.followers {
+		if len(f.queue) >= replicationBacklog {
+			primary.drop(f)
+			continue
+		}
+		f.queue = append(f.queue, entries...)
+		select {
+		case f.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// since returns the entries after lsn, or false if some of them are no
+// longer in the backlog. Callers hold primary.mu.
+func (primary *Primary) since(lsn uint64) ([]replicatedEntry, bool) {
+	if lsn == primary.last {
+		return nil, true
+	}
+	if lsn > primary.last || len(primary.backlog) == 0 || primary.backlog[0].lsn > lsn+1 {
+		return nil, false
+	}
+	// The backlog is numbered without gaps.
+	start := int(lsn + 1 - primary.backlog[0].lsn)
+	return append([]replicatedEntry(nil), primary.backlog[start:]...), true
+}
+
+// drop disconnects a replica. Callers hold primary.mu.
+func (primary *Primary) drop(f *follower) {
+	delete(primary.followers, f)
+	f.done = true
+	f.conn.Close()
+	select {
+	case f.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (primary *Primary) handle(conn net.Conn) {
+	defer primary.wg.Done()
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var hello replicationHello
+	if err := jsoniter.Unmarshal(line, &hello); err != nil {
+		return
+	}
+
+	f := &follower{conn: conn, ready: make(chan struct{}, 1)}
+	reply := replicationSync{ID: primary.id, LSN: hello.LSN}
+
+	primary.mu.Lock()
+	if primary.closed {
+		primary.mu.Unlock()
+		return
+	}
+	resume := false
+	if hello.ID == primary.id {
+		f.queue, resume = primary.since(hello.LSN)
+	}
+	primary.followers[f] = struct{}{}
+	primary.mu.Unlock()
+
+	log := primary.database.log()
+	log.Info("replica connected", "replica", conn.RemoteAddr().String(), "full_sync", !resume)
+	defer func() {
+		primary.mu.Lock()
+		if !f.done {
+			primary.drop(f)
+		}
+		primary.mu.Unlock()
+		log.Info("replica disconnected", "replica", conn.RemoteAddr().String())
+	}()
+
+	// The replica is registered before the snapshot is taken, so every
+	// entry the snapshot misses is queued for it.
+	var archive bytes.Buffer
+	if !resume {
+		snapshot, err := primary.database.backup(&archive)
+		if err != nil {
+			log.Error("taking snapshot for replica failed", "replica", conn.RemoteAddr().String(), "error", err)
+			return
+		}
+		reply.LSN = snapshot.lsn
+		reply.Snapshot = int64(archive.Len())
+	}
+
+	header, err := jsoniter.Marshal(reply)
+	if err != nil {
+		return
+	}
+	writer := bufio.NewWriter(conn)
+	writer.Write(append(header, '\n'))
+	writer.Write(archive.Bytes())
+	if err := writer.Flush(); err != nil {
+		return
+	}
+
+	for {
+		primary.mu.Lock()
+		queue, done := f.queue, f.done
+		f.queue = nil
+		primary.mu.Unlock()
+		if done {
+			return
+		}
+
+		for _, entry := range queue {
+			if entry.lsn > reply.LSN {
+				writer.Write(entry.line)
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return
+		}
+		<-f.ready
+	}
+}
+
+// replicaRetry is how long a replica waits before reconnecting at first.
+// The wait doubles up to maxReplicaRetry while the primary stays
+// unreachable.
+const (
+	replicaRetry    = 100 * time.Millisecond
+	maxReplicaRetry = 10 * time.Second
+)
+
+// Replica keeps a read-only copy of a primary's database. Close stops it.
+type Replica struct {
+	database *Database
+	addr     string
+	folder   string
+
+	mu        sync.Mutex
+	conn      net.Conn
+	primaryID string
+	lastErr   error
+	closed    bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// FollowPrimary connects to the primary at addr and returns a replica
+// holding a copy of its database, kept in folder. It returns once the copy
+// is in sync. Changes are then applied as they arrive, the way Load
+// replays the write-ahead log: without hooks, watchers or history. If the
+// connection drops, the replica reconnects and catches up or, if it
+// missed too much, resyncs. Writes to the replica's database fail with
+// ErrReplica. Save writes the copy to folder, and Load on a later start
+// picks it up, though the first sync still compares it with the primary.
+func FollowPrimary(addr, folder string) (*Replica, error) {
+	return FollowPrimaryWithKeys(addr, folder, nil)
+}
+
+// FollowPrimaryWithKeys is FollowPrimary for a primary with encryption on,
+// with keys being the primary's keys.
+func FollowPrimaryWithKeys(addr, folder string, keys KeyProvider) (*Replica, error) {
+	database := NewDatabase()
+	database.keys = keys
+	if _, err := os.Stat(filepath.Join(folder, "master.json")); err == nil {
+		if err := database.Load(folder); err != nil {
+			return nil, fmt.Errorf("FollowPrimary: %w", err)
+		}
+	} else if err := os.MkdirAll(folder, 0755); err != nil {
+		return nil, fmt.Errorf("FollowPrimary: %w", err)
+	} else {
+		database.SetFolder(folder)
+	}
+	database.follower = true
+
+	replica := &Replica{database: database, addr: addr, folder: folder, stop: make(chan struct{}), done: make(chan struct{})}
+	reader, err := replica.connect()
+	if err != nil {
+		return nil, fmt.Errorf("FollowPrimary: %w", err)
+	}
+
+	go replica.run(reader)
+	return replica, nil
+}
+
+// Database returns the replica's copy of the database.
+func (replica *Replica) Database() *Database {
+	return replica.database
+}
+
+// Err returns why the replica last lost its connection to the primary, or
+// nil if it hasn't.
+func (replica *Replica) Err() error {
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+
+	return replica.lastErr
+}
+
+// Close stops following the primary. The database stays readable.
+func (replica *Replica) Close() error {
+	replica.mu.Lock()
+	if replica.closed {
+		replica.mu.Unlock()
+		return nil
+	}
+	replica.closed = true
+	close(replica.stop)
+	if replica.conn != nil {
+		replica.conn.Close()
+	}
+	replica.mu.Unlock()
+
+	<-replica.done
+	return nil
+}
+
+func (replica *Replica) run(reader *bufio.Reader) {
+	defer close(replica.done)
+
+	retry := replicaRetry
+	for {
+		if reader != nil {
+			err := replica.database.readWAL(reader, replica.apply)
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			replica.mu.Lock()
+			replica.conn.Close()
+			replica.conn = nil
+			if replica.closed {
+				replica.mu.Unlock()
+				return
+			}
+			replica.lastErr = err
+			replica.mu.Unlock()
+			replica.database.log().Warn("lost connection to primary", "primary", replica.addr, "error", err)
+			retry = replicaRetry
+		}
+
+		select {
+		case <-time.After(retry):
+		case <-replica.stop:
+			return
+		}
+		if retry *= 2; retry > maxReplicaRetry {
+			retry = maxReplicaRetry
+		}
+
+		var err error
+		if reader, err = replica.connect(); err != nil {
+			replica.mu.Lock()
+			replica.lastErr = err
+			replica.mu.Unlock()
+			replica.database.log().Debug("reconnecting to primary failed", "primary", replica.addr, "retry", retry, "error", err)
+		}
+	}
+}
+
+// connect says hello to the primary and applies the snapshot it sends, if
+// any. It returns the connection to read entries from.
+func (replica *Replica) connect() (*bufio.Reader, error) {
+	conn, err := net.Dial("tcp", replica.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	replica.mu.Lock()
+	if replica.closed {
+		replica.mu.Unlock()
+		conn.Close()
+		return nil, errors.New("replica closed")
+	}
+	replica.conn = conn
+	hello := replicationHello{ID: replica.primaryID, LSN: replica.database.lsn.Load()}
+	replica.mu.Unlock()
+
+	reader, err := replica.sync(conn, hello)
+	if err != nil {
+		replica.mu.Lock()
+		replica.conn = nil
+		replica.mu.Unlock()
+		conn.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (replica *Replica) sync(conn net.Conn, hello replicationHello) (*bufio.Reader, error) {
+	line, err := jsoniter.Marshal(hello)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	if line, err = reader.ReadBytes('\n'); err != nil {
+		return nil, err
+	}
+	var reply replicationSync
+	if err := jsoniter.Unmarshal(line, &reply); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+
+	if reply.Snapshot > 0 {
+		recovered, err := loadArchive(io.LimitReader(reader, reply.Snapshot), replica.folder, replica.database.keyProvider())
+		if err != nil {
+			return nil, err
+		}
+		if err := replica.database.resync(recovered); err != nil {
+			return nil, err
+		}
+		replica.database.lsn.Store(reply.LSN)
+	}
+
+	replica.mu.Lock()
+	replica.primaryID = reply.ID
+	replica.mu.Unlock()
+	replica.database.log().Info("connected to primary", "primary", replica.addr, "full_sync", reply.Snapshot > 0, "lsn", reply.LSN)
+	return reader, nil
+}
+
+// apply applies the entries of a write received from the primary.
+func (replica *Replica) apply(group []walEntry) error {
+	for _, entry := range group {
+		if entry.LSN <= replica.database.lsn.Load() {
+			continue
+		}
+		if err := replica.database.replayEntry(entry); err != nil {
+			return err
+		}
+		replica.database.lsn.Store(entry.LSN)
+	}
+	return nil
+}
+
+// resync makes the tables match recovered. Tables the database doesn't
+// have yet are taken over with their settings; the records of the others
+// are brought in line one by one, so tables and records handed out
+// earlier stay valid.
+func (database *Database) resync(recovered *Database) error {
+	names := make(map[string]bool)
+	var adopted bool
+	var invalid error
+	recovered.tables.IterCb(func(name string, val interface{}) {
+		source, ok := val.(*Table)
+		if !ok {
+			return
+		}
+		names[name] = true
+
+		current, err := database.table(name)
+		if err != nil {
+			database.attach(name, source)
+			database.tables.Set(name, source)
+			adopted = true
+			return
+		}
+
+		defer current.unlock(current.lock())
+		removed, changes, err := current.diffRecords("Replica", source)
+		if err != nil {
+			invalid = err
+			return
+		}
+		for _, record := range removed {
+			current.removeRecord(record)
+		}
+		for _, change := range changes {
+			current.setRecord(change.previous, change.record)
+		}
+		current.modified()
+	})
+	if invalid != nil {
+		return invalid
+	}
+
+	var stale []string
+	database.tables.IterCb(func(name string, val interface{}) {
+		if !names[name] {
+			stale = append(stale, name)
+		}
+	})
+	for _, name := range stale {
+		if err := database.replayDrop(name); err != nil {
+			return err
+		}
+	}
+
+	if adopted {
+		database.resolveForeignKeys()
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package velox
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitForRecords waits until table holds want.
+func waitForRecords(t *testing.T, table *Table, want map[int]string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got := recordsOf(t, table)
+		if reflect.DeepEqual(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("replica records = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplicaResync(t *testing.T) {
+	database, err := New(WithFolder(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := database.GetTable("items")
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := table.CreateRecord(map[string]interface{}{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	primary, err := Replicate(database, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := primary.Addr().String()
+	replica, err := FollowPrimary(addr, t.TempDir())
+	if err != nil {
+		primary.Close()
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	copied, err := replica.Database().GetTable("items")
+	if err != nil {
+		primary.Close()
+		t.Fatal(err)
+	}
+	waitForRecords(t, copied, recordsOf(t, table))
+
+	// Entries logged after the sync are streamed.
+	if err := table.UpdateRecord(1, map[string]interface{}{"name": "a2"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForRecords(t, copied, recordsOf(t, table))
+	if _, err := copied.CreateRecord(map[string]interface{}{"name": "x"}); !errors.Is(err, ErrReplica) {
+		t.Fatalf("CreateRecord on replica = %v, want ErrReplica", err)
+	}
+
+	// Changes made while no primary runs can't be streamed, so the replica
+	// has to resync with the restarted primary.
+	if err := primary.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.DeleteRecord(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.UpdateRecord(3, map[string]interface{}{"name": "c2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.CreateRecord(map[string]interface{}{"name": "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTable("others"); err != nil {
+		t.Fatal(err)
+	}
+	others, _ := database.GetTable("others")
+	if _, err := others.CreateRecord(map[string]interface{}{"name": "e"}); err != nil {
+		t.Fatal(err)
+	}
+	if primary, err = Replicate(database, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+
+	// The table handed out before the resync stays in use.
+	waitForRecords(t, copied, recordsOf(t, table))
+	copiedOthers, err := replica.Database().GetTable("others")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForRecords(t, copiedOthers, recordsOf(t, others))
+
+	if _, err := table.CreateRecord(map[string]interface{}{"name": "f"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForRecords(t, copied, recordsOf(t, table))
+}
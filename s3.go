@@ -0,0 +1,282 @@
+package velox
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options configures NewS3Storage.
+type S3Options struct {
+	// Endpoint is the base URL of the service, such as
+	// https://s3.eu-west-1.amazonaws.com or the URL of a compatible store.
+	// Buckets are addressed by path.
+	Endpoint string
+	// Region is the region requests are signed for.
+	Region string
+	Bucket string
+	// Prefix is put in front of every file name, so several databases can
+	// share a bucket. End it with a slash to keep each in a folder.
+	Prefix string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only needed with temporary credentials.
+	SessionToken string
+
+	// Client sends the requests. Nil means http.DefaultClient.
+	Client *http.Client
+}
+
+type s3Storage struct {
+	options S3Options
+	base    *url.URL
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewS3Storage returns a Storage that keeps its files as objects in an S3
+// bucket or any store speaking the S3 API, signing requests with AWS
+// Signature Version 4. Each file is written with a single PUT, which S3
+// applies atomically.
+func NewS3Storage(options S3Options) (Storage, error) {
+	if options.Endpoint == "" || options.Region == "" || options.Bucket == "" {
+		return nil, errors.New("NewS3Storage: endpoint, region and bucket are required")
+	}
+	base, err := url.Parse(strings.TrimSuffix(options.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("NewS3Storage: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, errors.New("NewS3Storage: endpoint must be an http or https URL")
+	}
+
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &s3Storage{options: options, base: base, client: client, now: time.Now}, nil
+}
+
+func (s3 *s3Storage) ReadTable(file string) ([]byte, error) {
+	body, err := s3.OpenTable(file)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (s3 *s3Storage) OpenTable(file string) (io.ReadCloser, error) {
+	resp, err := s3.do(http.MethodGet, s3.options.Prefix+file, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, &os.PathError{Op: "read", Path: file, Err: os.ErrNotExist}
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Error("read", file, resp)
+	}
+	return resp.Body, nil
+}
+
+func (s3 *s3Storage) WriteTable(file string, data []byte) error {
+	resp, err := s3.do(http.MethodPut, s3.options.Prefix+file, nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("write", file, resp)
+	}
+	return nil
+}
+
+func (s3 *s3Storage) DeleteTable(file string) error {
+	resp, err := s3.do(http.MethodDelete, s3.options.Prefix+file, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error("delete", file, resp)
+	}
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s3 *s3Storage) ListTables() ([]string, error) {
+	var files []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s3.options.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s3.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		if resp.StatusCode != http.StatusOK {
+			err = s3Error("list", s3.options.Prefix, resp)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			file := strings.TrimPrefix(object.Key, s3.options.Prefix)
+			if file != "" && !strings.Contains(file, "/") {
+				files = append(files, file)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func (s3 *s3Storage) String() string {
+	return "s3://" + s3.options.Bucket + "/" + s3.options.Prefix
+}
+
+func s3Error(op, file string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s: %s", op, file, resp.Status, bytes.TrimSpace(body))
+}
+
+// do sends a signed request for key in the bucket, or for the bucket itself
+// if key is empty.
+func (s3 *s3Storage) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	target := *s3.base
+	target.Path = target.Path + "/" + s3.options.Bucket
+	if key != "" {
+		target.Path += "/" + key
+	}
+	target.RawPath = s3Path(target.Path)
+	target.RawQuery = s3Query(query)
+
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.ContentLength = 0
+		req.Body = http.NoBody
+	}
+	s3.sign(req, body)
+	return s3.client.Do(req)
+}
+
+// sign adds the headers of AWS Signature Version 4 to req.
+func (s3 *s3Storage) sign(req *http.Request, body []byte) {
+	now := s3.now().UTC()
+	stamp := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payload := sha256Hex(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if s3.options.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s3.options.SessionToken)
+	}
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		s3Path(req.URL.Path),
+		req.URL.RawQuery,
+		headers.String(),
+		signed,
+		payload,
+	}, "\n")
+
+	scope := day + "/" + s3.options.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s3.options.SecretAccessKey), day)
+	key = hmacSHA256(key, s3.options.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s3.options.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+	req.Header.Del("Host")
+	req.Host = req.URL.Host
+}
+
+// s3Query encodes query the way Signature Version 4 wants it: sorted, with
+// spaces as %20.
+func s3Query(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// s3Path escapes every byte of path but letters, digits, slashes and
+// "-_.~", as Signature Version 4 wants it.
+func s3Path(path string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,59 @@
+package velox
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkSave measures a Save rewriting every table, with the pooled
+// record slices and encoder streams and without them as a baseline.
+func BenchmarkSave(b *testing.B) {
+	for _, pooled := range []bool{true, false} {
+		name := "pooled"
+		if !pooled {
+			name = "unpooled"
+		}
+		b.Run(name, func(b *testing.B) {
+			defer func(pooled bool) { poolSaveBuffers = pooled }(poolSaveBuffers)
+			poolSaveBuffers = pooled
+			benchmarkSave(b)
+		})
+	}
+}
+
+func benchmarkSave(b *testing.B) {
+	database, err := New(WithFolder(b.TempDir()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	tables := make([]*Table, 4)
+	for i := range tables {
+		name := fmt.Sprintf("table%d", i)
+		if err := database.CreateTable(name); err != nil {
+			b.Fatal(err)
+		}
+		tables[i], _ = database.GetTable(name)
+		for j := 0; j < 5000; j++ {
+			data := map[string]interface{}{"name": fmt.Sprintf("record %d", j), "n": j, "active": j%2 == 0}
+			if _, err := tables[i].CreateRecord(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for _, table := range tables {
+			if err := table.UpdateRecord(1, map[string]interface{}{"name": "record 0", "n": i}); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StartTimer()
+
+		if err := database.Save(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
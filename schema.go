@@ -0,0 +1,467 @@
+package velox
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Schema is the subset of JSON Schema that tables can enforce: type,
+// properties, required, additionalProperties, items, enum, minimum,
+// maximum, minLength, maxLength, pattern, minItems and maxItems. A schema
+// using any other keyword is refused rather than partly enforced.
+//
+// The default of a property is filled in when a create or update leaves
+// the property out of an object, before the data is validated, so a
+// required property with a default is never missing. Defaults apply to
+// map data, such as decoded JSON; structs always hold all their fields.
+type Schema struct {
+	Type                 schemaTypes        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	MinItems  *int     `json:"minItems,omitempty"`
+	MaxItems  *int     `json:"maxItems,omitempty"`
+
+	// Annotations are accepted and kept but not enforced.
+	SchemaURI   string `json:"$schema,omitempty"`
+	ID          string `json:"$id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes is the type keyword, which is either one type name or a list
+// of them.
+type schemaTypes []string
+
+func (types schemaTypes) MarshalJSON() ([]byte, error) {
+	if len(types) == 1 {
+		return jsoniter.Marshal(types[0])
+	}
+	return jsoniter.Marshal([]string(types))
+}
+
+func (types *schemaTypes) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := jsoniter.Unmarshal(data, &one); err == nil {
+		*types = schemaTypes{one}
+		return nil
+	}
+
+	var many []string
+	if err := jsoniter.Unmarshal(data, &many); err != nil {
+		return errors.New("type must be a string or an array of strings")
+	}
+	*types = many
+	return nil
+}
+
+var schemaTypeNames = map[string]bool{
+	"null": true, "boolean": true, "integer": true, "number": true,
+	"string": true, "array": true, "object": true,
+}
+
+// ParseSchema reads a JSON Schema document.
+func ParseSchema(data []byte) (*Schema, error) {
+	var schema Schema
+	if err := strictJSON.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("ParseSchema: %w", err)
+	}
+	if err := schema.compile("schema"); err != nil {
+		return nil, fmt.Errorf("ParseSchema: %w", err)
+	}
+	return &schema, nil
+}
+
+// compile checks the schema and prepares it for validation.
+func (schema *Schema) compile(path string) error {
+	for _, name := range schema.Type {
+		if !schemaTypeNames[name] {
+			return fmt.Errorf("%s: unknown type %q", path, name)
+		}
+	}
+	if schema.Pattern != "" {
+		pattern, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: pattern: %w", path, err)
+		}
+		schema.pattern = pattern
+	}
+
+	for name, property := range schema.Properties {
+		if property == nil {
+			return fmt.Errorf("%s.%s: empty schema", path, name)
+		}
+		if err := property.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if schema.Items != nil {
+		if err := schema.Items.compile(path + "[]"); err != nil {
+			return err
+		}
+	}
+
+	if schema.Default != nil {
+		value, err := genericJSON(schema.Default)
+		if err != nil {
+			return fmt.Errorf("%s: default: %w", path, err)
+		}
+		var violations []SchemaViolation
+		schema.validate(value, path+".default", &violations)
+		if len(violations) > 0 {
+			return &SchemaError{Violations: violations}
+		}
+	}
+	return nil
+}
+
+// SchemaFor derives a schema from the type of v, which is usually a struct.
+// Fields follow their json tags. Fields without omitempty are required,
+// pointers may also be null, and objects derived from structs reject
+// fields the struct doesn't have. Types with their own JSON encoding are
+// left unconstrained.
+func SchemaFor(v interface{}) (*Schema, error) {
+	typ := reflect.TypeOf(v)
+	if typ == nil {
+		return nil, errors.New("SchemaFor: nil value")
+	}
+
+	schema := schemaForType(typ, make(map[reflect.Type]bool))
+	if err := schema.compile("schema"); err != nil {
+		return nil, fmt.Errorf("SchemaFor: %w", err)
+	}
+	return schema, nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+func schemaForType(typ reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	if typ == timeType {
+		return &Schema{Type: schemaTypes{"string"}}
+	}
+	if typ.Implements(jsonMarshalerType) || typ.Implements(textMarshalerType) {
+		return &Schema{}
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		schema := schemaForType(typ.Elem(), visiting)
+		if len(schema.Type) > 0 {
+			schema.Type = append(schema.Type, "null")
+		}
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: schemaTypes{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: schemaTypes{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: schemaTypes{"number"}}
+	case reflect.String:
+		return &Schema{Type: schemaTypes{"string"}}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: schemaTypes{"string"}}
+		}
+		types := schemaTypes{"array"}
+		if typ.Kind() == reflect.Slice {
+			types = append(types, "null")
+		}
+		return &Schema{Type: types, Items: schemaForType(typ.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: schemaTypes{"object", "null"}}
+	case reflect.Struct:
+		if visiting[typ] {
+			return &Schema{Type: schemaTypes{"object"}}
+		}
+		visiting[typ] = true
+		defer delete(visiting, typ)
+
+		closed := false
+		schema := &Schema{Type: schemaTypes{"object"}, Properties: make(map[string]*Schema), AdditionalProperties: &closed}
+		addStructProperties(schema, typ, visiting)
+		return schema
+	}
+	return &Schema{}
+}
+
+func addStructProperties(schema *Schema, typ reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "-" && len(tag) == 1 {
+			continue
+		}
+		if f.Anonymous && tag[0] == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addStructProperties(schema, embedded, visiting)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = f.Name
+		}
+		schema.Properties[name] = schemaForType(f.Type, visiting)
+
+		omitempty := false
+		for _, option := range tag[1:] {
+			omitempty = omitempty || option == "omitempty"
+		}
+		if !omitempty {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+}
+
+// SchemaError lists every way a value failed its table's schema.
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+type SchemaViolation struct {
+	// Path locates the offending value, such as data.address.zip or
+	// data.tags[2].
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (err *SchemaError) Error() string {
+	messages := make([]string, len(err.Violations))
+	for i, violation := range err.Violations {
+		messages[i] = violation.Path + ": " + violation.Message
+	}
+	return "schema violated: " + strings.Join(messages, "; ")
+}
+
+// Validate checks data against the schema. Data of any type is checked as
+// its JSON encoding.
+func (schema *Schema) Validate(data interface{}) error {
+	generic, err := genericJSON(data)
+	if err != nil {
+		return err
+	}
+
+	var violations []SchemaViolation
+	schema.validate(generic, "data", &violations)
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+// genericJSON returns data as decoded from its JSON encoding, with numbers
+// kept as json.Number.
+func genericJSON(data interface{}) (interface{}, error) {
+	encoded, err := jsoniter.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := canonicalJSON.Unmarshal(encoded, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// withDefaults returns value with the defaults of the schema filled in
+// wherever an object leaves out a property that has one, and whether any
+// were. Objects and arrays that change are copied, so value itself is left
+// alone.
+func (schema *Schema) withDefaults(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var filled map[string]interface{}
+		for name, property := range schema.Properties {
+			field, ok := v[name]
+			if !ok && property.Default != nil {
+				field, _ = property.withDefaults(copyData(property.Default))
+				ok = true
+			} else if ok {
+				field, ok = property.withDefaults(field)
+			}
+			if !ok {
+				continue
+			}
+			if filled == nil {
+				filled = make(map[string]interface{}, len(v)+1)
+				for key, value := range v {
+					filled[key] = value
+				}
+			}
+			filled[name] = field
+		}
+		if filled != nil {
+			return filled, true
+		}
+
+	case []interface{}:
+		if schema.Items == nil {
+			break
+		}
+		var filled []interface{}
+		for i, item := range v {
+			item, ok := schema.Items.withDefaults(item)
+			if ok && filled == nil {
+				filled = append(make([]interface{}, 0, len(v)), v[:i]...)
+			}
+			if filled != nil {
+				filled = append(filled, item)
+			}
+		}
+		if filled != nil {
+			return filled, true
+		}
+	}
+	return value, false
+}
+
+func (schema *Schema) validate(value interface{}, path string, violations *[]SchemaViolation) {
+	fail := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	kind := jsonKind(value)
+	if len(schema.Type) > 0 && !schema.allows(kind, value) {
+		fail("expected %s, got %s", strings.Join(schema.Type, " or "), kind)
+		return
+	}
+
+	if len(schema.Enum) > 0 {
+		key, _ := indexKey(value)
+		found := false
+		for _, allowed := range schema.Enum {
+			if allowedKey, ok := indexKey(allowed); ok && allowedKey == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value %s is not one of the allowed values", key)
+		}
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+		if schema.Minimum != nil && n < *schema.Minimum {
+			fail("%v is less than the minimum %v", v, *schema.Minimum)
+		}
+		if schema.Maximum != nil && n > *schema.Maximum {
+			fail("%v is greater than the maximum %v", v, *schema.Maximum)
+		}
+
+	case string:
+		length := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			fail("shorter than %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			fail("longer than %d characters", *schema.MaxLength)
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(v) {
+			fail("does not match pattern %q", schema.Pattern)
+		}
+
+	case []interface{}:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			fail("fewer than %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(v) > *schema.MaxItems {
+			fail("more than %d items", *schema.MaxItems)
+		}
+		if schema.Items != nil {
+			for i, item := range v {
+				schema.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				*violations = append(*violations, SchemaViolation{Path: path + "." + name, Message: "required field is missing"})
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if ok {
+				property.validate(v[name], path+"."+name, violations)
+			} else if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				*violations = append(*violations, SchemaViolation{Path: path + "." + name, Message: "field is not allowed"})
+			}
+		}
+	}
+}
+
+func (schema *Schema) allows(kind string, value interface{}) bool {
+	for _, name := range schema.Type {
+		if name == kind {
+			return true
+		}
+		if name == "integer" && kind == "number" {
+			if n, err := value.(json.Number).Float64(); err == nil && n == math.Trunc(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
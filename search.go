@@ -0,0 +1,422 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// textIndex is an inverted index over the words of some fields. Words are
+// the runs of letters and digits, lower-cased.
+type textIndex struct {
+	fields []string
+	// postings maps each word to the records holding it and how often.
+	postings map[string]map[int]int
+	// lengths holds the number of words of each indexed record.
+	lengths map[int]int
+}
+
+func newTextIndex(fields []string) *textIndex {
+	return &textIndex{
+		fields:   fields,
+		postings: make(map[string]map[int]int),
+		lengths:  make(map[int]int),
+	}
+}
+
+// EnableTextIndex indexes the words of fields so Search can find records by
+// them. String fields are indexed, as are the strings in list fields.
+// Existing records are indexed straight away and every later write keeps
+// the index up to date. Enabling it again replaces the indexed fields. The
+// fields are saved in master.json.
+func (table *Table) EnableTextIndex(fields ...string) error {
+	if len(fields) == 0 {
+		return errors.New("EnableTextIndex: at least one field is required")
+	}
+	for _, field := range fields {
+		if field == "" {
+			return errors.New("EnableTextIndex: invalid field name")
+		}
+	}
+
+	if err := table.administer("EnableTextIndex"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.buildTextIndex(append([]string(nil), fields...))
+	table.modified()
+	return nil
+}
+
+func (table *Table) DisableTextIndex() error {
+	if err := table.administer("DisableTextIndex"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if table.text == nil {
+		return errors.New("DisableTextIndex: text index not enabled")
+	}
+
+	table.text = nil
+	table.modified()
+	return nil
+}
+
+// buildTextIndex replaces the text index with one over fields built from
+// the current records. Callers hold the write lock.
+func (table *Table) buildTextIndex(fields []string) {
+	table.text = newTextIndex(fields)
+	table.records.IterCb(func(key string, val interface{}) {
+		if record, err := table.recordValue("Table_BuildTextIndex", val); err == nil {
+			table.text.add(record)
+		}
+	})
+}
+
+func (table *Table) textFields() []string {
+	if table.text == nil {
+		return nil
+	}
+	return append([]string(nil), table.text.fields...)
+}
+
+// Search returns the records matching query, best matches first. A query
+// is made of words, all of which must occur in a record; OR between words
+// makes either enough, NOT or a leading - excludes a word, and parentheses
+// group, as in "velocity AND (db OR database) NOT sql". Records are ranked
+// by how often the query's words occur in them, with rarer words counting
+// more and long records less.
+func (table *Table) Search(query string) ([]RecordInterface, error) {
+	expr, err := parseSearch(query)
+	if err != nil {
+		return nil, fmt.Errorf("Search: %w", err)
+	}
+
+	defer table.runlock(table.rlock())
+
+	if table.text == nil {
+		return nil, errors.New("Search: text index not enabled")
+	}
+	if table.indexingSuspended {
+		return nil, errors.New("Search: indexing is suspended")
+	}
+
+	type match struct {
+		record *Record
+		score  float64
+	}
+	words := expr.words(nil)
+	matches := make([]match, 0)
+	for id := range expr.eval(table.text) {
+		val, ok := table.records.Get(strconv.Itoa(id))
+		if !ok {
+			continue
+		}
+		record, err := table.recordValue("Search", val)
+		if err != nil || table.hidden(record) {
+			continue
+		}
+		record = table.readable(record)
+		matches = append(matches, match{record: &record, score: table.text.score(id, words)})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].record.ID < matches[j].record.ID
+	})
+
+	results := make([]RecordInterface, len(matches))
+	for i := range matches {
+		results[i] = matches[i].record
+	}
+	return results, nil
+}
+
+func (index *textIndex) add(record Record) {
+	counts := index.count(record)
+	if len(counts) == 0 {
+		return
+	}
+
+	total := 0
+	for word, n := range counts {
+		ids, ok := index.postings[word]
+		if !ok {
+			ids = make(map[int]int, 1)
+			index.postings[word] = ids
+		}
+		ids[record.ID] = n
+		total += n
+	}
+	index.lengths[record.ID] = total
+}
+
+func (index *textIndex) remove(record Record) {
+	for word := range index.count(record) {
+		ids := index.postings[word]
+		delete(ids, record.ID)
+		if len(ids) == 0 {
+			delete(index.postings, word)
+		}
+	}
+	delete(index.lengths, record.ID)
+}
+
+// count returns how often each word occurs in the indexed fields of record.
+func (index *textIndex) count(record Record) map[string]int {
+	counts := make(map[string]int)
+	for _, field := range index.fields {
+		if value, ok := fieldValue(record.Data, field); ok {
+			countWords(reflect.ValueOf(value), counts, 0)
+		}
+	}
+	return counts
+}
+
+func countWords(value reflect.Value, counts map[string]int, depth int) {
+	if depth > maxFloatCheckDepth {
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		for _, word := range tokenize(value.String()) {
+			counts[word]++
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			countWords(value.Elem(), counts, depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			countWords(value.Index(i), counts, depth+1)
+		}
+	}
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// score ranks record id for words with TF-IDF, dampened by the length of
+// the record.
+func (index *textIndex) score(id int, words []string) float64 {
+	score := 0.0
+	for _, word := range words {
+		ids := index.postings[word]
+		if n := ids[id]; n > 0 {
+			idf := math.Log(1 + float64(len(index.lengths))/float64(len(ids)))
+			score += float64(n) * idf
+		}
+	}
+	return score / math.Sqrt(float64(index.lengths[id]))
+}
+
+// searchExpr is a parsed search query.
+type searchExpr struct {
+	op       string // "word", "and", "or" or "not"
+	word     string
+	operands []*searchExpr
+}
+
+func (expr *searchExpr) eval(index *textIndex) map[int]struct{} {
+	ids := make(map[int]struct{})
+	switch expr.op {
+	case "word":
+		for id := range index.postings[expr.word] {
+			ids[id] = struct{}{}
+		}
+	case "or":
+		for _, operand := range expr.operands {
+			for id := range operand.eval(index) {
+				ids[id] = struct{}{}
+			}
+		}
+	case "not":
+		excluded := expr.operands[0].eval(index)
+		for id := range index.lengths {
+			if _, ok := excluded[id]; !ok {
+				ids[id] = struct{}{}
+			}
+		}
+	case "and":
+		ids = expr.operands[0].eval(index)
+		for _, operand := range expr.operands[1:] {
+			other := operand.eval(index)
+			for id := range ids {
+				if _, ok := other[id]; !ok {
+					delete(ids, id)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// words appends the words that count towards ranking, which are those not
+// excluded with NOT.
+func (expr *searchExpr) words(words []string) []string {
+	switch expr.op {
+	case "word":
+		return append(words, expr.word)
+	case "and", "or":
+		for _, operand := range expr.operands {
+			words = operand.words(words)
+		}
+	}
+	return words
+}
+
+func parseSearch(query string) (*searchExpr, error) {
+	parser := &searchParser{tokens: splitSearch(query)}
+	if len(parser.tokens) == 0 {
+		return nil, errors.New("empty query")
+	}
+
+	expr, err := parser.or()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q", parser.tokens[parser.pos])
+	}
+	return expr, nil
+}
+
+// splitSearch splits a query into parentheses, leading minus signs and
+// space separated words.
+func splitSearch(query string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(query) {
+		for strings.HasPrefix(field, "(") || strings.HasPrefix(field, "-") {
+			tokens = append(tokens, field[:1])
+			field = field[1:]
+		}
+		closing := 0
+		for strings.HasSuffix(field, ")") {
+			field = field[:len(field)-1]
+			closing++
+		}
+		if field != "" {
+			tokens = append(tokens, field)
+		}
+		for ; closing > 0; closing-- {
+			tokens = append(tokens, ")")
+		}
+	}
+	return tokens
+}
+
+type searchParser struct {
+	tokens []string
+	pos    int
+}
+
+func (parser *searchParser) peek() string {
+	if parser.pos < len(parser.tokens) {
+		return parser.tokens[parser.pos]
+	}
+	return ""
+}
+
+func (parser *searchParser) or() (*searchExpr, error) {
+	expr, err := parser.and()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek() == "OR" {
+		parser.pos++
+		operand, err := parser.and()
+		if err != nil {
+			return nil, err
+		}
+		if expr.op != "or" {
+			expr = &searchExpr{op: "or", operands: []*searchExpr{expr}}
+		}
+		expr.operands = append(expr.operands, operand)
+	}
+	return expr, nil
+}
+
+func (parser *searchParser) and() (*searchExpr, error) {
+	operands := make([]*searchExpr, 0, 1)
+	for {
+		operand, err := parser.unary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+
+		switch parser.peek() {
+		case "AND":
+			parser.pos++
+		case "", "OR", ")":
+			if len(operands) == 1 {
+				return operands[0], nil
+			}
+			return &searchExpr{op: "and", operands: operands}, nil
+		}
+	}
+}
+
+func (parser *searchParser) unary() (*searchExpr, error) {
+	switch token := parser.peek(); token {
+	case "NOT", "-":
+		parser.pos++
+		operand, err := parser.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &searchExpr{op: "not", operands: []*searchExpr{operand}}, nil
+
+	case "(":
+		parser.pos++
+		expr, err := parser.or()
+		if err != nil {
+			return nil, err
+		}
+		if parser.peek() != ")" {
+			return nil, parser.unexpected()
+		}
+		parser.pos++
+		return expr, nil
+
+	case "", "OR", "AND", ")":
+		return nil, parser.unexpected()
+
+	default:
+		parser.pos++
+		words := tokenize(token)
+		if len(words) == 0 {
+			return nil, fmt.Errorf("%q has no words to search for", token)
+		}
+		if len(words) == 1 {
+			return &searchExpr{op: "word", word: words[0]}, nil
+		}
+		expr := &searchExpr{op: "and"}
+		for _, word := range words {
+			expr.operands = append(expr.operands, &searchExpr{op: "word", word: word})
+		}
+		return expr, nil
+	}
+}
+
+func (parser *searchParser) unexpected() error {
+	if token := parser.peek(); token != "" {
+		return fmt.Errorf("unexpected %q", token)
+	}
+	return errors.New("unexpected end of query")
+}
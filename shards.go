@@ -0,0 +1,181 @@
+package velox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// shardMinRecords is the fewest records Save puts in a shard file, so
+// splitting small tables doesn't trade one file for many tiny ones.
+const shardMinRecords = 4096
+
+// shardBatch is how many decoded records a shard reader hands over at once.
+const shardBatch = 1024
+
+// SetShardCount makes Save split each table into up to n files that are
+// encoded, written and loaded in parallel, one worker per file, so large
+// tables aren't limited by encoding on a single core. A table only gets as
+// many files as it has shardMinRecords records for; n of 0 or 1 keeps
+// every table in one file. Load reads tables the way they were saved,
+// whatever the current setting. The next Save rewrites every table.
+func (database *Database) SetShardCount(n int) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.shardCount = n
+	database.savedTargets = nil
+}
+
+// shardsFor returns the number of files Save splits a table of count
+// records into.
+func shardsFor(count, shardCount int) int {
+	shards := count / shardMinRecords
+	if shards > shardCount {
+		shards = shardCount
+	}
+	if shards < 1 {
+		shards = 1
+	}
+	return shards
+}
+
+// shardFileName returns the name of shard i of a table stored in file.
+func shardFileName(file string, i int) string {
+	return strings.TrimSuffix(file, ".json") + "." + strconv.Itoa(i) + ".json"
+}
+
+// shardFiles returns the files holding the records of a table stored in
+// file: file itself, or its shard files if it was split.
+func shardFiles(file string, meta tableMeta) []string {
+	if meta.Shards <= 1 {
+		return []string{file}
+	}
+	files := make([]string, meta.Shards)
+	for i := range files {
+		files[i] = shardFileName(file, i)
+	}
+	return files
+}
+
+// parallel runs fn for 0 to n-1 at the same time and returns the error of
+// the lowest i that failed.
+func parallel(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeShards encodes records into shards table files, each holding an
+// even part of them, in parallel.
+func encodeShards(records []Record, shards int, codec Codec, compression Compression, keys KeyProvider, nextID int) ([][]byte, error) {
+	encoded := make([][]byte, shards)
+	err := parallel(shards, func(i int) error {
+		part := records[i*len(records)/shards : (i+1)*len(records)/shards]
+		var err error
+		encoded[i], err = encodeRecordsFile(part, codec, compression, keys, nextID)
+		return err
+	})
+	return encoded, err
+}
+
+// loadShards builds a table with the settings in meta from its shard
+// files, reading them in parallel. Each file is checked on its own as it
+// is decoded; records are added to the table by a single goroutine, which
+// also catches IDs and keys that appear in more than one file.
+func loadShards(storage Storage, meta tableMeta, files []string, keys KeyProvider) (*Table, error) {
+	table, err := emptyTable(meta, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := make(chan []Record, len(files))
+	restored := make(chan error, 1)
+	go func() {
+		var failed error
+		for batch := range batches {
+			if failed != nil {
+				continue
+			}
+			for _, record := range batch {
+				if failed = table.restoreShardRecord(record); failed != nil {
+					break
+				}
+			}
+		}
+		restored <- failed
+	}()
+
+	nextIDs := make([]int, len(files))
+	err = parallel(len(files), func(i int) error {
+		reader, err := openTable(storage, files[i])
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		batch := make([]Record, 0, shardBatch)
+		_, err = readTableFile(reader, keys, func(header tableHeader) error {
+			if header.Format == 0 {
+				return fmt.Errorf("%w: shard without header", ErrCorrupted)
+			}
+			nextIDs[i] = header.NextID
+			return nil
+		}, func(record Record) error {
+			batch = append(batch, record)
+			if len(batch) == shardBatch {
+				batches <- batch
+				batch = make([]Record, 0, shardBatch)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", files[i], err)
+		}
+		batches <- batch
+		return nil
+	})
+	close(batches)
+	if failed := <-restored; err == nil {
+		err = failed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nextID := range nextIDs {
+		if nextID > table.nextID {
+			table.nextID = nextID
+		}
+	}
+	return table, nil
+}
+
+// restoreShardRecord is restoreRecord for records coming from several
+// files, which may not repeat each other's IDs or keys.
+func (table *Table) restoreShardRecord(record Record) error {
+	if _, ok := table.records.Get(strconv.Itoa(record.ID)); ok {
+		return fmt.Errorf("%w: record %d appears twice", ErrCorrupted, record.ID)
+	}
+	if table.keys != nil && record.Key != "" {
+		if _, ok := table.keys[record.Key]; ok {
+			return fmt.Errorf("%w: key %q appears twice", ErrCorrupted, record.Key)
+		}
+	}
+	return table.restoreRecord(record)
+}
@@ -0,0 +1,75 @@
+package velox
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShardedRoundTrip(t *testing.T) {
+	storage := NewMemoryStorage()
+	database, err := New(WithStorage(storage), WithShardCount(3), WithCompression(Zstd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := database.GetTable("items")
+	for i := 0; i < 3*shardMinRecords; i++ {
+		if _, err := table.CreateRecord(map[string]interface{}{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// tableFilesOf returns how many files hold the table.
+	tableFilesOf := func() int {
+		t.Helper()
+		files, err := storage.ListTables()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, file := range files {
+			if strings.HasPrefix(file, "items.") {
+				n++
+			}
+		}
+		return n
+	}
+	check := func(files int) {
+		t.Helper()
+		if err := database.Save(); err != nil {
+			t.Fatal(err)
+		}
+		if n := tableFilesOf(); n != files {
+			t.Fatalf("table saved in %d files, want %d", n, files)
+		}
+		loaded := NewDatabase()
+		if err := loaded.LoadFrom(storage); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loaded.GetTable("items")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(recordsOf(t, got), recordsOf(t, table)) {
+			t.Fatal("loaded records differ from saved ones")
+		}
+		if got.NextID() != table.NextID() {
+			t.Fatalf("loaded NextID = %d, want %d", got.NextID(), table.NextID())
+		}
+	}
+	check(3)
+
+	// Shrinking the table merges the shards and deletes the files left
+	// over.
+	ids := make([]int, 0, 3*shardMinRecords)
+	for id := 11; id <= 3*shardMinRecords; id++ {
+		ids = append(ids, id)
+	}
+	if err := table.DeleteRecords(ids); err != nil {
+		t.Fatal(err)
+	}
+	check(1)
+}
@@ -0,0 +1,162 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SetSoftDelete turns soft delete mode on or off. In soft delete mode,
+// deletes mark records with DeletedAt instead of removing them. Reads,
+// queries and counts treat them as gone, but they can be brought back with
+// RestoreRecord until PurgeDeleted removes them for good. Soft deletes don't
+// cascade: records referencing a soft-deleted record keep their reference.
+// Turning the mode off leaves soft-deleted records as they are. The mode is
+// saved in master.json.
+func (table *Table) SetSoftDelete(on bool) error {
+	if err := table.administer("SetSoftDelete"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	table.softDelete = on
+	table.modified()
+	return nil
+}
+
+// softDeleteRecord marks record as deleted. Expired records are purged
+// instead, as they are gone for good anyway. Callers hold the write lock.
+func (table *Table) softDeleteRecord(op string, record Record) error {
+	if record.DeletedAt != nil {
+		return table.notFound(op, record.ID)
+	}
+	if table.ttlExpired(record) {
+		return table.purgeRecord(op, record, true)
+	}
+	if err := table.runBeforeDelete(op, record); err != nil {
+		return err
+	}
+
+	previous := record
+	now := table.now()
+	record.DeletedAt = &now
+	record.Version++
+	if err := table.writeAhead(walEntry{Table: table.name, Op: ChangeUpdate, ID: record.ID, Record: &record}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	table.setRecord(&previous, record)
+	table.changed(ChangeSoftDelete, &previous, &record)
+	return nil
+}
+
+// RestoreRecord undoes the soft delete of record id. It fails if the
+// record's data would now break a constraint, for example because another
+// record has since taken a unique value.
+func (table *Table) RestoreRecord(id int) error {
+	if err := table.throttle("RestoreRecord"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return table.notFound("RestoreRecord", id)
+	}
+	record, err := table.recordValue("RestoreRecord", val)
+	if err != nil {
+		return err
+	}
+	if table.ttlExpired(record) {
+		return table.notFound("RestoreRecord", id)
+	}
+	if record.DeletedAt == nil {
+		return fmt.Errorf("RestoreRecord: record %d is not deleted", id)
+	}
+
+	if err := table.checkConstraints(id, record.Data); err != nil {
+		return fmt.Errorf("RestoreRecord: %w", err)
+	}
+
+	previous := record
+	record.DeletedAt = nil
+	record.Version++
+	if err := table.writeAhead(walEntry{Table: table.name, Op: ChangeUpdate, ID: record.ID, Record: &record}); err != nil {
+		return fmt.Errorf("RestoreRecord: %w", err)
+	}
+
+	table.setRecord(&previous, record)
+	table.changed(ChangeRestore, &previous, &record)
+	return nil
+}
+
+// ListDeleted returns the soft-deleted records ordered by ID. Their
+// DeletedAt says when they were deleted.
+func (table *Table) ListDeleted() []RecordInterface {
+	defer table.runlock(table.rlock())
+
+	deleted := make([]*Record, 0)
+	table.records.IterCb(func(key string, val interface{}) {
+		record, err := table.recordValue("ListDeleted", val)
+		if err == nil && record.DeletedAt != nil && !table.ttlExpired(record) {
+			record = table.readable(record)
+			deleted = append(deleted, &record)
+		}
+	})
+
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].ID < deleted[j].ID })
+
+	results := make([]RecordInterface, len(deleted))
+	for i := range deleted {
+		results[i] = deleted[i]
+	}
+	return results
+}
+
+// PurgeDeleted removes the records soft-deleted at least olderThan ago for
+// good and returns how many it removed, not counting records removed by
+// cascades. An olderThan of zero purges every soft-deleted record. As with
+// ExpireRecords, records still referenced under RestrictOnDelete are kept.
+func (table *Table) PurgeDeleted(olderThan time.Duration) (int, error) {
+	if olderThan < 0 {
+		return 0, errors.New("PurgeDeleted: negative age")
+	}
+	if err := table.authorize(context.Background(), PermissionWrite); err != nil {
+		return 0, fmt.Errorf("PurgeDeleted: %w", err)
+	}
+
+	defer unlockTables(table.lockForDelete())
+
+	cutoff := table.now().Add(-olderThan)
+	purge := make([]Record, 0)
+	table.records.IterCb(func(key string, val interface{}) {
+		record, err := table.recordValue("PurgeDeleted", val)
+		if err == nil && record.DeletedAt != nil && !record.DeletedAt.After(cutoff) {
+			purge = append(purge, record)
+		}
+	})
+	sort.Slice(purge, func(i, j int) bool { return purge[i].ID < purge[j].ID })
+
+	purged := 0
+	for _, record := range purge {
+		// An earlier purge can have cascaded to it.
+		if _, ok := table.records.Get(strconv.Itoa(record.ID)); !ok {
+			continue
+		}
+
+		err := table.purgeRecord("PurgeDeleted", record, false)
+		if errors.Is(err, ErrForeignKeyViolation) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
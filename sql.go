@@ -0,0 +1,213 @@
+package velox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// SQLExportOptions configures ExportSQLWithOptions.
+type SQLExportOptions struct {
+	// Flatten writes one column per top-level field instead of the whole
+	// data as JSON in a single data column. Column types are picked from
+	// the values: INTEGER, REAL or TEXT, with booleans as 0 and 1 and
+	// nested values as JSON.
+	Flatten bool
+}
+
+// The columns every exported table has besides its data.
+var sqlRecordColumns = []string{"_id", "_version", "_created_at", "_updated_at", "_deleted_at"}
+
+// ExportSQL writes the database to w as SQL statements, a CREATE TABLE and
+// INSERTs for each table inside one transaction, for moving the data to
+// SQLite or another SQL database. Each table gets an _id primary key,
+// _version, _created_at, _updated_at and _deleted_at columns, times as RFC
+// 3339 text, and a data column holding the record data as JSON. Records
+// are read as Export reads them.
+func (database *Database) ExportSQL(w io.Writer) error {
+	return database.ExportSQLWithOptions(w, SQLExportOptions{})
+}
+
+// ExportSQLWithOptions is ExportSQL with options.
+func (database *Database) ExportSQLWithOptions(w io.Writer, opts SQLExportOptions) error {
+	writer := bufio.NewWriter(w)
+
+	err := database.exportTables("ExportSQL", func(count int) error {
+		_, err := writer.WriteString("BEGIN TRANSACTION;\n")
+		return err
+	}, func(name string, meta tableMeta, nextID int, records []Record) error {
+		return writeSQLTable(writer, name, records, opts)
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.WriteString("COMMIT;\n")
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("ExportSQL: %w", err)
+	}
+	return nil
+}
+
+func writeSQLTable(writer *bufio.Writer, name string, records []Record, opts SQLExportOptions) error {
+	columns := append([]string(nil), sqlRecordColumns...)
+	types := []string{"INTEGER PRIMARY KEY", "INTEGER NOT NULL", "TEXT", "TEXT", "TEXT"}
+
+	var fields []string
+	if opts.Flatten {
+		seen := make(map[string]bool)
+		for _, record := range records {
+			found := topLevelFields(record.Data)
+			if found == nil && record.Data != nil {
+				return fmt.Errorf("record %d: data has no fields to flatten", record.ID)
+			}
+			for _, field := range found {
+				if !seen[field] {
+					seen[field] = true
+					fields = append(fields, field)
+				}
+			}
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			for _, column := range sqlRecordColumns {
+				if field == column {
+					return fmt.Errorf("field %s clashes with a record column", field)
+				}
+			}
+			columns = append(columns, field)
+			types = append(types, sqlColumnType(records, field))
+		}
+	} else {
+		columns = append(columns, "data")
+		types = append(types, "TEXT")
+	}
+
+	quoted := make([]string, len(columns))
+	definitions := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = sqlIdentifier(column)
+		definitions[i] = quoted[i] + " " + types[i]
+	}
+	fmt.Fprintf(writer, "CREATE TABLE %s (%s);\n", sqlIdentifier(name), strings.Join(definitions, ", "))
+
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (", sqlIdentifier(name), strings.Join(quoted, ", "))
+	values := make([]string, len(columns))
+	for _, record := range records {
+		values[0] = strconv.Itoa(record.ID)
+		values[1] = strconv.Itoa(record.Version)
+		values[2] = sqlTime(&record.CreatedAt)
+		values[3] = sqlTime(&record.UpdatedAt)
+		values[4] = sqlTime(record.DeletedAt)
+
+		if opts.Flatten {
+			for i, field := range fields {
+				value, _ := fieldValue(record.Data, field)
+				literal, err := sqlValue(value)
+				if err != nil {
+					return fmt.Errorf("record %d: field %s: %w", record.ID, field, err)
+				}
+				values[len(sqlRecordColumns)+i] = literal
+			}
+		} else {
+			literal, err := sqlJSON(record.Data)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", record.ID, err)
+			}
+			values[len(sqlRecordColumns)] = literal
+		}
+
+		writer.WriteString(insert)
+		writer.WriteString(strings.Join(values, ", "))
+		if _, err := writer.WriteString(");\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlColumnType picks the type of the column for field from the values the
+// records have for it.
+func sqlColumnType(records []Record, field string) string {
+	integer, float := true, true
+	for _, record := range records {
+		value, _ := fieldValue(record.Data, field)
+		switch v := value.(type) {
+		case nil:
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		case float32:
+			integer = integer && float64(v) == math.Trunc(float64(v))
+		case float64:
+			integer = integer && v == math.Trunc(v) && !math.IsInf(v, 0)
+		default:
+			integer, float = false, false
+		}
+	}
+	switch {
+	case integer:
+		return "INTEGER"
+	case float:
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+func sqlValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return sqlString(v), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "NULL", nil
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return sqlValue(float64(v))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	case time.Time:
+		return sqlTime(&v), nil
+	}
+	return sqlJSON(value)
+}
+
+func sqlJSON(value interface{}) (string, error) {
+	if value == nil {
+		return "NULL", nil
+	}
+	encoded, err := jsoniter.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return sqlString(string(encoded)), nil
+}
+
+func sqlTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "NULL"
+	}
+	return sqlString(t.UTC().Format(time.RFC3339Nano))
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
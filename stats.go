@@ -0,0 +1,115 @@
+package velox
+
+import (
+	"strconv"
+	"time"
+	"unsafe"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+type TableStats struct {
+	Records int
+	// ApproxBytes estimates the memory held by the records: the data,
+	// metadata and keys plus a fixed overhead per record.
+	ApproxBytes int64
+	// LastModified is when a record was last created, changed or deleted
+	// since the table was created or loaded, zero if none was.
+	LastModified time.Time
+	NextID       int
+}
+
+// Count returns the number of live records. It is constant time unless the
+// table holds records with a TTL, which have to be checked one by one.
+func (table *Table) Count() int {
+	defer table.runlock(table.rlock())
+
+	if !table.hasHidden {
+		return table.records.Count()
+	}
+
+	count := 0
+	table.records.IterCb(func(key string, val interface{}) {
+		if record, err := table.recordValue("Count", val); err == nil && !table.hidden(record) {
+			count++
+		}
+	})
+	return count
+}
+
+func (table *Table) Exists(id int) bool {
+	defer table.runlock(table.rlock())
+
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return false
+	}
+	record, err := table.recordValue("Exists", val)
+	return err == nil && !table.hidden(record)
+}
+
+// Stats walks every record to estimate its size, so it costs about as much
+// as a full scan.
+func (table *Table) Stats() TableStats {
+	defer table.runlock(table.rlock())
+
+	stats := TableStats{NextID: table.nextID}
+	if modified := table.lastModified.Load(); modified != 0 {
+		stats.LastModified = time.Unix(0, modified)
+	}
+
+	table.records.IterCb(func(key string, val interface{}) {
+		record, err := table.recordValue("Stats", val)
+		if err != nil || table.hidden(record) {
+			return
+		}
+
+		stats.Records++
+		stats.ApproxBytes += recordOverhead + int64(len(key)+len(record.Key)+len(record.Hash))
+		stats.ApproxBytes += approxSize(record.Data)
+		for k, v := range record.Meta {
+			stats.ApproxBytes += mapEntryOverhead + int64(len(k)+len(v))
+		}
+	})
+	return stats
+}
+
+// recordOverhead is a rough figure for a record's fixed cost: the Record
+// itself, its record map entry and the boxing of the Record and its key.
+const (
+	recordOverhead   = int64(unsafe.Sizeof(Record{})) + 64
+	mapEntryOverhead = 48
+)
+
+// approxSize estimates the memory held by a value of the kinds records
+// usually hold. Other values are measured by their JSON encoding.
+func approxSize(value interface{}) int64 {
+	const header = 16
+
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case bool, int, int64, float64, jsoniter.Number:
+		return header
+	case string:
+		return header + int64(len(v))
+	case []interface{}:
+		size := int64(24)
+		for _, item := range v {
+			size += approxSize(item)
+		}
+		return size
+	case map[string]interface{}:
+		size := int64(48)
+		for key, item := range v {
+			size += mapEntryOverhead + int64(len(key)) + approxSize(item)
+		}
+		return size
+	}
+
+	encoded, err := jsoniter.Marshal(value)
+	if err != nil {
+		return header
+	}
+	return header + int64(len(encoded))
+}
@@ -0,0 +1,203 @@
+package velox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Storage holds the files Save writes and Load reads: master.json, one file
+// per table and the history files of tables that keep history. Files are
+// named by Save and never contain a path separator. DirStorage keeps them
+// in a folder, NewMemoryStorage in memory and NewS3Storage in a bucket.
+//
+// Only Load, LoadTables, Save, Backup and Export go through a Storage. The
+// write-ahead log, point-in-time recovery and blobs need a database folder
+// and are not available with other storage.
+type Storage interface {
+	// ReadTable returns the contents of file, or an error matching
+	// os.ErrNotExist if there is no such file.
+	ReadTable(file string) ([]byte, error)
+	// WriteTable replaces the contents of file, creating it if needed.
+	// Readers see either the old or the new contents, never a mix.
+	WriteTable(file string, data []byte) error
+	// ListTables returns the names of all files, sorted.
+	ListTables() ([]string, error)
+	// DeleteTable removes file. Removing a file that doesn't exist is not
+	// an error.
+	DeleteTable(file string) error
+}
+
+// tableOpener is implemented by storages that can hand out a file as a
+// stream, so Load can decode a table without reading its file into memory
+// first.
+type tableOpener interface {
+	OpenTable(file string) (io.ReadCloser, error)
+}
+
+// openTable opens file in storage for reading, as a stream if storage can.
+func openTable(storage Storage, file string) (io.ReadCloser, error) {
+	if opener, ok := storage.(tableOpener); ok {
+		return opener.OpenTable(file)
+	}
+	data, err := storage.ReadTable(file)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// DirStorage returns the Storage for a database folder, the one Load and
+// SetFolder use. Files are written to a temporary file first and renamed
+// into place.
+func DirStorage(folder string) Storage {
+	return dirStorage(folder)
+}
+
+type dirStorage string
+
+func (dir dirStorage) ReadTable(file string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(dir), file))
+}
+
+func (dir dirStorage) OpenTable(file string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(dir), file))
+}
+
+func (dir dirStorage) WriteTable(file string, data []byte) error {
+	return writeFileAtomic(filepath.Join(string(dir), file), data, 0644)
+}
+
+func (dir dirStorage) ListTables() ([]string, error) {
+	entries, err := os.ReadDir(string(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.Contains(entry.Name(), ".tmp") {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
+
+func (dir dirStorage) DeleteTable(file string) error {
+	if err := os.Remove(filepath.Join(string(dir), file)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (dir dirStorage) String() string {
+	return string(dir)
+}
+
+// NewMemoryStorage returns a Storage that keeps its files in memory, for
+// tests and for databases that only need to survive as long as the
+// process.
+func NewMemoryStorage() Storage {
+	return &memoryStorage{files: make(map[string][]byte)}
+}
+
+type memoryStorage struct {
+	files map[string][]byte
+	sync.RWMutex
+}
+
+func (memory *memoryStorage) ReadTable(file string) ([]byte, error) {
+	memory.RLock()
+	defer memory.RUnlock()
+
+	data, ok := memory.files[file]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: file, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (memory *memoryStorage) WriteTable(file string, data []byte) error {
+	memory.Lock()
+	defer memory.Unlock()
+
+	memory.files[file] = append([]byte(nil), data...)
+	return nil
+}
+
+func (memory *memoryStorage) ListTables() ([]string, error) {
+	memory.RLock()
+	defer memory.RUnlock()
+
+	files := make([]string, 0, len(memory.files))
+	for file := range memory.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (memory *memoryStorage) DeleteTable(file string) error {
+	memory.Lock()
+	defer memory.Unlock()
+
+	delete(memory.files, file)
+	return nil
+}
+
+func (memory *memoryStorage) String() string {
+	return fmt.Sprintf("memory:%p", memory)
+}
+
+// storageName names storage in a *SaveError and tells storages apart
+// between Saves: the folder for a DirStorage.
+func storageName(storage Storage) string {
+	if named, ok := storage.(fmt.Stringer); ok {
+		return named.String()
+	}
+	return fmt.Sprintf("%T:%p", storage, storage)
+}
+
+// SetStorage makes Load, Save and the rest use storage instead of the
+// database folder. With a DirStorage it is the same as SetFolder; with any
+// other storage, the database has no folder.
+func (database *Database) SetStorage(storage Storage) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.storage = storage
+	database.folder = ""
+	if dir, ok := storage.(dirStorage); ok {
+		database.folder = string(dir)
+	}
+}
+
+// Storage returns the storage Save writes to.
+func (database *Database) Storage() Storage {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	return database.storageLocked()
+}
+
+// storageLocked returns the storage Save writes to. Callers hold the
+// database lock.
+func (database *Database) storageLocked() Storage {
+	if database.storage == nil {
+		return dirStorage(database.folder)
+	}
+	return database.storage
+}
+
+// AddSaveStorage is AddSaveTarget for any storage.
+func (database *Database) AddSaveStorage(storage Storage) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.saveTargets = append(database.saveTargets, storage)
+}
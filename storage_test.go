@@ -0,0 +1,78 @@
+package velox
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMemoryStorageRoundTrip(t *testing.T) {
+	storage, mirror := NewMemoryStorage(), NewMemoryStorage()
+	database, err := New(WithStorage(storage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.AddSaveStorage(mirror)
+	for _, name := range []string{"items", "orders"} {
+		if err := database.CreateTable(name); err != nil {
+			t.Fatal(err)
+		}
+		table, _ := database.GetTable(name)
+		if name == "items" {
+			if err := table.EnableHistory(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := table.CreateRecord(map[string]interface{}{"n": i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Save deletes the files of dropped and renamed tables.
+	if err := database.DropTable("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.RenameTable("items", "things"); err != nil {
+		t.Fatal(err)
+	}
+	things, _ := database.GetTable("things")
+	if err := things.UpdateRecord(2, map[string]interface{}{"n": 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	want := recordsOf(t, things)
+
+	wantFiles := []string{"master.json", tableFileName("things"), historyFileName(tableFileName("things"))}
+	sort.Strings(wantFiles)
+	for _, target := range []Storage{storage, mirror} {
+		files, err := target.ListTables()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(files, wantFiles) {
+			t.Fatalf("files in %s = %v, want %v", storageName(target), files, wantFiles)
+		}
+
+		loaded := NewDatabase()
+		if err := loaded.LoadFrom(target); err != nil {
+			t.Fatal(err)
+		}
+		table, err := loaded.GetTable("things")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := recordsOf(t, table); !reflect.DeepEqual(got, want) {
+			t.Fatalf("records loaded from %s = %v, want %v", storageName(target), got, want)
+		}
+		if history, err := table.History(2); err != nil || len(history) != 2 {
+			t.Fatalf("history of record 2 loaded from %s = %v, %v, want 2 entries", storageName(target), history, err)
+		}
+	}
+}
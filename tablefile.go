@@ -0,0 +1,307 @@
+package velox
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// tableFormatVersion is the table file format Save writes. Version 1 files
+// start with a one-line tableHeader followed by the JSON array of records.
+// Version 0 files, written before the header existed, are the bare array;
+// Load still reads them but can't check them.
+const tableFormatVersion = 1
+
+type tableHeader struct {
+	Format  int `json:"format"`
+	Records int `json:"records"`
+	// NextID keeps IDs that were handed out and then deleted or reserved
+	// from being reused after a Load.
+	NextID int `json:"next_id"`
+	// Checksum is the hex SHA-256 of everything after the header line.
+	Checksum string `json:"checksum"`
+	// Codec names the Codec of the records, empty for JSON.
+	Codec string `json:"codec,omitempty"`
+	// Compression names the compression applied after encoding, empty
+	// for none.
+	Compression string `json:"compression,omitempty"`
+	// Encryption names the cipher applied last, empty for none, and KeyID
+	// the key it used. The checksum covers the bytes as stored.
+	Encryption string `json:"encryption,omitempty"`
+	KeyID      string `json:"key_id,omitempty"`
+}
+
+// encodeTableFile compresses body, the records encoded with codec,
+// encrypts it if keys is set, and prefixes it with its header.
+func encodeTableFile(body []byte, codec Codec, compression Compression, keys KeyProvider, records, nextID int) ([]byte, error) {
+	body, err := compress(compression, body)
+	if err != nil {
+		return nil, err
+	}
+	var keyID string
+	if keys != nil {
+		if body, keyID, err = seal(keys, body); err != nil {
+			return nil, err
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	header := tableHeader{
+		Format:   tableFormatVersion,
+		Records:  records,
+		NextID:   nextID,
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+	if codec != JSONCodec {
+		header.Codec = codec.Name()
+	}
+	header.Compression = compressionNames[compression]
+	if keys != nil {
+		header.Encryption = encryptionName
+		header.KeyID = keyID
+	}
+
+	encoded, err := jsoniter.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	file := make([]byte, 0, len(encoded)+1+len(body))
+	file = append(append(file, encoded...), '\n')
+	return append(file, body...), nil
+}
+
+// readTableFile checks and decodes a table file of any supported format
+// from r, decrypting it with keys if needed. It passes the header to start
+// and then each record to fn as it is decoded, so a JSON table file that
+// is neither encrypted nor encoded with another codec is never held in
+// memory whole. Damage is reported as ErrCorrupted; a file from a newer
+// version is not corrupt but is refused all the same. The checksum can
+// only be compared at the end, so fn may see records of a file that turns
+// out to be damaged.
+func readTableFile(r io.Reader, keys KeyProvider, start func(header tableHeader) error, fn func(record Record) error) (tableHeader, error) {
+	var header tableHeader
+	reader := bufio.NewReaderSize(r, tableReadBuffer)
+	first, err := skipSpace(reader)
+	if err != nil && err != io.EOF {
+		return header, err
+	}
+
+	count := 0
+	ids := make(map[int]struct{})
+	seenKeys := make(map[string]struct{})
+	check := func(record Record) error {
+		if record.ID < 1 {
+			return fmt.Errorf("%w: invalid record id %d", ErrCorrupted, record.ID)
+		}
+		if _, ok := ids[record.ID]; ok {
+			return fmt.Errorf("%w: record %d appears twice", ErrCorrupted, record.ID)
+		}
+		ids[record.ID] = struct{}{}
+
+		if record.Key != "" {
+			if _, ok := seenKeys[record.Key]; ok {
+				return fmt.Errorf("%w: key %q appears twice", ErrCorrupted, record.Key)
+			}
+			seenKeys[record.Key] = struct{}{}
+		}
+		count++
+		return fn(record)
+	}
+
+	if first != '[' {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return header, fmt.Errorf("%w: missing header", ErrCorrupted)
+		}
+		if err != nil {
+			return header, err
+		}
+		if err := parseTableHeader(line, &header); err != nil {
+			return header, err
+		}
+	}
+	if err := start(header); err != nil {
+		return header, err
+	}
+
+	if header.Format == 0 {
+		if err := readJSONRecords(reader, check); err != nil {
+			return header, err
+		}
+		return header, nil
+	}
+
+	codec, err := codecByName(header.Codec)
+	if err != nil {
+		return header, err
+	}
+	if header.Encryption != "" && header.Encryption != encryptionName {
+		return header, fmt.Errorf("unknown encryption %q", header.Encryption)
+	}
+
+	hash := sha256.New()
+	body := io.TeeReader(reader, hash)
+	verify := func() error {
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return err
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != header.Checksum {
+			return fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+		}
+		return nil
+	}
+
+	if header.Encryption != "" || codec != JSONCodec {
+		// Sealed bodies and other codecs can only be decoded whole.
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return header, err
+		}
+		if err := verify(); err != nil {
+			return header, err
+		}
+		if header.Encryption != "" {
+			if data, err = unseal(keys, header.KeyID, data); err != nil {
+				return header, err
+			}
+		}
+		if data, err = decompress(header.Compression, data); err != nil {
+			return header, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		records, err := codec.Unmarshal(data)
+		if err != nil {
+			return header, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		for _, record := range records {
+			if err := check(record); err != nil {
+				return header, err
+			}
+		}
+	} else {
+		stream, err := decompressReader(header.Compression, body)
+		if err == nil {
+			err = readJSONRecords(stream, check)
+			stream.Close()
+		} else {
+			err = fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		// A damaged file is reported as such, whatever the decoder made
+		// of it.
+		if failed := verify(); failed != nil {
+			return header, failed
+		}
+		if err != nil {
+			return header, err
+		}
+	}
+
+	if count != header.Records {
+		return header, fmt.Errorf("%w: header counts %d records, file holds %d", ErrCorrupted, header.Records, count)
+	}
+	return header, nil
+}
+
+// tableReadBuffer is the buffer readTableFile reads a table file through.
+const tableReadBuffer = 64 << 10
+
+// readJSONRecords decodes a JSON array of records from r one record at a
+// time.
+func readJSONRecords(r io.Reader, fn func(record Record) error) error {
+	iter := jsoniter.Parse(strictJSON, r, tableReadBuffer)
+	var failed error
+	iter.ReadArrayCB(func(iter *jsoniter.Iterator) bool {
+		var record Record
+		iter.ReadVal(&record)
+		if iter.Error != nil {
+			return false
+		}
+		if err := fn(record); err != nil {
+			failed = err
+			return false
+		}
+		return true
+	})
+	if failed != nil {
+		return failed
+	}
+	if iter.Error != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, iter.Error)
+	}
+	return nil
+}
+
+// skipSpace discards leading whitespace from reader and returns the first
+// byte after it without consuming it.
+func skipSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return c, reader.UnreadByte()
+		}
+	}
+}
+
+// parseTableHeader reads the header line of a table file into header.
+func parseTableHeader(line []byte, header *tableHeader) error {
+	if err := strictJSON.Unmarshal(bytes.TrimSpace(line), header); err != nil {
+		return fmt.Errorf("%w: header: %v", ErrCorrupted, err)
+	}
+	if header.Format < 1 || header.Format > tableFormatVersion {
+		return fmt.Errorf("unsupported table format version %d", header.Format)
+	}
+	if header.Records < 0 || header.NextID < 1 {
+		return fmt.Errorf("%w: invalid header", ErrCorrupted)
+	}
+	return nil
+}
+
+// openTableFile checks the header of a table file and returns its body
+// decrypted and decompressed, along with the codec it was encoded with.
+func openTableFile(data []byte, keys KeyProvider) ([]byte, tableHeader, Codec, error) {
+	var header tableHeader
+	codec := JSONCodec
+	body := bytes.TrimSpace(data)
+
+	if len(body) > 0 && body[0] != '[' {
+		end := bytes.IndexByte(body, '\n')
+		if end < 0 {
+			return nil, header, nil, fmt.Errorf("%w: missing header", ErrCorrupted)
+		}
+		if err := parseTableHeader(body[:end], &header); err != nil {
+			return nil, header, nil, err
+		}
+
+		body = data[bytes.IndexByte(data, '\n')+1:]
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != header.Checksum {
+			return nil, header, nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+		}
+
+		var err error
+		if codec, err = codecByName(header.Codec); err != nil {
+			return nil, header, nil, err
+		}
+		switch header.Encryption {
+		case "":
+		case encryptionName:
+			if body, err = unseal(keys, header.KeyID, body); err != nil {
+				return nil, header, nil, err
+			}
+		default:
+			return nil, header, nil, fmt.Errorf("unknown encryption %q", header.Encryption)
+		}
+		if body, err = decompress(header.Compression, body); err != nil {
+			return nil, header, nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+	}
+	return body, header, codec, nil
+}
@@ -0,0 +1,294 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ListTables returns the names of the loaded tables in sorted order.
+func (database *Database) ListTables() []string {
+	names := database.tables.Keys()
+	sort.Strings(names)
+	return names
+}
+
+// DropTable removes a table and deletes its blobs. Its file is deleted and
+// its entry removed from master.json by the next Save. A table that
+// another table references through a foreign key, or that a view reads,
+// can't be dropped.
+func (database *Database) DropTable(name string) error {
+	if err := database.authorize(context.Background(), name, PermissionAdmin); err != nil {
+		return &TableError{Op: "DropTable", Table: name, Err: err}
+	}
+	if database.isUnloaded(name) {
+		return database.dropUnloaded(name)
+	}
+
+	table, err := database.table(name)
+	if err != nil {
+		return fmt.Errorf("DropTable: %w", err)
+	}
+
+	defer table.unlock(table.lock())
+
+	if table.dropped {
+		return &TableError{Op: "DropTable", Table: name, Err: ErrNotFound}
+	}
+	if child, ok := database.referencingTable(table, name); ok {
+		return fmt.Errorf("DropTable: %w: table %s is referenced by table %s", ErrForeignKeyViolation, name, child)
+	}
+	if view, ok := table.viewOf(); ok {
+		return fmt.Errorf("DropTable: table %s is used by view %s", name, view)
+	}
+	if err := table.writeAhead(walEntry{Table: name, Op: walDropTable}); err != nil {
+		return fmt.Errorf("DropTable: %w", err)
+	}
+
+	database.dropTable(table, name)
+
+	if dir, err := table.blobsDir(); err == nil {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("DropTable: %w", err)
+		}
+	}
+	return nil
+}
+
+func (database *Database) dropUnloaded(name string) error {
+	if child, ok := database.referencingTable(nil, name); ok {
+		return fmt.Errorf("DropTable: %w: table %s is referenced by table %s", ErrForeignKeyViolation, name, child)
+	}
+	if err := database.writeAhead(walEntry{Table: name, Op: walDropTable}); err != nil {
+		return fmt.Errorf("DropTable: %w", err)
+	}
+
+	database.RWMutex.Lock()
+	delete(database.unloaded, name)
+	database.RWMutex.Unlock()
+
+	database.layoutChanged.Store(true)
+	return nil
+}
+
+// dropTable unlinks table from the database. Callers hold the table lock.
+func (database *Database) dropTable(table *Table, name string) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	for _, fk := range table.foreignKeys {
+		if fk.parent == nil {
+			continue
+		}
+		referencedBy := fk.parent.referencedBy[:0]
+		for _, other := range fk.parent.referencedBy {
+			if other != fk {
+				referencedBy = append(referencedBy, other)
+			}
+		}
+		fk.parent.referencedBy = referencedBy
+	}
+
+	database.tables.Remove(name)
+	table.dropped = true
+	table.closeWatchers()
+	database.layoutChanged.Store(true)
+}
+
+// referencingTable returns a table other than table itself whose foreign
+// keys point at name. table is nil for a table that is not loaded.
+func (database *Database) referencingTable(table *Table, name string) (string, bool) {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	var found string
+	database.tables.IterCb(func(childName string, val interface{}) {
+		child, ok := val.(*Table)
+		if !ok || child == table || found != "" {
+			return
+		}
+		for _, fk := range child.foreignKeys {
+			if fk.parentName == name {
+				found = childName
+			}
+		}
+	})
+	if found != "" {
+		return found, true
+	}
+
+	for childName, meta := range database.unloaded {
+		if childName == name {
+			continue
+		}
+		for _, fk := range meta.ForeignKeys {
+			if fk.Table == name {
+				return childName, true
+			}
+		}
+	}
+	return "", false
+}
+
+// RenameTable renames a loaded table together with its blobs. Foreign keys
+// that point at it follow the new name. The table is written under its new
+// file name, and the old file deleted, by the next Save.
+func (database *Database) RenameTable(oldName, newName string) error {
+	if newName == "" || oldName == newName {
+		return errors.New("RenameTable: invalid table names")
+	}
+	for _, name := range []string{oldName, newName} {
+		if err := database.authorize(context.Background(), name, PermissionAdmin); err != nil {
+			return &TableError{Op: "RenameTable", Table: name, Err: err}
+		}
+	}
+	if database.isUnloaded(oldName) {
+		return errors.New("RenameTable: table exists on disk but is not loaded")
+	}
+	if database.isUnloaded(newName) {
+		return &TableError{Op: "RenameTable", Table: newName, Err: ErrTableExists}
+	}
+
+	table, err := database.table(oldName)
+	if err != nil {
+		return fmt.Errorf("RenameTable: %w", err)
+	}
+
+	defer table.unlock(table.lock())
+
+	if table.dropped {
+		return &TableError{Op: "RenameTable", Table: oldName, Err: ErrNotFound}
+	}
+	if !database.tables.SetIfAbsent(newName, table) {
+		return &TableError{Op: "RenameTable", Table: newName, Err: ErrTableExists}
+	}
+
+	oldBlobs, err := table.blobsDir()
+	newBlobs := filepath.Join(filepath.Dir(oldBlobs), blobFileName(newName))
+	if err == nil {
+		if err := os.Rename(oldBlobs, newBlobs); err != nil && !os.IsNotExist(err) {
+			database.tables.Remove(newName)
+			return fmt.Errorf("RenameTable: %w", err)
+		}
+	}
+
+	if err := table.writeAhead(walEntry{Table: oldName, Op: walRenameTable, NewName: newName}); err != nil {
+		os.Rename(newBlobs, oldBlobs)
+		database.tables.Remove(newName)
+		return fmt.Errorf("RenameTable: %w", err)
+	}
+
+	database.renameTable(table, oldName, newName)
+	return nil
+}
+
+// renameTable moves table to newName, which callers have already mapped to
+// it. Callers hold the table lock.
+func (database *Database) renameTable(table *Table, oldName, newName string) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	table.name = newName
+	database.tables.IterCb(func(childName string, val interface{}) {
+		if child, ok := val.(*Table); ok {
+			for _, fk := range child.foreignKeys {
+				if fk.parentName == oldName {
+					fk.parentName = newName
+				}
+			}
+		}
+	})
+	for childName, meta := range database.unloaded {
+		for field, fk := range meta.ForeignKeys {
+			if fk.Table == oldName {
+				fk.Table = newName
+				meta.ForeignKeys[field] = fk
+			}
+		}
+		database.unloaded[childName] = meta
+	}
+
+	database.tables.Remove(oldName)
+	table.modified()
+	database.layoutChanged.Store(true)
+}
+
+// TruncateTable deletes every record of a table and their blobs. A table
+// that another table references through a foreign key can't be
+// truncated.
+func (database *Database) TruncateTable(name string) error {
+	if err := database.authorize(context.Background(), name, PermissionAdmin); err != nil {
+		return &TableError{Op: "TruncateTable", Table: name, Err: err}
+	}
+	table, err := database.table(name)
+	if err != nil {
+		return fmt.Errorf("TruncateTable: %w", err)
+	}
+
+	if err := table.throttle("TruncateTable"); err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if child, ok := database.referencingTable(table, name); ok {
+		return fmt.Errorf("TruncateTable: %w: table %s is referenced by table %s", ErrForeignKeyViolation, name, child)
+	}
+
+	records := make([]Record, 0, table.records.Count())
+	table.records.IterCb(func(key string, val interface{}) {
+		if record, err := table.recordValue("TruncateTable", val); err == nil {
+			records = append(records, record)
+		}
+	})
+
+	entries := make([]walEntry, len(records))
+	for i := range records {
+		entries[i] = walEntry{Table: name, Op: ChangeDelete, ID: records[i].ID}
+	}
+	if err := table.writeAhead(entries...); err != nil {
+		return fmt.Errorf("TruncateTable: %w", err)
+	}
+
+	for i := range records {
+		table.removeRecord(records[i])
+		table.changed(ChangeDelete, &records[i], nil)
+	}
+	return nil
+}
+
+func (database *Database) replayDrop(name string) error {
+	if database.isUnloaded(name) {
+		database.RWMutex.Lock()
+		delete(database.unloaded, name)
+		database.RWMutex.Unlock()
+		return nil
+	}
+
+	table, err := database.table(name)
+	if err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+	database.dropTable(table, name)
+	return nil
+}
+
+func (database *Database) replayRename(oldName, newName string) error {
+	table, err := database.table(oldName)
+	if err != nil {
+		return err
+	}
+
+	defer table.unlock(table.lock())
+
+	if !database.tables.SetIfAbsent(newName, table) {
+		return fmt.Errorf("cannot rename table %s: %w", oldName, &TableError{Table: newName, Err: ErrTableExists})
+	}
+	database.renameTable(table, oldName, newName)
+	return nil
+}
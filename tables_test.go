@@ -0,0 +1,37 @@
+package velox
+
+import "testing"
+
+func TestEmptyTableNameRejected(t *testing.T) {
+	database, err := New(WithFolder(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	if err := database.CreateTable(""); err == nil {
+		t.Fatal("CreateTable accepted an empty name")
+	}
+	if err := database.CreateTableWithOptions("", TableOptions{}); err == nil {
+		t.Fatal("CreateTableWithOptions accepted an empty name")
+	}
+
+	if err := database.CreateTable("users"); err != nil {
+		t.Fatal(err)
+	}
+	users, _ := database.GetTable("users")
+	record, err := users.CreateRecord(map[string]interface{}{"name": "ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.PutBlob(record.GetID(), "avatar", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.DropTable(""); err == nil {
+		t.Fatal("DropTable accepted an empty name")
+	}
+	if _, err := users.GetBlob(record.GetID(), "avatar"); err != nil {
+		t.Fatalf("blob of another table lost: %v", err)
+	}
+}
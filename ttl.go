@@ -0,0 +1,152 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CreateRecordTTL creates a record that expires after ttl. Expired records
+// are treated as deleted by reads and updates straight away, and removed
+// for good by ExpireRecords, which StartExpiry runs in the background.
+func (table *Table) CreateRecordTTL(record interface{}, ttl time.Duration) (RecordInterface, error) {
+	if ttl <= 0 {
+		return nil, errors.New("CreateRecordTTL: ttl must be positive")
+	}
+
+	if err := table.throttle("CreateRecordTTL"); err != nil {
+		return nil, err
+	}
+
+	defer table.unlock(table.lock())
+
+	expires := table.now().Add(ttl)
+	return table.insert("CreateRecordTTL", Record{ID: table.nextID, Data: record, ExpiresAt: &expires})
+}
+
+// ExpireRecords deletes the expired records of the table and returns how
+// many it deleted, not counting records removed by cascades. Expired
+// records that are still referenced under RestrictOnDelete are kept until
+// the references are gone.
+func (table *Table) ExpireRecords() (int, error) {
+	if err := table.administer("ExpireRecords"); err != nil {
+		return 0, err
+	}
+
+	return table.expireRecords()
+}
+
+func (table *Table) expireRecords() (int, error) {
+	defer unlockTables(table.lockForDelete())
+
+	expired := make([]Record, 0)
+	table.records.IterCb(func(key string, val interface{}) {
+		if record, err := table.recordValue("ExpireRecords", val); err == nil && table.ttlExpired(record) {
+			expired = append(expired, record)
+		}
+	})
+
+	deleted := 0
+	for _, record := range expired {
+		// An earlier delete can have cascaded to it.
+		if _, ok := table.records.Get(strconv.Itoa(record.ID)); !ok {
+			continue
+		}
+
+		err := table.purgeRecord("ExpireRecords", record, false)
+		if errors.Is(err, ErrForeignKeyViolation) {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+type reaper struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartExpiry runs ExpireRecords on every table each interval.
+func (database *Database) StartExpiry(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("StartExpiry: interval must be positive")
+	}
+	if database.readOnly {
+		return fmt.Errorf("StartExpiry: %w", ErrReadOnly)
+	}
+
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	if database.reaper != nil {
+		return errors.New("StartExpiry: expiry already running")
+	}
+
+	reaper := &reaper{stop: make(chan struct{}), done: make(chan struct{})}
+	database.reaper = reaper
+	go reaper.run(database, interval)
+
+	return nil
+}
+
+// StopExpiry stops the background expiry and waits for a running pass to
+// finish.
+func (database *Database) StopExpiry() {
+	database.RWMutex.Lock()
+	reaper := database.reaper
+	database.reaper = nil
+	database.RWMutex.Unlock()
+
+	if reaper == nil {
+		return
+	}
+	close(reaper.stop)
+	<-reaper.done
+}
+
+func (reaper *reaper) run(database *Database, interval time.Duration) {
+	defer close(reaper.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-reaper.stop:
+			return
+		case <-ticker.C:
+			for _, name := range database.ListTables() {
+				table, err := database.table(name)
+				if err != nil {
+					continue
+				}
+				if _, err := table.expireRecords(); err != nil {
+					database.log().Error("expiring records failed", "table", name, "error", err)
+				}
+			}
+		}
+	}
+}
+
+// hidden reports whether reads treat record as gone: its TTL has run out or
+// it has been soft-deleted.
+func (table *Table) hidden(record Record) bool {
+	return record.DeletedAt != nil || table.ttlExpired(record)
+}
+
+// ttlExpired reports whether record's TTL has run out.
+func (table *Table) ttlExpired(record Record) bool {
+	return record.ExpiresAt != nil && !table.now().Before(*record.ExpiresAt)
+}
+
+func (table *Table) now() time.Time {
+	if table.database == nil {
+		return time.Now()
+	}
+	return table.database.now()
+}
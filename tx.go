@@ -0,0 +1,312 @@
+package velox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+var (
+	ErrTxDone   = errors.New("transaction already committed or rolled back")
+	ErrConflict = errors.New("conflicting change")
+)
+
+// Tx groups creates, updates and deletes across tables so they are applied
+// all together or not at all. Nothing is applied before Commit. Records
+// read through the Tx must be unchanged when it commits, otherwise Commit
+// fails with ErrConflict, which makes read-modify-write sequences safe. A
+// Tx must not be used from several goroutines at once.
+type Tx struct {
+	database *Database
+	ops      []txOp
+	reads    []txRead
+	done     bool
+}
+
+type txOp struct {
+	table *Table
+	op    ChangeOp
+	id    int
+	data  interface{}
+}
+
+type txRead struct {
+	table *Table
+	id    int
+	data  interface{}
+	found bool
+}
+
+// txCommit collects what a committing transaction has applied, so it can
+// be logged and reported once every operation has succeeded, or undone if
+// one fails.
+type txCommit struct {
+	entries []walEntry
+	changes []txChange
+}
+
+type txChange struct {
+	table         *Table
+	op            ChangeOp
+	before, after *Record
+}
+
+func (database *Database) Begin() *Tx {
+	return &Tx{database: database}
+}
+
+// Create queues a record for creation and returns the ID it will get. The
+// ID is reserved straight away, so it can be referenced by later
+// operations of the same Tx. A rolled back Tx doesn't give its IDs back.
+func (tx *Tx) Create(tableName string, data interface{}) (int, error) {
+	table, err := tx.table("Create", tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	id := table.reserveIDs(1)
+	tx.ops = append(tx.ops, txOp{table: table, op: ChangeCreate, id: id, data: data})
+	return id, nil
+}
+
+func (tx *Tx) Update(tableName string, id int, data interface{}) error {
+	table, err := tx.table("Update", tableName)
+	if err != nil {
+		return err
+	}
+
+	tx.ops = append(tx.ops, txOp{table: table, op: ChangeUpdate, id: id, data: data})
+	return nil
+}
+
+func (tx *Tx) Delete(tableName string, id int) error {
+	table, err := tx.table("Delete", tableName)
+	if err != nil {
+		return err
+	}
+
+	tx.ops = append(tx.ops, txOp{table: table, op: ChangeDelete, id: id})
+	return nil
+}
+
+// Read returns the record data as this Tx would leave it, taking its
+// queued operations into account.
+func (tx *Tx) Read(tableName string, id int) (interface{}, error) {
+	table, err := tx.table("Read", tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(tx.ops) - 1; i >= 0; i-- {
+		op := tx.ops[i]
+		if op.table != table || op.id != id {
+			continue
+		}
+		if op.op == ChangeDelete {
+			return nil, table.notFound("Read", id)
+		}
+		return op.data, nil
+	}
+
+	data, err := table.ReadRecord(id)
+	tx.reads = append(tx.reads, txRead{table: table, id: id, data: data, found: err == nil})
+	if err != nil {
+		return nil, table.notFound("Read", id)
+	}
+	return data, nil
+}
+
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return fmt.Errorf("Rollback: %w", ErrTxDone)
+	}
+
+	tx.done = true
+	tx.ops = nil
+	tx.reads = nil
+	return nil
+}
+
+// Commit applies the queued operations in order. Deletes cascade and
+// restrict as usual. If any operation fails, the ones before it are undone
+// and the error is returned. Commit holds the locks of every table it
+// touches until it is done, and ReadRecord waits for them, so reads never
+// see changes that are then undone.
+func (tx *Tx) Commit() error {
+	return tx.CommitCtx(context.Background())
+}
+
+// CommitCtx is Commit that gives up if ctx is done before the operations
+// start being applied. The Tx is finished either way.
+func (tx *Tx) CommitCtx(ctx context.Context) error {
+	if tx.done {
+		return fmt.Errorf("Commit: %w", ErrTxDone)
+	}
+	tx.done = true
+
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	if err := tx.ops[0].table.throttleCtx(ctx, "Commit", PermissionWrite); err != nil {
+		return err
+	}
+	// The commit is throttled once, but every table it writes is checked.
+	for _, op := range tx.ops[1:] {
+		if err := op.table.authorize(ctx, PermissionWrite); err != nil {
+			return fmt.Errorf("Commit: %w", err)
+		}
+	}
+
+	locked := lockScope(tx.scope)
+	defer unlockTables(locked)
+	defer actAs(ctx, locked)()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("Commit: %w", err)
+	}
+	if err := tx.checkReads(); err != nil {
+		return err
+	}
+
+	return runCommit(locked, tx.apply)
+}
+
+// runCommit runs apply with the changes to the locked tables held back,
+// logs them with a single write and then publishes them. If apply or the
+// log write fails, every change is undone.
+func runCommit(locked []lockedTable, apply func() error) error {
+	commit := &txCommit{}
+	for _, lt := range locked {
+		lt.table.commit = commit
+	}
+	err := apply()
+	for _, lt := range locked {
+		lt.table.commit = nil
+	}
+	if err == nil && len(commit.entries) > 0 {
+		err = locked[0].table.logAhead(commit.entries...)
+	}
+	if err != nil {
+		commit.undo()
+		return err
+	}
+
+	for _, change := range commit.changes {
+		if change.op == ChangeDelete {
+			change.table.removeBlobs(change.before.ID)
+		}
+		change.table.changed(change.op, change.before, change.after)
+	}
+	return nil
+}
+
+func (tx *Tx) table(op, name string) (*Table, error) {
+	if tx.done {
+		return nil, fmt.Errorf("%s: %w", op, ErrTxDone)
+	}
+
+	table, err := tx.database.table(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return table, nil
+}
+
+// scope returns the tables Commit has to lock: every table written or
+// read, and everything a delete can cascade to.
+func (tx *Tx) scope() []*Table {
+	tables := make([]*Table, 0, len(tx.ops)+len(tx.reads))
+	for _, op := range tx.ops {
+		if op.op == ChangeDelete {
+			tables = append(tables, op.table.deleteScope()...)
+		} else {
+			tables = append(tables, op.table)
+		}
+	}
+	for _, read := range tx.reads {
+		tables = append(tables, read.table)
+	}
+	return tables
+}
+
+func (tx *Tx) checkReads() error {
+	for _, read := range tx.reads {
+		var record Record
+		val, found := read.table.records.Get(strconv.Itoa(read.id))
+		if found {
+			var err error
+			if record, err = read.table.recordValue("Commit", val); err != nil {
+				return err
+			}
+			// Read saw soft-deleted and expired records as not found.
+			found = !read.table.hidden(record)
+		}
+		if found != read.found {
+			return fmt.Errorf("Commit: %w: record %d in table %s", ErrConflict, read.id, read.table.name)
+		}
+		if !found {
+			continue
+		}
+
+		if !reflect.DeepEqual(record.Data, read.data) {
+			return fmt.Errorf("Commit: %w: record %d in table %s", ErrConflict, read.id, read.table.name)
+		}
+	}
+	return nil
+}
+
+// apply runs the queued operations. Callers hold the locks of tx.scope.
+func (tx *Tx) apply() error {
+	for _, op := range tx.ops {
+		val, found := op.table.records.Get(strconv.Itoa(op.id))
+
+		switch op.op {
+		case ChangeCreate:
+			if found {
+				return &RecordError{Op: "Commit", Table: op.table.name, ID: op.id, Err: ErrRecordExists}
+			}
+			if _, err := op.table.insertRecordAt("Commit", op.id, op.data, nil); err != nil {
+				return err
+			}
+
+		case ChangeUpdate, ChangeDelete:
+			if !found {
+				return op.table.notFound("Commit", op.id)
+			}
+			record, err := op.table.recordValue("Commit", val)
+			if err != nil {
+				return err
+			}
+			if op.table.hidden(record) {
+				return op.table.notFound("Commit", op.id)
+			}
+
+			if op.op == ChangeUpdate {
+				err = op.table.replaceData("Commit", record, op.data)
+			} else {
+				err = op.table.deleteRecord("Commit", record)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// undo reverts the applied changes, newest first.
+func (commit *txCommit) undo() {
+	for i := len(commit.changes) - 1; i >= 0; i-- {
+		change := commit.changes[i]
+		switch {
+		case change.before == nil:
+			change.table.unsetRecord(*change.after)
+		case change.after == nil:
+			change.table.setRecord(nil, *change.before)
+		default:
+			change.table.setRecord(change.after, *change.before)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package velox
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTxHiddenRecordsNotFound(t *testing.T) {
+	database, table := newTestTable(t, "items")
+	table.SetSoftDelete(true)
+
+	record, err := table.CreateRecord(map[string]interface{}{"name": "gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.DeleteRecord(record.GetID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.ReadRecord(record.GetID()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ReadRecord of soft-deleted record = %v, want ErrNotFound", err)
+	}
+
+	tx := database.Begin()
+	tx.Update("items", record.GetID(), map[string]interface{}{"name": "back"})
+	if err := tx.Commit(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Tx update of soft-deleted record = %v, want ErrNotFound", err)
+	}
+
+	tx = database.Begin()
+	tx.Delete("items", record.GetID())
+	if err := tx.Commit(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Tx delete of soft-deleted record = %v, want ErrNotFound", err)
+	}
+}
+
+func TestTxReadOfHiddenRecordCommits(t *testing.T) {
+	database, table := newTestTable(t, "items")
+	table.SetSoftDelete(true)
+
+	gone, err := table.CreateRecord(map[string]interface{}{"name": "gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := table.CreateRecord(map[string]interface{}{"name": "kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.DeleteRecord(gone.GetID()); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := database.Begin()
+	if _, err := tx.Read("items", gone.GetID()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Tx read of soft-deleted record = %v, want ErrNotFound", err)
+	}
+	tx.Update("items", kept.GetID(), map[string]interface{}{"name": "updated"})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit after reading a soft-deleted record: %v", err)
+	}
+
+	tx = database.Begin()
+	if _, err := tx.Read("items", gone.GetID()); !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	if err := table.RestoreRecord(gone.GetID()); err != nil {
+		t.Fatal(err)
+	}
+	tx.Update("items", kept.GetID(), map[string]interface{}{"name": "again"})
+	if err := tx.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Commit after a read record was restored = %v, want ErrConflict", err)
+	}
+}
@@ -0,0 +1,95 @@
+package velox
+
+import (
+	"fmt"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// TypedTable wraps a Table whose records all hold a T. Data that no longer
+// has type T, such as a map[string]interface{} read back from disk, is
+// converted to T through JSON on the way out.
+type TypedTable[T any] struct {
+	table *Table
+}
+
+type TypedRecord[T any] struct {
+	ID   int
+	Data T
+}
+
+// OpenTable returns the named table as a TypedTable, creating it if it
+// doesn't exist.
+func OpenTable[T any](database *Database, name string) (*TypedTable[T], error) {
+	table, err := database.table(name)
+	if err != nil {
+		if createErr := database.CreateTable(name); createErr != nil {
+			if table, err = database.table(name); err != nil {
+				return nil, fmt.Errorf("OpenTable: %w", createErr)
+			}
+		} else if table, err = database.table(name); err != nil {
+			return nil, fmt.Errorf("OpenTable: %w", err)
+		}
+	}
+
+	return &TypedTable[T]{table: table}, nil
+}
+
+// Table returns the untyped table underneath.
+func (typed *TypedTable[T]) Table() *Table {
+	return typed.table
+}
+
+func (typed *TypedTable[T]) CreateRecord(data T) (TypedRecord[T], error) {
+	record, err := typed.table.CreateRecord(data)
+	if err != nil {
+		return TypedRecord[T]{}, err
+	}
+	return TypedRecord[T]{ID: record.GetID(), Data: data}, nil
+}
+
+func (typed *TypedTable[T]) ReadRecord(id int) (T, error) {
+	data, err := typed.table.ReadRecord(id)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return convertData[T]("ReadRecord", data)
+}
+
+func (typed *TypedTable[T]) GetRecord(id int) (TypedRecord[T], error) {
+	record, err := typed.table.GetRecord(id)
+	if err != nil {
+		return TypedRecord[T]{}, err
+	}
+
+	data, err := convertData[T]("GetRecord", record.GetData())
+	if err != nil {
+		return TypedRecord[T]{}, err
+	}
+	return TypedRecord[T]{ID: record.GetID(), Data: data}, nil
+}
+
+func (typed *TypedTable[T]) UpdateRecord(id int, data T) error {
+	return typed.table.UpdateRecord(id, data)
+}
+
+func (typed *TypedTable[T]) DeleteRecord(id int) error {
+	return typed.table.DeleteRecord(id)
+}
+
+func convertData[T any](op string, data interface{}) (T, error) {
+	if value, ok := data.(T); ok {
+		return value, nil
+	}
+
+	var value T
+	encoded, err := jsoniter.Marshal(data)
+	if err != nil {
+		return value, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := jsoniter.Unmarshal(encoded, &value); err != nil {
+		return value, fmt.Errorf("%s: cannot convert %T to %T: %w", op, data, value, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,303 @@
+// Package veloxauth authenticates the callers of veloxhttp and veloxgrpc
+// servers with API keys and JWTs, and limits what each may do with scopes.
+//
+// An Authenticator holds the API keys and JWT verification keys. Its
+// Middleware and interceptors reject every request that doesn't carry a
+// valid token, either as "Authorization: Bearer <token>" or, for API keys,
+// as "X-API-Key: <key>", and run the others as the token's principal:
+//
+//	auth := veloxauth.New()
+//	auth.AddAPIKey(key, veloxauth.APIKey{Principal: "billing", Scopes: []string{"write:invoices"}})
+//	auth.AddJWTKey(veloxauth.JWTKey{ID: "2024-06", Key: publicKey})
+//	database.SetAuthorizer(veloxauth.RequireScopes(nil))
+//	handler := veloxhttp.NewServer(database, auth.Middleware())
+//
+// A scope is read, write or admin, for every table, or one of them
+// followed by a colon and a table name, such as read:users. Like
+// velox.Permission, each includes the ones before it. RequireScopes
+// refuses operations the request's scopes don't cover; a token without
+// scopes can do nothing.
+//
+// Keys are rotated by adding the new key, giving the old one an Expires
+// time or removing it once tokens signed or issued with it are no longer
+// in use. SetJWTKeys replaces every JWT key at once, for example when a
+// key set is reloaded.
+package veloxauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	velox "github.com/properfish/VeloxDB"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrUnauthenticated is returned for requests without a valid token.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Identity is who a token was issued to and what it allows.
+type Identity struct {
+	Principal string
+	Scopes    []string
+}
+
+// APIKey describes the holder of an API key.
+type APIKey struct {
+	Principal string
+	Scopes    []string
+	// Expires, if not zero, is when the key stops working.
+	Expires time.Time
+}
+
+// Options configures NewWithOptions.
+type Options struct {
+	// Issuer and Audience, if set, must match the iss and aud claims of
+	// every JWT.
+	Issuer   string
+	Audience string
+	// Leeway is how far clocks may disagree when checking exp and nbf.
+	Leeway time.Duration
+	// Clock replaces the system clock, for tests.
+	Clock velox.Clock
+}
+
+// Authenticator checks API keys and JWTs. Keys can be added and removed
+// while it is in use.
+type Authenticator struct {
+	options Options
+
+	mu sync.RWMutex
+	// apiKeys is keyed by the SHA-256 of the key, so the keys themselves
+	// aren't kept in memory.
+	apiKeys map[[sha256.Size]byte]APIKey
+	jwtKeys map[string]JWTKey
+}
+
+func New() *Authenticator {
+	return NewWithOptions(Options{})
+}
+
+func NewWithOptions(options Options) *Authenticator {
+	return &Authenticator{
+		options: options,
+		apiKeys: make(map[[sha256.Size]byte]APIKey),
+		jwtKeys: make(map[string]JWTKey),
+	}
+}
+
+// AddAPIKey lets requests in with key, as apiKey's principal. Adding a
+// key again replaces its description.
+func (auth *Authenticator) AddAPIKey(key string, apiKey APIKey) error {
+	if key == "" {
+		return errors.New("AddAPIKey: empty key")
+	}
+	if apiKey.Principal == "" {
+		return errors.New("AddAPIKey: empty principal")
+	}
+	apiKey.Scopes = append([]string(nil), apiKey.Scopes...)
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	auth.apiKeys[sha256.Sum256([]byte(key))] = apiKey
+	return nil
+}
+
+// RemoveAPIKey stops key from working.
+func (auth *Authenticator) RemoveAPIKey(key string) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	delete(auth.apiKeys, sha256.Sum256([]byte(key)))
+}
+
+// Authenticate returns the identity token stands for, which is either an
+// API key or a JWT. The error wraps ErrUnauthenticated.
+func (auth *Authenticator) Authenticate(token string) (Identity, error) {
+	if token == "" {
+		return Identity{}, fmt.Errorf("%w: no token", ErrUnauthenticated)
+	}
+	now := auth.now()
+
+	auth.mu.RLock()
+	apiKey, ok := auth.apiKeys[sha256.Sum256([]byte(token))]
+	auth.mu.RUnlock()
+	if ok {
+		if !apiKey.Expires.IsZero() && !now.Before(apiKey.Expires) {
+			return Identity{}, fmt.Errorf("%w: API key expired", ErrUnauthenticated)
+		}
+		return Identity{Principal: apiKey.Principal, Scopes: append([]string(nil), apiKey.Scopes...)}, nil
+	}
+
+	if strings.Count(token, ".") == 2 {
+		return auth.verifyJWT(token, now)
+	}
+	return Identity{}, fmt.Errorf("%w: unknown API key", ErrUnauthenticated)
+}
+
+func (auth *Authenticator) now() time.Time {
+	if auth.options.Clock != nil {
+		return auth.options.Clock.Now()
+	}
+	return time.Now()
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying identity, with its principal as
+// the velox actor.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	ctx = context.WithValue(ctx, identityKey{}, identity)
+	return velox.WithActor(ctx, identity.Principal)
+}
+
+// IdentityFrom returns the identity set with WithIdentity.
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// Middleware returns a veloxhttp middleware that answers requests without
+// a valid token with 401 Unauthorized and runs the others with the
+// token's identity.
+func (auth *Authenticator) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get("X-API-Key")
+			if token == "" {
+				token = bearer(r.Header.Get("Authorization"))
+			}
+			identity, err := auth.Authenticate(token)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="velox"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				jsoniter.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// UnaryInterceptor returns a gRPC interceptor that fails calls without a
+// valid token with Unauthenticated and runs the others with the token's
+// identity. Tokens are read from the authorization and x-api-key
+// metadata, as the HTTP headers are.
+func (auth *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := auth.authenticateGRPC(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
+
+// StreamInterceptor is UnaryInterceptor for streaming calls.
+func (auth *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := auth.authenticateGRPC(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(server, identityStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// ServerOptions returns the options that install both interceptors, for
+// veloxgrpc.Serve or grpc.NewServer.
+func (auth *Authenticator) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(auth.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(auth.StreamInterceptor()),
+	}
+}
+
+func (auth *Authenticator) authenticateGRPC(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		token = values[0]
+	} else if values := md.Get("authorization"); len(values) > 0 {
+		token = bearer(values[0])
+	}
+
+	identity, err := auth.Authenticate(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return WithIdentity(ctx, identity), nil
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream identityStream) Context() context.Context {
+	return stream.ctx
+}
+
+// bearer returns the token of an Authorization header using the Bearer
+// scheme, or "".
+func bearer(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// RequireScopes returns a velox.Authorizer that refuses operations the
+// scopes of the request's identity don't cover, and then asks next, if not
+// nil. Operations without an identity didn't come through an
+// Authenticator, but from the application itself, and are left to next
+// alone.
+func RequireScopes(next velox.Authorizer) velox.Authorizer {
+	return scopeAuthorizer{next: next}
+}
+
+type scopeAuthorizer struct {
+	next velox.Authorizer
+}
+
+var scopePermissions = map[string]velox.Permission{
+	"read":  velox.PermissionRead,
+	"write": velox.PermissionWrite,
+	"admin": velox.PermissionAdmin,
+}
+
+func (authorizer scopeAuthorizer) Authorize(ctx context.Context, table string, permission velox.Permission) error {
+	if identity, ok := IdentityFrom(ctx); ok && !covers(identity.Scopes, table, permission) {
+		return fmt.Errorf("%w: %s has no scope for %s on table %s", velox.ErrPermissionDenied, identity.Principal, permission, table)
+	}
+	if authorizer.next != nil {
+		return authorizer.next.Authorize(ctx, table, permission)
+	}
+	return nil
+}
+
+// covers reports whether scopes allow permission on table.
+func covers(scopes []string, table string, permission velox.Permission) bool {
+	for _, scope := range scopes {
+		name, scopeTable, scoped := strings.Cut(scope, ":")
+		if scoped && scopeTable != table {
+			continue
+		}
+		if granted, ok := scopePermissions[name]; ok && granted >= permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package veloxauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.Hash
+	_ "crypto/sha512" // registers SHA-384 and SHA-512
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// JWTKey is a key JWTs are verified with. The algorithms it accepts follow
+// from its type:
+//
+//	[]byte             HS256, HS384, HS512
+//	*rsa.PublicKey     RS256, RS384, RS512, PS256, PS384, PS512
+//	*ecdsa.PublicKey   ES256, ES384, ES512
+//	ed25519.PublicKey  EdDSA
+type JWTKey struct {
+	// ID is matched against the kid header of tokens. Tokens without a
+	// kid are tried against every key that fits their algorithm.
+	ID  string
+	Key interface{}
+	// Expires, if not zero, is when the key stops being accepted, so that
+	// a rotated-out key keeps working until the tokens it signed expire.
+	Expires time.Time
+}
+
+// AddJWTKey accepts JWTs signed with key, on top of the keys added so far.
+// A key with the ID of one already added replaces it.
+func (auth *Authenticator) AddJWTKey(key JWTKey) error {
+	if err := checkJWTKey(key); err != nil {
+		return fmt.Errorf("AddJWTKey: %w", err)
+	}
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	auth.jwtKeys[key.ID] = key
+	return nil
+}
+
+// RemoveJWTKey stops accepting JWTs signed with the key called id.
+func (auth *Authenticator) RemoveJWTKey(id string) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	delete(auth.jwtKeys, id)
+}
+
+// SetJWTKeys replaces every JWT key with keys at once.
+func (auth *Authenticator) SetJWTKeys(keys []JWTKey) error {
+	replaced := make(map[string]JWTKey, len(keys))
+	for _, key := range keys {
+		if err := checkJWTKey(key); err != nil {
+			return fmt.Errorf("SetJWTKeys: %w", err)
+		}
+		if _, ok := replaced[key.ID]; ok {
+			return fmt.Errorf("SetJWTKeys: duplicate key ID %q", key.ID)
+		}
+		replaced[key.ID] = key
+	}
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	auth.jwtKeys = replaced
+	return nil
+}
+
+func checkJWTKey(key JWTKey) error {
+	switch k := key.Key.(type) {
+	case []byte:
+		if len(k) == 0 {
+			return fmt.Errorf("key %q: empty HMAC secret", key.ID)
+		}
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return fmt.Errorf("key %q: unsupported key type %T", key.ID, key.Key)
+	}
+	return nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  interface{} `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	// Scope is the OAuth 2.0 scope claim, space separated. Some issuers
+	// use scp, a list, instead.
+	Scope string      `json:"scope"`
+	Scp   interface{} `json:"scp"`
+}
+
+// verifyJWT checks the signature and claims of a JWT in compact form. The
+// token must have sub and exp claims.
+func (auth *Authenticator) verifyJWT(token string, now time.Time) (Identity, error) {
+	parts := strings.Split(token, ".")
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, fmt.Errorf("%w: invalid JWT header: %v", ErrUnauthenticated, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: invalid JWT signature encoding", ErrUnauthenticated)
+	}
+
+	auth.mu.RLock()
+	var keys []JWTKey
+	if header.Kid != "" {
+		if key, ok := auth.jwtKeys[header.Kid]; ok {
+			keys = append(keys, key)
+		}
+	} else {
+		for _, key := range auth.jwtKeys {
+			keys = append(keys, key)
+		}
+	}
+	auth.mu.RUnlock()
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if !key.Expires.IsZero() && !now.Before(key.Expires) {
+			continue
+		}
+		if verifySignature(header.Alg, key.Key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return Identity{}, fmt.Errorf("%w: JWT signature not verified by any key", ErrUnauthenticated)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("%w: invalid JWT claims: %v", ErrUnauthenticated, err)
+	}
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: JWT has no sub claim", ErrUnauthenticated)
+	}
+	leeway := auth.options.Leeway
+	if claims.ExpiresAt == nil {
+		return Identity{}, fmt.Errorf("%w: JWT has no exp claim", ErrUnauthenticated)
+	}
+	if !now.Before(unixTime(*claims.ExpiresAt).Add(leeway)) {
+		return Identity{}, fmt.Errorf("%w: JWT expired", ErrUnauthenticated)
+	}
+	if claims.NotBefore != nil && now.Add(leeway).Before(unixTime(*claims.NotBefore)) {
+		return Identity{}, fmt.Errorf("%w: JWT not valid yet", ErrUnauthenticated)
+	}
+	if auth.options.Issuer != "" && claims.Issuer != auth.options.Issuer {
+		return Identity{}, fmt.Errorf("%w: JWT issuer %q not accepted", ErrUnauthenticated, claims.Issuer)
+	}
+	if auth.options.Audience != "" && !containsAudience(claims.Audience, auth.options.Audience) {
+		return Identity{}, fmt.Errorf("%w: JWT not issued for this audience", ErrUnauthenticated)
+	}
+
+	return Identity{Principal: claims.Subject, Scopes: claims.scopes()}, nil
+}
+
+func (claims jwtClaims) scopes() []string {
+	scopes := strings.Fields(claims.Scope)
+	switch scp := claims.Scp.(type) {
+	case string:
+		scopes = append(scopes, strings.Fields(scp)...)
+	case []interface{}:
+		for _, scope := range scp {
+			if s, ok := scope.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
+
+func containsAudience(claim interface{}, audience string) bool {
+	switch aud := claim.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return jsoniter.Unmarshal(decoded, v)
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+var hashes = map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+
+// curveBits is the curve each ES algorithm signs with: P-256, P-384 and
+// P-521.
+var curveBits = map[string]int{"256": 256, "384": 384, "512": 521}
+
+// verifySignature reports whether signature is a valid alg signature of
+// signed by key. Algorithms that don't fit the key's type, and none, never
+// verify.
+func verifySignature(alg string, key interface{}, signed, signature []byte) bool {
+	if alg == "EdDSA" {
+		return verifyEd25519(key, signed, signature)
+	}
+	if len(alg) != 5 {
+		return false
+	}
+	hash, ok := hashes[alg[2:]]
+	if !ok {
+		return false
+	}
+	h := hash.New()
+	h.Write(signed)
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case "RS":
+		public, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(public, hash, h.Sum(nil), signature) == nil
+	case "PS":
+		public, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(public, hash, h.Sum(nil), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	case "ES":
+		public, ok := key.(*ecdsa.PublicKey)
+		if !ok || public.Curve.Params().BitSize != curveBits[alg[2:]] {
+			return false
+		}
+		size := (public.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(public, h.Sum(nil), r, s)
+	}
+	return false
+}
+
+func verifyEd25519(key interface{}, signed, signature []byte) bool {
+	public, ok := key.(ed25519.PublicKey)
+	return ok && len(public) == ed25519.PublicKeySize && ed25519.Verify(public, signed, signature)
+}
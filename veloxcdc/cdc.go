@@ -0,0 +1,166 @@
+// Package veloxcdc publishes the changes captured by velox.EnableCDC to
+// Kafka or NATS JetStream.
+//
+// Each change becomes a message holding the velox.CDCEvent as JSON. The
+// sinks leave the connection to the broker to a client library of the
+// application's choosing, behind KafkaProducer or NATSPublisher, which
+// take a few lines to implement over any of them:
+//
+//	type producer struct{ *kafka.Writer }
+//
+//	func (p producer) Produce(ctx context.Context, messages []veloxcdc.KafkaMessage) error {
+//		converted := make([]kafka.Message, len(messages))
+//		for i, m := range messages {
+//			converted[i] = kafka.Message{Topic: m.Topic, Key: m.Key, Value: m.Value}
+//		}
+//		return p.WriteMessages(ctx, converted...)
+//	}
+//
+//	database.EnableCDC(veloxcdc.NewKafkaSink(producer{writer}))
+//
+// Delivery is at least once: after a failure or a restart, changes the
+// broker already has may be sent again. Consumers can tell repeats apart
+// by the LSN of the event, which Kafka messages carry in the velox-lsn
+// header and NATS messages as their Nats-Msg-Id, so that JetStream drops
+// repeats within its duplicate window.
+package veloxcdc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	velox "github.com/properfish/VeloxDB"
+)
+
+// KafkaMessage is a message for a Kafka topic.
+type KafkaMessage struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// KafkaProducer sends messages to Kafka. Produce must return nil only once
+// the brokers have acknowledged every message, which takes acks=all to
+// survive the loss of a broker, and must keep the order of the messages of
+// each topic and key.
+type KafkaProducer interface {
+	Produce(ctx context.Context, messages []KafkaMessage) error
+}
+
+// KafkaOptions configures NewKafkaSinkWithOptions.
+type KafkaOptions struct {
+	// Topic returns the topic of the changes of table. By default every
+	// change goes to the topic velox.<table>.
+	Topic func(table string) string
+}
+
+// KafkaSink is a velox.CDCSink producing to Kafka. Messages are keyed by
+// record ID, so the changes of a record land on one partition, in order.
+type KafkaSink struct {
+	producer KafkaProducer
+	options  KafkaOptions
+}
+
+func NewKafkaSink(producer KafkaProducer) *KafkaSink {
+	return NewKafkaSinkWithOptions(producer, KafkaOptions{})
+}
+
+func NewKafkaSinkWithOptions(producer KafkaProducer, options KafkaOptions) *KafkaSink {
+	if options.Topic == nil {
+		options.Topic = func(table string) string { return "velox." + table }
+	}
+	return &KafkaSink{producer: producer, options: options}
+}
+
+// Publish implements velox.CDCSink.
+func (sink *KafkaSink) Publish(ctx context.Context, events []velox.CDCEvent) error {
+	messages := make([]KafkaMessage, 0, len(events))
+	for _, event := range events {
+		value, err := jsoniter.Marshal(event)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, KafkaMessage{
+			Topic:   sink.options.Topic(event.Table),
+			Key:     []byte(strconv.Itoa(event.ID)),
+			Value:   value,
+			Headers: map[string]string{"velox-lsn": strconv.FormatUint(event.LSN, 10)},
+		})
+	}
+	return sink.producer.Produce(ctx, messages)
+}
+
+// NATSMessage is a message for a NATS subject.
+type NATSMessage struct {
+	Subject string
+	Data    []byte
+	// MsgID is to be sent as the Nats-Msg-Id header.
+	MsgID string
+}
+
+// NATSPublisher publishes to NATS JetStream. Publish must return nil only
+// once the stream has acknowledged the message. Plain NATS, which doesn't
+// acknowledge messages, can't give at-least-once delivery.
+type NATSPublisher interface {
+	Publish(ctx context.Context, message NATSMessage) error
+}
+
+// NATSOptions configures NewNATSSinkWithOptions.
+type NATSOptions struct {
+	// Subject returns the subject of a change. By default it is
+	// velox.<table>.<op>, with characters subjects can't hold in the table
+	// name replaced by underscores.
+	Subject func(event velox.CDCEvent) string
+}
+
+// NATSSink is a velox.CDCSink publishing to NATS JetStream, one message at
+// a time so that they are stored in order.
+type NATSSink struct {
+	publisher NATSPublisher
+	options   NATSOptions
+}
+
+func NewNATSSink(publisher NATSPublisher) *NATSSink {
+	return NewNATSSinkWithOptions(publisher, NATSOptions{})
+}
+
+func NewNATSSinkWithOptions(publisher NATSPublisher, options NATSOptions) *NATSSink {
+	if options.Subject == nil {
+		options.Subject = func(event velox.CDCEvent) string {
+			return "velox." + subjectToken(event.Table) + "." + string(event.Op)
+		}
+	}
+	return &NATSSink{publisher: publisher, options: options}
+}
+
+// Publish implements velox.CDCSink.
+func (sink *NATSSink) Publish(ctx context.Context, events []velox.CDCEvent) error {
+	for _, event := range events {
+		data, err := jsoniter.Marshal(event)
+		if err != nil {
+			return err
+		}
+		message := NATSMessage{
+			Subject: sink.options.Subject(event),
+			Data:    data,
+			MsgID:   strconv.FormatUint(event.LSN, 10),
+		}
+		if err := sink.publisher.Publish(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var subjectReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_", "\r", "_", "\n", "_")
+
+// subjectToken makes name usable as one token of a NATS subject.
+func subjectToken(name string) string {
+	if name == "" {
+		return "_"
+	}
+	return subjectReplacer.Replace(name)
+}
@@ -1,25 +1,60 @@
 package velox
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	cmap "github.com/orcaman/concurrent-map"
 )
 
+var (
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrInvalidRecordType  = errors.New("invalid record type")
+	ErrInvalidTableType   = errors.New("invalid table type")
+)
+
 type Record struct {
-	ID   int         `json:"id"`
-	Data interface{} `json:"data"`
+	ID   int               `json:"id"`
+	Key  string            `json:"key,omitempty"`
+	Data interface{}       `json:"data"`
+	Meta map[string]string `json:"meta,omitempty"`
+	Hash string            `json:"hash,omitempty"`
+
+	// Version starts at 1 and goes up with every change to the record.
+	// Records saved before versions existed load at 0.
+	Version int `json:"version,omitempty"`
+
+	// CreatedAt is when the record was created, and UpdatedAt when it was
+	// created or last updated, its metadata included. Records saved before
+	// these existed load with zero times.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// ExpiresAt is set for records created with a TTL.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// DeletedAt is set for records deleted from a table in soft delete
+	// mode, until they are restored or purged.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type RecordInterface interface {
 	GetID() int
 	GetData() interface{}
+	GetMeta() map[string]string
+	GetCreatedAt() time.Time
+	GetUpdatedAt() time.Time
 }
 
 func (record *Record) GetID() int {
@@ -30,9 +65,95 @@ func (record *Record) GetData() interface{} {
 	return record.Data
 }
 
+func (record *Record) GetVersion() int {
+	return record.Version
+}
+
+func (record *Record) GetCreatedAt() time.Time {
+	return record.CreatedAt
+}
+
+func (record *Record) GetUpdatedAt() time.Time {
+	return record.UpdatedAt
+}
+
+// Table is a table of records, safe for concurrent use. Reads are
+// linearizable with writes: a read sees every write that finished before it
+// started and none that hasn't finished, so a batch or transaction is seen
+// whole or not at all and a write that fails leaves nothing behind. A
+// query sees the table as of one moment. Cursor and Iterate look up one
+// record at a time and may see writes made between lookups; use
+// Database.Snapshot for a consistent view across tables or calls.
 type Table struct {
-	records *cmap.ConcurrentMap
+	records *recordMap
 	nextID  int
+	enums   map[string][]string
+	hashes  map[string]map[int]struct{}
+	indexes map[string]fieldIndex
+	// uniques indexes the fields with a unique constraint.
+	uniques map[string]fieldIndex
+	text    *textIndex
+	// indexingSuspended stops writes from updating indexes and text; see
+	// SuspendIndexing.
+	indexingSuspended bool
+
+	keyStrategy KeyStrategy
+	// keys maps record keys to IDs for tables that don't use
+	// KeyAutoIncrement.
+	keys map[string]int
+
+	schema *Schema
+
+	foreignKeys  map[string]*foreignKey
+	referencedBy []*foreignKey
+
+	monitor  lockMonitor
+	database *Database
+	// name changes only while both the table lock and the database lock
+	// are held, so either is enough to read it.
+	name string
+	// seq orders tables for locking; see lockTables.
+	seq     uint64
+	dropped bool
+
+	// commit collects the changes of the transaction that is committing
+	// while it holds this table's write lock.
+	commit *txCommit
+
+	watchers  map[*watcher]struct{}
+	snapshots map[*SnapshotTable]struct{}
+	// views are the views reading the table; see CreateView.
+	views map[*View]struct{}
+	// computed holds the computed fields; see AddComputedField. It is
+	// replaced, never changed, so it can be read without the lock.
+	computed atomic.Pointer[map[string]ComputeFunc]
+
+	// generation counts changes to the table; savedGeneration is the
+	// generation the last successful Save wrote.
+	generation      atomic.Uint64
+	savedGeneration atomic.Uint64
+	// savedShards is the number of files the table was last saved in or
+	// loaded from, kept in master.json while Save skips the table. Only
+	// Load and Save, which don't run at the same time, touch it.
+	savedShards int
+	// lastModified is the UnixNano time of the last record change.
+	lastModified atomic.Int64
+	// hasHidden is set once the table holds a record with a TTL or a
+	// soft-deleted one.
+	hasHidden bool
+	// softDelete makes deletes mark records instead of removing them.
+	softDelete bool
+	// copyOnRead makes reads return copies of record data. It is atomic
+	// so reads that copy outside the table lock can check it.
+	copyOnRead atomic.Bool
+
+	// history holds the changes to each record while history is enabled.
+	history map[int][]HistoryEntry
+	// actor is who is making the changes in progress; see WithActor.
+	actor string
+
+	hooks hooks
+
 	sync.RWMutex
 }
 
@@ -44,168 +165,1411 @@ type TableInterface interface {
 }
 
 func (table *Table) CreateRecord(record interface{}) (RecordInterface, error) {
-	table.RWMutex.Lock()
-	defer table.RWMutex.Unlock()
+	return table.createRecord(context.Background(), "CreateRecord", record, nil)
+}
+
+// CreateRecordCtx is CreateRecord that gives up if ctx is done before the
+// write starts, including while it waits for the rate limiter. The same
+// goes for the other Ctx variants of record operations.
+func (table *Table) CreateRecordCtx(ctx context.Context, record interface{}) (RecordInterface, error) {
+	return table.createRecord(ctx, "CreateRecord", record, nil)
+}
 
-	id := table.nextID
-	table.nextID++
+func (table *Table) createRecord(ctx context.Context, op string, record interface{}, meta map[string]string) (created RecordInterface, err error) {
+	ctx, done := table.observe(ctx, op)
+	defer func() { done(err) }()
 
-	data := Record{
-		ID:   id,
-		Data: record,
+	if err := table.throttleCtx(ctx, op, PermissionWrite); err != nil {
+		return nil, err
 	}
 
-	table.records.Set(strconv.Itoa(id), data)
+	defer table.unlock(table.lock())
+	defer table.actAs(ctx)()
+
+	return table.insertRecord(op, record, meta)
+}
+
+// insertRecord stores record under the next ID. Callers hold the write lock.
+func (table *Table) insertRecord(op string, record interface{}, meta map[string]string) (RecordInterface, error) {
+	return table.insertRecordAt(op, table.nextID, record, meta)
+}
+
+// insertRecordAt stores record under id, moving nextID past it. Callers
+// hold the write lock and have checked that id is free.
+func (table *Table) insertRecordAt(op string, id int, record interface{}, meta map[string]string) (RecordInterface, error) {
+	return table.insert(op, Record{ID: id, Data: record, Meta: meta})
+}
+
+// insert validates and stores data, filling in its hash. Callers hold the
+// write lock and have checked that data.ID is free.
+func (table *Table) insert(op string, data Record) (RecordInterface, error) {
+	var err error
+	if data.Data, err = table.runBeforeCreate(op, data.Data); err != nil {
+		return nil, err
+	}
+	if table.schema != nil {
+		data.Data, _ = table.schema.withDefaults(data.Data)
+	}
+	if err := table.assignKey(&data); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := table.checkConstraints(data.ID, data.Data); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	hash, err := table.recordHash(data.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	data.Hash = hash
+	data.Version = 1
+	data.CreatedAt = table.now()
+	data.UpdatedAt = data.CreatedAt
+
+	if err := table.writeAhead(walEntry{Table: table.name, Op: ChangeCreate, ID: data.ID, Record: &data}); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if data.ID >= table.nextID {
+		table.nextID = data.ID + 1
+	}
+
+	table.setRecord(nil, data)
+	table.changed(ChangeCreate, nil, &data)
 
 	return &data, nil
 }
 
+// setRecord stores record, replacing previous if given, and keeps the
+// table's lookup structures in sync. Callers hold the write lock.
+func (table *Table) setRecord(previous *Record, record Record) {
+	if previous != nil {
+		table.unindexHash(*previous)
+		table.unindexFields(*previous)
+		table.unindexRecordKey(*previous)
+	}
+	table.preserve(record.ID)
+	table.records.Set(strconv.Itoa(record.ID), record)
+	table.indexHash(record)
+	table.indexFields(record)
+	table.indexRecordKey(record)
+	if record.ExpiresAt != nil || record.DeletedAt != nil {
+		table.hasHidden = true
+	}
+}
+
+// recordValue checks a value read from the record map. Anything other than
+// a Record means the table is internally inconsistent, which is logged
+// rather than allowed to panic.
+func (table *Table) recordValue(op string, val interface{}) (Record, error) {
+	record, ok := val.(Record)
+	if !ok {
+		table.log().Error("unexpected value in record map", "op", op, "type", fmt.Sprintf("%T", val))
+		return Record{}, fmt.Errorf("%s: %w", op, ErrInvalidRecordType)
+	}
+	return record, nil
+}
+
+func (table *Table) removeRecord(record Record) {
+	table.unsetRecord(record)
+	if table.commit == nil {
+		table.removeBlobs(record.ID)
+	}
+}
+
+// unsetRecord removes record from the table's lookup structures but leaves
+// its blobs alone. Callers hold the write lock.
+func (table *Table) unsetRecord(record Record) {
+	table.preserve(record.ID)
+	table.records.Remove(strconv.Itoa(record.ID))
+	table.unindexHash(record)
+	table.unindexFields(record)
+	table.unindexRecordKey(record)
+}
+
+// ReadRecord returns the data of record id. It waits for a write in
+// progress on the table, so it sees the record as of the latest finished
+// write: every CreateRecord, UpdateRecord or DeleteRecord call that
+// returned before it started is visible, from any goroutine.
 func (table *Table) ReadRecord(id int) (interface{}, error) {
+	return table.ReadRecordCtx(context.Background(), id)
+}
+
+func (table *Table) ReadRecordCtx(ctx context.Context, id int) (data interface{}, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("ReadRecord: %w", err)
+	}
+	_, done := table.observe(ctx, "ReadRecord")
+	defer func() { done(err) }()
+	defer table.runlock(table.rlock())
+
 	val, ok := table.records.Get(strconv.Itoa(id))
 	if !ok {
-		return nil, errors.New("ReadRecord: record not found")
+		return nil, table.notFound("ReadRecord", id)
 	}
 
-	record, ok := val.(Record)
+	record, err := table.recordValue("ReadRecord", val)
+	if err != nil {
+		return nil, err
+	}
+	if table.hidden(record) {
+		return nil, table.notFound("ReadRecord", id)
+	}
+
+	return table.readable(record).Data, nil
+}
+
+func (table *Table) GetRecord(id int) (RecordInterface, error) {
+	return table.GetRecordCtx(context.Background(), id)
+}
+
+func (table *Table) GetRecordCtx(ctx context.Context, id int) (result RecordInterface, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("GetRecord: %w", err)
+	}
+	_, done := table.observe(ctx, "GetRecord")
+	defer func() { done(err) }()
+	defer table.runlock(table.rlock())
+
+	val, ok := table.records.Get(strconv.Itoa(id))
 	if !ok {
-		return nil, errors.New("ReadRecord: invalid record type")
+		return nil, table.notFound("GetRecord", id)
+	}
+
+	record, err := table.recordValue("GetRecord", val)
+	if err != nil {
+		return nil, err
+	}
+	if table.hidden(record) {
+		return nil, table.notFound("GetRecord", id)
 	}
 
-	return record.Data, nil
+	record = table.readable(record)
+	return &record, nil
 }
 
 func (t *Table) UpdateRecord(id int, record interface{}) error {
-	t.RWMutex.Lock()
-	defer t.RWMutex.Unlock()
+	return t.updateRecord(context.Background(), "UpdateRecord", id, anyVersion, record)
+}
+
+func (t *Table) UpdateRecordCtx(ctx context.Context, id int, record interface{}) error {
+	return t.updateRecord(ctx, "UpdateRecord", id, anyVersion, record)
+}
+
+// UpdateRecordIfVersion updates a record only if it is still at version,
+// and fails with ErrConflict if another write got there first.
+func (t *Table) UpdateRecordIfVersion(id, version int, record interface{}) error {
+	return t.updateRecord(context.Background(), "UpdateRecordIfVersion", id, version, record)
+}
+
+// UpdateRecordFull stores rec's data under its ID. If rec carries a
+// version, as records read from the table do, the update fails with
+// ErrConflict when the stored record has moved on since.
+func (t *Table) UpdateRecordFull(rec RecordInterface) error {
+	if rec == nil {
+		return errors.New("UpdateRecordFull: record is nil")
+	}
+
+	version := anyVersion
+	if versioned, ok := rec.(interface{ GetVersion() int }); ok && versioned.GetVersion() > 0 {
+		version = versioned.GetVersion()
+	}
+	return t.updateRecord(context.Background(), "UpdateRecordFull", rec.GetID(), version, rec.GetData())
+}
+
+// anyVersion makes updateRecord skip the version check.
+const anyVersion = -1
+
+func (t *Table) updateRecord(ctx context.Context, op string, id, version int, record interface{}) (err error) {
+	ctx, done := t.observe(ctx, op)
+	defer func() { done(err) }()
+
+	if err := t.throttleCtx(ctx, op, PermissionWrite); err != nil {
+		return err
+	}
+
+	defer t.unlock(t.lock())
+	defer t.actAs(ctx)()
 
 	val, ok := t.records.Get(strconv.Itoa(id))
 	if !ok {
-		return errors.New("UpdateRecord: record not found")
+		return t.notFound(op, id)
 	}
 
-	updateRecord, ok := val.(Record)
-	if !ok {
-		return errors.New("UpdateRecord: invalid record type")
+	updateRecord, err := t.recordValue(op, val)
+	if err != nil {
+		return err
+	}
+	if t.hidden(updateRecord) {
+		return t.notFound(op, id)
+	}
+	if version != anyVersion && updateRecord.Version != version {
+		return fmt.Errorf("%s: %w: record %d is at version %d, not %d", op, ErrConflict, id, updateRecord.Version, version)
+	}
+
+	return t.replaceData(op, updateRecord, record)
+}
+
+// replaceData validates data and stores it as the new Data of record.
+// Callers hold the write lock.
+func (table *Table) replaceData(op string, record Record, data interface{}) error {
+	data, err := table.runBeforeUpdate(op, record, data)
+	if err != nil {
+		return err
+	}
+	if table.schema != nil {
+		data, _ = table.schema.withDefaults(data)
+	}
+	if err := table.checkConstraints(record.ID, data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	hash, err := table.recordHash(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	updateRecord.Data = record
+	previous := record
+	record.Data = data
+	record.Hash = hash
+	record.Version++
+	record.UpdatedAt = table.now()
+	if err := table.writeAhead(walEntry{Table: table.name, Op: ChangeUpdate, ID: record.ID, Record: &record}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-	t.records.Set(strconv.Itoa(id), updateRecord)
+	table.setRecord(&previous, record)
+	table.changed(ChangeUpdate, &previous, &record)
 
 	return nil
 }
 
 func (t *Table) DeleteRecord(id int) error {
-	t.RWMutex.Lock()
-	defer t.RWMutex.Unlock()
+	return t.DeleteRecordCtx(context.Background(), id)
+}
+
+func (t *Table) DeleteRecordCtx(ctx context.Context, id int) (err error) {
+	ctx, done := t.observe(ctx, "DeleteRecord")
+	defer func() { done(err) }()
+
+	if err := t.throttleCtx(ctx, "DeleteRecord", PermissionWrite); err != nil {
+		return err
+	}
+
+	locked := t.lockForDelete()
+	defer unlockTables(locked)
+	defer actAs(ctx, locked)()
 
-	_, ok := t.records.Get(strconv.Itoa(id))
+	val, ok := t.records.Get(strconv.Itoa(id))
 	if !ok {
-		return errors.New("DeleteRecord: record not found")
+		return t.notFound("DeleteRecord", id)
 	}
 
-	t.records.Remove(strconv.Itoa(id))
-	return nil
+	record, err := t.recordValue("DeleteRecord", val)
+	if err != nil {
+		return err
+	}
+
+	return t.deleteRecord("DeleteRecord", record)
+}
+
+func (table *Table) DeleteIf(id int, expected interface{}) error {
+	if err := table.throttle("DeleteIf"); err != nil {
+		return err
+	}
+
+	defer unlockTables(table.lockForDelete())
+
+	val, ok := table.records.Get(strconv.Itoa(id))
+	if !ok {
+		return table.notFound("DeleteIf", id)
+	}
+
+	record, err := table.recordValue("DeleteIf", val)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(record.Data, expected) {
+		return fmt.Errorf("DeleteIf: %w", ErrPreconditionFailed)
+	}
+
+	return table.deleteRecord("DeleteIf", record)
 }
 
 type Database struct {
-	tables   cmap.ConcurrentMap
-	folder   string
+	tables cmap.ConcurrentMap
+	folder string
+	// storage is where Save writes, the folder unless SetStorage says
+	// otherwise.
+	storage  Storage
 	lastSave string
+
+	saveTargets []Storage
+	limiter     *rateLimiter
+	clock       Clock
+	changeLog   *changeLog
+	wal         *writeAheadLog
+	// cdc publishes logged record changes; see EnableCDC.
+	cdc         *cdcLog
+	codec       Codec
+	compression Compression
+	shardCount  int
+	keys        KeyProvider
+	observers   atomic.Pointer[[]Observer]
+	logger      atomic.Pointer[loggerRef]
+	autoSave    *autoSaver
+	reaper      *reaper
+	// memory is set for databases that never touch the disk; see
+	// NewMemoryDatabase.
+	memory bool
+	// lsn is the sequence number of the last entry written to the
+	// write-ahead log.
+	lsn atomic.Uint64
+	// retention is how far back RestoreToTime can go; see
+	// SetWALRetention.
+	retention time.Duration
+	// sequence serializes numbering entries for the write-ahead log and
+	// replication.
+	sequence sync.Mutex
+	// primary streams logged entries to replicas; see Replicate. follower
+	// is set for replicas, which refuse writes.
+	primary  *Primary
+	follower bool
+
+	// saving serializes Save calls.
+	saving sync.Mutex
+	// folderLock locks the folder the database is loaded from or saved
+	// to.
+	folderLock folderLock
+	// savedTargets name the storages the last Save wrote to. Clean tables
+	// are only skipped when Save writes to the same storages again.
+	savedTargets []string
+	// layoutChanged is set when tables are dropped or renamed, which
+	// changes master.json without making any table dirty.
+	layoutChanged atomic.Bool
+
+	// unloaded holds the manifest entries of tables that are on disk but
+	// not in memory, so Save keeps them in master.json.
+	unloaded map[string]tableMeta
+
+	// readOnly is set by OpenReadOnly and WithReadOnly before the
+	// database is used and never changes.
+	readOnly bool
+
+	// authorizer, if set, is asked before operations; see SetAuthorizer.
+	authorizer atomic.Pointer[Authorizer]
+
+	// views holds the views created with CreateView, by name.
+	views map[string]*View
+
+	// namespaces holds the namespaces loaded by Namespace, by name.
+	namespaces  map[string]*Database
+	namespaceMu sync.Mutex
+
+	// LoadBestEffort makes Load skip tables that cannot be read or decoded
+	// instead of aborting. The skipped tables are reported in a *LoadError.
+	LoadBestEffort bool
+
+	// LazyLoad makes Load read only master.json and leave every table on
+	// disk until it is first used through GetTable or an operation naming
+	// it, so opening a large database takes no memory for tables that are
+	// never touched. Tables not used yet are left out of ListTables, and
+	// the write-ahead log can't be enabled until all are loaded. It has no
+	// effect when a write-ahead log is waiting to be replayed.
+	LazyLoad bool
+	// lazy is set while tables Load left on disk are loaded on first use,
+	// one at a time under hydrating.
+	lazy      bool
+	hydrating sync.Mutex
+
+	sync.RWMutex
+}
+
+type tableMeta struct {
+	File  string              `json:"file,omitempty"`
+	Enums map[string][]string `json:"enums,omitempty"`
+
+	ContentHash bool                      `json:"content_hash,omitempty"`
+	ForeignKeys map[string]foreignKeyMeta `json:"foreign_keys,omitempty"`
+	Indexes     []string                  `json:"indexes,omitempty"`
+	Keys        string                    `json:"keys,omitempty"`
+	Schema      *Schema                   `json:"schema,omitempty"`
+	Unique      []string                  `json:"unique,omitempty"`
+	TextIndex   []string                  `json:"text_index,omitempty"`
+	SoftDelete  bool                      `json:"soft_delete,omitempty"`
+	History     bool                      `json:"history,omitempty"`
+	CopyOnRead  bool                      `json:"copy_on_read,omitempty"`
+	// MapShards is TableOptions.MapShards, left out for the default.
+	MapShards int `json:"map_shards,omitempty"`
+	// Shards is the number of files the records are split into, see
+	// SetShardCount. Zero means they are all in File.
+	Shards int `json:"shards,omitempty"`
+}
+
+func (table *Table) meta() tableMeta {
+	defer table.runlock(table.rlock())
+
+	return table.metaLocked()
+}
+
+// metaLocked is meta for callers that hold the table lock.
+func (table *Table) metaLocked() tableMeta {
+	meta := tableMeta{
+		ContentHash: table.hashes != nil,
+		Keys:        keyStrategyNames[table.keyStrategy],
+		Schema:      table.schema,
+		SoftDelete:  table.softDelete,
+		History:     table.history != nil,
+		CopyOnRead:  table.copyOnRead.Load(),
+	}
+	if shards := len(*table.records); shards != defaultShardCount {
+		meta.MapShards = shards
+	}
+	if len(table.enums) > 0 {
+		meta.Enums = make(map[string][]string, len(table.enums))
+		for field, allowed := range table.enums {
+			meta.Enums[field] = allowed
+		}
+	}
+	meta.ForeignKeys = table.foreignKeyMeta()
+	meta.Indexes = fieldNames(table.indexes)
+	meta.Unique = fieldNames(table.uniques)
+	meta.TextIndex = table.textFields()
+
+	return meta
+}
+
+type LoadError struct {
+	Failed map[string]error
+}
+
+func (err *LoadError) Error() string {
+	names := make([]string, 0, len(err.Failed))
+	for name := range err.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return fmt.Sprintf("Database_Load: %d table(s) failed to load: %s", len(names), strings.Join(names, ", "))
 }
 
 func NewDatabase() *Database {
-	return &Database{
-		tables: cmap.New(),
+	return NewDatabaseWithOptions(DatabaseOptions{})
+}
+
+// DatabaseOptions configures NewDatabaseWithOptions.
+type DatabaseOptions struct {
+	// Logger receives the database's log; see Logger. Nil means the
+	// default, which prints warnings and errors.
+	Logger Logger
+}
+
+func NewDatabaseWithOptions(options DatabaseOptions) *Database {
+	database := &Database{
+		tables:  cmap.New(),
+		limiter: &rateLimiter{},
+		clock:   realClock{},
 	}
+	database.SetLogger(options.Logger)
+	return database
 }
 
 func (database *Database) CreateTable(name string) error {
-	if _, ok := database.tables.Get(name); ok {
-		return errors.New("CreateTable: table already exists")
+	if name == "" {
+		return errors.New("CreateTable: invalid table name")
+	}
+	if err := database.authorize(context.Background(), name, PermissionAdmin); err != nil {
+		return &TableError{Op: "CreateTable", Table: name, Err: err}
+	}
+	if database.readOnly {
+		return fmt.Errorf("CreateTable: %w", ErrReadOnly)
+	}
+	if database.isUnloaded(name) {
+		return errors.New("CreateTable: table exists on disk but is not loaded")
+	}
+
+	table := NewTable()
+	database.attach(name, table)
+
+	if !database.tables.SetIfAbsent(name, table) {
+		return &TableError{Op: "CreateTable", Table: name, Err: ErrTableExists}
 	}
 
-	database.tables.Set(name, *NewTable())
 	return nil
 }
 
 func NewTable() *Table {
-	return &Table{
-		records: &cmap.ConcurrentMap{},
-		nextID:  1,
+	return newTable(TableOptions{})
+}
+
+func (database *Database) attach(name string, table *Table) {
+	table.database = database
+	table.name = name
+}
+
+func newTable(options TableOptions) *Table {
+	table := &Table{
+		records:     newRecordMap(options.MapShards, options.InitialCapacity),
+		nextID:      1,
+		seq:         tableSeq.Add(1),
+		keyStrategy: options.Keys,
+		schema:      options.Schema,
+		softDelete:  options.SoftDelete,
+	}
+	if options.Keys != KeyAutoIncrement {
+		table.keys = make(map[string]int, options.InitialCapacity)
+	}
+	table.copyOnRead.Store(options.CopyOnRead)
+	table.modified()
+	return table
+}
+
+var tableSeq atomic.Uint64
+
+type TableOptions struct {
+	// InitialCapacity presizes the table for the expected number of
+	// records so bulk loads don't keep growing the record map.
+	InitialCapacity int
+
+	// Keys sets how records are addressed; see KeyStrategy.
+	Keys KeyStrategy
+
+	// Schema, if set, is checked on every create and update, which fail
+	// with a *SchemaError listing every field that doesn't conform. The
+	// defaults it declares are filled in first.
+	Schema *Schema
+
+	// SoftDelete turns on soft delete mode; see SetSoftDelete.
+	SoftDelete bool
+
+	// CopyOnRead turns on copy on read mode; see SetCopyOnRead.
+	CopyOnRead bool
+
+	// MapShards is how many shards the table's record map is split into,
+	// 32 if zero. Each shard has its own lock, so more shards let more
+	// goroutines look records up at once when many cores hit one table,
+	// at the cost of a little memory per shard. It is saved in
+	// master.json.
+	MapShards int
+}
+
+func (database *Database) CreateTableWithOptions(name string, options TableOptions) error {
+	if name == "" {
+		return errors.New("CreateTableWithOptions: invalid table name")
+	}
+	if err := database.authorize(context.Background(), name, PermissionAdmin); err != nil {
+		return &TableError{Op: "CreateTableWithOptions", Table: name, Err: err}
+	}
+	if options.InitialCapacity < 0 {
+		return errors.New("CreateTableWithOptions: negative initial capacity")
+	}
+	if options.MapShards < 0 {
+		return errors.New("CreateTableWithOptions: negative map shard count")
+	}
+	if _, ok := keyStrategyNames[options.Keys]; !ok && options.Keys != KeyAutoIncrement {
+		return errors.New("CreateTableWithOptions: invalid key strategy")
+	}
+	if options.Schema != nil {
+		if err := options.Schema.compile("schema"); err != nil {
+			return fmt.Errorf("CreateTableWithOptions: %w", err)
+		}
+	}
+	if database.readOnly {
+		return fmt.Errorf("CreateTableWithOptions: %w", ErrReadOnly)
+	}
+	if database.isUnloaded(name) {
+		return errors.New("CreateTableWithOptions: table exists on disk but is not loaded")
+	}
+
+	table := newTable(options)
+	database.attach(name, table)
+
+	if !database.tables.SetIfAbsent(name, table) {
+		return &TableError{Op: "CreateTableWithOptions", Table: name, Err: ErrTableExists}
 	}
+
+	return nil
 }
 
-func (database *Database) GetTable(name string) (interface{}, error) {
-	table, ok := database.tables.Get(name)
+// GetTable returns the table called name, loading it first if Load left
+// it on disk for LazyLoad.
+func (database *Database) GetTable(name string) (*Table, error) {
+	return database.GetTableCtx(context.Background(), name)
+}
+
+func (database *Database) getTable(name string) (*Table, error) {
+	val, ok := database.tables.Get(name)
+	if !ok {
+		if err := database.hydrate(name); err != nil {
+			return nil, &TableError{Op: "GetTable", Table: name, Err: err}
+		}
+		if val, ok = database.tables.Get(name); !ok {
+			return nil, &TableError{Op: "GetTable", Table: name, Err: ErrNotFound}
+		}
+	}
+
+	table, ok := val.(*Table)
 	if !ok {
-		return nil, errors.New("GetTable: table not found")
+		return nil, &TableError{Op: "GetTable", Table: name, Err: ErrInvalidTableType}
+	}
+	return table, nil
+}
+
+// GetOrCreateTable returns the table called name, creating it with default
+// options if there is none. Like CreateTable, it fails for a table that is
+// on disk but not loaded, unless LazyLoad loads it.
+func (database *Database) GetOrCreateTable(name string) (*Table, error) {
+	for {
+		table, err := database.GetTable(name)
+		if !errors.Is(err, ErrNotFound) {
+			return table, err
+		}
+		// Another goroutine may create the table first; then it is
+		// read on the next pass.
+		if err := database.CreateTable(name); err != nil && !errors.Is(err, ErrTableExists) {
+			return nil, fmt.Errorf("GetOrCreateTable: %w", err)
+		}
 	}
+}
 
-	return &table, nil
+func (database *Database) SetFolder(folder string) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.folder = folder
+	database.storage = dirStorage(folder)
 }
 
 func (database *Database) Load(folder string) error {
-	file, err := os.Open(folder + "master.json")
+	return database.LoadCtx(context.Background(), folder)
+}
+
+// LoadCtx is Load with cancellation between tables. Tables loaded before
+// ctx is done stay loaded.
+func (database *Database) LoadCtx(ctx context.Context, folder string) error {
+	return database.LoadFromCtx(ctx, dirStorage(folder))
+}
+
+// LoadFrom is Load from any storage, which becomes the storage Save
+// writes to; see SetStorage.
+func (database *Database) LoadFrom(storage Storage) error {
+	return database.LoadFromCtx(context.Background(), storage)
+}
+
+// LoadFromCtx is LoadFrom with cancellation between tables.
+func (database *Database) LoadFromCtx(ctx context.Context, storage Storage) (err error) {
+	ctx, done := database.observe(ctx, "Load", "")
+	defer func() { done(err) }()
+	start := time.Now()
+
+	if database.memory {
+		return fmt.Errorf("Database_Load: %w", ErrInMemory)
+	}
+	dir, isDir := storage.(dirStorage)
+	if isDir && !database.readOnly {
+		// A folder the lock file can't be created in, such as a
+		// read-only one, is loaded unlocked.
+		if err := database.folderLock.acquire(string(dir)); errors.Is(err, ErrLocked) {
+			return fmt.Errorf("Database_Load: %w", err)
+		}
+	}
+
+	manifest, err := readManifest(storage)
 	if err != nil {
 		return fmt.Errorf("Database_Load: %s", err)
 	}
-	database.folder = folder
-	defer file.Close()
+	database.SetStorage(storage)
+	database.lsn.Store(manifest.LSN)
+	keys := database.keyProvider()
 
-	var tables map[string]interface{}
-	if err := jsoniter.NewDecoder(file).Decode(&tables); err != nil {
-		return fmt.Errorf("Database_Load: %s", err)
+	lazy := database.LazyLoad && !(isDir && hasWAL(string(dir)))
+
+	failed := make(map[string]error)
+	unloaded := make(map[string]tableMeta)
+	for name, meta := range manifest.Tables {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("Database_Load: %w", err)
+		}
+		if lazy {
+			unloaded[name] = meta
+			continue
+		}
+
+		table, err := loadTable(storage, name, meta, keys)
+		if err != nil {
+			if !database.LoadBestEffort {
+				return fmt.Errorf("Database_Load: %w", err)
+			}
+			database.log().Warn("skipping table that can't be loaded", "table", name, "error", err)
+			failed[name] = err
+			unloaded[name] = meta
+			continue
+		}
+		database.attach(name, table)
+
+		database.tables.Set(name, table)
 	}
 
-	for name := range tables {
+	database.RWMutex.Lock()
+	database.unloaded = unloaded
+	database.lazy = lazy
+	database.savedTargets = []string{storageName(storage)}
+	if !manifest.SavedAt.IsZero() {
+		database.lastSave = manifest.SavedAt.String()
+	}
+	database.RWMutex.Unlock()
+
+	if isDir {
+		if err := database.replayWAL(string(dir)); err != nil {
+			return fmt.Errorf("Database_Load: write-ahead log: %s", err)
+		}
+	}
 
-		table := NewTable()
+	database.resolveForeignKeys()
+	database.log().Info("database loaded", "storage", storageName(storage), "tables", len(manifest.Tables),
+		"lazy", lazy, "duration", time.Since(start))
 
-		tbl, err := os.Open(fmt.Sprintf("%s%s.json", folder, name))
+	if len(failed) > 0 {
+		return &LoadError{Failed: failed}
+	}
+	return nil
+}
+
+// LoadTables loads only the named tables from the database folder or
+// storage. The other tables in master.json stay on disk untouched, and
+// Save keeps their entries in master.json without rewriting them. Nothing
+// is loaded if any named table is missing or can't be read.
+func (database *Database) LoadTables(names ...string) error {
+	if database.memory {
+		return fmt.Errorf("LoadTables: %w", ErrInMemory)
+	}
+
+	database.RWMutex.RLock()
+	folder := database.folder
+	storage := database.storageLocked()
+	database.RWMutex.RUnlock()
+
+	saved, err := readManifest(storage)
+	if err != nil {
+		return fmt.Errorf("LoadTables: %s", err)
+	}
+	manifest := saved.Tables
+	if folder != "" && hasWAL(folder) {
+		return errors.New("LoadTables: write-ahead log must be replayed by Load")
+	}
+	keys := database.keyProvider()
+
+	loaded := make(map[string]*Table, len(names))
+	for _, name := range names {
+		if _, ok := database.tables.Get(name); ok {
+			return fmt.Errorf("LoadTables: table %s is already loaded", name)
+		}
+
+		meta, ok := manifest[name]
+		if !ok {
+			return &TableError{Op: "LoadTables", Table: name, Err: ErrNotFound}
+		}
+
+		table, err := loadTable(storage, name, meta, keys)
 		if err != nil {
-			return fmt.Errorf("Database_Load: %s", err)
+			return fmt.Errorf("LoadTables: table %s: %w", name, err)
 		}
+		database.attach(name, table)
+		loaded[name] = table
+	}
 
-		var records []Record
-		if err := jsoniter.NewDecoder(tbl).Decode(&records); err != nil {
+	database.RWMutex.Lock()
+	if database.unloaded == nil {
+		database.unloaded = make(map[string]tableMeta)
+	}
+	for name, meta := range manifest {
+		if _, ok := database.tables.Get(name); !ok {
+			database.unloaded[name] = meta
+		}
+	}
+	for name, table := range loaded {
+		delete(database.unloaded, name)
+		database.tables.Set(name, table)
+	}
+	database.RWMutex.Unlock()
 
-			for _, record := range records {
-				table.records.Set(strconv.Itoa(record.ID), record)
-				if record.ID >= table.nextID {
-					table.nextID = record.ID + 1
-				}
-			}
+	database.resolveForeignKeys()
+	return nil
+}
+
+// hydrate loads name if Load left it on disk for LazyLoad and nothing has
+// used it yet.
+func (database *Database) hydrate(name string) error {
+	database.RWMutex.RLock()
+	_, unloaded := database.unloaded[name]
+	lazy := database.lazy && unloaded
+	database.RWMutex.RUnlock()
+	if !lazy {
+		return nil
+	}
+
+	database.hydrating.Lock()
+	defer database.hydrating.Unlock()
+
+	if _, ok := database.tables.Get(name); ok || !database.isUnloaded(name) {
+		return nil
+	}
+	return database.LoadTables(name)
+}
+
+func (database *Database) isUnloaded(name string) bool {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	_, ok := database.unloaded[name]
+	return ok
+}
+
+func loadTable(storage Storage, name string, meta tableMeta, keys KeyProvider) (*Table, error) {
+	file, err := tableFile(name, meta)
+	if err != nil {
+		return nil, err
+	}
 
-			database.tables.Set(name, table)
+	var table *Table
+	if meta.Shards > 1 {
+		table, err = loadShards(storage, meta, shardFiles(file, meta), keys)
+	} else {
+		table, err = readTable(storage, file, meta, keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	table.savedGeneration.Store(table.generation.Load())
+	table.savedShards = meta.Shards
+
+	if meta.History {
+		if table.history, err = loadHistory(storage, file, keys); err != nil {
+			return nil, err
 		}
+	}
+	return table, nil
+}
 
+// readTable builds a table with the settings in meta from file, adding
+// records as they are decoded.
+func readTable(storage Storage, file string, meta tableMeta, keys KeyProvider) (*Table, error) {
+	reader, err := openTable(storage, file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var table *Table
+	_, err = readTableFile(reader, keys, func(header tableHeader) error {
+		var err error
+		table, err = emptyTable(meta, header.Records)
+		if err == nil && header.NextID > table.nextID {
+			table.nextID = header.NextID
+		}
+		return err
+	}, func(record Record) error {
+		return table.restoreRecord(record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return table, nil
+}
+
+// restoreTable builds a table with the settings in meta holding records.
+// IDs up to nextID are treated as used.
+func restoreTable(meta tableMeta, records []Record, nextID int) (*Table, error) {
+	table, err := emptyTable(meta, len(records))
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if err := table.restoreRecord(record); err != nil {
+			return nil, err
+		}
+	}
+	if nextID > table.nextID {
+		table.nextID = nextID
+	}
+	table.savedGeneration.Store(table.generation.Load())
+
+	return table, nil
+}
+
+// maxRestoreCapacity caps how far emptyTable presizes a table for the
+// record count in a header that hasn't been checked yet.
+const maxRestoreCapacity = 1 << 20
+
+// emptyTable builds a table with the settings in meta, presized for
+// capacity records, for restoreRecord to fill.
+func emptyTable(meta tableMeta, capacity int) (*Table, error) {
+	strategy, err := parseKeyStrategy(meta.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.Schema != nil {
+		if err := meta.Schema.compile("schema"); err != nil {
+			return nil, err
+		}
+	}
+
+	if capacity > maxRestoreCapacity {
+		capacity = maxRestoreCapacity
+	}
+	table := newTable(TableOptions{InitialCapacity: capacity, Keys: strategy, Schema: meta.Schema, SoftDelete: meta.SoftDelete,
+		CopyOnRead: meta.CopyOnRead, MapShards: meta.MapShards})
+	table.enums = meta.Enums
+	if meta.ContentHash {
+		table.hashes = make(map[string]map[int]struct{})
+	}
+	for _, field := range meta.Indexes {
+		if table.indexes == nil {
+			table.indexes = make(map[string]fieldIndex)
+		}
+		table.indexes[field] = make(fieldIndex)
+	}
+	for _, field := range meta.Unique {
+		if table.uniques == nil {
+			table.uniques = make(map[string]fieldIndex)
+		}
+		table.uniques[field] = make(fieldIndex)
+	}
+	if len(meta.TextIndex) > 0 {
+		table.text = newTextIndex(meta.TextIndex)
+	}
+	for field, fk := range meta.ForeignKeys {
+		if table.foreignKeys == nil {
+			table.foreignKeys = make(map[string]*foreignKey)
+		}
+		action := RestrictOnDelete
+		if fk.Cascade {
+			action = CascadeOnDelete
+		}
+		table.foreignKeys[field] = &foreignKey{child: table, field: field, parentName: fk.Table, action: action, name: fk.Name, inverse: fk.Inverse}
+	}
+
+	return table, nil
+}
+
+// restoreRecord adds a record read back from a file to a table that isn't
+// shared yet.
+func (table *Table) restoreRecord(record Record) error {
+	if table.hashes != nil && record.Hash == "" {
+		var err error
+		if record.Hash, err = contentHash(record.Data); err != nil {
+			return fmt.Errorf("record %d: %w", record.ID, err)
+		}
+	}
+
+	table.setRecord(nil, record)
+	if record.ID >= table.nextID {
+		table.nextID = record.ID + 1
 	}
 	return nil
 }
 
+// AddSaveTarget registers an extra folder that Save mirrors every table to.
+// Targets are written one after another and a failing target is skipped
+// for the rest of the Save, so after a partial failure the folders can
+// hold different versions of the data until the next successful Save.
+func (database *Database) AddSaveTarget(folder string) {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	database.saveTargets = append(database.saveTargets, dirStorage(folder))
+}
+
+// Save writes each file to a temporary file and renames it into place, so
+// a crash leaves either the previous or the new version on disk. Tables
+// that can't be encoded and targets that can't be written don't stop the
+// Save; they are reported together in a *SaveError. Tables that haven't
+// changed since they were last written to the same folders are skipped;
+// changes made in between are covered by the write-ahead log if enabled.
 func (database *Database) Save() error {
-	database.tables.IterCb(func(key string, val interface{}) {
-		table := val.(*Table)
+	return database.SaveCtx(context.Background())
+}
+
+// SaveCtx is Save with cancellation between tables. A cancelled Save
+// leaves master.json as it was; tables written before ctx is done keep
+// their new file.
+func (database *Database) SaveCtx(ctx context.Context) (err error) {
+	ctx, done := database.observe(ctx, "Save", "")
+	defer func() { done(err) }()
+	start := time.Now()
+
+	if database.memory {
+		return fmt.Errorf("Database_Save: %w", ErrInMemory)
+	}
+	if database.readOnly {
+		return fmt.Errorf("Database_Save: %w", ErrReadOnly)
+	}
+
+	database.saving.Lock()
+	defer database.saving.Unlock()
+
+	database.RWMutex.RLock()
+	folder := database.folder
+	targets := append([]Storage{database.storageLocked()}, database.saveTargets...)
+	names := make([]string, len(targets))
+	for i, target := range targets {
+		names[i] = storageName(target)
+	}
+	incremental := sameStrings(names, database.savedTargets)
+	codec := database.codec
+	if codec == nil {
+		codec = JSONCodec
+	}
+	compression := database.compression
+	keys := database.keys
+	shardCount := database.shardCount
+	unloaded := make(map[string]tableMeta, len(database.unloaded))
+	for name, meta := range database.unloaded {
+		unloaded[name] = meta
+	}
+	database.RWMutex.RUnlock()
+
+	if folder != "" {
+		if err := database.folderLock.acquire(folder); err != nil {
+			return fmt.Errorf("Database_Save: %w", err)
+		}
+		if err := database.rotateWAL(folder); err != nil {
+			return fmt.Errorf("Database_Save: write-ahead log: %s", err)
+		}
+	}
+	database.layoutChanged.Store(false)
 
-		filename := fmt.Sprintf("%s%s%s.json", database.folder, string(os.PathSeparator), key)
+	failed := make(map[string]error)
+	manifest := make(map[string]tableMeta)
+	skipped := make(map[string]error)
+	written := 0
 
-		data := make([]Record, 0)
+	var cancelled error
+	database.tables.IterCb(func(name string, val interface{}) {
+		if cancelled != nil {
+			return
+		}
+		if cancelled = ctx.Err(); cancelled != nil {
+			return
+		}
 
+		table, ok := val.(*Table)
+		if !ok {
+			skipped[name] = fmt.Errorf("%w: %T", ErrInvalidTableType, val)
+			return
+		}
+		generation := table.generation.Load()
+		nextID := table.NextID()
+		meta := table.meta()
+		meta.File = tableFileName(name)
+		meta.Shards = table.savedShards
+		manifest[name] = meta
+		if incremental && generation == table.savedGeneration.Load() {
+			return
+		}
+
+		records := recordSlicePool.Get().(*[]Record)
+		data := (*records)[:0]
+		defer func() {
+			for i := range data {
+				data[i] = Record{}
+			}
+			*records = data[:0]
+			if poolSaveBuffers {
+				recordSlicePool.Put(records)
+			}
+		}()
+
+		var invalid error
 		table.records.IterCb(func(key string, val interface{}) {
-			data = append(data, val.(Record))
+			record, err := table.recordValue("Database_Save", val)
+			if err != nil {
+				invalid = err
+				return
+			}
+			data = append(data, record)
 		})
+		if invalid != nil {
+			skipped[name] = invalid
+			return
+		}
 
-		encoded, err := jsoniter.Marshal(data)
+		// A table that can't be encoded keeps its old files and entry.
+		meta.Shards = 0
+		if shards := shardsFor(len(data), shardCount); shards > 1 {
+			meta.Shards = shards
+		}
+		files := shardFiles(meta.File, meta)
+		encoded, err := encodeShards(data, len(files), codec, compression, keys, nextID)
 		if err != nil {
-			fmt.Printf("Database_Save: Error marshaling data for table %s: %v\n", key, err)
+			skipped[name] = err
 			return
 		}
+		var history []byte
+		if meta.History {
+			if history, err = table.encodeHistory(compression, keys, time.Time{}); err != nil {
+				skipped[name] = err
+				return
+			}
+		}
+		manifest[name] = meta
+		written++
 
-		if err := os.WriteFile(filename, encoded, 0644); err != nil {
-			fmt.Printf("Database_Save: Error writing data for table %s: %v\n", key, err)
+		for i, target := range targets {
+			if _, ok := failed[names[i]]; ok {
+				continue
+			}
+
+			err := parallel(len(files), func(j int) error {
+				return target.WriteTable(files[j], encoded[j])
+			})
+			if err != nil {
+				failed[names[i]] = fmt.Errorf("table %s: %w", name, err)
+				continue
+			}
+			if history != nil {
+				if err := target.WriteTable(historyFileName(meta.File), history); err != nil {
+					failed[names[i]] = fmt.Errorf("table %s: %w", name, err)
+				}
+			}
+		}
+		if len(failed) == 0 {
+			table.savedGeneration.Store(generation)
+			table.savedShards = meta.Shards
 		}
 	})
-	database.lastSave = time.Now().String()
+
+	if cancelled != nil {
+		database.layoutChanged.Store(true)
+		return fmt.Errorf("Database_Save: %w", cancelled)
+	}
+
+	// Tables that were never loaded keep their existing file. Mirrors get a
+	// copy of it so their master.json doesn't point at a missing file.
+	for name, meta := range unloaded {
+		if _, ok := manifest[name]; ok {
+			continue
+		}
+		manifest[name] = meta
+		if incremental {
+			continue
+		}
+
+		files, err := tableFiles(name, meta)
+		if err != nil {
+			continue
+		}
+		for i, target := range targets[1:] {
+			for _, file := range files {
+				if _, ok := failed[names[i+1]]; ok {
+					break
+				}
+
+				if err := copyTableFile(targets[0], target, file); err != nil {
+					failed[names[i+1]] = fmt.Errorf("table %s: %w", name, err)
+				}
+			}
+		}
+	}
+
+	now := database.now()
+	encoded, err := jsoniter.Marshal(manifestFile{Version: manifestVersion, SavedAt: now, Tables: manifest, LSN: database.lsn.Load()})
+	if err != nil {
+		return fmt.Errorf("Database_Save: %s", err)
+	}
+	for i, target := range targets {
+		if _, ok := failed[names[i]]; ok {
+			continue
+		}
+
+		previous, _ := readManifest(target)
+		if err := target.WriteTable("master.json", encoded); err != nil {
+			failed[names[i]] = fmt.Errorf("master.json: %w", err)
+			continue
+		}
+		if err := removeStaleFiles(target, previous.Tables, manifest); err != nil {
+			failed[names[i]] = err
+		}
+	}
+	if len(failed) > 0 || len(skipped) > 0 {
+		database.layoutChanged.Store(true)
+	}
+	database.RWMutex.Lock()
+	database.lastSave = now.String()
+	database.savedTargets = names
+	database.RWMutex.Unlock()
+
+	if _, ok := failed[names[0]]; !ok && len(skipped) == 0 && folder != "" {
+		if err := database.trimWAL(folder); err != nil {
+			failed[names[0]] = fmt.Errorf("write-ahead log: %w", err)
+		}
+	}
+
+	if len(failed) > 0 || len(skipped) > 0 {
+		err := &SaveError{Failed: failed, Tables: skipped}
+		database.log().Warn("database saved with errors", "storage", names[0], "tables", written, "error", err)
+		return err
+	}
+	database.log().Info("database saved", "storage", names[0], "tables", written, "duration", time.Since(start))
 	return nil
 }
+
+// encodeRecordsFile encodes records with codec into a table file.
+func encodeRecordsFile(records []Record, codec Codec, compression Compression, keys KeyProvider, nextID int) ([]byte, error) {
+	if codec != JSONCodec {
+		body, err := codec.Marshal(records)
+		if err != nil {
+			return nil, err
+		}
+		return encodeTableFile(body, codec, compression, keys, len(records), nextID)
+	}
+
+	stream := streamPool.Get().(*jsoniter.Stream)
+	if poolSaveBuffers {
+		defer streamPool.Put(stream)
+	}
+	stream.Reset(nil)
+	stream.Error = nil
+
+	stream.WriteVal(records)
+	if stream.Error != nil {
+		return nil, stream.Error
+	}
+	return encodeTableFile(stream.Buffer(), codec, compression, keys, len(records), nextID)
+}
+
+// Save reuses its per-table record slices and encoder streams to keep
+// allocations down when it runs often. Record slices are zeroed before
+// going back to the pool so they don't pin record data. BenchmarkSave
+// turns poolSaveBuffers off to measure Save without the pools.
+var (
+	recordSlicePool = sync.Pool{New: func() interface{} { return new([]Record) }}
+	streamPool      = sync.Pool{New: func() interface{} { return jsoniter.NewStream(jsoniter.ConfigDefault, nil, 4096) }}
+	poolSaveBuffers = true
+)
+
+type SaveError struct {
+	// Failed holds the first error for each target that failed, keyed by
+	// folder for folders.
+	Failed map[string]error
+	// Tables holds the tables that were not written to any target.
+	Tables map[string]error
+}
+
+func (err *SaveError) Error() string {
+	messages := make([]string, 0, 2)
+	if len(err.Failed) > 0 {
+		messages = append(messages, fmt.Sprintf("%d target(s) failed: %s", len(err.Failed), joinErrors(err.Failed)))
+	}
+	if len(err.Tables) > 0 {
+		messages = append(messages, fmt.Sprintf("%d table(s) skipped: %s", len(err.Tables), joinErrors(err.Tables)))
+	}
+
+	return "Database_Save: " + strings.Join(messages, "; ")
+}
+
+// Is reports whether any of the target or table errors matches target.
+func (err *SaveError) Is(target error) bool {
+	for _, failure := range err.Failed {
+		if errors.Is(failure, target) {
+			return true
+		}
+	}
+	for _, failure := range err.Tables {
+		if errors.Is(failure, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinErrors(errs map[string]error) string {
+	keys := make([]string, 0, len(errs))
+	for key := range errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	messages := make([]string, 0, len(keys))
+	for _, key := range keys {
+		messages = append(messages, fmt.Sprintf("%s: %v", key, errs[key]))
+	}
+	return strings.Join(messages, ", ")
+}
+
+func copyTableFile(source, destination Storage, file string) error {
+	if storageName(source) == storageName(destination) {
+		return nil
+	}
+
+	data, err := source.ReadTable(file)
+	if err != nil {
+		return err
+	}
+	return destination.WriteTable(file, data)
+}
+
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// removeStaleFiles deletes the table files that the previous master.json in
+// storage listed but the current one doesn't, such as those of dropped or
+// renamed tables.
+func removeStaleFiles(storage Storage, previous, current map[string]tableMeta) error {
+	files := make(map[string]bool, len(current))
+	for name, meta := range current {
+		names, _ := tableFiles(name, meta)
+		for _, file := range names {
+			files[file] = true
+		}
+	}
+
+	for name, meta := range previous {
+		names, _ := tableFiles(name, meta)
+		for _, file := range names {
+			if files[file] {
+				continue
+			}
+			if err := storage.DeleteTable(file); err != nil {
+				return fmt.Errorf("table %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package velox
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func newTestTable(t testing.TB, name string) (*Database, *Table) {
+	t.Helper()
+	database, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTable(name); err != nil {
+		t.Fatal(err)
+	}
+	table, err := database.GetTable(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database, table
+}
+
+// TestReadYourWrites interleaves creates and reads across goroutines, each
+// going through its own GetTable call, and checks that no write is lost.
+func TestReadYourWrites(t *testing.T) {
+	const writers, perWriter = 8, 200
+	database, _ := newTestTable(t, "items")
+
+	created := make(chan int, writers*perWriter)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				table, err := database.GetTable("items")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				record, err := table.CreateRecord(map[string]interface{}{"writer": w, "i": i})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := table.ReadRecord(record.GetID()); err != nil {
+					t.Errorf("own write %d not visible: %v", record.GetID(), err)
+				}
+				created <- record.GetID()
+			}
+		}(w)
+	}
+
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for id := range created {
+				table, err := database.GetTable("items")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := table.ReadRecord(id); err != nil {
+					t.Errorf("write %d not visible to another goroutine: %v", id, err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(created)
+	readers.Wait()
+
+	table, _ := database.GetTable("items")
+	if n := table.Count(); n != writers*perWriter {
+		t.Fatalf("Count() = %d, want %d", n, writers*perWriter)
+	}
+}
+
+// BenchmarkBulkInsert loads a fresh table with and without a capacity
+// hint, which saves the record map from growing during the load.
+func BenchmarkBulkInsert(b *testing.B) {
+	const records = 100000
+	for _, capacity := range []int{0, records} {
+		b.Run(fmt.Sprintf("capacity=%d", capacity), func(b *testing.B) {
+			data := map[string]interface{}{"name": "record", "n": 1}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				database, err := New()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := database.CreateTableWithOptions("bulk", TableOptions{InitialCapacity: capacity}); err != nil {
+					b.Fatal(err)
+				}
+				table, _ := database.GetTable("bulk")
+				for j := 0; j < records; j++ {
+					if _, err := table.CreateRecord(data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package veloxgrpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+	velox "github.com/properfish/VeloxDB"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Client struct {
+	conn   *grpc.ClientConn
+	client VeloxClient
+}
+
+// Dial connects to a server started with Serve. Transport security is set
+// through opts, as for grpc.Dial.
+func Dial(addr string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, client: NewVeloxClient(conn)}, nil
+}
+
+func (client *Client) Close() error {
+	return client.conn.Close()
+}
+
+func (client *Client) ListTables(ctx context.Context) ([]string, error) {
+	response, err := client.client.ListTables(ctx, &ListTablesRequest{})
+	if err != nil {
+		return nil, clientError("ListTables", err)
+	}
+	return response.Tables, nil
+}
+
+// Table returns a handle on a remote table. No call is made until it is
+// used.
+func (client *Client) Table(name string) *Table {
+	return &Table{client: client, name: name}
+}
+
+// Table is a remote table. Its methods use context.Background; the Ctx
+// variants take a context for the call.
+type Table struct {
+	client *Client
+	name   string
+}
+
+var _ velox.TableInterface = (*Table)(nil)
+
+func (table *Table) CreateRecord(record interface{}) (velox.RecordInterface, error) {
+	return table.CreateRecordCtx(context.Background(), record)
+}
+
+func (table *Table) CreateRecordCtx(ctx context.Context, record interface{}) (velox.RecordInterface, error) {
+	data, err := jsoniter.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("CreateRecord: %w", err)
+	}
+
+	message, err := table.client.client.CreateRecord(ctx, &CreateRecordRequest{Table: table.name, Data: data})
+	if err != nil {
+		return nil, clientError("CreateRecord", err)
+	}
+	return recordValue("CreateRecord", message)
+}
+
+func (table *Table) ReadRecord(id int) (velox.RecordInterface, error) {
+	return table.ReadRecordCtx(context.Background(), id)
+}
+
+func (table *Table) ReadRecordCtx(ctx context.Context, id int) (velox.RecordInterface, error) {
+	message, err := table.client.client.ReadRecord(ctx, &RecordRequest{Table: table.name, Id: int64(id)})
+	if err != nil {
+		return nil, clientError("ReadRecord", err)
+	}
+	return recordValue("ReadRecord", message)
+}
+
+func (table *Table) UpdateRecord(id int, record interface{}) error {
+	return table.UpdateRecordCtx(context.Background(), id, record)
+}
+
+func (table *Table) UpdateRecordCtx(ctx context.Context, id int, record interface{}) error {
+	data, err := jsoniter.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("UpdateRecord: %w", err)
+	}
+
+	_, err = table.client.client.UpdateRecord(ctx, &UpdateRecordRequest{Table: table.name, Id: int64(id), Data: data})
+	return clientError("UpdateRecord", err)
+}
+
+func (table *Table) DeleteRecord(id int) error {
+	return table.DeleteRecordCtx(context.Background(), id)
+}
+
+func (table *Table) DeleteRecordCtx(ctx context.Context, id int) error {
+	_, err := table.client.client.DeleteRecord(ctx, &RecordRequest{Table: table.name, Id: int64(id)})
+	return clientError("DeleteRecord", err)
+}
+
+// NewCondition builds a query condition; op is one of the operators
+// accepted by velox.QueryBuilder.Where.
+func NewCondition(field, op string, value interface{}) (*Condition, error) {
+	encoded, err := jsoniter.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Condition{Field: field, Op: op, Value: encoded}, nil
+}
+
+// Query runs request against the table, ignoring request.Table, and
+// collects the streamed results.
+func (table *Table) Query(ctx context.Context, request *QueryRequest) ([]velox.Record, error) {
+	query := &QueryRequest{
+		Table:   table.name,
+		Where:   request.Where,
+		OrderBy: request.OrderBy,
+		Desc:    request.Desc,
+		Limit:   request.Limit,
+	}
+
+	stream, err := table.client.client.Query(ctx, query)
+	if err != nil {
+		return nil, clientError("Query", err)
+	}
+
+	var records []velox.Record
+	for {
+		message, err := stream.Recv()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, clientError("Query", err)
+		}
+
+		record, err := recordValue("Query", message)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+}
+
+// Watch streams the table's changes like velox.Table.Watch. The channel is
+// closed when ctx is done or the stream ends for any other reason.
+func (table *Table) Watch(ctx context.Context) (<-chan velox.ChangeEvent, error) {
+	stream, err := table.client.client.Watch(ctx, &WatchRequest{Table: table.name})
+	if err != nil {
+		return nil, clientError("Watch", err)
+	}
+	if _, err := stream.Header(); err != nil {
+		return nil, clientError("Watch", err)
+	}
+
+	events := make(chan velox.ChangeEvent)
+	go func() {
+		defer close(events)
+		for {
+			message, err := stream.Recv()
+			if err != nil {
+				return
+			}
+
+			event := velox.ChangeEvent{Table: message.Table, Op: velox.ChangeOp(message.Op), ID: int(message.Id)}
+			if message.Before != nil {
+				jsoniter.Unmarshal(message.Before, &event.Before)
+			}
+			if message.After != nil {
+				jsoniter.Unmarshal(message.After, &event.After)
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+func recordValue(op string, message *Record) (*velox.Record, error) {
+	record := &velox.Record{ID: int(message.Id), Meta: message.Meta}
+	if err := jsoniter.Unmarshal(message.Data, &record.Data); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return record, nil
+}
+
+// remoteError carries the server's message while matching the error it
+// stands for with errors.Is.
+type remoteError struct {
+	message string
+	err     error
+}
+
+func (err *remoteError) Error() string {
+	return err.message
+}
+
+func (err *remoteError) Unwrap() error {
+	return err.err
+}
+
+// clientError turns a status error back into the error the server saw, as
+// far as errorCodes allows. The server's messages already name the
+// operation.
+func clientError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	switch st.Code() {
+	case codes.Canceled:
+		return &remoteError{message: st.Message(), err: context.Canceled}
+	case codes.DeadlineExceeded:
+		return &remoteError{message: st.Message(), err: context.DeadlineExceeded}
+	}
+	for _, known := range errorCodes {
+		if st.Code() == known.code {
+			return &remoteError{message: st.Message(), err: known.err}
+		}
+	}
+	return &remoteError{message: st.Message(), err: err}
+}
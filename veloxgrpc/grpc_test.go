@@ -0,0 +1,91 @@
+package veloxgrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	velox "github.com/properfish/VeloxDB"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestClientServerRoundTrip(t *testing.T) {
+	database, err := velox.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	Register(server, database)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	client, err := Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	table := client.Table("items")
+	events, err := table.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := table.CreateRecord(map[string]interface{}{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := table.UpdateRecord(2, map[string]interface{}{"name": "b2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.DeleteRecord(3); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := table.ReadRecord(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := record.GetData().(map[string]interface{})["name"]; name != "b2" {
+		t.Fatalf("ReadRecord(2) name = %v, want b2", name)
+	}
+	if _, err := table.ReadRecord(3); !errors.Is(err, velox.ErrNotFound) {
+		t.Fatalf("ReadRecord of a deleted record = %v, want ErrNotFound", err)
+	}
+	if _, err := client.Table("missing").ReadRecord(1); !errors.Is(err, velox.ErrNotFound) {
+		t.Fatalf("ReadRecord of a missing table = %v, want ErrNotFound", err)
+	}
+
+	condition, err := NewCondition("name", "!=", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := table.Query(ctx, &QueryRequest{Where: []*Condition{condition}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != 2 {
+		t.Fatalf("Query = %v, want record 2", records)
+	}
+
+	want := []velox.ChangeOp{velox.ChangeCreate, velox.ChangeCreate, velox.ChangeCreate, velox.ChangeUpdate, velox.ChangeDelete}
+	for i, op := range want {
+		event := <-events
+		if event.Op != op || event.Table != "items" {
+			t.Fatalf("event %d = %s on %s, want %s on items", i, event.Op, event.Table, op)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package veloxgrpc serves a VeloxDB database over gRPC and provides a
+// client whose tables implement velox.TableInterface. The service is
+// defined in velox.proto; record data is sent as JSON. Calls run as the
+// actor in their context, so an interceptor that authenticates the caller
+// and sets it with velox.WithActor lets the database's Authorizer decide
+// what each caller may do; refused calls fail with PermissionDenied.
+// Package veloxauth provides such interceptors for API keys and JWTs.
+// Calls over a rate limit fail with ResourceExhausted; package veloxlimit
+// limits each client and the writes to each table.
+package veloxgrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative velox.proto
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	jsoniter "github.com/json-iterator/go"
+	velox "github.com/properfish/VeloxDB"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type server struct {
+	UnimplementedVeloxServer
+	database *velox.Database
+}
+
+// Register adds the Velox service for database to registrar.
+func Register(registrar grpc.ServiceRegistrar, database *velox.Database) {
+	RegisterVeloxServer(registrar, &server{database: database})
+}
+
+// Serve listens on addr and serves database until the listener fails.
+func Serve(database *velox.Database, addr string, opts ...grpc.ServerOption) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	Register(grpcServer, database)
+	return grpcServer.Serve(listener)
+}
+
+func (server *server) ListTables(ctx context.Context, request *ListTablesRequest) (*ListTablesResponse, error) {
+	return &ListTablesResponse{Tables: server.database.ListTablesCtx(ctx)}, nil
+}
+
+func (server *server) CreateRecord(ctx context.Context, request *CreateRecordRequest) (*Record, error) {
+	table, err := server.table(ctx, request.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+	if err := jsoniter.Unmarshal(request.Data, &data); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid record data: %v", err)
+	}
+
+	record, err := table.CreateRecordCtx(ctx, data)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return recordMessage(record)
+}
+
+func (server *server) ReadRecord(ctx context.Context, request *RecordRequest) (*Record, error) {
+	table, err := server.table(ctx, request.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := table.GetRecordCtx(ctx, int(request.Id))
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return recordMessage(record)
+}
+
+func (server *server) UpdateRecord(ctx context.Context, request *UpdateRecordRequest) (*UpdateRecordResponse, error) {
+	table, err := server.table(ctx, request.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+	if err := jsoniter.Unmarshal(request.Data, &data); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid record data: %v", err)
+	}
+	if err := table.UpdateRecordCtx(ctx, int(request.Id), data); err != nil {
+		return nil, statusOf(err)
+	}
+	return &UpdateRecordResponse{}, nil
+}
+
+func (server *server) DeleteRecord(ctx context.Context, request *RecordRequest) (*DeleteRecordResponse, error) {
+	table, err := server.table(ctx, request.Table)
+	if err != nil {
+		return nil, err
+	}
+	if err := table.DeleteRecordCtx(ctx, int(request.Id)); err != nil {
+		return nil, statusOf(err)
+	}
+	return &DeleteRecordResponse{}, nil
+}
+
+func (server *server) Query(request *QueryRequest, stream Velox_QueryServer) error {
+	table, err := server.table(stream.Context(), request.Table)
+	if err != nil {
+		return err
+	}
+
+	query := table.Select()
+	for _, cond := range request.Where {
+		var value interface{}
+		if err := jsoniter.Unmarshal(cond.Value, &value); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid value for field %s: %v", cond.Field, err)
+		}
+		query.Where(cond.Field, cond.Op, value)
+	}
+	if request.OrderBy != "" {
+		if request.Desc {
+			query.OrderByDesc(request.OrderBy)
+		} else {
+			query.OrderBy(request.OrderBy)
+		}
+	}
+	if request.Limit > 0 {
+		query.Limit(int(request.Limit))
+	}
+
+	records, err := query.RunCtx(stream.Context())
+	if err != nil {
+		if ctxErr := stream.Context().Err(); ctxErr != nil {
+			return status.FromContextError(ctxErr).Err()
+		}
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	for _, record := range records {
+		message, err := recordMessage(record)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (server *server) Watch(request *WatchRequest, stream Velox_WatchServer) error {
+	table, err := server.table(stream.Context(), request.Table)
+	if err != nil {
+		return err
+	}
+
+	events, err := table.Watch(stream.Context())
+	if err != nil {
+		return statusOf(err)
+	}
+
+	// Send the headers now so the client knows the watch is in place
+	// before any change is made.
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for event := range events {
+		message := &ChangeEvent{Table: event.Table, Op: string(event.Op), Id: int64(event.ID)}
+		if event.Before != nil {
+			if message.Before, err = jsoniter.Marshal(event.Before); err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+		}
+		if event.After != nil {
+			if message.After, err = jsoniter.Marshal(event.After); err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+		}
+		if err := stream.Send(message); err != nil {
+			return err
+		}
+	}
+
+	if err := stream.Context().Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Aborted, "watch fell behind or table was dropped")
+}
+
+func (server *server) table(ctx context.Context, name string) (*velox.Table, error) {
+	table, err := server.database.GetTableCtx(ctx, name)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return table, nil
+}
+
+func recordMessage(record velox.RecordInterface) (*Record, error) {
+	data, err := jsoniter.Marshal(record.GetData())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &Record{Id: int64(record.GetID()), Data: data, Meta: record.GetMeta()}, nil
+}
+
+// errorCodes pairs the errors that clients can tell apart with their status
+// codes. Client errors with these codes wrap the first matching error again.
+var errorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{velox.ErrNotFound, codes.NotFound},
+	{velox.ErrDuplicate, codes.AlreadyExists},
+	{velox.ErrTableExists, codes.AlreadyExists},
+	{velox.ErrRateLimited, codes.ResourceExhausted},
+	{velox.ErrPermissionDenied, codes.PermissionDenied},
+	{velox.ErrConflict, codes.Aborted},
+	{velox.ErrForeignKeyViolation, codes.FailedPrecondition},
+	{velox.ErrInvalidFloat, codes.InvalidArgument},
+}
+
+func statusOf(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(status.FromContextError(err).Code(), err.Error())
+	}
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return status.Error(known.code, err.Error())
+		}
+	}
+
+	var constraint *velox.ConstraintError
+	var schema *velox.SchemaError
+	if errors.As(err, &constraint) || errors.As(err, &schema) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,390 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: velox.proto
+
+package veloxgrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Velox_ListTables_FullMethodName   = "/velox.v1.Velox/ListTables"
+	Velox_CreateRecord_FullMethodName = "/velox.v1.Velox/CreateRecord"
+	Velox_ReadRecord_FullMethodName   = "/velox.v1.Velox/ReadRecord"
+	Velox_UpdateRecord_FullMethodName = "/velox.v1.Velox/UpdateRecord"
+	Velox_DeleteRecord_FullMethodName = "/velox.v1.Velox/DeleteRecord"
+	Velox_Query_FullMethodName        = "/velox.v1.Velox/Query"
+	Velox_Watch_FullMethodName        = "/velox.v1.Velox/Watch"
+)
+
+// VeloxClient is the client API for Velox service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type VeloxClient interface {
+	ListTables(ctx context.Context, in *ListTablesRequest, opts ...grpc.CallOption) (*ListTablesResponse, error)
+	CreateRecord(ctx context.Context, in *CreateRecordRequest, opts ...grpc.CallOption) (*Record, error)
+	ReadRecord(ctx context.Context, in *RecordRequest, opts ...grpc.CallOption) (*Record, error)
+	UpdateRecord(ctx context.Context, in *UpdateRecordRequest, opts ...grpc.CallOption) (*UpdateRecordResponse, error)
+	DeleteRecord(ctx context.Context, in *RecordRequest, opts ...grpc.CallOption) (*DeleteRecordResponse, error)
+	// Query streams the matching records in result order.
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (Velox_QueryClient, error)
+	// Watch streams the changes made to a table until the call is cancelled.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Velox_WatchClient, error)
+}
+
+type veloxClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVeloxClient(cc grpc.ClientConnInterface) VeloxClient {
+	return &veloxClient{cc}
+}
+
+func (c *veloxClient) ListTables(ctx context.Context, in *ListTablesRequest, opts ...grpc.CallOption) (*ListTablesResponse, error) {
+	out := new(ListTablesResponse)
+	err := c.cc.Invoke(ctx, Velox_ListTables_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *veloxClient) CreateRecord(ctx context.Context, in *CreateRecordRequest, opts ...grpc.CallOption) (*Record, error) {
+	out := new(Record)
+	err := c.cc.Invoke(ctx, Velox_CreateRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *veloxClient) ReadRecord(ctx context.Context, in *RecordRequest, opts ...grpc.CallOption) (*Record, error) {
+	out := new(Record)
+	err := c.cc.Invoke(ctx, Velox_ReadRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *veloxClient) UpdateRecord(ctx context.Context, in *UpdateRecordRequest, opts ...grpc.CallOption) (*UpdateRecordResponse, error) {
+	out := new(UpdateRecordResponse)
+	err := c.cc.Invoke(ctx, Velox_UpdateRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *veloxClient) DeleteRecord(ctx context.Context, in *RecordRequest, opts ...grpc.CallOption) (*DeleteRecordResponse, error) {
+	out := new(DeleteRecordResponse)
+	err := c.cc.Invoke(ctx, Velox_DeleteRecord_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *veloxClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (Velox_QueryClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Velox_ServiceDesc.Streams[0], Velox_Query_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &veloxQueryClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Velox_QueryClient interface {
+	Recv() (*Record, error)
+	grpc.ClientStream
+}
+
+type veloxQueryClient struct {
+	grpc.ClientStream
+}
+
+func (x *veloxQueryClient) Recv() (*Record, error) {
+	m := new(Record)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *veloxClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Velox_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Velox_ServiceDesc.Streams[1], Velox_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &veloxWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Velox_WatchClient interface {
+	Recv() (*ChangeEvent, error)
+	grpc.ClientStream
+}
+
+type veloxWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *veloxWatchClient) Recv() (*ChangeEvent, error) {
+	m := new(ChangeEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// VeloxServer is the server API for Velox service.
+// All implementations must embed UnimplementedVeloxServer
+// for forward compatibility
+type VeloxServer interface {
+	ListTables(context.Context, *ListTablesRequest) (*ListTablesResponse, error)
+	CreateRecord(context.Context, *CreateRecordRequest) (*Record, error)
+	ReadRecord(context.Context, *RecordRequest) (*Record, error)
+	UpdateRecord(context.Context, *UpdateRecordRequest) (*UpdateRecordResponse, error)
+	DeleteRecord(context.Context, *RecordRequest) (*DeleteRecordResponse, error)
+	// Query streams the matching records in result order.
+	Query(*QueryRequest, Velox_QueryServer) error
+	// Watch streams the changes made to a table until the call is cancelled.
+	Watch(*WatchRequest, Velox_WatchServer) error
+	mustEmbedUnimplementedVeloxServer()
+}
+
+// UnimplementedVeloxServer must be embedded to have forward compatible implementations.
+type UnimplementedVeloxServer struct {
+}
+
+func (UnimplementedVeloxServer) ListTables(context.Context, *ListTablesRequest) (*ListTablesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTables not implemented")
+}
+func (UnimplementedVeloxServer) CreateRecord(context.Context, *CreateRecordRequest) (*Record, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateRecord not implemented")
+}
+func (UnimplementedVeloxServer) ReadRecord(context.Context, *RecordRequest) (*Record, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadRecord not implemented")
+}
+func (UnimplementedVeloxServer) UpdateRecord(context.Context, *UpdateRecordRequest) (*UpdateRecordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateRecord not implemented")
+}
+func (UnimplementedVeloxServer) DeleteRecord(context.Context, *RecordRequest) (*DeleteRecordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRecord not implemented")
+}
+func (UnimplementedVeloxServer) Query(*QueryRequest, Velox_QueryServer) error {
+	return status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedVeloxServer) Watch(*WatchRequest, Velox_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedVeloxServer) mustEmbedUnimplementedVeloxServer() {}
+
+// UnsafeVeloxServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VeloxServer will
+// result in compilation errors.
+type UnsafeVeloxServer interface {
+	mustEmbedUnimplementedVeloxServer()
+}
+
+func RegisterVeloxServer(s grpc.ServiceRegistrar, srv VeloxServer) {
+	s.RegisterService(&Velox_ServiceDesc, srv)
+}
+
+func _Velox_ListTables_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTablesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VeloxServer).ListTables(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Velox_ListTables_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VeloxServer).ListTables(ctx, req.(*ListTablesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Velox_CreateRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VeloxServer).CreateRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Velox_CreateRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VeloxServer).CreateRecord(ctx, req.(*CreateRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Velox_ReadRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VeloxServer).ReadRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Velox_ReadRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VeloxServer).ReadRecord(ctx, req.(*RecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Velox_UpdateRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VeloxServer).UpdateRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Velox_UpdateRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VeloxServer).UpdateRecord(ctx, req.(*UpdateRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Velox_DeleteRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VeloxServer).DeleteRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Velox_DeleteRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VeloxServer).DeleteRecord(ctx, req.(*RecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Velox_Query_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VeloxServer).Query(m, &veloxQueryServer{stream})
+}
+
+type Velox_QueryServer interface {
+	Send(*Record) error
+	grpc.ServerStream
+}
+
+type veloxQueryServer struct {
+	grpc.ServerStream
+}
+
+func (x *veloxQueryServer) Send(m *Record) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Velox_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VeloxServer).Watch(m, &veloxWatchServer{stream})
+}
+
+type Velox_WatchServer interface {
+	Send(*ChangeEvent) error
+	grpc.ServerStream
+}
+
+type veloxWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *veloxWatchServer) Send(m *ChangeEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Velox_ServiceDesc is the grpc.ServiceDesc for Velox service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Velox_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "velox.v1.Velox",
+	HandlerType: (*VeloxServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTables",
+			Handler:    _Velox_ListTables_Handler,
+		},
+		{
+			MethodName: "CreateRecord",
+			Handler:    _Velox_CreateRecord_Handler,
+		},
+		{
+			MethodName: "ReadRecord",
+			Handler:    _Velox_ReadRecord_Handler,
+		},
+		{
+			MethodName: "UpdateRecord",
+			Handler:    _Velox_UpdateRecord_Handler,
+		},
+		{
+			MethodName: "DeleteRecord",
+			Handler:    _Velox_DeleteRecord_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Query",
+			Handler:       _Velox_Query_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _Velox_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "velox.proto",
+}
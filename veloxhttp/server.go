@@ -0,0 +1,389 @@
+// Package veloxhttp serves a VeloxDB database over a JSON REST API:
+//
+//	GET    /tables
+//	GET    /tables/{name}/records
+//	POST   /tables/{name}/records
+//	GET    /tables/{name}/records/{id}
+//	PUT    /tables/{name}/records/{id}
+//	PATCH  /tables/{name}/records/{id}
+//	DELETE /tables/{name}/records/{id}
+//	POST   /tables/{name}/query
+//
+// Record bodies are the record data as JSON. PATCH takes a JSON merge patch,
+// or a JSON Patch when sent as application/json-patch+json. Errors are returned as
+// {"error": "..."} with a matching status code. Data failing the table's
+// schema also gets "violations", a list of {"path": ..., "message": ...}
+// for every field at fault. Bodies over 8 MiB are refused with 413.
+//
+// Requests run as the actor in their context, so a middleware that
+// authenticates the caller and sets it with velox.WithActor lets the
+// database's Authorizer decide what each caller may do; see
+// velox.SetAuthorizer. Refused requests get 403 Forbidden. Package
+// veloxauth provides such a middleware for API keys and JWTs. Requests over
+// a rate limit get 429 Too Many Requests; package veloxlimit limits each
+// client and the writes to each table.
+package veloxhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	velox "github.com/properfish/VeloxDB"
+)
+
+// Middleware wraps the server's handler, for example to authenticate
+// requests.
+type Middleware func(http.Handler) http.Handler
+
+type Server struct {
+	database *velox.Database
+	handler  http.Handler
+}
+
+// NewServer returns a Server for database. The first middleware is the
+// outermost, so it sees each request first.
+func NewServer(database *velox.Database, middleware ...Middleware) *Server {
+	server := &Server{database: database}
+
+	var handler http.Handler = http.HandlerFunc(server.route)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	server.handler = handler
+
+	return server
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.handler.ServeHTTP(w, r)
+}
+
+// maxBodySize caps request bodies.
+const maxBodySize = 8 << 20
+
+type queryRequest struct {
+	Where []struct {
+		Field string      `json:"field"`
+		Op    string      `json:"op"`
+		Value interface{} `json:"value"`
+	} `json:"where"`
+	// WhereMeta filters on record metadata, whose values are strings.
+	WhereMeta []struct {
+		Key   string `json:"key"`
+		Op    string `json:"op"`
+		Value string `json:"value"`
+	} `json:"where_meta"`
+	OrderBy string `json:"order_by"`
+	Desc    bool   `json:"desc"`
+	Limit   *int   `json:"limit"`
+}
+
+func (server *Server) route(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "tables" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"tables": server.database.ListTablesCtx(r.Context())})
+
+	case len(parts) == 3 && parts[2] == "records":
+		table, ok := server.table(w, r, parts[1])
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			server.listRecords(w, r, table)
+		case http.MethodPost:
+			server.createRecord(w, r, table)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+
+	case len(parts) == 4 && parts[2] == "records":
+		table, ok := server.table(w, r, parts[1])
+		if !ok {
+			return
+		}
+		id, err := strconv.Atoi(parts[3])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid record id %q", parts[3]))
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			server.getRecord(w, r, table, id)
+		case http.MethodPut:
+			server.updateRecord(w, r, table, id)
+		case http.MethodPatch:
+			server.patchRecord(w, r, table, id)
+		case http.MethodDelete:
+			server.deleteRecord(w, r, table, id)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+		}
+
+	case len(parts) == 3 && parts[2] == "query":
+		table, ok := server.table(w, r, parts[1])
+		if !ok {
+			return
+		}
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		server.query(w, r, table)
+
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (server *Server) table(w http.ResponseWriter, r *http.Request, name string) (*velox.Table, bool) {
+	table, err := server.database.GetTableCtx(r.Context(), name)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return nil, false
+	}
+	return table, true
+}
+
+// listRecords returns records in ID order, paged with ?limit= and either
+// ?offset= or ?after=, the last ID of the previous page. A full page also
+// returns that ID as next_after.
+func (server *Server) listRecords(w http.ResponseWriter, r *http.Request, table *velox.Table) {
+	limit, offset, after := math.MaxInt, 0, -1
+	for name, target := range map[string]*int{"limit": &limit, "offset": &offset, "after": &after} {
+		if value := r.URL.Query().Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q", name, value))
+				return
+			}
+			*target = n
+		}
+	}
+
+	var records []velox.RecordInterface
+	var err error
+	if after >= 0 {
+		records, err = table.ListAfter(after, limit)
+	} else {
+		records, err = table.List(offset, limit)
+	}
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	body := map[string]interface{}{"records": records}
+	if len(records) > 0 && len(records) == limit {
+		body["next_after"] = records[len(records)-1].GetID()
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (server *Server) createRecord(w http.ResponseWriter, r *http.Request, table *velox.Table) {
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	record, err := table.CreateRecordCtx(r.Context(), data)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, record)
+}
+
+func (server *Server) getRecord(w http.ResponseWriter, r *http.Request, table *velox.Table, id int) {
+	record, err := table.GetRecordCtx(r.Context(), id)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (server *Server) updateRecord(w http.ResponseWriter, r *http.Request, table *velox.Table, id int) {
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	if err := table.UpdateRecordCtx(r.Context(), id, data); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	record, err := table.GetRecordCtx(r.Context(), id)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (server *Server) patchRecord(w http.ResponseWriter, r *http.Request, table *velox.Table, id int) {
+	patch, ok := readAll(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json-patch+json") {
+		err = table.JSONPatchRecordCtx(r.Context(), id, patch)
+	} else {
+		err = table.MergePatchRecordCtx(r.Context(), id, patch)
+	}
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	record, err := table.GetRecordCtx(r.Context(), id)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (server *Server) deleteRecord(w http.ResponseWriter, r *http.Request, table *velox.Table, id int) {
+	if err := table.DeleteRecordCtx(r.Context(), id); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) query(w http.ResponseWriter, r *http.Request, table *velox.Table) {
+	body, ok := readAll(w, r)
+	if !ok {
+		return
+	}
+	var request queryRequest
+	if err := jsoniter.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid query: %w", err))
+		return
+	}
+
+	query := table.Select()
+	for _, cond := range request.Where {
+		query.Where(cond.Field, cond.Op, cond.Value)
+	}
+	for _, cond := range request.WhereMeta {
+		query.WhereMeta(cond.Key, cond.Op, cond.Value)
+	}
+	if request.OrderBy != "" {
+		if request.Desc {
+			query.OrderByDesc(request.OrderBy)
+		} else {
+			query.OrderBy(request.OrderBy)
+		}
+	}
+	if request.Limit != nil {
+		query.Limit(*request.Limit)
+	}
+
+	records, err := query.RunCtx(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"records": records})
+}
+
+// readAll reads the request body. Bodies over maxBodySize are refused
+// with 413 rather than cut short.
+func readAll(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body is larger than %d bytes", maxBodySize))
+		} else {
+			writeError(w, http.StatusBadRequest, err)
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+func readBody(w http.ResponseWriter, r *http.Request) (interface{}, bool) {
+	body, ok := readAll(w, r)
+	if !ok {
+		return nil, false
+	}
+	var data interface{}
+	if err := jsoniter.Unmarshal(body, &data); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid record data: %w", err))
+		return nil, false
+	}
+	return data, true
+}
+
+// statusOf maps an error from the database to an HTTP status.
+func statusOf(err error) int {
+	var constraint *velox.ConstraintError
+	var schema *velox.SchemaError
+	switch {
+	case errors.Is(err, velox.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, velox.ErrPermissionDenied), errors.Is(err, velox.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, velox.ErrReplica):
+		return http.StatusConflict
+	case errors.Is(err, velox.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, velox.ErrForeignKeyViolation), errors.Is(err, velox.ErrConflict), errors.Is(err, velox.ErrDuplicate):
+		return http.StatusConflict
+	case errors.Is(err, velox.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, velox.ErrInvalidFloat), errors.Is(err, velox.ErrInvalidPatch), errors.As(err, &constraint), errors.As(err, &schema):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+// writeError reports err as {"error": "..."}, adding the list of
+// violations for data that failed the table's schema.
+func writeError(w http.ResponseWriter, status int, err error) {
+	var schema *velox.SchemaError
+	if errors.As(err, &schema) {
+		writeJSON(w, status, map[string]interface{}{"error": err.Error(), "violations": schema.Violations})
+		return
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	encoded, err := jsoniter.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		encoded = []byte(`{"error":"cannot encode response"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(encoded, '\n'))
+}
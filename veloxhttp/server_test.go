@@ -0,0 +1,53 @@
+package veloxhttp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	velox "github.com/properfish/VeloxDB"
+)
+
+func TestOversizedBody(t *testing.T) {
+	database, err := velox.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(database)
+
+	big := append([]byte(`{"data":"`), bytes.Repeat([]byte("x"), maxBodySize)...)
+	big = append(big, `"}`...)
+	for _, request := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/tables/items/records", bytes.NewReader(big)),
+		httptest.NewRequest(http.MethodPost, "/tables/items/query", bytes.NewReader(big)),
+	} {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s %s: status %d, want 413", request.Method, request.URL.Path, recorder.Code)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/tables/items/records", bytes.NewReader([]byte(`{"name":"ann"}`))))
+	if recorder.Code != http.StatusCreated && recorder.Code != http.StatusOK {
+		t.Fatalf("small body: status %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestStatusOfReadOnly(t *testing.T) {
+	cases := map[error]int{
+		fmt.Errorf("CreateRecord: %w", velox.ErrReadOnly): http.StatusForbidden,
+		fmt.Errorf("CreateRecord: %w", velox.ErrReplica):  http.StatusConflict,
+	}
+	for err, want := range cases {
+		if got := statusOf(err); got != want {
+			t.Errorf("statusOf(%v) = %d, want %d", err, got, want)
+		}
+	}
+}
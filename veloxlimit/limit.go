@@ -0,0 +1,464 @@
+// Package veloxlimit rate limits the clients of veloxhttp and veloxgrpc
+// servers, so that one misbehaving client can't starve the others of a
+// single-node database.
+//
+// A Limiter gives each client a request rate, and each table a write rate
+// shared by every client. Its Middleware and interceptors turn away the
+// requests of clients over their rate, with 429 Too Many Requests or
+// ResourceExhausted, and WriteQuotas returns a velox.Authorizer that fails
+// writes to tables over their rate with velox.ErrRateLimited, which the
+// servers report the same way:
+//
+//	limiter := veloxlimit.NewWithOptions(veloxlimit.Options{
+//		Client:      veloxlimit.Limit{Rate: 100, Burst: 200},
+//		TableWrites: veloxlimit.Limit{Rate: 1000},
+//	})
+//	database.SetAuthorizer(limiter.WriteQuotas(nil))
+//	handler := veloxhttp.NewServer(database, auth.Middleware(), limiter.Middleware())
+//
+// A client is the actor of the request, as set by velox.WithActor, or the
+// remote IP address for requests without one, so the Limiter should come
+// after the middleware or interceptor that authenticates requests. Only
+// requests that came through the Limiter count against table quotas;
+// writes the application makes itself are never limited.
+//
+// The Limiter is also an http.Handler serving its metrics in the Prometheus
+// text format:
+//
+//	velox_ratelimit_allowed_total{limit}          counter
+//	velox_ratelimit_rejected_total{limit}         counter
+//	velox_ratelimit_table_rejected_total{table}   counter
+//	velox_ratelimit_clients                       gauge
+//
+// limit is client or table. Rejected clients aren't labelled one by one:
+// clients without an actor are told apart by IP address, of which there
+// is no end.
+package veloxlimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	velox "github.com/properfish/VeloxDB"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Limit is a token bucket: Rate requests a second, with bursts of up to
+// Burst requests. A Burst of zero or less allows one second worth of
+// requests, and at least one. A Rate of zero or less means unlimited.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (limit Limit) burst() float64 {
+	if limit.Burst > 0 {
+		return float64(limit.Burst)
+	}
+	return math.Max(1, math.Ceil(limit.Rate))
+}
+
+// Options configures NewWithOptions.
+type Options struct {
+	// Client is the request rate of each client without a limit of its
+	// own.
+	Client Limit
+	// TableWrites is the write rate of each table without a limit of its
+	// own.
+	TableWrites Limit
+	// IdleTimeout is how long a client's rate is remembered after its
+	// last request. It defaults to ten minutes.
+	IdleTimeout time.Duration
+	// Namespace prefixes every metric name instead of "velox".
+	Namespace string
+	// Clock replaces the system clock, for tests.
+	Clock velox.Clock
+}
+
+const (
+	limitClient = "client"
+	limitTable  = "table"
+)
+
+// Limiter keeps the rates of clients and tables. Limits can be changed
+// while it is in use.
+type Limiter struct {
+	options Options
+
+	mu           sync.Mutex
+	clientLimits map[string]Limit
+	tableLimits  map[string]Limit
+	clients      map[string]*bucket
+	tables       map[string]*bucket
+	lastSweep    time.Time
+	// rejectedTables counts the rejected writes of each table.
+	rejectedTables map[string]uint64
+
+	allowedClients  atomic.Uint64
+	allowedTables   atomic.Uint64
+	rejectedClients atomic.Uint64
+}
+
+func New() *Limiter {
+	return NewWithOptions(Options{})
+}
+
+func NewWithOptions(options Options) *Limiter {
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = 10 * time.Minute
+	}
+	if options.Namespace == "" {
+		options.Namespace = "velox"
+	}
+	return &Limiter{
+		options:        options,
+		clientLimits:   make(map[string]Limit),
+		tableLimits:    make(map[string]Limit),
+		clients:        make(map[string]*bucket),
+		tables:         make(map[string]*bucket),
+		rejectedTables: make(map[string]uint64),
+	}
+}
+
+// SetClientLimit gives client a limit of its own instead of
+// Options.Client.
+func (limiter *Limiter) SetClientLimit(client string, limit Limit) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.clientLimits[client] = limit
+	delete(limiter.clients, client)
+}
+
+// ClearClientLimit puts client back on Options.Client.
+func (limiter *Limiter) ClearClientLimit(client string) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	delete(limiter.clientLimits, client)
+	delete(limiter.clients, client)
+}
+
+// SetTableLimit gives table a write limit of its own instead of
+// Options.TableWrites.
+func (limiter *Limiter) SetTableLimit(table string, limit Limit) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.tableLimits[table] = limit
+	delete(limiter.tables, table)
+}
+
+// ClearTableLimit puts table back on Options.TableWrites.
+func (limiter *Limiter) ClearTableLimit(table string) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	delete(limiter.tableLimits, table)
+	delete(limiter.tables, table)
+}
+
+// bucket is a token bucket holding at most burst tokens.
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token if there is one, or returns how long until there is.
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	burst := b.limit.burst()
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// allow takes a token from the bucket of key, kind being limitClient or
+// limitTable, and counts the outcome.
+func (limiter *Limiter) allow(kind, key string) (bool, time.Duration) {
+	now := limiter.now()
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	buckets, limits, fallback, allowed := limiter.clients, limiter.clientLimits, limiter.options.Client, &limiter.allowedClients
+	if kind == limitTable {
+		buckets, limits, fallback, allowed = limiter.tables, limiter.tableLimits, limiter.options.TableWrites, &limiter.allowedTables
+	}
+	limiter.sweep(now)
+
+	limit, ok := limits[key]
+	if !ok {
+		limit = fallback
+	}
+	if limit.Rate <= 0 {
+		allowed.Add(1)
+		return true, 0
+	}
+
+	b := buckets[key]
+	if b == nil {
+		b = &bucket{limit: limit, tokens: limit.burst(), last: now}
+		buckets[key] = b
+	}
+	ok, retry := b.take(now)
+	switch {
+	case ok:
+		allowed.Add(1)
+	case kind == limitTable:
+		limiter.rejectedTables[key]++
+	default:
+		limiter.rejectedClients.Add(1)
+	}
+	return ok, retry
+}
+
+// sweep forgets the buckets of clients and tables idle for longer than
+// the idle timeout, at most once per timeout. A bucket left idle that long
+// has refilled, so forgetting it changes nothing.
+func (limiter *Limiter) sweep(now time.Time) {
+	timeout := limiter.options.IdleTimeout
+	if now.Sub(limiter.lastSweep) < timeout {
+		return
+	}
+	limiter.lastSweep = now
+
+	for _, buckets := range []map[string]*bucket{limiter.clients, limiter.tables} {
+		for key, b := range buckets {
+			if now.Sub(b.last) >= timeout && now.Sub(b.last).Seconds()*b.limit.Rate >= b.limit.burst() {
+				delete(buckets, key)
+			}
+		}
+	}
+}
+
+func (limiter *Limiter) now() time.Time {
+	if limiter.options.Clock != nil {
+		return limiter.options.Clock.Now()
+	}
+	return time.Now()
+}
+
+// rejectedError is the error requests of client over its rate fail with.
+func rejectedError(client string) error {
+	return fmt.Errorf("too many requests from %s", client)
+}
+
+// retrySeconds rounds retry up to whole seconds, for Retry-After.
+func retrySeconds(retry time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(retry.Seconds())), 10)
+}
+
+type limitedKey struct{}
+
+// limited marks ctx as coming through the Limiter, so that WriteQuotas
+// applies to it.
+func limited(ctx context.Context) context.Context {
+	return context.WithValue(ctx, limitedKey{}, true)
+}
+
+// Middleware returns a veloxhttp middleware that answers the requests of
+// clients over their rate with 429 Too Many Requests and a Retry-After
+// header.
+func (limiter *Limiter) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := velox.ActorFrom(r.Context())
+			if client == "" {
+				client = remoteHost(r.RemoteAddr)
+			}
+			if ok, retry := limiter.allow(limitClient, client); !ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", retrySeconds(retry))
+				w.WriteHeader(http.StatusTooManyRequests)
+				jsoniter.NewEncoder(w).Encode(map[string]string{"error": rejectedError(client).Error()})
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(limited(r.Context())))
+		})
+	}
+}
+
+// UnaryInterceptor returns a gRPC interceptor that fails the calls of
+// clients over their rate with ResourceExhausted. The call's metadata
+// carries retry-after, in seconds, as the HTTP header does.
+func (limiter *Limiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := limiter.limitGRPC(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
+
+// StreamInterceptor is UnaryInterceptor for streaming calls. A stream
+// counts as one request however many messages it carries.
+func (limiter *Limiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := limiter.limitGRPC(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(server, limitedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// ServerOptions returns the options that install both interceptors, for
+// veloxgrpc.Serve or grpc.NewServer. They must come after those of the
+// authenticating interceptors.
+func (limiter *Limiter) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(limiter.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(limiter.StreamInterceptor()),
+	}
+}
+
+func (limiter *Limiter) limitGRPC(ctx context.Context) (context.Context, error) {
+	client := velox.ActorFrom(ctx)
+	if client == "" {
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			client = remoteHost(p.Addr.String())
+		}
+	}
+	if ok, retry := limiter.allow(limitClient, client); !ok {
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", retrySeconds(retry)))
+		return nil, status.Error(codes.ResourceExhausted, rejectedError(client).Error())
+	}
+	return limited(ctx), nil
+}
+
+type limitedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream limitedStream) Context() context.Context {
+	return stream.ctx
+}
+
+// remoteHost returns the host of a host:port address, or the address if it
+// has no port.
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// WriteQuotas returns a velox.Authorizer that asks next, if not nil, and
+// then fails writes to tables over their rate with velox.ErrRateLimited.
+// Writes refused by next don't count against the table's rate. Only
+// operations that came through the Limiter's middleware or interceptors
+// are limited.
+func (limiter *Limiter) WriteQuotas(next velox.Authorizer) velox.Authorizer {
+	return quotaAuthorizer{limiter: limiter, next: next}
+}
+
+type quotaAuthorizer struct {
+	limiter *Limiter
+	next    velox.Authorizer
+}
+
+func (authorizer quotaAuthorizer) Authorize(ctx context.Context, table string, permission velox.Permission) error {
+	if authorizer.next != nil {
+		if err := authorizer.next.Authorize(ctx, table, permission); err != nil {
+			return err
+		}
+	}
+	if permission != velox.PermissionWrite || ctx.Value(limitedKey{}) == nil {
+		return nil
+	}
+	if ok, _ := authorizer.limiter.allow(limitTable, table); !ok {
+		return fmt.Errorf("%w: quota of table %s used up", velox.ErrRateLimited, table)
+	}
+	return nil
+}
+
+func (limiter *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	limiter.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format, so they
+// can be appended to those of veloxmetrics.Collector.
+func (limiter *Limiter) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	writer := bufio.NewWriter(counter)
+
+	limiter.mu.Lock()
+	tables := make([]string, 0, len(limiter.rejectedTables))
+	rejected := make(map[string]uint64, len(limiter.rejectedTables))
+	var rejectedTables uint64
+	for table, count := range limiter.rejectedTables {
+		tables = append(tables, table)
+		rejected[table] = count
+		rejectedTables += count
+	}
+	clients := len(limiter.clients)
+	limiter.mu.Unlock()
+	sort.Strings(tables)
+
+	namespace := limiter.options.Namespace
+	name := namespace + "_ratelimit_allowed_total"
+	fmt.Fprintf(writer, "# HELP %s Requests and table writes let through, by limit.\n# TYPE %s counter\n", name, name)
+	fmt.Fprintf(writer, "%s{limit=\"%s\"} %d\n", name, limitClient, limiter.allowedClients.Load())
+	fmt.Fprintf(writer, "%s{limit=\"%s\"} %d\n", name, limitTable, limiter.allowedTables.Load())
+
+	name = namespace + "_ratelimit_rejected_total"
+	fmt.Fprintf(writer, "# HELP %s Requests and table writes turned away, by limit.\n# TYPE %s counter\n", name, name)
+	fmt.Fprintf(writer, "%s{limit=\"%s\"} %d\n", name, limitClient, limiter.rejectedClients.Load())
+	fmt.Fprintf(writer, "%s{limit=\"%s\"} %d\n", name, limitTable, rejectedTables)
+
+	name = namespace + "_ratelimit_table_rejected_total"
+	fmt.Fprintf(writer, "# HELP %s Table writes turned away, by table.\n# TYPE %s counter\n", name, name)
+	for _, table := range tables {
+		fmt.Fprintf(writer, "%s{table=\"%s\"} %d\n", name, escapeLabel(table), rejected[table])
+	}
+
+	name = namespace + "_ratelimit_clients"
+	fmt.Fprintf(writer, "# HELP %s Clients whose rate is being tracked.\n# TYPE %s gauge\n", name, name)
+	fmt.Fprintf(writer, "%s %d\n", name, clients)
+
+	err := writer.Flush()
+	return counter.n, err
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (counter *countingWriter) Write(p []byte) (int, error) {
+	n, err := counter.w.Write(p)
+	counter.n += int64(n)
+	return n, err
+}
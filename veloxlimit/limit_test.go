@@ -0,0 +1,47 @@
+package veloxlimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRejectedClientsNotLabelled(t *testing.T) {
+	limiter := NewWithOptions(Options{Client: Limit{Rate: 1, Burst: 1}})
+	handler := limiter.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	const clients = 1000
+	for i := 0; i < clients; i++ {
+		for j := 0; j < 2; j++ {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+		}
+	}
+	if ok, _ := limiter.allow(limitTable, "orders"); !ok {
+		t.Fatal("table without a limit was limited")
+	}
+	limiter.SetTableLimit("orders", Limit{Rate: 1, Burst: 1})
+	limiter.allow(limitTable, "orders")
+	limiter.allow(limitTable, "orders")
+
+	var metrics strings.Builder
+	if _, err := limiter.WriteTo(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	out := metrics.String()
+	if strings.Contains(out, "10.0.") {
+		t.Fatal("metrics label rejected clients by address")
+	}
+	for _, line := range []string{
+		fmt.Sprintf(`velox_ratelimit_rejected_total{limit="client"} %d`, clients),
+		`velox_ratelimit_rejected_total{limit="table"} 1`,
+		`velox_ratelimit_table_rejected_total{table="orders"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("metrics lack %q:\n%s", line, out)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Package veloxmetrics collects metrics of a VeloxDB database for
+// Prometheus:
+//
+//	velox_operations_total{op, table}            counter
+//	velox_operation_errors_total{op, table}      counter
+//	velox_operation_duration_seconds{op, table}  histogram
+//	velox_table_records{table}                   gauge
+//
+// op is the operation as velox.Observer names it, such as CreateRecord,
+// ReadRecord, UpdateRecord, DeleteRecord, Query, Save or Load; Save and
+// Load have an empty table. Record counts are read when metrics are
+// scraped.
+//
+// The Collector is a prometheus.Collector, so it can be registered on an
+// existing registry:
+//
+//	prometheus.MustRegister(veloxmetrics.New(database))
+//
+// It can also serve the metrics on its own path or write them with
+// WriteTo, without a registry.
+package veloxmetrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	velox "github.com/properfish/VeloxDB"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency
+// histogram buckets.
+var DefaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// Options configures NewWithOptions.
+type Options struct {
+	// Namespace prefixes every metric name instead of "velox".
+	Namespace string
+	// Buckets replaces DefaultBuckets. They must be sorted.
+	Buckets []float64
+}
+
+// Collector counts the operations of a database. It is a velox.Observer,
+// a prometheus.Collector and an http.Handler serving the metrics.
+type Collector struct {
+	database  *velox.Database
+	namespace string
+	buckets   []float64
+
+	operations *prometheus.Desc
+	errors     *prometheus.Desc
+	duration   *prometheus.Desc
+	records    *prometheus.Desc
+
+	mu     sync.RWMutex
+	series map[velox.Operation]*series
+}
+
+type series struct {
+	count   atomic.Uint64
+	errors  atomic.Uint64
+	buckets []atomic.Uint64
+	// sum holds the float64 bits of the total duration in seconds.
+	sum atomic.Uint64
+}
+
+// New returns a Collector observing database.
+func New(database *velox.Database) *Collector {
+	return NewWithOptions(database, Options{})
+}
+
+// NewWithOptions is New with options.
+func NewWithOptions(database *velox.Database, opts Options) *Collector {
+	collector := &Collector{
+		database:  database,
+		namespace: opts.Namespace,
+		buckets:   opts.Buckets,
+		series:    make(map[velox.Operation]*series),
+	}
+	if collector.namespace == "" {
+		collector.namespace = "velox"
+	}
+	if collector.buckets == nil {
+		collector.buckets = DefaultBuckets
+	}
+	opLabelNames := []string{"op", "table"}
+	collector.operations = prometheus.NewDesc(collector.namespace+"_operations_total",
+		"Operations run, by operation and table.", opLabelNames, nil)
+	collector.errors = prometheus.NewDesc(collector.namespace+"_operation_errors_total",
+		"Operations that failed, by operation and table.", opLabelNames, nil)
+	collector.duration = prometheus.NewDesc(collector.namespace+"_operation_duration_seconds",
+		"Time operations took, by operation and table.", opLabelNames, nil)
+	collector.records = prometheus.NewDesc(collector.namespace+"_table_records",
+		"Live records in each loaded table.", []string{"table"}, nil)
+	database.AddObserver(collector)
+	return collector
+}
+
+// Begin implements velox.Observer.
+func (collector *Collector) Begin(ctx context.Context, op velox.Operation) (context.Context, func(err error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		collector.record(op, time.Since(start), err)
+	}
+}
+
+func (collector *Collector) record(op velox.Operation, took time.Duration, err error) {
+	collector.mu.RLock()
+	s := collector.series[op]
+	collector.mu.RUnlock()
+	if s == nil {
+		collector.mu.Lock()
+		if s = collector.series[op]; s == nil {
+			s = &series{buckets: make([]atomic.Uint64, len(collector.buckets))}
+			collector.series[op] = s
+		}
+		collector.mu.Unlock()
+	}
+
+	seconds := took.Seconds()
+	s.count.Add(1)
+	if err != nil {
+		s.errors.Add(1)
+	}
+	if i := sort.SearchFloat64s(collector.buckets, seconds); i < len(s.buckets) {
+		s.buckets[i].Add(1)
+	}
+	for {
+		old := s.sum.Load()
+		if s.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+seconds)) {
+			break
+		}
+	}
+}
+
+func (collector *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	collector.WriteTo(w)
+}
+
+// Describe implements prometheus.Collector.
+func (collector *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.operations
+	ch <- collector.errors
+	ch <- collector.duration
+	ch <- collector.records
+}
+
+// Collect implements prometheus.Collector.
+func (collector *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, e := range collector.entries() {
+		count, buckets := collector.histogram(e.series)
+		ch <- prometheus.MustNewConstMetric(collector.operations, prometheus.CounterValue, float64(e.count.Load()), e.op.Name, e.op.Table)
+		ch <- prometheus.MustNewConstMetric(collector.errors, prometheus.CounterValue, float64(e.errors.Load()), e.op.Name, e.op.Table)
+		upperBounds := make(map[float64]uint64, len(buckets))
+		for j, bound := range collector.buckets {
+			upperBounds[bound] = buckets[j]
+		}
+		ch <- prometheus.MustNewConstHistogram(collector.duration, count, math.Float64frombits(e.sum.Load()), upperBounds, e.op.Name, e.op.Table)
+	}
+	for _, table := range collector.tables() {
+		ch <- prometheus.MustNewConstMetric(collector.records, prometheus.GaugeValue, float64(table.count), table.name)
+	}
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (collector *Collector) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	writer := bufio.NewWriter(counter)
+	entries := collector.entries()
+
+	name := collector.namespace + "_operations_total"
+	fmt.Fprintf(writer, "# HELP %s Operations run, by operation and table.\n# TYPE %s counter\n", name, name)
+	for _, e := range entries {
+		fmt.Fprintf(writer, "%s{%s} %d\n", name, opLabels(e.op), e.count.Load())
+	}
+
+	name = collector.namespace + "_operation_errors_total"
+	fmt.Fprintf(writer, "# HELP %s Operations that failed, by operation and table.\n# TYPE %s counter\n", name, name)
+	for _, e := range entries {
+		fmt.Fprintf(writer, "%s{%s} %d\n", name, opLabels(e.op), e.errors.Load())
+	}
+
+	name = collector.namespace + "_operation_duration_seconds"
+	fmt.Fprintf(writer, "# HELP %s Time operations took, by operation and table.\n# TYPE %s histogram\n", name, name)
+	for _, e := range entries {
+		labels := opLabels(e.op)
+		count, buckets := collector.histogram(e.series)
+		for j, bound := range collector.buckets {
+			fmt.Fprintf(writer, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), buckets[j])
+		}
+		fmt.Fprintf(writer, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, count)
+		fmt.Fprintf(writer, "%s_sum{%s} %s\n", name, labels, formatFloat(math.Float64frombits(e.sum.Load())))
+		fmt.Fprintf(writer, "%s_count{%s} %d\n", name, labels, count)
+	}
+
+	name = collector.namespace + "_table_records"
+	fmt.Fprintf(writer, "# HELP %s Live records in each loaded table.\n# TYPE %s gauge\n", name, name)
+	for _, table := range collector.tables() {
+		fmt.Fprintf(writer, "%s{table=\"%s\"} %d\n", name, escapeLabel(table.name), table.count)
+	}
+
+	err := writer.Flush()
+	return counter.n, err
+}
+
+type entry struct {
+	op velox.Operation
+	*series
+}
+
+// entries returns the series recorded so far, sorted by operation and
+// table.
+func (collector *Collector) entries() []entry {
+	collector.mu.RLock()
+	entries := make([]entry, 0, len(collector.series))
+	for op, s := range collector.series {
+		entries = append(entries, entry{op, s})
+	}
+	collector.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].op.Name != entries[j].op.Name {
+			return entries[i].op.Name < entries[j].op.Name
+		}
+		return entries[i].op.Table < entries[j].op.Table
+	})
+	return entries
+}
+
+// histogram returns the count of s and its cumulative bucket counts.
+func (collector *Collector) histogram(s *series) (uint64, []uint64) {
+	// An operation ending while this runs can show up in the buckets but
+	// not the count read before them.
+	count := s.count.Load()
+	buckets := make([]uint64, len(collector.buckets))
+	var cumulative uint64
+	for j := range collector.buckets {
+		cumulative += s.buckets[j].Load()
+		buckets[j] = cumulative
+	}
+	if count < cumulative {
+		count = cumulative
+	}
+	return count, buckets
+}
+
+type tableCount struct {
+	name  string
+	count int
+}
+
+// tables returns the record count of each loaded table.
+func (collector *Collector) tables() []tableCount {
+	var counts []tableCount
+	for _, name := range collector.database.ListTables() {
+		table, err := collector.database.GetTable(name)
+		if err != nil {
+			continue
+		}
+		counts = append(counts, tableCount{name, table.Count()})
+	}
+	return counts
+}
+
+func opLabels(op velox.Operation) string {
+	return `op="` + escapeLabel(op.Name) + `",table="` + escapeLabel(op.Table) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (counter *countingWriter) Write(p []byte) (int, error) {
+	n, err := counter.w.Write(p)
+	counter.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,70 @@
+package veloxmetrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	velox "github.com/properfish/VeloxDB"
+)
+
+func TestRegisterOnRegistry(t *testing.T) {
+	database, err := velox.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := New(database)
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	table, err := database.GetTable("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := table.CreateRecord(map[string]interface{}{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := table.ReadRecord(100); err == nil {
+		t.Fatal("ReadRecord of a missing record succeeded")
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += "," + label.GetName() + "=" + label.GetValue()
+			}
+			switch {
+			case metric.Counter != nil:
+				values[name] = metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				values[name] = metric.GetGauge().GetValue()
+			case metric.Histogram != nil:
+				values[name] = float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	for name, want := range map[string]float64{
+		"velox_operations_total,op=CreateRecord,table=items":           3,
+		"velox_operation_errors_total,op=ReadRecord,table=items":       1,
+		"velox_operation_duration_seconds,op=CreateRecord,table=items": 3,
+		"velox_table_records,table=items":                              3,
+	} {
+		if got, ok := values[name]; !ok || got != want {
+			t.Errorf("%s = %v (present %v), want %v", name, got, ok, want)
+		}
+	}
+}
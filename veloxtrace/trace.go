@@ -0,0 +1,91 @@
+// Package veloxtrace puts VeloxDB operations in distributed traces. Each
+// operation a velox.Observer sees, record operations and queries as well as
+// Save and Load, becomes a span named "velox." plus the operation, such as
+// velox.CreateRecord, started from the context the operation was given.
+// Use the Ctx variants of the record methods, as veloxhttp and veloxgrpc
+// do, so the spans land under the span of the request that caused them.
+//
+// The module doesn't depend on OpenTelemetry. Tracer is small enough to
+// adapt an OpenTelemetry tracer in a few lines:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attrs []veloxtrace.Attribute) (context.Context, veloxtrace.Span) {
+//		kvs := make([]attribute.KeyValue, len(attrs))
+//		for i, attr := range attrs {
+//			kvs[i] = attribute.String(attr.Key, attr.Value)
+//		}
+//		ctx, span := t.Tracer.Start(ctx, name, trace.WithAttributes(kvs...))
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) End(err error) {
+//		if err != nil {
+//			s.Span.RecordError(err)
+//			s.Span.SetStatus(codes.Error, err.Error())
+//		}
+//		s.Span.End()
+//	}
+//
+//	veloxtrace.Instrument(database, otelTracer{otel.Tracer("velox")})
+package veloxtrace
+
+import (
+	"context"
+
+	velox "github.com/properfish/VeloxDB"
+)
+
+// Attribute is a key and value describing a span.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	// Start starts a span called name as a child of the span in ctx, if
+	// any, and returns a context holding it.
+	Start(ctx context.Context, name string, attributes []Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span, marking it failed if err is not nil.
+	End(err error)
+}
+
+// The attributes every span gets, following the OpenTelemetry conventions
+// for database spans.
+const (
+	SystemKey     = "db.system"
+	OperationKey  = "db.operation"
+	CollectionKey = "db.collection.name"
+
+	System = "veloxdb"
+)
+
+// Instrument makes database report its operations to tracer.
+func Instrument(database *velox.Database, tracer Tracer) {
+	database.AddObserver(Observer(tracer))
+}
+
+// Observer returns a velox.Observer that starts a span for each operation.
+func Observer(tracer Tracer) velox.Observer {
+	return observer{tracer}
+}
+
+type observer struct {
+	tracer Tracer
+}
+
+func (observer observer) Begin(ctx context.Context, op velox.Operation) (context.Context, func(err error)) {
+	attributes := []Attribute{{SystemKey, System}, {OperationKey, op.Name}}
+	if op.Table != "" {
+		attributes = append(attributes, Attribute{CollectionKey, op.Table})
+	}
+	ctx, span := observer.tracer.Start(ctx, "velox."+op.Name, attributes)
+	return ctx, span.End
+}
@@ -0,0 +1,490 @@
+package velox
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// View is a materialized view: the results of a query, kept in memory and
+// brought up to date by every change to the tables it reads, so reading
+// it costs no more than reading a table of its results. Views are read
+// through their own methods, which work as the Table methods of the same
+// name do, and can't be written.
+//
+// Views are not saved; create them again after Load, as indexes are.
+type View struct {
+	name string
+	// leftName and rightName prefix the fields of join rows. They are the
+	// names the tables had when the view was created.
+	leftName, rightName string
+	// query is the view's query. Its conditions pick the left records,
+	// its order and limit apply when the view is read.
+	query QueryBuilder
+	left  *Table
+	// right and on are set for views made with CreateJoinView.
+	right *Table
+	on    JoinOn
+	// rows holds the results: the left records themselves, or the joined
+	// rows under IDs of their own.
+	rows *Table
+
+	// mu serializes changes to the view, which come from both tables of
+	// a join.
+	mu   sync.Mutex
+	join *viewJoin
+}
+
+// viewJoin is what a join view keeps to update its rows without reading
+// either table.
+type viewJoin struct {
+	// lefts holds the left records matching the query and rights every
+	// live right record.
+	lefts  map[int]Record
+	rights map[int]Record
+	// leftsByKey and rightsByKey index them by the value they join on.
+	leftsByKey  map[string]map[int]struct{}
+	rightsByKey map[string]map[int]struct{}
+	// rowsOf holds the row IDs of each left record.
+	rowsOf  map[int][]int
+	nextRow int
+}
+
+// CreateView creates a view of the records of query's table that match
+// query. Its records keep their IDs, and reading them in full with
+// Records gives them in the query's order, up to its limit.
+func (database *Database) CreateView(name string, query *QueryBuilder) (*View, error) {
+	return database.createView("CreateView", name, query, "", JoinOn{})
+}
+
+// CreateJoinView creates a view of the records of query's table that
+// match query joined with the records of right, as RunJoin joins them.
+// Each row of the view holds the fields of both records, with their names
+// prefixed by the name of their table and a dot, such as users.name, and
+// their IDs as <table>.id. A left record that matches no right record in
+// an outer join has a row with only its own fields. Rows get IDs of their
+// own, in the order they are added.
+func (database *Database) CreateJoinView(name string, query *QueryBuilder, right string, on JoinOn) (*View, error) {
+	if on.LeftField == "" {
+		return nil, errors.New("CreateJoinView: left field is required")
+	}
+	return database.createView("CreateJoinView", name, query, right, on)
+}
+
+func (database *Database) createView(op, name string, query *QueryBuilder, right string, on JoinOn) (*View, error) {
+	if query.err != nil {
+		return nil, fmt.Errorf("%s: %w", op, query.err)
+	}
+	if query.table.database != database {
+		return nil, fmt.Errorf("%s: query table does not belong to the database", op)
+	}
+
+	view := &View{name: name, query: *query, left: query.table, on: on, rows: NewTable()}
+	view.query.conditions = append([]condition(nil), query.conditions...)
+	view.rows.name = name
+	view.rows.copyOnRead.Store(view.left.copyOnRead.Load())
+
+	database.RWMutex.RLock()
+	view.leftName = view.left.name
+	database.RWMutex.RUnlock()
+	if _, err := database.GetTable(view.leftName); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	scope := []*Table{view.left}
+	if right != "" {
+		table, err := database.GetTable(right)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		view.right, view.rightName = table, right
+		scope = append(scope, table)
+		view.join = &viewJoin{
+			lefts:       make(map[int]Record),
+			rights:      make(map[int]Record),
+			leftsByKey:  make(map[string]map[int]struct{}),
+			rightsByKey: make(map[string]map[int]struct{}),
+			rowsOf:      make(map[int][]int),
+			nextRow:     1,
+		}
+	}
+
+	locked := lockTables(scope)
+	defer unlockTables(locked)
+
+	for _, lt := range locked {
+		if lt.table.dropped {
+			return nil, &TableError{Op: op, Table: lt.table.name, Err: ErrNotFound}
+		}
+	}
+
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	if _, ok := database.views[name]; ok {
+		return nil, fmt.Errorf("%s: %w: view %s", op, ErrTableExists, name)
+	}
+	_, unloaded := database.unloaded[name]
+	if _, ok := database.tables.Get(name); ok || unloaded {
+		return nil, fmt.Errorf("%s: %w: table %s", op, ErrTableExists, name)
+	}
+
+	view.build()
+	for _, lt := range locked {
+		if lt.table.views == nil {
+			lt.table.views = make(map[*View]struct{})
+		}
+		lt.table.views[view] = struct{}{}
+	}
+	if database.views == nil {
+		database.views = make(map[string]*View)
+	}
+	database.views[name] = view
+	return view, nil
+}
+
+// View returns the view called name.
+func (database *Database) View(name string) (*View, error) {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	view, ok := database.views[name]
+	if !ok {
+		return nil, fmt.Errorf("View: view %s: %w", name, ErrNotFound)
+	}
+	return view, nil
+}
+
+// ListViews returns the names of the views, sorted.
+func (database *Database) ListViews() []string {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	names := make([]string, 0, len(database.views))
+	for name := range database.views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DropView removes the view called name, which stops being kept up to
+// date.
+func (database *Database) DropView(name string) error {
+	view, err := database.View(name)
+	if err != nil {
+		return fmt.Errorf("DropView: view %s: %w", name, ErrNotFound)
+	}
+
+	scope := []*Table{view.left}
+	if view.right != nil {
+		scope = append(scope, view.right)
+	}
+	locked := lockTables(scope)
+	defer unlockTables(locked)
+
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	if database.views[name] != view {
+		return fmt.Errorf("DropView: view %s: %w", name, ErrNotFound)
+	}
+	delete(database.views, name)
+	for _, lt := range locked {
+		delete(lt.table.views, view)
+	}
+	return nil
+}
+
+// viewOf returns the name of a view reading table, if any. Callers hold
+// the table's lock.
+func (table *Table) viewOf() (string, bool) {
+	for view := range table.views {
+		return view.name, true
+	}
+	return "", false
+}
+
+func (view *View) Name() string {
+	return view.name
+}
+
+// ReadRecord returns the data of record id of the view.
+func (view *View) ReadRecord(id int) (interface{}, error) {
+	return view.rows.ReadRecord(id)
+}
+
+func (view *View) Count() int {
+	return view.rows.Count()
+}
+
+// Records returns the records of the view, ordered and limited as its
+// query says. The order of a join view is by the field of the left table.
+func (view *View) Records() ([]RecordInterface, error) {
+	all := func(RecordInterface) bool { return true }
+
+	var results []RecordInterface
+	var err error
+	switch {
+	case view.query.orderBy == "":
+		results, err = view.rows.Query(all)
+	case view.join != nil:
+		results, err = view.rows.QuerySorted(all, view.leftName+"."+view.query.orderBy, !view.query.desc)
+	default:
+		results, err = view.rows.QuerySorted(all, view.query.orderBy, !view.query.desc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if view.query.limited && len(results) > view.query.limit {
+		results = results[:view.query.limit]
+	}
+	return results, nil
+}
+
+// Query returns the records of the view that match predicate.
+func (view *View) Query(predicate func(RecordInterface) bool) ([]RecordInterface, error) {
+	return view.rows.Query(predicate)
+}
+
+// Select starts a query of the view that matches every record, on top of
+// the view's own query. The view's order and limit don't apply to it.
+func (view *View) Select() *QueryBuilder {
+	return view.rows.Select()
+}
+
+// Where starts a query of the view with a single condition. See
+// QueryBuilder.Where.
+func (view *View) Where(field, op string, value interface{}) *QueryBuilder {
+	return view.rows.Where(field, op, value)
+}
+
+// Aggregate starts an aggregation over every record of the view.
+func (view *View) Aggregate() *Aggregation {
+	return view.rows.Aggregate()
+}
+
+// build fills the view from its tables. Callers hold their locks.
+func (view *View) build() {
+	defer view.rows.unlock(view.rows.lock())
+
+	if view.join != nil {
+		view.right.records.IterCb(func(key string, val interface{}) {
+			if record, err := view.right.recordValue("CreateView", val); err == nil && !view.right.hidden(record) {
+				view.join.addRight(view, record)
+			}
+		})
+	}
+	view.left.records.IterCb(func(key string, val interface{}) {
+		record, err := view.left.recordValue("CreateView", val)
+		if err != nil || view.left.hidden(record) || !view.query.matches(&record) {
+			return
+		}
+		if view.join == nil {
+			view.rows.setRecord(nil, record)
+			return
+		}
+		view.join.addLeft(view, record)
+		view.join.addRows(view, record.ID)
+	})
+}
+
+// changed updates the view for a change to a record of source, which is
+// one of its tables. before is nil for creates and after is nil for
+// deletes. Callers hold the lock of source.
+func (view *View) changed(source *Table, before, after *Record) {
+	view.mu.Lock()
+	defer view.mu.Unlock()
+	defer view.rows.unlock(view.rows.lock())
+
+	var id int
+	if before != nil {
+		id = before.ID
+	} else {
+		id = after.ID
+	}
+	if after != nil && source.hidden(*after) {
+		after = nil
+	}
+
+	if view.join == nil {
+		var previous *Record
+		if val, ok := view.rows.records.Get(strconv.Itoa(id)); ok {
+			if record, err := view.rows.recordValue("View", val); err == nil {
+				previous = &record
+			}
+		}
+		switch {
+		case after != nil && view.query.matches(after):
+			view.rows.setRecord(previous, *after)
+		case previous != nil:
+			view.rows.unsetRecord(*previous)
+		}
+		return
+	}
+
+	// A table joined with itself is both sides of the view.
+	join := view.join
+	if source == view.right {
+		affected := make(map[int]struct{})
+		if previous, ok := join.rights[id]; ok {
+			for left := range join.leftsByKey[view.rightKey(previous)] {
+				affected[left] = struct{}{}
+			}
+			join.removeRight(view, previous)
+		}
+		if after != nil {
+			join.addRight(view, *after)
+			for left := range join.leftsByKey[view.rightKey(*after)] {
+				affected[left] = struct{}{}
+			}
+		}
+		for left := range affected {
+			join.removeRows(view, left)
+			join.addRows(view, left)
+		}
+	}
+	if source == view.left {
+		join.removeRows(view, id)
+		if previous, ok := join.lefts[id]; ok {
+			join.removeLeft(view, previous)
+		}
+		if after != nil && view.query.matches(after) {
+			join.addLeft(view, *after)
+			join.addRows(view, id)
+		}
+	}
+}
+
+// leftKey returns the key a left record joins on, which is that of the
+// right records it joins with.
+func (view *View) leftKey(record Record) (string, bool) {
+	value, ok := view.left.fieldOf(record.Data, view.on.LeftField)
+	if !ok || value == nil {
+		return "", false
+	}
+	if view.on.RightField == "" {
+		id, ok := referencedID(value)
+		return strconv.Itoa(id), ok
+	}
+	return indexKey(value)
+}
+
+func (view *View) rightKey(record Record) string {
+	if view.on.RightField == "" {
+		return strconv.Itoa(record.ID)
+	}
+	value, ok := view.right.fieldOf(record.Data, view.on.RightField)
+	if !ok || value == nil {
+		return ""
+	}
+	key, _ := indexKey(value)
+	return key
+}
+
+func (join *viewJoin) addLeft(view *View, record Record) {
+	join.lefts[record.ID] = record
+	if key, ok := view.leftKey(record); ok {
+		addToKey(join.leftsByKey, key, record.ID)
+	}
+}
+
+func (join *viewJoin) removeLeft(view *View, record Record) {
+	delete(join.lefts, record.ID)
+	if key, ok := view.leftKey(record); ok {
+		removeFromKey(join.leftsByKey, key, record.ID)
+	}
+}
+
+func (join *viewJoin) addRight(view *View, record Record) {
+	join.rights[record.ID] = record
+	if key := view.rightKey(record); key != "" {
+		addToKey(join.rightsByKey, key, record.ID)
+	}
+}
+
+func (join *viewJoin) removeRight(view *View, record Record) {
+	delete(join.rights, record.ID)
+	if key := view.rightKey(record); key != "" {
+		removeFromKey(join.rightsByKey, key, record.ID)
+	}
+}
+
+func addToKey(index map[string]map[int]struct{}, key string, id int) {
+	if index[key] == nil {
+		index[key] = make(map[int]struct{})
+	}
+	index[key][id] = struct{}{}
+}
+
+func removeFromKey(index map[string]map[int]struct{}, key string, id int) {
+	delete(index[key], id)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// addRows adds the rows of left record id, if it matches the query.
+// Callers hold the lock of the rows.
+func (join *viewJoin) addRows(view *View, id int) {
+	left, ok := join.lefts[id]
+	if !ok {
+		return
+	}
+
+	var rights []int
+	if key, ok := view.leftKey(left); ok {
+		for right := range join.rightsByKey[key] {
+			rights = append(rights, right)
+		}
+	}
+	sort.Ints(rights)
+	if len(rights) == 0 && view.on.Outer {
+		rights = []int{-1}
+	}
+
+	for _, right := range rights {
+		data := make(map[string]interface{})
+		view.addFields(data, view.leftName, left)
+		if right >= 0 {
+			view.addFields(data, view.rightName, join.rights[right])
+		}
+
+		row := Record{ID: join.nextRow, Data: data, Version: 1, CreatedAt: left.CreatedAt, UpdatedAt: left.UpdatedAt}
+		join.nextRow++
+		view.rows.setRecord(nil, row)
+		join.rowsOf[id] = append(join.rowsOf[id], row.ID)
+	}
+}
+
+// removeRows removes the rows of left record id. Callers hold the lock of
+// the rows.
+func (join *viewJoin) removeRows(view *View, id int) {
+	for _, row := range join.rowsOf[id] {
+		if val, ok := view.rows.records.Get(strconv.Itoa(row)); ok {
+			if record, err := view.rows.recordValue("View", val); err == nil {
+				view.rows.unsetRecord(record)
+			}
+		}
+	}
+	delete(join.rowsOf, id)
+}
+
+// addFields copies the fields of record into data, prefixed with table.
+func (view *View) addFields(data map[string]interface{}, table string, record Record) {
+	data[table+".id"] = record.ID
+	generic, err := genericValue(record.Data)
+	if err != nil {
+		return
+	}
+	fields, ok := generic.(map[string]interface{})
+	if !ok {
+		data[table] = generic
+		return
+	}
+	for field, value := range fields {
+		data[table+"."+field] = value
+	}
+}
@@ -0,0 +1,133 @@
+package velox
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// viewRows returns the canonical JSON of the rows of view, sorted. Join
+// rows get IDs in the order they are added, so only the IDs of other
+// views are kept.
+func viewRows(t *testing.T, view *View) []string {
+	t.Helper()
+	records, err := view.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make([]string, len(records))
+	for i, record := range records {
+		rows[i] = canonical(t, record.GetData())
+		if view.join == nil {
+			rows[i] = strconv.Itoa(record.GetID()) + " " + rows[i]
+		}
+	}
+	sort.Strings(rows)
+	return rows
+}
+
+func TestViewMaintenance(t *testing.T) {
+	database, users := newTestTable(t, "users")
+	if err := database.CreateTable("orders"); err != nil {
+		t.Fatal(err)
+	}
+	orders, _ := database.GetTable("orders")
+	users.SetSoftDelete(true)
+	for _, name := range []string{"ann", "bob", "cid"} {
+		if _, err := users.CreateRecord(map[string]interface{}{"name": name, "active": true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, user := range []int{1, 1, 2} {
+		if _, err := orders.CreateRecord(map[string]interface{}{"user": user, "total": 10 * user}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	active := func() *QueryBuilder { return users.Where("active", "=", true) }
+	small := func() *QueryBuilder { return orders.Where("total", "<", 100) }
+	on := JoinOn{LeftField: "user", Outer: true}
+	filtered, err := database.CreateView("active_users", active())
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined, err := database.CreateJoinView("small_orders", small(), "users", on)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check compares the views with views built from scratch.
+	step := 0
+	check := func(what string) {
+		t.Helper()
+		step++
+		for _, view := range []*View{filtered, joined} {
+			var fresh *View
+			var err error
+			name := view.Name() + "_" + strconv.Itoa(step)
+			if view.join == nil {
+				fresh, err = database.CreateView(name, active())
+			} else {
+				fresh, err = database.CreateJoinView(name, small(), "users", on)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := viewRows(t, view), viewRows(t, fresh); !reflect.DeepEqual(got, want) {
+				t.Fatalf("after %s, %s = %v, want %v", what, view.Name(), got, want)
+			}
+			if err := database.DropView(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	check("creating the views")
+	for _, row := range viewRows(t, joined) {
+		if !strings.Contains(row, `"users.name"`) {
+			t.Fatalf("small_orders row %s has no user", row)
+		}
+	}
+
+	if err := users.UpdateRecord(2, map[string]interface{}{"name": "bob", "active": false}); err != nil {
+		t.Fatal(err)
+	}
+	check("an update of a right record leaving a query")
+	if err := users.UpdateRecord(2, map[string]interface{}{"name": "bobby", "active": true}); err != nil {
+		t.Fatal(err)
+	}
+	check("an update of a right record entering a query")
+	if err := orders.UpdateRecord(3, map[string]interface{}{"user": 3, "total": 30}); err != nil {
+		t.Fatal(err)
+	}
+	check("an update joining a left record with another right record")
+	if err := orders.UpdateRecord(2, map[string]interface{}{"user": 1, "total": 200}); err != nil {
+		t.Fatal(err)
+	}
+	check("an update of a left record leaving the query")
+	if err := orders.DeleteRecord(1); err != nil {
+		t.Fatal(err)
+	}
+	check("a delete of a left record")
+	if err := users.DeleteRecord(3); err != nil {
+		t.Fatal(err)
+	}
+	check("a soft delete of a right record")
+	if err := users.RestoreRecord(3); err != nil {
+		t.Fatal(err)
+	}
+	check("a restore of a right record")
+	if _, err := orders.CreateRecord(map[string]interface{}{"user": 2, "total": 5}); err != nil {
+		t.Fatal(err)
+	}
+	check("a create of a left record")
+	if err := orders.UpdateRecord(2, map[string]interface{}{"user": 2, "total": 20}); err != nil {
+		t.Fatal(err)
+	}
+	check("an update of a left record entering the query")
+
+	if filtered.Count() != 3 {
+		t.Fatalf("active_users has %d records, want 3", filtered.Count())
+	}
+}
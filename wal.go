@@ -0,0 +1,476 @@
+package velox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// The write-ahead log lives next to master.json. Save moves walFileName to
+// walSegmentName before writing the tables and removes the segment once
+// they are on disk, so entries written during a Save stay in walFileName.
+const (
+	walFileName    = "wal.log"
+	walSegmentName = "wal.log.1"
+)
+
+// Besides record changes, the log holds table drops and renames, which
+// only walEntry uses.
+const (
+	walDropTable   ChangeOp = "drop_table"
+	walRenameTable ChangeOp = "rename_table"
+)
+
+type walEntry struct {
+	Table   string   `json:"table"`
+	Op      ChangeOp `json:"op"`
+	ID      int      `json:"id"`
+	Record  *Record  `json:"record,omitempty"`
+	NewName string   `json:"new_name,omitempty"`
+
+	// LSN numbers the entries of a database in the order they were
+	// logged, and Time says when. Entries logged before these existed
+	// have neither.
+	LSN  uint64     `json:"lsn,omitempty"`
+	Time *time.Time `json:"time,omitempty"`
+	// Remaining counts the entries logged in the same write after this
+	// one, such as the rest of a transaction or of a delete cascade. Load
+	// applies the entries of a write only once it has read the last one.
+	Remaining int `json:"remaining,omitempty"`
+
+	// With encryption on, each logged entry is sealed whole into Sealed
+	// and only KeyID is written alongside it.
+	Sealed []byte `json:"sealed,omitempty"`
+	KeyID  string `json:"key_id,omitempty"`
+
+	// before is the record as it was before the entry, kept for change
+	// data capture and never logged.
+	before *Record
+}
+
+type writeAheadLog struct {
+	folder string
+	file   *os.File
+	sync.Mutex
+}
+
+// EnableWAL appends every create, update and delete to a log in the
+// database folder before applying it, and Load replays the log on top of
+// the last Save. Each write waits for the log to be synced to disk, and a
+// transaction, a delete cascade or a RenameField is replayed whole or not
+// at all. Table settings such as enum constraints and foreign keys are not
+// logged and are only persisted by Save.
+func (database *Database) EnableWAL() error {
+	database.RWMutex.Lock()
+	defer database.RWMutex.Unlock()
+
+	if database.wal != nil {
+		return nil
+	}
+	if database.memory {
+		return fmt.Errorf("EnableWAL: %w", ErrInMemory)
+	}
+	if database.readOnly {
+		return fmt.Errorf("EnableWAL: %w", ErrReadOnly)
+	}
+	if database.folder == "" {
+		return errors.New("EnableWAL: database folder not set")
+	}
+	if len(database.unloaded) > 0 {
+		return errors.New("EnableWAL: all tables must be loaded")
+	}
+	if err := database.folderLock.acquire(database.folder); err != nil {
+		return fmt.Errorf("EnableWAL: %w", err)
+	}
+
+	file, err := openWAL(database.folder)
+	if err != nil {
+		return fmt.Errorf("EnableWAL: %w", err)
+	}
+	database.wal = &writeAheadLog{folder: database.folder, file: file}
+
+	return nil
+}
+
+// DisableWAL stops logging writes. The log already on disk is kept until
+// the next Save.
+func (database *Database) DisableWAL() error {
+	database.RWMutex.Lock()
+	wal := database.wal
+	database.wal = nil
+	database.RWMutex.Unlock()
+
+	if wal == nil {
+		return nil
+	}
+
+	wal.Lock()
+	defer wal.Unlock()
+
+	if err := wal.file.Close(); err != nil {
+		return fmt.Errorf("DisableWAL: %w", err)
+	}
+	return nil
+}
+
+func openWAL(folder string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(folder, walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// writeAhead logs entries and syncs the log. Nothing may be applied if it
+// fails. Callers hold the write locks of the tables in entries.
+func (table *Table) writeAhead(entries ...walEntry) error {
+	if table.database != nil && table.database.capturing() {
+		table.database.keepBefore(entries)
+	}
+	return table.logAhead(entries...)
+}
+
+// logAhead is writeAhead for entries whose records before them are kept
+// already, as those of a transaction are while it runs.
+func (table *Table) logAhead(entries ...walEntry) error {
+	if table.dropped {
+		return errors.New("table has been dropped")
+	}
+	if table.commit != nil {
+		table.commit.entries = append(table.commit.entries, entries...)
+		return nil
+	}
+	if table.database == nil {
+		return nil
+	}
+	return table.database.writeAhead(entries...)
+}
+
+func (database *Database) writeAhead(entries ...walEntry) error {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	if database.follower {
+		return ErrReplica
+	}
+	if database.readOnly {
+		return ErrReadOnly
+	}
+	wal, primary, cdc := database.wal, database.primary, database.cdc
+	if wal == nil && primary == nil && cdc == nil {
+		return nil
+	}
+
+	database.sequence.Lock()
+	defer database.sequence.Unlock()
+
+	// Numbers are only used up once the entries are on disk.
+	lsn := database.lsn.Load()
+	now := database.now()
+	var encoded []byte
+	lines := make([]replicatedEntry, 0, len(entries))
+	var numbered []walEntry
+	for i, entry := range entries {
+		lsn++
+		entry.LSN = lsn
+		entry.Time = &now
+		entry.Remaining = len(entries) - 1 - i
+		if cdc != nil {
+			numbered = append(numbered, entry)
+		}
+		line, err := encodeWALEntry(database.keys, entry)
+		if err != nil {
+			return fmt.Errorf("write-ahead log: %w", err)
+		}
+		encoded = append(encoded, line...)
+		lines = append(lines, replicatedEntry{lsn: lsn, line: line})
+	}
+
+	if wal != nil {
+		wal.Lock()
+		defer wal.Unlock()
+
+		if _, err := wal.file.Write(encoded); err != nil {
+			return fmt.Errorf("write-ahead log: %w", err)
+		}
+		if err := wal.file.Sync(); err != nil {
+			return fmt.Errorf("write-ahead log: %w", err)
+		}
+	}
+	if cdc != nil {
+		if err := database.captureChanges(cdc, numbered); err != nil {
+			return fmt.Errorf("change data capture: %w", err)
+		}
+	}
+	if primary != nil {
+		primary.publish(lines)
+	}
+	database.lsn.Store(lsn)
+	return nil
+}
+
+// encodeWALEntry encodes entry as a line of the log, sealed if keys is set.
+func encodeWALEntry(keys KeyProvider, entry walEntry) ([]byte, error) {
+	line, err := jsoniter.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		sealed, keyID, err := seal(keys, line)
+		if err != nil {
+			return nil, err
+		}
+		if line, err = jsoniter.Marshal(walEntry{Sealed: sealed, KeyID: keyID}); err != nil {
+			return nil, err
+		}
+	}
+	return append(line, '\n'), nil
+}
+
+// rotateWAL moves the log aside before Save snapshots the tables. If a
+// segment from a failed Save is still there, the log is left alone so the
+// segment is not overwritten; replaying entries that are already in the
+// snapshot is harmless.
+func (database *Database) rotateWAL(folder string) error {
+	database.RWMutex.RLock()
+	defer database.RWMutex.RUnlock()
+
+	if _, err := os.Stat(filepath.Join(folder, walSegmentName)); err == nil {
+		return nil
+	}
+
+	wal := database.wal
+	if wal != nil {
+		wal.Lock()
+		defer wal.Unlock()
+	}
+
+	err := os.Rename(filepath.Join(folder, walFileName), filepath.Join(folder, walSegmentName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if wal != nil {
+		file, err := openWAL(wal.folder)
+		if err != nil {
+			return err
+		}
+		wal.file.Close()
+		wal.file = file
+	}
+	return nil
+}
+
+// trimWAL removes what Save has made redundant: the rotated segment, and
+// the log itself when nothing is appending to it. With WAL retention on,
+// the segment is archived instead.
+func (database *Database) trimWAL(folder string) error {
+	database.RWMutex.RLock()
+	logging := database.wal != nil
+	retention := database.retention
+	database.RWMutex.RUnlock()
+
+	if retention > 0 && logging {
+		return database.archiveWAL(folder, retention)
+	}
+	if err := os.Remove(filepath.Join(folder, walSegmentName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !logging {
+		if err := os.Remove(filepath.Join(folder, walFileName)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasWAL reports whether folder holds log entries that Load would replay.
+func hasWAL(folder string) bool {
+	for _, name := range []string{walSegmentName, walFileName} {
+		if info, err := os.Stat(filepath.Join(folder, name)); err == nil && info.Size() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// replayWAL applies the logged entries in folder on top of the loaded
+// tables. Tables created after the last Save are created as they are
+// found. A write the log ends in the middle of was in flight when the
+// process stopped. None of it is applied, and unless the database is
+// read-only it is cut from the log so later writes aren't appended to it.
+func (database *Database) replayWAL(folder string) error {
+	for _, name := range []string{walSegmentName, walFileName} {
+		flag := os.O_RDWR
+		if database.readOnly {
+			flag = os.O_RDONLY
+		}
+		file, err := os.OpenFile(filepath.Join(folder, name), flag, 0)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		err = database.replayWALFile(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (database *Database) replayWALFile(file *os.File) error {
+	complete, err := database.readWALFrom(file, func(group []walEntry) error {
+		for _, entry := range group {
+			if entry.LSN > database.lsn.Load() {
+				database.lsn.Store(entry.LSN)
+			}
+			if err := database.replayEntry(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.Size() == complete || database.readOnly {
+		return err
+	}
+	return file.Truncate(complete)
+}
+
+// readWAL decodes the entries of a log and passes them to fn in order, the
+// entries of one write at a time. A write the log ends in the middle of is
+// left out.
+func (database *Database) readWAL(file io.Reader, fn func(group []walEntry) error) error {
+	_, err := database.readWALFrom(file, fn)
+	return err
+}
+
+// readWALFrom is readWAL, also returning the size of the part of the log
+// holding complete writes.
+func (database *Database) readWALFrom(file io.Reader, fn func(group []walEntry) error) (int64, error) {
+	keys := database.keyProvider()
+	reader := bufio.NewReader(file)
+	var complete, offset int64
+	var group []walEntry
+	for line := 1; ; line++ {
+		encoded, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return complete, nil
+		}
+		if err != nil {
+			return complete, err
+		}
+		offset += int64(len(encoded))
+
+		entry, err := decodeWALEntry(keys, encoded)
+		if err != nil {
+			return complete, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(group) > 0 && entry.Remaining != group[len(group)-1].Remaining-1 {
+			return complete, fmt.Errorf("line %d: write started before the one at line %d was complete", line, line-len(group))
+		}
+		if group = append(group, entry); entry.Remaining > 0 {
+			continue
+		}
+		if err := fn(group); err != nil {
+			return complete, fmt.Errorf("line %d: %w", line, err)
+		}
+		group = nil
+		complete = offset
+	}
+}
+
+// decodeWALEntry decodes a line written by encodeWALEntry.
+func decodeWALEntry(keys KeyProvider, line []byte) (walEntry, error) {
+	var entry walEntry
+	if err := jsoniter.Unmarshal(line, &entry); err != nil {
+		return walEntry{}, err
+	}
+	if entry.Sealed != nil {
+		plain, err := unseal(keys, entry.KeyID, entry.Sealed)
+		if err != nil {
+			return walEntry{}, err
+		}
+		entry = walEntry{}
+		if err := jsoniter.Unmarshal(plain, &entry); err != nil {
+			return walEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+func (database *Database) replayEntry(entry walEntry) error {
+	switch entry.Op {
+	case walDropTable:
+		return database.replayDrop(entry.Table)
+	case walRenameTable:
+		return database.replayRename(entry.Table, entry.NewName)
+	}
+
+	if database.isUnloaded(entry.Table) {
+		return fmt.Errorf("table %s has logged changes but is not loaded", entry.Table)
+	}
+
+	val, ok := database.tables.Get(entry.Table)
+	if !ok {
+		table := NewTable()
+		database.attach(entry.Table, table)
+		database.tables.SetIfAbsent(entry.Table, table)
+		val, _ = database.tables.Get(entry.Table)
+	}
+	table, ok := val.(*Table)
+	if !ok {
+		return ErrInvalidTableType
+	}
+
+	defer table.unlock(table.lock())
+	table.modified()
+
+	var previous *Record
+	if val, ok := table.records.Get(strconv.Itoa(entry.ID)); ok {
+		if record, err := table.recordValue("Database_Load", val); err == nil {
+			previous = &record
+		}
+	}
+
+	switch entry.Op {
+	case ChangeCreate, ChangeUpdate:
+		if entry.Record == nil {
+			return fmt.Errorf("%s of record %d without data", entry.Op, entry.ID)
+		}
+		record := *entry.Record
+		if table.hashes != nil && record.Hash == "" {
+			hash, err := contentHash(record.Data)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", record.ID, err)
+			}
+			record.Hash = hash
+		}
+		table.setRecord(previous, record)
+		if record.ID >= table.nextID {
+			table.nextID = record.ID + 1
+		}
+	case ChangeDelete:
+		if previous != nil {
+			table.removeRecord(*previous)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", entry.Op)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package velox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// openWALDatabase loads the database in folder with the write-ahead log on.
+func openWALDatabase(t *testing.T, folder string) *Database {
+	t.Helper()
+	database, err := New(WithFolder(folder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, "master.json")); err == nil {
+		if err := database.Load(folder); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.EnableWAL(); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+// recordsOf returns the canonical JSON of the data of each record, so
+// tables compare equal whether or not their numbers went through JSON.
+func recordsOf(t *testing.T, table *Table) map[int]string {
+	t.Helper()
+	all, err := table.Query(func(RecordInterface) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make(map[int]string, len(all))
+	for _, record := range all {
+		encoded, err := canonicalJSON.Marshal(record.GetData())
+		if err != nil {
+			t.Fatal(err)
+		}
+		records[record.GetID()] = string(encoded)
+	}
+	return records
+}
+
+func TestWALReplayAfterCrash(t *testing.T) {
+	folder := t.TempDir()
+	database := openWALDatabase(t, folder)
+	if err := database.CreateTable("items"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := database.GetTable("items")
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := table.CreateRecord(map[string]interface{}{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.UpdateRecord(1, map[string]interface{}{"name": "a2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.DeleteRecord(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.CreateRecord(map[string]interface{}{"name": "d"}); err != nil {
+		t.Fatal(err)
+	}
+	want := recordsOf(t, table)
+	// Close doesn't save, so the changes since Save are only in the log.
+	if err := database.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := openWALDatabase(t, folder)
+	defer loaded.Close()
+	table, err := loaded.GetTable("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recordsOf(t, table); !reflect.DeepEqual(got, want) {
+		t.Fatalf("records after replay = %v, want %v", got, want)
+	}
+	if record, err := table.CreateRecord(map[string]interface{}{"name": "e"}); err != nil || record.GetID() != 5 {
+		t.Fatalf("CreateRecord after replay = %v, %v, want record 5", record, err)
+	}
+}
+
+func TestWALDropsTornWrite(t *testing.T) {
+	folder := t.TempDir()
+	database := openWALDatabase(t, folder)
+	if err := database.CreateTable("accounts"); err != nil {
+		t.Fatal(err)
+	}
+	table, _ := database.GetTable("accounts")
+	for i := 0; i < 3; i++ {
+		if _, err := table.CreateRecord(map[string]interface{}{"balance": 100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.UpdateRecord(3, map[string]interface{}{"balance": 120}); err != nil {
+		t.Fatal(err)
+	}
+	before := recordsOf(t, table)
+
+	logged, err := os.ReadFile(filepath.Join(folder, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := database.Begin()
+	tx.Update("accounts", 1, map[string]interface{}{"balance": 50})
+	tx.Update("accounts", 2, map[string]interface{}{"balance": 150})
+	tx.Update("accounts", 3, map[string]interface{}{"balance": 100})
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the log after the first entry of the transaction and halfway
+	// through the second, as a crash in the middle of the write would.
+	full, err := os.ReadFile(filepath.Join(folder, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := full[len(logged):]
+	if n := bytes.Count(written, []byte("\n")); n != 3 {
+		t.Fatalf("transaction logged %d lines, want 3", n)
+	}
+	first := bytes.IndexByte(written, '\n') + 1
+	torn := len(logged) + first + (bytes.IndexByte(written[first:], '\n'))/2
+	if err := os.WriteFile(filepath.Join(folder, walFileName), full[:torn], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := openWALDatabase(t, folder)
+	table, _ = loaded.GetTable("accounts")
+	if got := recordsOf(t, table); !reflect.DeepEqual(got, before) {
+		t.Fatalf("records after replaying a torn transaction = %v, want %v", got, before)
+	}
+	if info, err := os.Stat(filepath.Join(folder, walFileName)); err != nil || info.Size() != int64(len(logged)) {
+		t.Fatalf("log not cut back to the last complete write: %v, %v", info, err)
+	}
+
+	// Writes after the restart are appended to the cut log and replayed.
+	if err := table.UpdateRecord(2, map[string]interface{}{"balance": 75}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := openWALDatabase(t, folder)
+	defer reloaded.Close()
+	table, _ = reloaded.GetTable("accounts")
+	before[2] = `{"balance":75}`
+	if got := recordsOf(t, table); !reflect.DeepEqual(got, before) {
+		t.Fatalf("records after a second replay = %v, want %v", got, before)
+	}
+}
@@ -0,0 +1,93 @@
+package velox
+
+import "context"
+
+// ChangeEvent describes one committed change to a record. Before is nil for
+// creates and After is nil for deletes.
+type ChangeEvent struct {
+	Table  string
+	Op     ChangeOp
+	ID     int
+	Before interface{}
+	After  interface{}
+}
+
+// watchBuffer is how many events a watcher can fall behind before it is
+// dropped.
+const watchBuffer = 256
+
+type watcher struct {
+	events  chan ChangeEvent
+	removed chan struct{}
+}
+
+// Watch returns a channel of the table's changes, in the order they were
+// made, until ctx is done. A watcher that falls more than watchBuffer
+// events behind has its channel closed early rather than slowing writers
+// down, so a close before ctx is done means events were missed. Dropping
+// the table also closes the channel. The principal of ctx needs read
+// permission.
+func (table *Table) Watch(ctx context.Context) (<-chan ChangeEvent, error) {
+	if err := table.throttleCtx(ctx, "Watch", PermissionRead); err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		events:  make(chan ChangeEvent, watchBuffer),
+		removed: make(chan struct{}),
+	}
+
+	func() {
+		defer table.unlock(table.lock())
+
+		if table.dropped {
+			table.closeWatcher(w)
+			return
+		}
+		if table.watchers == nil {
+			table.watchers = make(map[*watcher]struct{})
+		}
+		table.watchers[w] = struct{}{}
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			defer table.unlock(table.lock())
+			if _, ok := table.watchers[w]; ok {
+				delete(table.watchers, w)
+				table.closeWatcher(w)
+			}
+		case <-w.removed:
+		}
+	}()
+
+	return w.events, nil
+}
+
+// notifyWatchers sends event to every watcher. Callers hold the write
+// lock.
+func (table *Table) notifyWatchers(event ChangeEvent) {
+	for w := range table.watchers {
+		select {
+		case w.events <- event:
+		default:
+			delete(table.watchers, w)
+			table.closeWatcher(w)
+		}
+	}
+}
+
+// closeWatchers closes every watcher of the table. Callers hold the write
+// lock.
+func (table *Table) closeWatchers() {
+	for w := range table.watchers {
+		delete(table.watchers, w)
+		table.closeWatcher(w)
+	}
+}
+
+func (table *Table) closeWatcher(w *watcher) {
+	close(w.events)
+	close(w.removed)
+}